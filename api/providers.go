@@ -8,6 +8,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/dcos/dcos-diagnostics/api/rest"
 	"github.com/dcos/dcos-diagnostics/collector"
 	"github.com/dcos/dcos-diagnostics/util"
 
@@ -17,9 +18,28 @@ import (
 
 // LogProviders a structure defines a list of Providers
 type LogProviders struct {
-	HTTPEndpoints []HTTPProvider
-	LocalFiles    []FileProvider
-	LocalCommands []CommandProvider
+	HTTPEndpoints       []HTTPProvider
+	LocalFiles          []FileProvider
+	LocalCommands       []CommandProvider
+	PrometheusEndpoints []PrometheusProvider
+	LocalDirectories    []DirectoryProvider
+	KernelLogs          []KernelProvider
+
+	// MaxBundleSize is the number of bytes all collectors could write into a bundle, 0 disables the limit
+	MaxBundleSize int64
+	// MaxCollectorSize is the number of bytes a single collector could write into a bundle unless its provider
+	// sets MaxSize, 0 disables the limit
+	MaxCollectorSize int64
+	// Truncate is the default truncation of collected data exceeding limits, one of head, tail or head+tail
+	Truncate string
+}
+
+// SizeLimit limits the number of bytes a single provider writes into a bundle
+type SizeLimit struct {
+	// MaxSize is the number of bytes written into the bundle, 0 means MaxCollectorSize
+	MaxSize int64
+	// Truncate is head, tail or head+tail, empty means the default truncation
+	Truncate string
 }
 
 // HTTPProvider is a provider for fetching an HTTP endpoint.
@@ -29,6 +49,20 @@ type HTTPProvider struct {
 	FileName string
 	Role     []string
 	Optional bool
+	SizeLimit
+}
+
+// PrometheusProvider is a provider for scraping an HTTP endpoint exposing Prometheus metrics.
+// Metrics are stored as FileName and in JSON with .json extension.
+type PrometheusProvider struct {
+	Port     int
+	URI      string
+	FileName string
+	Role     []string
+	Optional bool
+	// Metrics are glob patterns (see path.Match) of collected metric names, empty collects all metrics
+	Metrics []string
+	SizeLimit
 }
 
 // FileProvider is a local file provider.
@@ -36,6 +70,38 @@ type FileProvider struct {
 	Location string
 	Role     []string
 	Optional bool
+	// TimestampLayout is the layout of timestamps starting log lines (see time.Parse). When set,
+	// only lines logged in the time window requested for a bundle are collected.
+	TimestampLayout string
+	SizeLimit
+}
+
+// DirectoryProvider is a provider of local files matching glob patterns, matched directories are collected
+// recursively. Every file is stored under its own path and the report listing collected and skipped files
+// is stored as Name.
+type DirectoryProvider struct {
+	Name     string
+	Paths    []string
+	Exclude  []string
+	Role     []string
+	Optional bool
+	// MaxFileSize is the size in bytes of the biggest collected file, 0 disables the limit
+	MaxFileSize int64
+	// MaxTotalSize is the number of bytes collected from all files, 0 disables the limit
+	MaxTotalSize int64
+	// ModifiedWithin skips files not modified in the given duration e.g., "24h", empty disables the filter
+	ModifiedWithin string
+	SizeLimit
+}
+
+// KernelProvider is a provider of kernel messages logged to journal, the same way `journalctl --dmesg` shows them.
+// Messages are collected from the time window of unit logs.
+type KernelProvider struct {
+	// FileName is the name of the file storing messages, empty name is kernel
+	FileName string
+	Role     []string
+	Optional bool
+	SizeLimit
 }
 
 // CommandProvider is a local command to execute.
@@ -43,6 +109,7 @@ type CommandProvider struct {
 	Command  []string
 	Role     []string
 	Optional bool
+	SizeLimit
 }
 
 func loadProviders(cfg *config.Config, DCOSTools dcos.Tooler) (*LogProviders, error) {
@@ -77,6 +144,19 @@ func loadExternalProviders(endpointsConfgFiles []string) (externalProviders LogP
 		externalProviders.HTTPEndpoints = append(externalProviders.HTTPEndpoints, logProviders.HTTPEndpoints...)
 		externalProviders.LocalFiles = append(externalProviders.LocalFiles, logProviders.LocalFiles...)
 		externalProviders.LocalCommands = append(externalProviders.LocalCommands, logProviders.LocalCommands...)
+		externalProviders.PrometheusEndpoints = append(externalProviders.PrometheusEndpoints, logProviders.PrometheusEndpoints...)
+		externalProviders.LocalDirectories = append(externalProviders.LocalDirectories, logProviders.LocalDirectories...)
+		externalProviders.KernelLogs = append(externalProviders.KernelLogs, logProviders.KernelLogs...)
+		// limits set in later files override earlier ones
+		if logProviders.MaxBundleSize != 0 {
+			externalProviders.MaxBundleSize = logProviders.MaxBundleSize
+		}
+		if logProviders.MaxCollectorSize != 0 {
+			externalProviders.MaxCollectorSize = logProviders.MaxCollectorSize
+		}
+		if logProviders.Truncate != "" {
+			externalProviders.Truncate = logProviders.Truncate
+		}
 	}
 
 	return externalProviders, nil
@@ -102,7 +182,6 @@ func loadSystemdCollectors(cfg *config.Config, DCOSTools dcos.Tooler) ([]collect
 			collector.NewSystemd(unit, false, unit, duration),
 		)
 	}
-
 	return collectors, nil
 }
 
@@ -144,27 +223,32 @@ func loadInternalProviders(cfg *config.Config, DCOSTools dcos.Tooler) (internalC
 	}, nil
 }
 
-func LoadCollectors(cfg *config.Config, tools dcos.Tooler, client *http.Client) ([]collector.Collector, error) {
-
+// LoadCollectors returns collectors of the node with limits of bytes they could write into a bundle
+func LoadCollectors(cfg *config.Config, tools dcos.Tooler, client *http.Client) ([]collector.Collector, rest.SizeLimits, error) {
 	collectors, err := loadSystemdCollectors(cfg, tools)
 	if err != nil {
-		return nil, fmt.Errorf("could load systemd collectors: %s", err)
+		return nil, rest.SizeLimits{}, fmt.Errorf("could load systemd collectors: %s", err)
 	}
 
 	// load the external providers from a cfg file
 	providers, err := loadExternalProviders(cfg.FlagDiagnosticsBundleEndpointsConfigFiles)
 	if err != nil {
-		return nil, fmt.Errorf("could not initialize external log providers: %s", err)
+		return nil, rest.SizeLimits{}, fmt.Errorf("could not initialize external log providers: %s", err)
 	}
 
 	role, err := tools.GetNodeRole()
 	if err != nil {
-		return nil, fmt.Errorf("could not get role: %s", err)
+		return nil, rest.SizeLimits{}, fmt.Errorf("could not get role: %s", err)
 	}
 
 	port, err := getPullPortByRole(cfg, role)
 	if err != nil {
-		return nil, err
+		return nil, rest.SizeLimits{}, err
+	}
+
+	limits, err := newSizeLimits(providers)
+	if err != nil {
+		return nil, rest.SizeLimits{}, fmt.Errorf("could not initialize size limits: %s", err)
 	}
 
 	// add dcos-diagnostics health report.
@@ -187,11 +271,44 @@ func LoadCollectors(cfg *config.Config, tools dcos.Tooler, client *http.Client)
 
 		url, err := util.UseTLSScheme(fmt.Sprintf("http://%s:%d%s", cfg.FlagHostname, endpoint.Port, endpoint.URI), cfg.FlagForceTLS)
 		if err != nil {
-			return nil, fmt.Errorf("could not initialize internal log providers: %s", err)
+			return nil, rest.SizeLimits{}, fmt.Errorf("could not initialize internal log providers: %s", err)
 
 		}
 
 		c := collector.NewEndpoint(fileName, endpoint.Optional, url, client)
+		if err := addSizeLimit(limits, c.Name(), endpoint.SizeLimit); err != nil {
+			return nil, rest.SizeLimits{}, err
+		}
+		collectors = append(collectors, c)
+	}
+
+	for _, endpoint := range providers.PrometheusEndpoints {
+		if !roleMatched(role, endpoint.Role) {
+			continue
+		}
+
+		fileName := fmt.Sprintf("%d-%s.prom", endpoint.Port, util.SanitizeString(endpoint.URI))
+		if endpoint.FileName != "" {
+			fileName = endpoint.FileName
+		}
+
+		url, err := util.UseTLSScheme(fmt.Sprintf("http://%s:%d%s", cfg.FlagHostname, endpoint.Port, endpoint.URI), cfg.FlagForceTLS)
+		if err != nil {
+			return nil, rest.SizeLimits{}, fmt.Errorf("could not initialize Prometheus collectors: %s", err)
+		}
+
+		if err := addSizeLimit(limits, fileName, endpoint.SizeLimit); err != nil {
+			return nil, rest.SizeLimits{}, err
+		}
+		// the scraped exposition is kept in memory so it's limited the same way as collected data
+		limit, ok := limits.Collectors[fileName]
+		if !ok {
+			limit = limits.Default
+		}
+		c, err := collector.NewPrometheus(fileName, endpoint.Optional, url, client, endpoint.Metrics, limit.MaxSize)
+		if err != nil {
+			return nil, rest.SizeLimits{}, fmt.Errorf("could not initialize Prometheus collector %s: %s", fileName, err)
+		}
 		collectors = append(collectors, c)
 	}
 
@@ -201,7 +318,47 @@ func LoadCollectors(cfg *config.Config, tools dcos.Tooler, client *http.Client)
 		}
 
 		key := strings.TrimLeft(fileProvider.Location, "/")
-		c := collector.NewFile(key, fileProvider.Optional, fileProvider.Location)
+		c := collector.NewTimeAwareFile(key, fileProvider.Optional, fileProvider.Location, fileProvider.TimestampLayout)
+		if err := addSizeLimit(limits, c.Name(), fileProvider.SizeLimit); err != nil {
+			return nil, rest.SizeLimits{}, err
+		}
+		collectors = append(collectors, c)
+	}
+
+	for _, dirProvider := range providers.LocalDirectories {
+		if !roleMatched(role, dirProvider.Role) {
+			continue
+		}
+
+		c, err := newDirCollector(dirProvider)
+		if err != nil {
+			return nil, rest.SizeLimits{}, fmt.Errorf("could not initialize directory collector %s: %s", dirProvider.Name, err)
+		}
+		if err := addSizeLimit(limits, c.Name(), dirProvider.SizeLimit); err != nil {
+			return nil, rest.SizeLimits{}, err
+		}
+		collectors = append(collectors, c)
+	}
+
+	for _, kernelProvider := range providers.KernelLogs {
+		if !roleMatched(role, kernelProvider.Role) {
+			continue
+		}
+
+		duration, err := time.ParseDuration(cfg.FlagDiagnosticsBundleUnitsLogsSinceString)
+		if err != nil {
+			return nil, rest.SizeLimits{}, fmt.Errorf("error parsing '%s': %s", cfg.FlagDiagnosticsBundleUnitsLogsSinceString, err)
+		}
+
+		fileName := "kernel"
+		if kernelProvider.FileName != "" {
+			fileName = kernelProvider.FileName
+		}
+
+		c := collector.NewKernel(fileName, kernelProvider.Optional, duration)
+		if err := addSizeLimit(limits, c.Name(), kernelProvider.SizeLimit); err != nil {
+			return nil, rest.SizeLimits{}, err
+		}
 		collectors = append(collectors, c)
 	}
 
@@ -215,9 +372,64 @@ func LoadCollectors(cfg *config.Config, tools dcos.Tooler, client *http.Client)
 		trimmedCmdWithArgs := strings.Replace(cmdWithArgs, "/", "", -1)
 		key := fmt.Sprintf("%s.output", trimmedCmdWithArgs)
 		c := collector.NewCmd(key, commandProvider.Optional, commandProvider.Command)
+		if err := addSizeLimit(limits, c.Name(), commandProvider.SizeLimit); err != nil {
+			return nil, rest.SizeLimits{}, err
+		}
 		collectors = append(collectors, c)
 
 	}
 
-	return collectors, nil
+	return collectors, limits, nil
+}
+
+func newDirCollector(provider DirectoryProvider) (*collector.Dir, error) {
+	if provider.Name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	options := collector.DirOptions{
+		Exclude:      provider.Exclude,
+		MaxFileSize:  provider.MaxFileSize,
+		MaxTotalSize: provider.MaxTotalSize,
+	}
+	if provider.ModifiedWithin != "" {
+		d, err := time.ParseDuration(provider.ModifiedWithin)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing '%s': %s", provider.ModifiedWithin, err)
+		}
+		options.ModifiedWithin = d
+	}
+	return collector.NewDir(provider.Name, provider.Optional, provider.Paths, options)
+}
+
+// newSizeLimits returns limits of collectors not limited by their providers
+func newSizeLimits(providers LogProviders) (rest.SizeLimits, error) {
+	truncation, err := rest.ParseTruncation(providers.Truncate)
+	if err != nil {
+		return rest.SizeLimits{}, err
+	}
+	return rest.SizeLimits{
+		Default:       rest.SizeLimit{MaxSize: providers.MaxCollectorSize, Truncation: truncation},
+		Collectors:    make(map[string]rest.SizeLimit),
+		MaxBundleSize: providers.MaxBundleSize,
+	}, nil
+}
+
+// addSizeLimit sets the limit of the named collector, zero fields of the limit are taken from the default limit
+func addSizeLimit(limits rest.SizeLimits, name string, limit SizeLimit) error {
+	if limit == (SizeLimit{}) {
+		return nil
+	}
+	result := limits.Default
+	if limit.MaxSize != 0 {
+		result.MaxSize = limit.MaxSize
+	}
+	if limit.Truncate != "" {
+		t, err := rest.ParseTruncation(limit.Truncate)
+		if err != nil {
+			return fmt.Errorf("could not initialize size limit of %s: %s", name, err)
+		}
+		result.Truncation = t
+	}
+	limits.Collectors[name] = result
+	return nil
 }
@@ -2,11 +2,17 @@ package api
 
 import (
 	"errors"
+	"io/ioutil"
 	"net/http"
+	"os"
 	"path/filepath"
 	"testing"
 
+	"github.com/dcos/dcos-diagnostics/api/rest"
+	"github.com/dcos/dcos-diagnostics/collector"
+
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestLoadCollectors(t *testing.T) {
@@ -21,7 +27,7 @@ func TestLoadCollectors(t *testing.T) {
 		filepath.Join("testdata", "endpoint-config.json"),
 	}
 
-	got, err := LoadCollectors(cfg, tools, http.DefaultClient)
+	got, _, err := LoadCollectors(cfg, tools, http.DefaultClient)
 
 	assert.NoError(t, err)
 	assert.Len(t, got, 15)
@@ -48,6 +54,144 @@ func TestLoadCollectors(t *testing.T) {
 	}
 }
 
+func TestLoadCollectorsWithPrometheusEndpoints(t *testing.T) {
+	t.Parallel()
+	tools := new(MockedTools)
+
+	tools.On("GetNodeRole").Return("master", nil)
+	tools.On("GetUnitNames").Return([]string{}, nil)
+
+	cfg := testCfg()
+	cfg.FlagDiagnosticsBundleEndpointsConfigFiles = []string{
+		filepath.Join("testdata", "prometheus-config.json"),
+	}
+
+	got, _, err := LoadCollectors(cfg, tools, http.DefaultClient)
+
+	assert.NoError(t, err)
+	var names []string
+	for _, c := range got {
+		if p, ok := c.(*collector.Prometheus); ok {
+			names = append(names, p.Name())
+		}
+	}
+	assert.Equal(t, []string{"5050-metrics_snapshot.prom", "telegraf-metrics.prom"}, names)
+}
+
+func TestLoadCollectorsFailsOnInvalidMetricPattern(t *testing.T) {
+	t.Parallel()
+	tools := new(MockedTools)
+
+	tools.On("GetNodeRole").Return("master", nil)
+	tools.On("GetUnitNames").Return([]string{}, nil)
+
+	dir, err := ioutil.TempDir("", "endpoints-config")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	configFile := filepath.Join(dir, "config.json")
+	require.NoError(t, ioutil.WriteFile(configFile,
+		[]byte(`{"PrometheusEndpoints": [{"Port": 5050, "Uri": "/metrics", "Metrics": ["["]}]}`), 0644))
+
+	cfg := testCfg()
+	cfg.FlagDiagnosticsBundleEndpointsConfigFiles = []string{configFile}
+
+	_, _, err = LoadCollectors(cfg, tools, http.DefaultClient)
+	assert.EqualError(t, err,
+		`could not initialize Prometheus collector 5050-metrics.prom: invalid metric pattern "[": syntax error in pattern`)
+}
+
+func TestLoadCollectorsWithLocalDirectories(t *testing.T) {
+	t.Parallel()
+	tools := new(MockedTools)
+
+	tools.On("GetNodeRole").Return("master", nil)
+	tools.On("GetUnitNames").Return([]string{}, nil)
+
+	cfg := testCfg()
+	cfg.FlagDiagnosticsBundleEndpointsConfigFiles = []string{
+		filepath.Join("testdata", "directory-config.json"),
+	}
+
+	got, _, err := LoadCollectors(cfg, tools, http.DefaultClient)
+
+	assert.NoError(t, err)
+	var names []string
+	for _, c := range got {
+		if d, ok := c.(*collector.Dir); ok {
+			names = append(names, d.Name())
+		}
+	}
+	assert.Equal(t, []string{"mesos-logs.json"}, names)
+}
+
+func TestLoadCollectorsWithKernelLogs(t *testing.T) {
+	t.Parallel()
+	tools := new(MockedTools)
+
+	tools.On("GetNodeRole").Return("agent", nil)
+	tools.On("GetUnitNames").Return([]string{}, nil)
+
+	cfg := testCfg()
+	cfg.FlagDiagnosticsBundleEndpointsConfigFiles = []string{
+		filepath.Join("testdata", "kernel-config.json"),
+	}
+
+	got, limits, err := LoadCollectors(cfg, tools, http.DefaultClient)
+
+	assert.NoError(t, err)
+	var kernels []*collector.Kernel
+	for _, c := range got {
+		if k, ok := c.(*collector.Kernel); ok {
+			kernels = append(kernels, k)
+		}
+	}
+	require.Len(t, kernels, 2)
+	assert.Equal(t, "kernel", kernels[0].Name())
+	assert.False(t, kernels[0].Optional())
+	assert.Equal(t, "dmesg.log", kernels[1].Name())
+	assert.True(t, kernels[1].Optional())
+	assert.Equal(t, rest.SizeLimit{MaxSize: 1024, Truncation: rest.TruncateTail}, limits.Collectors["dmesg.log"])
+}
+
+func TestLoadCollectorsFailsOnInvalidDirectory(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		config string
+		err    string
+	}{
+		{
+			config: `{"LocalDirectories": [{"Paths": ["/var/log"]}]}`,
+			err:    "could not initialize directory collector : name is required",
+		},
+		{
+			config: `{"LocalDirectories": [{"Name": "logs", "Paths": ["/var/log"], "ModifiedWithin": "2 days"}]}`,
+			err:    "could not initialize directory collector logs: error parsing '2 days'",
+		},
+		{
+			config: `{"LocalDirectories": [{"Name": "logs", "Paths": ["/var/log/["]}]}`,
+			err:    `could not initialize directory collector logs: invalid pattern "/var/log/[": syntax error in pattern`,
+		},
+	} {
+		tools := new(MockedTools)
+		tools.On("GetNodeRole").Return("master", nil)
+		tools.On("GetUnitNames").Return([]string{}, nil)
+
+		dir, err := ioutil.TempDir("", "endpoints-config")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+		configFile := filepath.Join(dir, "config.json")
+		require.NoError(t, ioutil.WriteFile(configFile, []byte(tc.config), 0644))
+
+		cfg := testCfg()
+		cfg.FlagDiagnosticsBundleEndpointsConfigFiles = []string{configFile}
+
+		_, _, err = LoadCollectors(cfg, tools, http.DefaultClient)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), tc.err)
+	}
+}
+
 func TestLoadCollectors_GetNodeRoleErrors(t *testing.T) {
 	t.Parallel()
 	tools := new(MockedTools)
@@ -60,7 +204,7 @@ func TestLoadCollectors_GetNodeRoleErrors(t *testing.T) {
 		filepath.Join("testdata", "endpoint-config.json"),
 	}
 
-	got, err := LoadCollectors(cfg, tools, http.DefaultClient)
+	got, _, err := LoadCollectors(cfg, tools, http.DefaultClient)
 
 	assert.EqualError(t, err, "could not get role: some error")
 	assert.Empty(t, got)
@@ -77,7 +221,7 @@ func TestLoadCollectors_GetUnitNamesErrors(t *testing.T) {
 		filepath.Join("testdata", "endpoint-config.json"),
 	}
 
-	got, err := LoadCollectors(cfg, tools, http.DefaultClient)
+	got, _, err := LoadCollectors(cfg, tools, http.DefaultClient)
 
 	assert.EqualError(t, err, "could load systemd collectors: could not get unit names: some error")
 	assert.Empty(t, got)
@@ -95,8 +239,55 @@ func TestLoadCollectors_GetNodeRoleReturnsInvalidRole(t *testing.T) {
 		filepath.Join("testdata", "endpoint-config.json"),
 	}
 
-	got, err := LoadCollectors(cfg, tools, http.DefaultClient)
+	got, _, err := LoadCollectors(cfg, tools, http.DefaultClient)
 
 	assert.EqualError(t, err, "incorrect role invalid, must be: master, agent or agent_public")
 	assert.Empty(t, got)
 }
+
+func TestLoadCollectorsWithSizeLimits(t *testing.T) {
+	t.Parallel()
+	tools := new(MockedTools)
+
+	tools.On("GetNodeRole").Return("master", nil)
+	tools.On("GetUnitNames").Return([]string{}, nil)
+
+	cfg := testCfg()
+	cfg.FlagDiagnosticsBundleEndpointsConfigFiles = []string{
+		filepath.Join("testdata", "size-limits-config.json"),
+	}
+
+	_, limits, err := LoadCollectors(cfg, tools, http.DefaultClient)
+	require.NoError(t, err)
+
+	assert.Equal(t, rest.SizeLimits{
+		Default: rest.SizeLimit{MaxSize: 104857600, Truncation: rest.TruncateTail},
+		Collectors: map[string]rest.SizeLimit{
+			"var/log/mesos/mesos-master.log": {MaxSize: 52428800, Truncation: rest.TruncateHeadTail},
+			"journalctl_--list-boots.output": {MaxSize: 1024, Truncation: rest.TruncateTail},
+		},
+		MaxBundleSize: 1073741824,
+	}, limits)
+}
+
+func TestLoadCollectorsFailsOnUnknownTruncation(t *testing.T) {
+	t.Parallel()
+	tools := new(MockedTools)
+
+	tools.On("GetNodeRole").Return("master", nil)
+	tools.On("GetUnitNames").Return([]string{}, nil)
+
+	dir, err := ioutil.TempDir("", "endpoints-config")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	configFile := filepath.Join(dir, "config.json")
+	require.NoError(t, ioutil.WriteFile(configFile,
+		[]byte(`{"LocalCommands": [{"Command": ["ps"], "MaxSize": 1024, "Truncate": "middle"}]}`), 0644))
+
+	cfg := testCfg()
+	cfg.FlagDiagnosticsBundleEndpointsConfigFiles = []string{configFile}
+
+	_, _, err = LoadCollectors(cfg, tools, http.DefaultClient)
+	assert.EqualError(t, err,
+		`could not initialize size limit of ps.output: unknown truncation "middle", must be head, tail or head+tail`)
+}
@@ -7,6 +7,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/dcos/dcos-diagnostics/api/rest"
 	"github.com/dcos/dcos-diagnostics/config"
 	"github.com/dcos/dcos-diagnostics/dcos"
 	"github.com/dcos/dcos-diagnostics/util"
@@ -20,6 +21,7 @@ type pull struct {
 	runPullerChan      <-chan bool
 	runPullerDoneChan  chan<- bool
 	monitoringResponse *MonitoringResponse
+	trigger            *rest.Trigger // creates bundles on nodes where units turned unhealthy, nil disables it
 }
 
 // StartPullWithInterval will start to pull a DC/OS cluster health status
@@ -31,6 +33,7 @@ func StartPullWithInterval(dt *Dt) {
 		runPullerChan:      dt.RunPullerChan,
 		runPullerDoneChan:  dt.RunPullerDoneChan,
 		monitoringResponse: dt.MR,
+		trigger:            dt.Trigger,
 	}
 	for {
 		p.runPull()
@@ -114,6 +117,7 @@ func (p *pull) updateHealthStatus(responses <-chan *httpResponse) {
 				Units:       units,
 				UpdatedTime: time.Now(),
 			})
+			p.trigger.Observe(nodes)
 			return
 		}
 	}
@@ -1,9 +1,10 @@
 package rest
 
 import (
-	"archive/zip"
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -13,10 +14,12 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
-	"sync"
 	"time"
 
+	"github.com/dcos/dcos-diagnostics/archive"
 	"github.com/dcos/dcos-diagnostics/collector"
+	"github.com/dcos/dcos-diagnostics/encrypt"
+	"github.com/dcos/dcos-diagnostics/redact"
 
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
@@ -24,8 +27,9 @@ import (
 
 // work dir contains only directories, each dir is created for single bundle (id is its name) and should contain:
 const (
-	stateFileName = "state.json" // file with information about diagnostics run
-	dataFileName  = "file.zip"   // data gathered by diagnostics
+	stateFileName    = "state.json"    // file with information about diagnostics run
+	dataFileName     = "file.zip"      // data gathered by diagnostics, the name is kept for every archive format
+	webhooksFileName = "webhooks.json" // log of webhook deliveries of bundle lifecycle events
 
 	summaryErrorsReportFileName = "summaryErrorsReport.txt" // error log in bundle
 
@@ -41,6 +45,28 @@ type Bundle struct {
 	Started time.Time `json:"started_at,omitempty"`
 	Stopped time.Time `json:"stopped_at,omitempty"`
 	Errors  []string  `json:"errors,omitempty"`
+	// Checksum is hex encoded SHA-256 of the bundle file, set when bundle is Done
+	Checksum string `json:"checksum,omitempty"`
+	// Format of the bundle archive, empty means zip
+	Format archive.Format `json:"format,omitempty"`
+	// Encrypted is true when bundle file is encrypted for recipients configured on the node
+	Encrypted bool `json:"encrypted,omitempty"`
+	// Since and Until limit time window of collected logs
+	Since *time.Time `json:"since,omitempty"`
+	Until *time.Time `json:"until,omitempty"`
+	// ProgressPercentage tells how much of the bundle is already collected
+	ProgressPercentage float32 `json:"progress_percentage,omitempty"`
+	// Collectors contains status of every collector taking part in local bundle creation
+	Collectors []collectorReport `json:"collectors,omitempty"`
+	// Nodes contains status of every node taking part in cluster bundle creation
+	Nodes map[string]nodeBundleReport `json:"nodes,omitempty"`
+	// Upload describes the last upload of the bundle to the object storage
+	Upload *BundleUpload `json:"upload,omitempty"`
+	// Truncated lists collectors whose data exceeded size limits and was truncated
+	Truncated []string `json:"truncated,omitempty"`
+	// Webhooks is the log of webhook deliveries of the bundle lifecycle events. It's kept in a separate file
+	// and returned only with the status of a single bundle.
+	Webhooks []WebhookDelivery `json:"webhooks,omitempty"`
 }
 
 func (b *Bundle) IsFinished() bool {
@@ -66,31 +92,78 @@ type realClock struct{}
 
 func (realClock) Now() time.Time { return time.Now() }
 
-func NewBundleHandler(workDir string, collectors []collector.Collector, timeout, collectorTimeout time.Duration) (*BundleHandler, error) {
+// BundleHandlerOptions are optional features of local bundles, zero fields disable them
+type BundleHandlerOptions struct {
+	// Space prevents bundles from filling the disk
+	Space *DiskSpaceGuard
+	// Redactor removes sensitive data from collected data
+	Redactor *redact.Redactor
+	// Recipients are recipients bundles are encrypted for
+	Recipients []encrypt.Recipient
+	// Exporter uploads bundles to the object storage
+	Exporter *Exporter
+	// Notifier sends bundle lifecycle events to webhooks
+	Notifier *Notifier
+	// Limits limit the number of bytes written into bundles
+	Limits SizeLimits
+	// NodeIP and NodeRole describe the node in bundle manifests
+	NodeIP   net.IP
+	NodeRole string
+	// Registry is shared with other components working in the same work dir, nil creates a new one
+	Registry *BundleRegistry
+}
+
+func NewBundleHandler(workDir string, collectors []collector.Collector, timeout, collectorTimeout time.Duration,
+	collectorsConcurrency int, options BundleHandlerOptions) (*BundleHandler, error) {
+	if collectorsConcurrency < 1 {
+		return nil, fmt.Errorf("collectors concurrency must be greater than 0, got %d", collectorsConcurrency)
+	}
+
 	err := initializeWorkDir(workDir)
 	if err != nil {
 		return nil, err
 	}
 
+	bundles := options.Registry
+	if bundles == nil {
+		bundles = NewBundleRegistry()
+	}
+
 	return &BundleHandler{
-		stateFileLock:         &sync.RWMutex{},
 		clock:                 realClock{},
 		workDir:               workDir,
 		collectors:            collectors,
 		bundleCreationTimeout: timeout,
 		collectorTimeout:      collectorTimeout,
+		collectorsConcurrency: collectorsConcurrency,
+		space:                 options.Space,
+		redactor:              options.Redactor,
+		recipients:            options.Recipients,
+		exporter:              options.Exporter,
+		notifier:              options.Notifier,
+		limits:                options.Limits,
+		node:                  node{IP: options.NodeIP, Role: options.NodeRole},
+		bundles:               bundles,
 	}, nil
 }
 
 // BundleHandler is a struct that collects all functions
 // responsible for diagnostics bundle lifecycle
 type BundleHandler struct {
-	stateFileLock         *sync.RWMutex // used to synchronize access to state file
 	clock                 Clock
 	workDir               string                // location where bundles are generated and stored
 	collectors            []collector.Collector // information what should be in the bundle
 	bundleCreationTimeout time.Duration         // limits how long bundle creation could take
 	collectorTimeout      time.Duration         // limits how long single collection can take
+	collectorsConcurrency int                   // limits how many collectors could run at the same time
+	space                 *DiskSpaceGuard       // prevents bundles from filling the disk
+	redactor              *redact.Redactor      // removes sensitive data from collected data, nil disables redaction
+	recipients            []encrypt.Recipient   // bundles are encrypted for recipients, empty disables encryption
+	exporter              *Exporter             // uploads bundles to the object storage, nil disables export
+	notifier              *Notifier             // sends bundle lifecycle events to webhooks, nil disables webhooks
+	limits                SizeLimits            // limits the number of bytes written into bundles
+	node                  node                  // the node bundles are created on, described in manifests
+	bundles               *BundleRegistry       // tracks running bundles and guards their state files
 }
 
 type node struct {
@@ -99,100 +172,369 @@ type node struct {
 	baseURL string
 }
 
+// localOptions is the body of the local bundle creation request
+type localOptions struct {
+	Type       Type               `json:"type"`
+	Collectors CollectorSelection `json:"collectors"`
+	Since      string             `json:"since,omitempty"`
+	Until      string             `json:"until,omitempty"`
+	Format     string             `json:"format,omitempty"`
+	Journal    JournalSelection   `json:"journal"`
+	// Encrypt set to false disables encryption of the bundle. Masters use it for node bundles
+	// because they are merged into the cluster bundle which is encrypted by the master.
+	Encrypt *bool `json:"encrypt,omitempty"`
+}
+
+// parseLocalOptions reads options from the body of the local bundle creation request
+func parseLocalOptions(body io.Reader, now time.Time) (BundleOptions, error) {
+	o := localOptions{}
+	if body != nil {
+		if err := json.NewDecoder(body).Decode(&o); err != nil {
+			if err != io.EOF { // Accept empty body
+				return BundleOptions{}, err
+			}
+		}
+	}
+	if err := o.Collectors.validate(); err != nil {
+		return BundleOptions{}, err
+	}
+	format, err := archive.ParseFormat(o.Format)
+	if err != nil {
+		return BundleOptions{}, err
+	}
+	journal, err := o.Journal.parse()
+	if err != nil {
+		return BundleOptions{}, err
+	}
+	window, err := parseTimeWindow(o.Since, o.Until, now)
+	skipEncryption := o.Encrypt != nil && !*o.Encrypt
+	return BundleOptions{Collectors: o.Collectors, Window: window, Format: format, SkipEncryption: skipEncryption,
+		Journal: journal}, err
+}
+
+// createError is an error of the bundle creation with the status code the API responds with
+type createError struct {
+	code int
+	err  error
+}
+
+func (e *createError) Error() string {
+	return e.err.Error()
+}
+
+// writeCreateError responds with the status code of the bundle creation error
+func writeCreateError(w http.ResponseWriter, err error) {
+	switch e := err.(type) {
+	case *InsufficientStorageError:
+		writeInsufficientStorage(w, e)
+	case *createError:
+		writeJSONError(w, e.code, e.err)
+	default:
+		writeJSONError(w, http.StatusInternalServerError, err)
+	}
+}
+
 func (h BundleHandler) Create(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	if h.bundleExists(id) {
-		writeJSONError(w, http.StatusConflict, fmt.Errorf("bundle %s already exists", id))
+	options, err := parseLocalOptions(r.Body, time.Now())
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Errorf("could not parse request body %s", err))
 		return
 	}
 
+	bundleStatus, err := h.create(id, options)
+	if err != nil {
+		writeCreateError(w, err)
+		return
+	}
+	write(w, bundleStatus)
+}
+
+// CreateBundle starts creating the local bundle with options given in JSON the same way as in the body
+// of the creation request
+func (h BundleHandler) CreateBundle(id string, options []byte) error {
+	o, err := parseLocalOptions(bytes.NewReader(options), time.Now())
+	if err != nil {
+		return fmt.Errorf("invalid options: %s", err)
+	}
+	_, err = h.create(id, o)
+	return err
+}
+
+// create starts collecting the bundle in the background and returns its state
+func (h BundleHandler) create(id string, options BundleOptions) ([]byte, error) {
+	if h.bundleExists(id) {
+		return nil, &createError{code: http.StatusConflict, err: fmt.Errorf("bundle %s already exists", id)}
+	}
+
+	if e := h.space.admit(Local); e != nil {
+		return nil, e
+	}
+
 	bundleWorkDir := filepath.Join(h.workDir, id)
 	err := os.MkdirAll(bundleWorkDir, dirPerm)
 	if err != nil {
-		writeJSONError(w, http.StatusInsufficientStorage, fmt.Errorf("could not create bundle %s workdir: %s", id, err))
-		return
+		return nil, &createError{code: http.StatusInsufficientStorage,
+			err: fmt.Errorf("could not create bundle %s workdir: %s", id, err)}
 	}
 
 	bundle := Bundle{
-		ID:      id,
-		Started: h.clock.Now(),
-		Status:  Started,
+		ID:        id,
+		Started:   h.clock.Now(),
+		Status:    Started,
+		Format:    options.Format,
+		Encrypted: len(h.recipients) > 0 && !options.SkipEncryption,
+		Since:     timePtr(options.Window.Since),
+		Until:     timePtr(options.Window.Until),
 	}
 
 	bundleStatus, err := h.writeStateFile(bundle)
 	if err != nil {
-		writeJSONError(w, http.StatusInsufficientStorage, fmt.Errorf("could not update state file %s: %s", id, err))
-		return
+		return nil, &createError{code: http.StatusInsufficientStorage,
+			err: fmt.Errorf("could not update state file %s: %s", id, err)}
 	}
+	h.notifier.notify(bundle)
 
 	dataFile, err := os.Create(filepath.Join(h.workDir, id, dataFileName))
 	if err != nil {
 		bundle.Status = Failed
 		bundle.Stopped = h.clock.Now()
 		bundle.Errors = append(bundle.Errors, err.Error())
+		h.notifier.notify(bundle)
 		_, err := h.writeStateFile(bundle)
 		if err != nil {
-			writeJSONError(w, http.StatusInsufficientStorage, fmt.Errorf("could not update state file %s: %s", id, err))
-			return
+			return nil, &createError{code: http.StatusInsufficientStorage,
+				err: fmt.Errorf("could not update state file %s: %s", id, err)}
 		}
-		writeJSONError(w, http.StatusInsufficientStorage, fmt.Errorf("could not create data file %s: %s", id, err))
-		return
+		return nil, &createError{code: http.StatusInsufficientStorage,
+			err: fmt.Errorf("could not create data file %s: %s", id, err)}
 	}
 
-	//TODO(janisz): use context cancel function to cancel bundle creation https://jira.mesosphere.com/browse/DCOS_OSS-5222
-	ctx, _ := context.WithTimeout(context.Background(), h.bundleCreationTimeout) //nolint:govet
+	checksum := newChecksumWriter(dataFile)
+	data, err := bundleDataWriter(bundle, checksum, h.recipients)
+	if err != nil {
+		dataFile.Close()
+		bundle.Failed(h.clock.Now(), err)
+		if _, e := h.writeStateFile(bundle); e != nil {
+			logrus.WithError(e).Errorf("Could not update state file %s", id)
+		}
+		h.notifier.notify(bundle)
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), h.bundleCreationTimeout)
+	h.bundles.running.add(id, cancel)
+	stopWatching := h.space.watch(cancel)
 	done := make(chan []string)
 
-	go collectAll(ctx, done, dataFile, h.collectors, h.collectorTimeout)
+	collectors := options.Collectors.filter(h.collectors)
+	if len(collectors) == 0 {
+		logrus.WithField("ID", id).WithField("collectors", options.Collectors).Warn("No collector selected, bundle will be empty")
+	}
+
+	progress := newBundleProgress(collectors, func(reports []collectorReport) {
+		inProgress := bundle
+		inProgress.Status = InProgress
+		inProgress.Collectors = reports
+		inProgress.ProgressPercentage = progressPercentage(reports)
+		if _, e := h.writeStateFile(inProgress); e != nil {
+			logrus.WithError(e).Errorf("Could not update state file %s", id)
+		}
+	})
+
+	go collectAll(ctx, done, data, bundleWorkDir, collectors, h.node, options, h.redactor, h.limits, h.collectorTimeout,
+		h.collectorsConcurrency, progress)
 
 	go func() {
-		select {
-		case <-ctx.Done():
-			break
-		case bundle.Errors = <-done:
-			bundle.Status = Done
-			bundle.Stopped = h.clock.Now()
-			if _, e := h.writeStateFile(bundle); e != nil {
-				logrus.WithError(e).Errorf("Could not update state file %s", id)
+		defer h.bundles.running.remove(id)
+		defer cancel()
+
+		bundle.Errors = <-done
+		abortReason := stopWatching()
+		bundle.Stopped = h.clock.Now()
+		bundle.Status = Done
+		bundle.Collectors = progress.snapshot()
+		bundle.ProgressPercentage = progressPercentage(bundle.Collectors)
+		bundle.Truncated = truncatedCollectors(bundle.Collectors)
+		if abortReason != nil {
+			bundle.Failed(bundle.Stopped, abortReason)
+			if e := os.Remove(filepath.Join(h.workDir, id, dataFileName)); e != nil {
+				logrus.WithError(e).Errorf("Could not remove data file of aborted bundle %s", id)
+			}
+		} else if ctx.Err() == context.Canceled {
+			bundle.Status = Canceled
+			if e := os.Remove(filepath.Join(h.workDir, id, dataFileName)); e != nil {
+				logrus.WithError(e).Errorf("Could not remove data file of canceled bundle %s", id)
 			}
+		} else {
+			bundle.Checksum = checksum.sum()
+		}
+		if _, e := h.writeStateFile(bundle); e != nil {
+			logrus.WithError(e).Errorf("Could not update state file %s", id)
+			return
+		}
+		h.notifier.notify(bundle)
+		if bundle.Status == Done {
+			h.exporter.bundleDone(id)
 		}
 	}()
 
-	write(w, bundleStatus)
+	return bundleStatus, nil
 }
 
-func collectAll(ctx context.Context, done chan<- []string, dataFile io.WriteCloser,
-	collectors []collector.Collector, collectorTimeout time.Duration) {
-	zipWriter := zip.NewWriter(dataFile)
+func collectAll(ctx context.Context, done chan<- []string, dataFile io.WriteCloser, spoolDir string,
+	collectors []collector.Collector, n node, options BundleOptions, redactor *redact.Redactor, limits SizeLimits,
+	collectorTimeout time.Duration, concurrency int, progress *bundleProgress) {
+	archiveWriter, err := archive.NewWriter(options.Format, dataFile)
+	if err != nil {
+		dataFile.Close()
+		done <- []string{err.Error()}
+		return
+	}
 	var errors []string
 
-	for _, c := range collectors {
-		if ctx.Err() != nil {
-			errors = append(errors, ctx.Err().Error())
-			break
+	// results are written to the archive as soon as collectors finish so spooled files of finished
+	// collectors do not wait on disk for slower collectors defined before them
+	results := make(chan indexedResult, len(collectors))
+
+	jobs := make(chan int)
+	go func() {
+		for i := range collectors {
+			jobs <- i
 		}
-		collectorCtx, cancel := context.WithTimeout(ctx, collectorTimeout) //nolint: govet
-		err := collect(collectorCtx, c, zipWriter)
-		cancel()
-		if err != nil && !c.Optional() {
-			errors = append(errors, err.Error())
+		close(jobs)
+	}()
+
+	for w := 0; w < concurrency; w++ {
+		go func() {
+			for i := range jobs {
+				if ctx.Err() != nil {
+					progress.failed(i, 0)
+					results <- indexedResult{i: i, collectorResult: collectorResult{skipped: true}}
+					continue
+				}
+				progress.running(i)
+				collectorCtx, cancel := context.WithTimeout(ctx, collectorTimeout)
+				result := spool(collectorCtx, collectors[i], options, redactor, limits.collector(collectors[i].Name()), spoolDir)
+				cancel()
+				if result.truncated() {
+					progress.truncated(i)
+				}
+				if result.failed() {
+					progress.failed(i, result.size)
+				} else {
+					progress.done(i, result.size)
+				}
+				results <- indexedResult{i: i, collectorResult: result}
+			}
+		}()
+	}
+
+	// archive writer is not safe for concurrent use so only this goroutine writes to it
+	skipped := false
+	var written int64 // number of bytes written into the bundle, limited by limits.MaxBundleSize
+	// manifest entries and errors are kept by collectors so they are listed in the order collectors are defined
+	entries := make([][]manifestEntry, len(collectors))
+	collectorErrors := make([][]string, len(collectors))
+	for range collectors {
+		indexed := <-results
+		i, c, result := indexed.i, collectors[indexed.i], indexed.collectorResult
+		entry := manifestEntry{
+			Collector: c.Name(),
+			Type:      collectorType(c),
+			NodeRole:  n.Role,
+			Optional:  c.Optional(),
+			Started:   result.started,
+			Stopped:   result.stopped,
+		}
+		if n.IP != nil {
+			entry.NodeIP = n.IP.String()
+		}
+		if result.skipped {
+			skipped = true
+			entry.Failed = true
+			entry.Err = ctx.Err().Error()
+			entries[i] = append(entries[i], entry)
+			continue
 		}
+		if len(result.files) == 0 {
+			if result.err != nil {
+				entry.Failed = true
+				entry.Err = result.err.Error()
+				if !c.Optional() {
+					collectorErrors[i] = append(collectorErrors[i], result.err.Error())
+				}
+			}
+			entries[i] = append(entries[i], entry)
+			continue
+		}
+		// every file has its own entry, multi collectors produce many of them
+		for _, f := range result.files {
+			fileEntry := entry
+			if f.spool != nil && limits.MaxBundleSize > 0 && written+f.size > limits.MaxBundleSize {
+				budget := limits.MaxBundleSize - written
+				if budget < 0 {
+					budget = 0
+				}
+				f = truncateSpool(f, budget, limits.collector(c.Name()).Truncation, spoolDir)
+				progress.truncated(i)
+			}
+			err := f.err
+			if err == nil {
+				err = result.err
+			}
+			// spool is nil when file of mandatory collector could not be opened
+			if f.spool != nil {
+				if e := writeSpool(archiveWriter, f.name, f.spool, result.stopped); e != nil {
+					if err != nil {
+						e = fmt.Errorf("%s; %s", err, e)
+					}
+					err = e
+					progress.failed(i, result.size)
+				} else {
+					written += f.size
+					fileEntry.Path = f.name
+					fileEntry.Size = f.size
+					fileEntry.SHA256 = f.sha256
+					fileEntry.Redactions = f.redactions
+					fileEntry.Truncated = f.truncated
+				}
+			}
+			if err != nil {
+				fileEntry.Failed = true
+				fileEntry.Err = err.Error()
+				if !c.Optional() {
+					collectorErrors[i] = append(collectorErrors[i], err.Error())
+				}
+			}
+			entries[i] = append(entries[i], fileEntry)
+		}
+	}
+
+	m := manifest{Entries: make([]manifestEntry, 0, len(collectors))}
+	for i := range collectors {
+		m.Entries = append(m.Entries, entries[i]...)
+		errors = append(errors, collectorErrors[i]...)
+	}
+	if skipped {
+		errors = append(errors, ctx.Err().Error())
 	}
 
+	now := time.Now()
 	if len(errors) != 0 {
-		summaryErrorReportFile, err := zipWriter.Create(summaryErrorsReportFileName)
-		if err != nil {
+		summary := []byte(strings.Join(errors, "\n"))
+		if err := archive.WriteFile(archiveWriter, summaryErrorsReportFileName, summary, now); err != nil {
 			errors = append(errors, err.Error())
-		} else {
-			if _, err := summaryErrorReportFile.Write([]byte(strings.Join(errors, "\n"))); err != nil {
-				errors = append(errors, err.Error())
-			}
 		}
 	}
 
-	if err := zipWriter.Close(); err != nil {
+	if err := archive.WriteFile(archiveWriter, manifestFileName, jsonMarshal(m), now); err != nil {
+		errors = append(errors, err.Error())
+	}
+
+	if err := archiveWriter.Close(); err != nil {
 		errors = append(errors, err.Error())
 	}
 	if err := dataFile.Close(); err != nil {
@@ -202,22 +544,199 @@ func collectAll(ctx context.Context, done chan<- []string, dataFile io.WriteClos
 	done <- errors
 }
 
-func collect(ctx context.Context, c collector.Collector, zipWriter *zip.Writer) error {
-	rc, err := c.Collect(ctx)
+// indexedResult is the result of the collector with index i
+type indexedResult struct {
+	collectorResult
+	i int
+}
+
+// collectorResult is an outcome of a single collector run
+type collectorResult struct {
+	files   []spooledFile // collected files, empty when nothing was collected
+	size    int64         // number of collected bytes in all files
+	started time.Time
+	stopped time.Time
+	err     error
+	skipped bool // true when collector was not run because bundle creation was stopped
+}
+
+func (r collectorResult) failed() bool {
+	if r.err != nil {
+		return true
+	}
+	for _, f := range r.files {
+		if f.err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (r collectorResult) truncated() bool {
+	for _, f := range r.files {
+		if f.truncated {
+			return true
+		}
+	}
+	return false
+}
+
+// spooledFile is a single collected file stored in a temporary file
+type spooledFile struct {
+	name       string   // path in the bundle
+	spool      *os.File // temporary file with collected data
+	size       int64    // number of collected bytes
+	sha256     string   // hex encoded SHA-256 of collected data
+	redactions int      // number of redacted secrets
+	truncated  bool     // true when collected data exceeded the size limit
+	err        error
+}
+
+// spool runs the collector and stores its output in temporary files in given dir,
+// so slow collectors could run concurrently without blocking the archive writer. Sensitive data is redacted
+// before it's stored when redactor is not nil. Files are truncated so all of them fit the limit.
+func spool(ctx context.Context, c collector.Collector, options BundleOptions, redactor *redact.Redactor,
+	limit SizeLimit, dir string) collectorResult {
+	result := collectorResult{started: time.Now()}
+	outputs, err := collectOutputs(ctx, c, options)
 	if err != nil {
+		result.err = fmt.Errorf("could not collect %s: %s", c.Name(), err)
 		if !c.Optional() {
-			return fmt.Errorf("could not collect %s: %s", c.Name(), err)
+			result.stopped = time.Now()
+			return result
 		}
-		rc = ioutil.NopCloser(bytes.NewReader([]byte(err.Error())))
+		// optional collector failure is not reported as bundle error
+		// but its details are stored in the bundle
+		outputs = []collector.Output{{Name: c.Name(), Open: errorOutput(err)}}
+	}
+
+	for _, o := range outputs {
+		rc, err := o.Open(ctx)
+		var openErr error
+		if err != nil {
+			openErr = fmt.Errorf("could not collect %s: %s", o.Name, err)
+			if !c.Optional() {
+				result.files = append(result.files, spooledFile{name: o.Name, err: openErr})
+				continue
+			}
+			rc = ioutil.NopCloser(bytes.NewReader([]byte(err.Error())))
+		}
+		f, err := spoolFile(o.Name, rc, redactor, limit.max(result.size), limit.Truncation, dir)
+		if err != nil {
+			result.err = err
+			break
+		}
+		if f.err == nil {
+			f.err = openErr
+		}
+		result.size += f.size
+		result.files = append(result.files, f)
+	}
+	result.stopped = time.Now()
+	return result
+}
+
+// spoolFile copies data into a new temporary file in given dir and closes data. Data exceeding max bytes is
+// truncated, negative max disables truncation. Error is returned only when the temporary file could not be created.
+func spoolFile(name string, rc io.ReadCloser, redactor *redact.Redactor, max int64, truncation Truncation,
+	dir string) (spooledFile, error) {
+	var redacted *redact.Reader
+	if redactor != nil {
+		redacted = redactor.Reader(rc)
+		rc = redacted
 	}
 	defer rc.Close()
 
-	zipFile, err := zipWriter.Create(c.Name())
+	f, err := ioutil.TempFile(dir, "collector-*")
 	if err != nil {
-		return fmt.Errorf("could not create a %s in the zip: %s", c.Name(), err)
+		return spooledFile{}, fmt.Errorf("could not create a %s spool file: %s", name, err)
 	}
-	if _, err := io.Copy(zipFile, rc); err != nil {
-		return fmt.Errorf("could not copy %s data to zip: %s", c.Name(), err)
+
+	var w io.Writer = f
+	var truncating *truncatingWriter
+	if max >= 0 {
+		truncating = newTruncatingWriter(f, max, truncation)
+		w = truncating
+	}
+
+	hash := sha256.New()
+	result := spooledFile{name: name, spool: f}
+	result.size, err = io.Copy(io.MultiWriter(w, hash), rc)
+	if err != nil && err != errLimitReached {
+		result.err = fmt.Errorf("could not copy %s data to zip: %s", name, err)
+	}
+	result.sha256 = hex.EncodeToString(hash.Sum(nil))
+	if redacted != nil {
+		result.redactions = redacted.Redactions()
+	}
+	if truncating != nil && truncating.truncated() {
+		result.truncated = true
+		result.spool, result.size, result.sha256, err = truncating.rewrite(dir, truncationMarker(max))
+		if err != nil {
+			result.err = fmt.Errorf("could not truncate %s: %s", name, err)
+		}
+	}
+	return result, nil
+}
+
+// collectOutputs returns files collected by the collector. Collectors that are not multi collectors
+// produce a single file named after them.
+func collectOutputs(ctx context.Context, c collector.Collector, options BundleOptions) ([]collector.Output, error) {
+	if m, ok := c.(collector.MultiCollector); ok {
+		return m.CollectOutputs(ctx, options.Window)
+	}
+	rc, err := collect(ctx, c, options)
+	if err != nil {
+		return nil, err
+	}
+	return []collector.Output{{Name: c.Name(), Open: func(context.Context) (io.ReadCloser, error) {
+		return rc, nil
+	}}}, nil
+}
+
+func errorOutput(err error) func(context.Context) (io.ReadCloser, error) {
+	return func(context.Context) (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader([]byte(err.Error()))), nil
+	}
+}
+
+// collect returns data collected by the collector limited to the given window when collector supports it.
+// Journal collectors get journal options as well.
+func collect(ctx context.Context, c collector.Collector, options BundleOptions) (io.ReadCloser, error) {
+	if j, ok := c.(collector.JournalCollector); ok {
+		return j.CollectJournal(ctx, options.Window, options.Journal)
+	}
+	window := options.Window
+	if w, ok := c.(collector.WindowCollector); ok && !window.IsZero() {
+		return w.CollectWindow(ctx, window)
+	}
+	return c.Collect(ctx)
+}
+
+// writeSpool copies spooled collector data into the archive and removes the spool file
+func writeSpool(w archive.Writer, name string, spool *os.File, modified time.Time) error {
+	defer func() {
+		spool.Close()
+		if err := os.Remove(spool.Name()); err != nil {
+			logrus.WithError(err).Warnf("Could not remove spool file of %s", name)
+		}
+	}()
+
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("could not read %s spool file: %s", name, err)
+	}
+
+	info, err := spool.Stat()
+	if err != nil {
+		return fmt.Errorf("could not read %s spool file: %s", name, err)
+	}
+
+	file, err := w.Create(archive.Header{Name: name, Size: info.Size(), Modified: modified})
+	if err != nil {
+		return fmt.Errorf("could not create a %s in the archive: %s", name, err)
+	}
+	if _, err := io.Copy(file, spool); err != nil {
+		return fmt.Errorf("could not copy %s data to archive: %s", name, err)
 	}
 
 	return nil
@@ -239,6 +758,11 @@ func (h BundleHandler) Get(w http.ResponseWriter, r *http.Request) {
 		logrus.WithField("ID", id).WithError(err).Warn("There is a problem with the bundle")
 	}
 
+	bundle.Webhooks, err = loadWebhookDeliveries(h.workDir, id)
+	if err != nil {
+		logrus.WithField("ID", id).WithError(err).Warn("Could not read webhook delivery log")
+	}
+
 	write(w, jsonMarshal(bundle))
 }
 
@@ -263,8 +787,11 @@ func (h BundleHandler) GetFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Add("Content-Type", "application/zip, application/octet-stream")
-	w.Header().Add("Content-disposition", fmt.Sprintf("attachment; filename=%s.zip", id))
+	setBundleFileHeaders(w, id, bundle.Format, bundle.Encrypted)
+	if bundle.Checksum != "" {
+		// allows clients to resume download with If-Range and validate it
+		w.Header().Set("ETag", checksumETag(bundle.Checksum))
+	}
 	http.ServeFile(w, r, filepath.Join(h.workDir, id, dataFileName))
 }
 
@@ -344,6 +871,11 @@ func (h BundleHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// bundle that is still being created is canceled before it is deleted
+	if finished, ok := h.bundles.running.cancel(id); ok {
+		<-finished
+	}
+
 	bundle, err := h.getBundleState(id)
 	if err != nil {
 		logrus.WithField("ID", id).WithError(err).Warn("There is a problem with the bundle")
@@ -359,38 +891,104 @@ func (h BundleHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	//TODO(janisz): Handle Canceled Status https://jira.mesosphere.com/browse/DCOS_OSS-5222
-
 	err = os.Remove(filepath.Join(h.workDir, id, dataFileName))
 	if err != nil {
 		writeJSONError(w, http.StatusInternalServerError, fmt.Errorf("could not delete bundle %s: %s", id, err))
 		return
 	}
 
-	bundle.Status = Deleted
-	newRawState, err := h.writeStateFile(bundle)
+	// state is updated in place so the upload status written in the meantime is kept
+	size := bundle.Size
+	bundle, err = h.bundles.updateState(h.workDir, id, func(bundle *Bundle) error {
+		bundle.Status = Deleted
+		bundle.Size = size
+		return nil
+	})
 	if err != nil {
 		writeJSONError(w, http.StatusInternalServerError,
 			fmt.Errorf("bundle %s was deleted but state could not be updated: %s", id, err))
 		return
 	}
+	h.notifier.notify(bundle)
+	write(w, jsonMarshal(bundle))
+}
+
+// Cancel stops creation of the bundle with the given id. Running collectors are interrupted,
+// partial data is removed and the bundle is marked as Canceled.
+func (h BundleHandler) Cancel(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	if !h.bundleExists(id) {
+		http.NotFound(w, r)
+		return
+	}
+
+	if finished, ok := h.bundles.running.cancel(id); ok {
+		<-finished
+	}
+
+	bundle, err := h.getBundleState(id)
+	if err != nil {
+		logrus.WithField("ID", id).WithError(err).Warn("There is a problem with the bundle")
+		bundle.Errors = append(bundle.Errors, err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		write(w, jsonMarshal(bundle))
+		return
+	}
+
+	switch bundle.Status {
+	case Canceled:
+		write(w, jsonMarshal(bundle))
+		return
+	case Done, Deleted, Failed:
+		writeJSONError(w, http.StatusConflict, fmt.Errorf("bundle %s is already %s", id, bundle.Status))
+		return
+	}
+
+	// There is no running process for this bundle but its state says it's not finished.
+	// This could happen when dcos-diagnostics was restarted during bundle creation.
+	err = os.Remove(filepath.Join(h.workDir, id, dataFileName))
+	if err != nil && !os.IsNotExist(err) {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Errorf("could not remove bundle %s data: %s", id, err))
+		return
+	}
+
+	bundle.Status = Canceled
+	bundle.Size = 0
+	bundle.Stopped = h.clock.Now()
+	newRawState, err := h.writeStateFile(bundle)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError,
+			fmt.Errorf("bundle %s was canceled but state could not be updated: %s", id, err))
+		return
+	}
+	h.notifier.notify(bundle)
 	write(w, newRawState)
 }
 
+// Upload starts upload of the bundle with the given id to the object storage. Upload status is
+// reported in the bundle state.
+func (h BundleHandler) Upload(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	if !h.bundleExists(id) {
+		http.NotFound(w, r)
+		return
+	}
+
+	h.exporter.serveUpload(w, id)
+}
+
 func (h BundleHandler) writeStateFile(bundle Bundle) ([]byte, error) {
-	stateFilePath := filepath.Join(h.workDir, bundle.ID, stateFileName)
-	newRawState := jsonMarshal(bundle)
-	h.stateFileLock.Lock()
-	err := ioutil.WriteFile(stateFilePath, newRawState, filePerm)
-	h.stateFileLock.Unlock()
-	return newRawState, err
+	return h.bundles.writeState(h.workDir, bundle)
 }
 
 func (h BundleHandler) readStateFile(bundle Bundle) ([]byte, error) {
-	stateFilePath := filepath.Join(h.workDir, bundle.ID, stateFileName)
-	h.stateFileLock.RLock()
-	defer h.stateFileLock.RUnlock()
-	return ioutil.ReadFile(stateFilePath)
+	h.bundles.state.RLock()
+	defer h.bundles.state.RUnlock()
+	return ioutil.ReadFile(filepath.Join(h.workDir, bundle.ID, stateFileName))
 }
 
 func writeJSONError(w http.ResponseWriter, code int, e error) {
@@ -4,18 +4,26 @@ import (
 	"archive/zip"
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math/rand"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/dcos/dcos-diagnostics/archive"
 	"github.com/dcos/dcos-diagnostics/collector"
 	diagio "github.com/dcos/dcos-diagnostics/io"
+	"github.com/dcos/dcos-diagnostics/redact"
 
 	"github.com/gorilla/mux"
 
@@ -24,8 +32,10 @@ import (
 )
 
 const (
-	bundleEndpoint     = bundlesEndpoint + "/{id}"
-	bundleFileEndpoint = bundleEndpoint + "/file"
+	bundleEndpoint       = bundlesEndpoint + "/{id}"
+	bundleFileEndpoint   = bundleEndpoint + "/file"
+	bundleCancelEndpoint = bundleEndpoint + "/cancel"
+	bundleUploadEndpoint = bundleEndpoint + "/upload"
 
 	collectorTimeout = time.Millisecond
 )
@@ -37,7 +47,7 @@ func TestIfReturnsEmptyListWhenDirIsEmpty(t *testing.T) {
 	defer os.RemoveAll(workdir)
 	require.NoError(t, err)
 
-	bh, err := NewBundleHandler(workdir, nil, time.Millisecond, collectorTimeout)
+	bh, err := NewBundleHandler(workdir, nil, time.Millisecond, collectorTimeout, 1, BundleHandlerOptions{})
 	require.NoError(t, err)
 
 	req, err := http.NewRequest(http.MethodGet, bundlesEndpoint, nil)
@@ -62,7 +72,7 @@ func TestIfReturnsEmptyListWhenDirIsEmptyContainsNoDirs(t *testing.T) {
 	_, err = ioutil.TempFile(workdir, "")
 	require.NoError(t, err)
 
-	bh, err := NewBundleHandler(workdir, nil, time.Millisecond, collectorTimeout)
+	bh, err := NewBundleHandler(workdir, nil, time.Millisecond, collectorTimeout, 1, BundleHandlerOptions{})
 	require.NoError(t, err)
 
 	req, err := http.NewRequest(http.MethodGet, bundlesEndpoint, nil)
@@ -89,7 +99,7 @@ func TestIfDirsAsBundlesIdsWithStatusUnknown(t *testing.T) {
 		require.NoError(t, err)
 	}
 
-	bh, err := NewBundleHandler(workdir, nil, time.Millisecond, collectorTimeout)
+	bh, err := NewBundleHandler(workdir, nil, time.Millisecond, collectorTimeout, 1, BundleHandlerOptions{})
 	require.NoError(t, err)
 
 	req, err := http.NewRequest(http.MethodGet, bundlesEndpoint, nil)
@@ -144,7 +154,7 @@ func TestIfListShowsStatusWithoutAFile(t *testing.T) {
 		"stopped_at":"2019-05-21T00:00:00Z" }`), filePerm)
 	require.NoError(t, err)
 
-	bh, err := NewBundleHandler(workdir, nil, time.Millisecond, collectorTimeout)
+	bh, err := NewBundleHandler(workdir, nil, time.Millisecond, collectorTimeout, 1, BundleHandlerOptions{})
 	require.NoError(t, err)
 
 	req, err := http.NewRequest(http.MethodGet, bundlesEndpoint, nil)
@@ -174,7 +184,7 @@ func TestIfListWorksWithoutBundleDir(t *testing.T) {
 	err = os.RemoveAll(workdir)
 	require.NoError(t, err)
 
-	bh, err := NewBundleHandler(workdir, nil, time.Millisecond, collectorTimeout)
+	bh, err := NewBundleHandler(workdir, nil, time.Millisecond, collectorTimeout, 1, BundleHandlerOptions{})
 	require.NoError(t, err)
 
 	req, err := http.NewRequest(http.MethodGet, bundlesEndpoint, nil)
@@ -206,7 +216,7 @@ func TestIfShowsStatusWithoutAFileButStatusDoneShouldChangeStatusToUnknown(t *te
 		"stopped_at":"2019-05-21T00:00:00Z" }`), filePerm)
 	require.NoError(t, err)
 
-	bh, err := NewBundleHandler(workdir, nil, time.Millisecond, collectorTimeout)
+	bh, err := NewBundleHandler(workdir, nil, time.Millisecond, collectorTimeout, 1, BundleHandlerOptions{})
 	require.NoError(t, err)
 
 	req, err := http.NewRequest(http.MethodGet, bundlesEndpoint, nil)
@@ -249,7 +259,7 @@ func TestIfShowsStatusWithFileAndDontUpdatesFileSize(t *testing.T) {
 	err = ioutil.WriteFile(filepath.Join(bundleWorkDir, dataFileName), []byte(`OK`), filePerm)
 	require.NoError(t, err)
 
-	bh, err := NewBundleHandler(workdir, nil, time.Millisecond, collectorTimeout)
+	bh, err := NewBundleHandler(workdir, nil, time.Millisecond, collectorTimeout, 1, BundleHandlerOptions{})
 	require.NoError(t, err)
 
 	req, err := http.NewRequest(http.MethodGet, bundlesEndpoint, nil)
@@ -295,7 +305,7 @@ func TestIfGetShowsStatusWithoutAFileWhenBundleIsDeleted(t *testing.T) {
 		"stopped_at":"2019-05-21T00:00:00Z" }`), filePerm)
 	require.NoError(t, err)
 
-	bh, err := NewBundleHandler(workdir, nil, time.Millisecond, collectorTimeout)
+	bh, err := NewBundleHandler(workdir, nil, time.Millisecond, collectorTimeout, 1, BundleHandlerOptions{})
 	require.NoError(t, err)
 
 	req, err := http.NewRequest(http.MethodGet, bundlesEndpoint+"/bundle", nil)
@@ -335,7 +345,7 @@ func TestIfGetShowsStatusWithoutAFileWhenBundleIsDone(t *testing.T) {
 		"stopped_at":"2019-05-21T00:00:00Z" }`), filePerm)
 	require.NoError(t, err)
 
-	bh, err := NewBundleHandler(workdir, nil, time.Millisecond, collectorTimeout)
+	bh, err := NewBundleHandler(workdir, nil, time.Millisecond, collectorTimeout, 1, BundleHandlerOptions{})
 	require.NoError(t, err)
 
 	req, err := http.NewRequest(http.MethodGet, bundlesEndpoint+"/bundle", nil)
@@ -367,7 +377,7 @@ func TestIfGetReturns500WhenBundleStateIsNotJson(t *testing.T) {
 		[]byte(`invalid JSON`), filePerm)
 	require.NoError(t, err)
 
-	bh, err := NewBundleHandler(workdir, nil, time.Millisecond, collectorTimeout)
+	bh, err := NewBundleHandler(workdir, nil, time.Millisecond, collectorTimeout, 1, BundleHandlerOptions{})
 	require.NoError(t, err)
 
 	req, err := http.NewRequest(http.MethodGet, bundlesEndpoint+"/bundle-state-not-json", nil)
@@ -399,7 +409,7 @@ func TestIfDeleteReturns404WhenNoBundleFound(t *testing.T) {
 	defer os.RemoveAll(workdir)
 	require.NoError(t, err)
 
-	bh, err := NewBundleHandler(workdir, nil, time.Nanosecond, collectorTimeout)
+	bh, err := NewBundleHandler(workdir, nil, time.Nanosecond, collectorTimeout, 1, BundleHandlerOptions{})
 	require.NoError(t, err)
 
 	req, err := http.NewRequest(http.MethodDelete, bundlesEndpoint+"/not-existing-bundle", nil)
@@ -425,7 +435,7 @@ func TestIfDeleteReturns500WhenNoBundleStateFound(t *testing.T) {
 	err = os.Mkdir(bundleWorkDir, dirPerm)
 	require.NoError(t, err)
 
-	bh, err := NewBundleHandler(workdir, nil, time.Millisecond, collectorTimeout)
+	bh, err := NewBundleHandler(workdir, nil, time.Millisecond, collectorTimeout, 1, BundleHandlerOptions{})
 	require.NoError(t, err)
 
 	req, err := http.NewRequest(http.MethodDelete, bundlesEndpoint+"/not-existing-bundle-state", nil)
@@ -457,7 +467,7 @@ func TestIfDeleteReturns500WhenBundleStateIsNotJson(t *testing.T) {
 		[]byte(`invalid JSON`), filePerm)
 	require.NoError(t, err)
 
-	bh, err := NewBundleHandler(workdir, nil, time.Millisecond, collectorTimeout)
+	bh, err := NewBundleHandler(workdir, nil, time.Millisecond, collectorTimeout, 1, BundleHandlerOptions{})
 	require.NoError(t, err)
 
 	req, err := http.NewRequest(http.MethodDelete, bundlesEndpoint+"/bundle-state-not-json", nil)
@@ -503,7 +513,7 @@ func TestIfDeleteReturns200WhenBundleWasDeletedBefore(t *testing.T) {
 	err = ioutil.WriteFile(stateFilePath, []byte(bundleState), filePerm)
 	require.NoError(t, err)
 
-	bh, err := NewBundleHandler(workdir, nil, time.Millisecond, collectorTimeout)
+	bh, err := NewBundleHandler(workdir, nil, time.Millisecond, collectorTimeout, 1, BundleHandlerOptions{})
 	require.NoError(t, err)
 
 	req, err := http.NewRequest(http.MethodDelete, bundlesEndpoint+"/deleted-bundle", nil)
@@ -535,7 +545,7 @@ func TestIfDeleteReturns500WhenBundleFileIsMissing(t *testing.T) {
 		"stopped_at":"2019-05-21T00:00:00Z" }`)), filePerm)
 	require.NoError(t, err)
 
-	bh, err := NewBundleHandler(workdir, nil, time.Millisecond, collectorTimeout)
+	bh, err := NewBundleHandler(workdir, nil, time.Millisecond, collectorTimeout, 1, BundleHandlerOptions{})
 	require.NoError(t, err)
 
 	req, err := http.NewRequest(http.MethodDelete, bundlesEndpoint+"/missing-data-file", nil)
@@ -575,7 +585,7 @@ func TestIfDeleteReturns200WhenBundleWasDeleted(t *testing.T) {
 	err = ioutil.WriteFile(filepath.Join(bundleWorkDir, dataFileName), []byte(`OK`), filePerm)
 	require.NoError(t, err)
 
-	bh, err := NewBundleHandler(workdir, nil, time.Millisecond, collectorTimeout)
+	bh, err := NewBundleHandler(workdir, nil, time.Millisecond, collectorTimeout, 1, BundleHandlerOptions{})
 	require.NoError(t, err)
 
 	req, err := http.NewRequest(http.MethodDelete, bundlesEndpoint+"/bundle-0", nil)
@@ -621,7 +631,7 @@ func TestIfGetFileReturnsBundle(t *testing.T) {
 		[]byte(`OK`), filePerm)
 	require.NoError(t, err)
 
-	bh, err := NewBundleHandler(workdir, nil, time.Millisecond, collectorTimeout)
+	bh, err := NewBundleHandler(workdir, nil, time.Millisecond, collectorTimeout, 1, BundleHandlerOptions{})
 	require.NoError(t, err)
 
 	req, err := http.NewRequest(http.MethodGet, bundlesEndpoint+"/bundle", nil)
@@ -664,7 +674,7 @@ func TestIfGetFileReturns404WhenBundleIsStarted(t *testing.T) {
 		[]byte(`OK`), filePerm)
 	require.NoError(t, err)
 
-	bh, err := NewBundleHandler(workdir, nil, time.Millisecond, collectorTimeout)
+	bh, err := NewBundleHandler(workdir, nil, time.Millisecond, collectorTimeout, 1, BundleHandlerOptions{})
 	require.NoError(t, err)
 
 	req, err := http.NewRequest(http.MethodGet, bundlesEndpoint+"/bundle", nil)
@@ -709,7 +719,7 @@ func TestIfGetFileReturns410WhenBundleIsNotDone(t *testing.T) {
 		[]byte(`OK`), filePerm)
 	require.NoError(t, err)
 
-	bh, err := NewBundleHandler(workdir, nil, time.Millisecond, collectorTimeout)
+	bh, err := NewBundleHandler(workdir, nil, time.Millisecond, collectorTimeout, 1, BundleHandlerOptions{})
 	require.NoError(t, err)
 
 	req, err := http.NewRequest(http.MethodGet, bundlesEndpoint+"/bundle", nil)
@@ -734,7 +744,7 @@ func TestIfGetFileReturnsErrorWhenBundleDoesNotExists(t *testing.T) {
 	defer os.RemoveAll(workdir)
 	require.NoError(t, err)
 
-	bh, err := NewBundleHandler(workdir, nil, time.Millisecond, collectorTimeout)
+	bh, err := NewBundleHandler(workdir, nil, time.Millisecond, collectorTimeout, 1, BundleHandlerOptions{})
 	require.NoError(t, err)
 
 	req, err := http.NewRequest(http.MethodGet, bundlesEndpoint+"/bundle", nil)
@@ -769,7 +779,7 @@ func TestIfCreateReturns409WhenBundleWithGivenIdAlreadyExists(t *testing.T) {
 	err = ioutil.WriteFile(filepath.Join(bundleWorkDir, dataFileName), []byte(`OK`), filePerm)
 	require.NoError(t, err)
 
-	bh, err := NewBundleHandler(workdir, nil, time.Millisecond, collectorTimeout)
+	bh, err := NewBundleHandler(workdir, nil, time.Millisecond, collectorTimeout, 1, BundleHandlerOptions{})
 	require.NoError(t, err)
 
 	req, err := http.NewRequest(http.MethodPut, bundlesEndpoint+"/bundle-0", nil)
@@ -794,7 +804,7 @@ func TestIfCreateReturns507WhenCouldNotCreateWorkDir(t *testing.T) {
 	bundleWorkDir := filepath.Join(workdir, "bundle-0")
 	err = ioutil.WriteFile(bundleWorkDir, []byte{}, 0000)
 
-	bh, err := NewBundleHandler(workdir, nil, time.Millisecond, collectorTimeout)
+	bh, err := NewBundleHandler(workdir, nil, time.Millisecond, collectorTimeout, 1, BundleHandlerOptions{})
 	require.NoError(t, err)
 
 	req, err := http.NewRequest(http.MethodPut, bundlesEndpoint+"/bundle-0", nil)
@@ -810,6 +820,165 @@ func TestIfCreateReturns507WhenCouldNotCreateWorkDir(t *testing.T) {
 	assert.Contains(t, rr.Body.String(), `{"code":507,"error":"could not create bundle bundle-0 workdir: `)
 }
 
+func TestIfCancelReturns404WhenNoBundleFound(t *testing.T) {
+	t.Parallel()
+
+	workdir, err := ioutil.TempDir("", "work-dir")
+	defer os.RemoveAll(workdir)
+	require.NoError(t, err)
+
+	bh, err := NewBundleHandler(workdir, nil, time.Millisecond, collectorTimeout, 1, BundleHandlerOptions{})
+	require.NoError(t, err)
+
+	req, err := http.NewRequest(http.MethodPost, bundlesEndpoint+"/not-existing-bundle/cancel", nil)
+	require.NoError(t, err)
+
+	router := mux.NewRouter()
+	router.HandleFunc(bundleCancelEndpoint, bh.Cancel)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestIfCancelReturns409WhenBundleIsDone(t *testing.T) {
+	t.Parallel()
+
+	workdir, err := ioutil.TempDir("", "work-dir")
+	defer os.RemoveAll(workdir)
+	require.NoError(t, err)
+	bundleWorkDir := filepath.Join(workdir, "bundle")
+	err = os.Mkdir(bundleWorkDir, dirPerm)
+	require.NoError(t, err)
+	err = ioutil.WriteFile(filepath.Join(bundleWorkDir, stateFileName),
+		[]byte(`{
+		"id": "bundle",
+		"type": "Local",
+		"status": "Done",
+		"started_at":"1991-05-21T00:00:00Z",
+		"stopped_at":"2019-05-21T00:00:00Z" }`), filePerm)
+	require.NoError(t, err)
+	err = ioutil.WriteFile(filepath.Join(bundleWorkDir, dataFileName), []byte(`OK`), filePerm)
+	require.NoError(t, err)
+
+	bh, err := NewBundleHandler(workdir, nil, time.Millisecond, collectorTimeout, 1, BundleHandlerOptions{})
+	require.NoError(t, err)
+
+	req, err := http.NewRequest(http.MethodPost, bundlesEndpoint+"/bundle/cancel", nil)
+	require.NoError(t, err)
+
+	router := mux.NewRouter()
+	router.HandleFunc(bundleCancelEndpoint, bh.Cancel)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	assert.JSONEq(t, `{"code":409,"error":"bundle bundle is already Done"}`, rr.Body.String())
+	assert.FileExists(t, filepath.Join(bundleWorkDir, dataFileName))
+}
+
+func TestIfCancelMarksOrphanedBundleAsCanceled(t *testing.T) {
+	t.Parallel()
+
+	workdir, err := ioutil.TempDir("", "work-dir")
+	defer os.RemoveAll(workdir)
+	require.NoError(t, err)
+	bundleWorkDir := filepath.Join(workdir, "bundle")
+	err = os.Mkdir(bundleWorkDir, dirPerm)
+	require.NoError(t, err)
+	err = ioutil.WriteFile(filepath.Join(bundleWorkDir, stateFileName),
+		[]byte(`{
+		"id": "bundle",
+		"type": "Local",
+		"status": "Started",
+		"started_at":"2015-08-05T09:40:51.62Z" }`), filePerm)
+	require.NoError(t, err)
+	err = ioutil.WriteFile(filepath.Join(bundleWorkDir, dataFileName), []byte(`OK`), filePerm)
+	require.NoError(t, err)
+
+	now, err := time.Parse(time.RFC3339, "2015-08-05T09:40:51.620Z")
+	require.NoError(t, err)
+
+	bh, err := NewBundleHandler(workdir, nil, time.Millisecond, collectorTimeout, 1, BundleHandlerOptions{})
+	require.NoError(t, err)
+	bh.clock = &MockClock{now: now}
+
+	req, err := http.NewRequest(http.MethodPost, bundlesEndpoint+"/bundle/cancel", nil)
+	require.NoError(t, err)
+
+	router := mux.NewRouter()
+	router.HandleFunc(bundleCancelEndpoint, bh.Cancel)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{
+		"id": "bundle",
+		"type": "Local",
+		"status": "Canceled",
+		"started_at":"2015-08-05T09:40:51.62Z",
+		"stopped_at":"2015-08-05T10:40:51.62Z"
+	}`, rr.Body.String())
+	_, err = os.Stat(filepath.Join(bundleWorkDir, dataFileName))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestIfCancelStopsRunningBundle(t *testing.T) {
+	t.Parallel()
+
+	workdir, err := ioutil.TempDir("", "work-dir")
+	defer os.RemoveAll(workdir)
+	require.NoError(t, err)
+
+	now, err := time.Parse(time.RFC3339, "2015-08-05T08:40:51.620Z")
+	require.NoError(t, err)
+
+	collectors := []collector.Collector{
+		MockCollector{name: "collector-1", rc: ioutil.NopCloser(bytes.NewReader([]byte("OK")))},
+		MockCollector{name: "collector-2", rc: slowReader{delay: time.Millisecond}},
+		MockCollector{name: "collector-3", rc: ioutil.NopCloser(bytes.NewReader([]byte("OK")))},
+	}
+
+	bh, err := NewBundleHandler(workdir, collectors, time.Hour, time.Hour, 1, BundleHandlerOptions{})
+	require.NoError(t, err)
+	bh.clock = &MockClock{now: now}
+
+	router := mux.NewRouter()
+	router.HandleFunc(bundleEndpoint, bh.Create).Methods(http.MethodPut)
+	router.HandleFunc(bundleEndpoint, bh.Get).Methods(http.MethodGet)
+	router.HandleFunc(bundleCancelEndpoint, bh.Cancel).Methods(http.MethodPost)
+
+	req, err := http.NewRequest(http.MethodPut, bundlesEndpoint+"/bundle-0", nil)
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	req, err = http.NewRequest(http.MethodPost, bundlesEndpoint+"/bundle-0/cancel", nil)
+	require.NoError(t, err)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	bundle := Bundle{}
+	err = json.Unmarshal(rr.Body.Bytes(), &bundle)
+	require.NoError(t, err)
+	assert.Equal(t, Canceled, bundle.Status)
+	assert.Equal(t, now.Add(time.Hour), bundle.Started)
+	assert.Equal(t, now.Add(2*time.Hour), bundle.Stopped)
+	assert.Contains(t, bundle.Errors, "context canceled")
+	_, err = os.Stat(filepath.Join(workdir, "bundle-0", dataFileName))
+	assert.True(t, os.IsNotExist(err))
+
+	req, err = http.NewRequest(http.MethodPost, bundlesEndpoint+"/bundle-0/cancel", nil)
+	require.NoError(t, err)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"status":"Canceled"`)
+}
+
 func TestIfE2E_(t *testing.T) {
 	workdir, err := ioutil.TempDir("", "work-dir")
 	require.NoError(t, err)
@@ -826,7 +995,7 @@ func TestIfE2E_(t *testing.T) {
 		MockCollector{name: "collector-4", rc: slowReader{delay: time.Millisecond}},
 	}
 
-	bh, err := NewBundleHandler(workdir, collectors, time.Second, 5 * time.Millisecond)
+	bh, err := NewBundleHandler(workdir, collectors, time.Second, 5*time.Millisecond, 2, BundleHandlerOptions{})
 	require.NoError(t, err)
 	bh.clock = &MockClock{now: now}
 
@@ -849,7 +1018,7 @@ func TestIfE2E_(t *testing.T) {
 	})
 
 	t.Run("create bundle-0", func(t *testing.T) {
-		bundle, err := client.CreateBundle(context.TODO(), testServer.URL, "bundle-0")
+		bundle, err := client.CreateBundle(context.TODO(), testServer.URL, "bundle-0", BundleOptions{})
 		require.NoError(t, err)
 
 		assert.Equal(t, &Bundle{
@@ -878,12 +1047,13 @@ func TestIfE2E_(t *testing.T) {
 			Status:  Done,
 			Started: now.Add(time.Hour),
 			Stopped: now.Add(2 * time.Hour),
-			Size:    618,
 			Errors: []string{
 				"could not collect collector-1: some error",
 				"could not copy collector-4 data to zip: context deadline exceeded",
 			},
-		}, bundle)
+			ProgressPercentage: 100,
+			Collectors:         e2eCollectorReports,
+		}, withoutChecksum(t, withoutSize(t, withoutDurations(bundle))))
 	})
 
 	t.Run("get bundle-0 file and validate it", func(t *testing.T) {
@@ -896,40 +1066,36 @@ func TestIfE2E_(t *testing.T) {
 		err = client.GetFile(context.TODO(), testServer.URL, "bundle-0", f.Name())
 		require.NoError(t, err)
 
-		reader, err := zip.OpenReader(f.Name())
-		require.NoError(t, err)
-
-		require.Len(t, reader.File, 4)
-		assert.Equal(t, "collector-2", reader.File[0].Name)
-		assert.Equal(t, "collector-3", reader.File[1].Name)
-		assert.Equal(t, "collector-4", reader.File[2].Name)
-		assert.Equal(t, "summaryErrorsReport.txt", reader.File[3].Name)
-
-		rc, err := reader.File[0].Open()
+		bundle, err := client.Status(context.TODO(), testServer.URL, "bundle-0")
 		require.NoError(t, err)
-		content, err := ioutil.ReadAll(rc)
+		data, err := ioutil.ReadFile(f.Name())
 		require.NoError(t, err)
-		assert.Equal(t, "OK", string(content))
+		assert.Equal(t, fmt.Sprintf("%x", sha256.Sum256(data)), bundle.Checksum)
 
-		rc, err = reader.File[1].Open()
-		require.NoError(t, err)
-		content, err = ioutil.ReadAll(rc)
+		reader, err := zip.OpenReader(f.Name())
 		require.NoError(t, err)
-		assert.Equal(t, "some other error", string(content))
 
-		rc, err = reader.File[2].Open()
-		require.NoError(t, err)
-		content, err = ioutil.ReadAll(rc)
-		require.NoError(t, err)
-		assert.Empty(t, content)
+		// collectors run concurrently so their files are archived in the order they finish
+		require.Len(t, reader.File, 5)
+		assert.ElementsMatch(t, []string{"collector-2", "collector-3"}, []string{reader.File[0].Name, reader.File[1].Name})
+		assert.Equal(t, "collector-4", reader.File[2].Name)
+		assert.Equal(t, "summaryErrorsReport.txt", reader.File[3].Name)
+		assert.Equal(t, "manifest.json", reader.File[4].Name)
 
-		rc, err = reader.File[3].Open()
-		require.NoError(t, err)
-		content, err = ioutil.ReadAll(rc)
-		require.NoError(t, err)
+		contents := make(map[string]string)
+		for _, file := range reader.File[:4] {
+			rc, err := file.Open()
+			require.NoError(t, err)
+			content, err := ioutil.ReadAll(rc)
+			require.NoError(t, err)
+			contents[file.Name] = string(content)
+		}
+		assert.Equal(t, "OK", contents["collector-2"])
+		assert.Equal(t, "some other error", contents["collector-3"])
+		assert.Empty(t, contents["collector-4"])
 		assert.Equal(t,
 			`could not collect collector-1: some error
-could not copy collector-4 data to zip: context deadline exceeded`, string(content))
+could not copy collector-4 data to zip: context deadline exceeded`, contents["summaryErrorsReport.txt"])
 	})
 
 	t.Run("delete bundle-0", func(t *testing.T) {
@@ -945,18 +1111,21 @@ could not copy collector-4 data to zip: context deadline exceeded`, string(conte
 		body, err := ioutil.ReadAll(rr.Body)
 		require.NoError(t, err)
 
-		assert.JSONEq(t, string(jsonMarshal(Bundle{
+		bundle := &Bundle{}
+		require.NoError(t, json.Unmarshal(body, bundle))
+		assert.Equal(t, &Bundle{
 			ID:      "bundle-0",
 			Type:    Local,
 			Status:  Deleted,
 			Started: now.Add(time.Hour),
 			Stopped: now.Add(2 * time.Hour),
-			Size:    618,
 			Errors:  []string{
 				"could not collect collector-1: some error",
 				"could not copy collector-4 data to zip: context deadline exceeded",
 			},
-		})), string(body))
+			ProgressPercentage: 100,
+			Collectors:         e2eCollectorReports,
+		}, withoutChecksum(t, withoutSize(t, withoutDurations(bundle))))
 	})
 
 	t.Run("list bundles", func(t *testing.T) {
@@ -968,21 +1137,128 @@ could not copy collector-4 data to zip: context deadline exceeded`, string(conte
 
 		require.NoError(t, err)
 		assert.Equal(t, http.StatusOK, rr.Code)
-		assert.JSONEq(t, string(jsonMarshal([]Bundle{{
+		var bundles []*Bundle
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &bundles))
+		require.Len(t, bundles, 1)
+		assert.Equal(t, &Bundle{
 			ID:      "bundle-0",
 			Type:    Local,
 			Status:  Deleted,
 			Started: now.Add(time.Hour),
 			Stopped: now.Add(2 * time.Hour),
-			Size:    618,
 			Errors:  []string{
 				"could not collect collector-1: some error",
 				"could not copy collector-4 data to zip: context deadline exceeded",
 			},
-		}})), rr.Body.String())
+			ProgressPercentage: 100,
+			Collectors:         e2eCollectorReports,
+		}, withoutChecksum(t, withoutSize(t, withoutDurations(bundles[0]))))
 	})
 }
 
+var e2eCollectorReports = []collectorReport{
+	{Name: "collector-1", Status: CollectorFailed},
+	{Name: "collector-2", Status: CollectorDone, Size: 2},
+	{Name: "collector-3", Status: CollectorFailed, Size: 16},
+	{Name: "collector-4", Status: CollectorFailed},
+}
+
+// withoutDurations clears collectors' durations so bundle could be compared
+func withoutDurations(bundle *Bundle) *Bundle {
+	for i := range bundle.Collectors {
+		bundle.Collectors[i].Duration = ""
+	}
+	return bundle
+}
+
+// withoutSize clears bundle size so bundle could be compared. Size depends on manifest content
+// which contains collection times.
+func withoutSize(t *testing.T, bundle *Bundle) *Bundle {
+	assert.NotZero(t, bundle.Size)
+	bundle.Size = 0
+	return bundle
+}
+
+// withoutChecksum clears bundle checksum so bundle could be compared. Checksum depends on manifest content
+// which contains collection times.
+func withoutChecksum(t *testing.T, bundle *Bundle) *Bundle {
+	assert.Len(t, bundle.Checksum, 64)
+	bundle.Checksum = ""
+	return bundle
+}
+
+func TestIfBundleReportsCollectorsProgress(t *testing.T) {
+	t.Parallel()
+
+	workdir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workdir)
+
+	now, err := time.Parse(time.RFC3339, "2015-08-05T08:40:51.620Z")
+	require.NoError(t, err)
+
+	unblock := make(chan struct{})
+	collectors := []collector.Collector{
+		MockCollector{name: "collector-1", rc: ioutil.NopCloser(bytes.NewReader([]byte("OK")))},
+		MockCollector{name: "collector-2", rc: &blockingReader{unblock: unblock}},
+	}
+
+	bh, err := NewBundleHandler(workdir, collectors, time.Hour, time.Hour, 1, BundleHandlerOptions{})
+	require.NoError(t, err)
+	bh.clock = &MockClock{now: now}
+
+	router := mux.NewRouter()
+	router.HandleFunc(bundleEndpoint, bh.Create).Methods(http.MethodPut)
+	router.HandleFunc(bundleEndpoint, bh.Get).Methods(http.MethodGet)
+
+	req, err := http.NewRequest(http.MethodPut, bundlesEndpoint+"/bundle-0", nil)
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	get := func() *Bundle {
+		req, err := http.NewRequest(http.MethodGet, bundlesEndpoint+"/bundle-0", nil)
+		require.NoError(t, err)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+		bundle := &Bundle{}
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), bundle))
+		return withoutDurations(bundle)
+	}
+
+	var bundle *Bundle
+	for { // busy wait for the second collector to start
+		bundle = get()
+		if len(bundle.Collectors) == 2 && bundle.Collectors[1].Status == CollectorRunning {
+			break
+		}
+	}
+
+	assert.Equal(t, InProgress, bundle.Status)
+	assert.Equal(t, float32(50), bundle.ProgressPercentage)
+	assert.Equal(t, []collectorReport{
+		{Name: "collector-1", Status: CollectorDone, Size: 2},
+		{Name: "collector-2", Status: CollectorRunning},
+	}, bundle.Collectors)
+
+	close(unblock)
+
+	for { // busy wait for bundle
+		bundle = get()
+		if bundle.Status == Done {
+			break
+		}
+	}
+
+	assert.Equal(t, float32(100), bundle.ProgressPercentage)
+	assert.Equal(t, []collectorReport{
+		{Name: "collector-1", Status: CollectorDone, Size: 2},
+		{Name: "collector-2", Status: CollectorDone, Size: 4},
+	}, bundle.Collectors)
+}
+
 func TestBundleHandlerWorkDirIsCreatedIfNotExists(t *testing.T) {
 	t.Parallel()
 
@@ -991,7 +1267,7 @@ func TestBundleHandlerWorkDirIsCreatedIfNotExists(t *testing.T) {
 	err = os.RemoveAll(workdir)
 	require.NoError(t, err)
 
-	_, err = NewBundleHandler(workdir, nil, time.Millisecond, collectorTimeout)
+	_, err = NewBundleHandler(workdir, nil, time.Millisecond, collectorTimeout, 1, BundleHandlerOptions{})
 	require.NoError(t, err)
 
 	assert.DirExists(t, workdir)
@@ -1004,48 +1280,837 @@ func TestBundleHandlerWorkDirInitFailsWhenFileExists(t *testing.T) {
 	workdir, err := ioutil.TempFile("", "work-dir")
 	require.NoError(t, err)
 
-	_, err = NewBundleHandler(workdir.Name(), nil, time.Millisecond, collectorTimeout)
+	_, err = NewBundleHandler(workdir.Name(), nil, time.Millisecond, collectorTimeout, 1, BundleHandlerOptions{})
 	assert.Error(t, err)
 }
 
-// MockClock is a monotonic clock. Every call to Now() adds one hour
-type MockClock struct {
-	now time.Time
-}
+func TestBundleHandlerFailsWhenConcurrencyIsInvalid(t *testing.T) {
+	t.Parallel()
 
-func (m *MockClock) Now() time.Time {
-	m.now = m.now.Add(time.Hour)
-	return m.now
-}
+	workdir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workdir)
 
-type MockCollector struct {
-	name     string
-	optional bool
-	rc       io.ReadCloser
-	err      error
+	_, err = NewBundleHandler(workdir, nil, time.Millisecond, collectorTimeout, 0, BundleHandlerOptions{})
+	assert.EqualError(t, err, "collectors concurrency must be greater than 0, got 0")
 }
 
-func (m MockCollector) Name() string {
-	return m.name
+func TestCollectAllRunsCollectorsConcurrently(t *testing.T) {
+	t.Parallel()
+
+	workdir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workdir)
+
+	dataFile, err := os.Create(filepath.Join(workdir, dataFileName))
+	require.NoError(t, err)
+
+	// every collector waits for all others to start so they could only finish when run concurrently
+	started := &sync.WaitGroup{}
+	started.Add(3)
+	collectors := []collector.Collector{
+		barrierCollector{name: "collector-1", started: started},
+		barrierCollector{name: "collector-2", started: started},
+		barrierCollector{name: "collector-3", started: started},
+	}
+
+	done := make(chan []string)
+	progress := newBundleProgress(collectors, nil)
+	go collectAll(context.Background(), done, dataFile, workdir, collectors, node{}, BundleOptions{}, nil, SizeLimits{}, time.Second, 3, progress)
+	assert.Empty(t, <-done)
+
+	for i, r := range progress.snapshot() {
+		assert.Equal(t, collectors[i].Name(), r.Name)
+		assert.Equal(t, CollectorDone, r.Status)
+		assert.EqualValues(t, len(r.Name), r.Size)
+		assert.NotEmpty(t, r.Duration)
+	}
+
+	reader, err := zip.OpenReader(dataFile.Name())
+	require.NoError(t, err)
+	defer reader.Close()
+
+	// files are archived in the order collectors finish
+	require.Len(t, reader.File, 4)
+	var names []string
+	for _, f := range reader.File[:3] {
+		names = append(names, f.Name)
+		rc, err := f.Open()
+		require.NoError(t, err)
+		content, err := ioutil.ReadAll(rc)
+		require.NoError(t, err)
+		assert.Equal(t, f.Name, string(content))
+	}
+	assert.ElementsMatch(t, []string{"collector-1", "collector-2", "collector-3"}, names)
+
+	files, err := ioutil.ReadDir(workdir)
+	require.NoError(t, err)
+	require.Len(t, files, 1, "spool files should be removed")
+	assert.Equal(t, dataFileName, files[0].Name())
 }
 
-func (m MockCollector) Optional() bool {
-	return m.optional
+// gateCollector returns its name when it's released
+type gateCollector struct {
+	name    string
+	release <-chan struct{}
 }
 
-func (m MockCollector) Collect(ctx context.Context) (io.ReadCloser, error) {
-	return diagio.ReadCloserWithContext(ctx, m.rc), m.err
+func (g gateCollector) Name() string {
+	return g.name
 }
 
-type slowReader struct {
-	delay time.Duration
+func (g gateCollector) Optional() bool {
+	return false
 }
 
-func (s slowReader) Read(p []byte) (n int, err error) {
-	time.Sleep(s.delay)
-	return 0, nil
+func (g gateCollector) Collect(ctx context.Context) (io.ReadCloser, error) {
+	select {
+	case <-g.release:
+		return ioutil.NopCloser(strings.NewReader(g.name)), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
 }
 
-func (s slowReader) Close() error {
-	return nil
+func TestCollectAllArchivesFilesWithoutWaitingForSlowerCollectors(t *testing.T) {
+	t.Parallel()
+
+	workdir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workdir)
+
+	dataFile, err := os.Create(filepath.Join(workdir, dataFileName))
+	require.NoError(t, err)
+
+	release := make(chan struct{})
+	collectors := []collector.Collector{
+		gateCollector{name: "slow", release: release},
+		MockCollector{name: "fast", rc: ioutil.NopCloser(strings.NewReader("fast"))},
+	}
+
+	done := make(chan []string)
+	progress := newBundleProgress(collectors, nil)
+	go collectAll(context.Background(), done, dataFile, workdir, collectors, node{}, BundleOptions{}, nil, SizeLimits{}, 5*time.Second, 2, progress)
+
+	// the spool of the fast collector is removed once it's archived while the slow one is still running
+	archived := false
+	for i := 0; i < 1000 && !archived; i++ {
+		files, err := ioutil.ReadDir(workdir)
+		require.NoError(t, err)
+		archived = progress.snapshot()[1].Status == CollectorDone && len(files) == 1
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	assert.Empty(t, <-done)
+	assert.True(t, archived, "fast collector output should not wait for the slow collector")
+
+	reader, err := zip.OpenReader(dataFile.Name())
+	require.NoError(t, err)
+	defer reader.Close()
+	require.Len(t, reader.File, 3)
+	assert.Equal(t, "fast", reader.File[0].Name)
+	assert.Equal(t, "slow", reader.File[1].Name)
+
+	rc, err := reader.File[2].Open()
+	require.NoError(t, err)
+	m := manifest{}
+	require.NoError(t, json.NewDecoder(rc).Decode(&m))
+	require.Len(t, m.Entries, 2)
+	assert.Equal(t, "slow", m.Entries[0].Collector, "manifest should list collectors in their order")
+	assert.Equal(t, "fast", m.Entries[1].Collector)
+}
+
+func TestCollectAllWritesManifest(t *testing.T) {
+	t.Parallel()
+
+	workdir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workdir)
+
+	dataFile, err := os.Create(filepath.Join(workdir, dataFileName))
+	require.NoError(t, err)
+
+	collectors := []collector.Collector{
+		MockCollector{name: "collector-1", err: fmt.Errorf("some error")},
+		MockCollector{name: "collector-2", rc: ioutil.NopCloser(bytes.NewReader([]byte("OK")))},
+		MockCollector{name: "collector-3", err: fmt.Errorf("some other error"), optional: true},
+	}
+
+	done := make(chan []string)
+	go collectAll(context.Background(), done, dataFile, workdir, collectors, node{IP: net.ParseIP("192.0.2.1"), Role: "agent"}, BundleOptions{}, nil, SizeLimits{}, time.Second, 2, newBundleProgress(collectors, nil))
+	assert.Equal(t, []string{"could not collect collector-1: some error"}, <-done)
+
+	reader, err := zip.OpenReader(dataFile.Name())
+	require.NoError(t, err)
+	defer reader.Close()
+
+	require.Len(t, reader.File, 4)
+	assert.Equal(t, manifestFileName, reader.File[3].Name)
+	rc, err := reader.File[3].Open()
+	require.NoError(t, err)
+	m := manifest{}
+	require.NoError(t, json.NewDecoder(rc).Decode(&m))
+
+	require.Len(t, m.Entries, 3)
+	for _, e := range m.Entries {
+		assert.False(t, e.Started.IsZero())
+		assert.False(t, e.Stopped.Before(e.Started))
+	}
+	assert.Equal(t, manifestEntry{
+		Collector: "collector-1",
+		NodeIP:    "192.0.2.1",
+		NodeRole:  "agent",
+		Failed:    true,
+		Err:       "could not collect collector-1: some error",
+	}, withoutTimes(m.Entries[0]))
+	assert.Equal(t, manifestEntry{
+		Path:      "collector-2",
+		Collector: "collector-2",
+		NodeIP:    "192.0.2.1",
+		NodeRole:  "agent",
+		Size:      2,
+		SHA256:    "565339bc4d33d72817b583024112eb7f5cdf3e5eef0252d6ec1b9c9a94e12bb3", // sha256 of "OK"
+	}, withoutTimes(m.Entries[1]))
+	assert.Equal(t, manifestEntry{
+		Path:      "collector-3",
+		Collector: "collector-3",
+		NodeIP:    "192.0.2.1",
+		NodeRole:  "agent",
+		Size:      16,
+		SHA256:    "ae9764e012b144cb1df5a4709f07e8839892a832f012114b6dbfe59a9b833270", // sha256 of "some other error"
+		Optional:  true,
+		Failed:    true,
+		Err:       "could not collect collector-3: some other error",
+	}, withoutTimes(m.Entries[2]))
+}
+
+func TestCollectAllRedactsSensitiveData(t *testing.T) {
+	t.Parallel()
+
+	workdir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workdir)
+
+	dataFile, err := os.Create(filepath.Join(workdir, dataFileName))
+	require.NoError(t, err)
+
+	collectors := []collector.Collector{
+		MockCollector{name: "ps", rc: ioutil.NopCloser(strings.NewReader("java -Dpassword=hunter2\nsleep 10\n"))},
+		MockCollector{name: "state", rc: ioutil.NopCloser(strings.NewReader(`{"token":"abc","secret":"def"}`))},
+		MockCollector{name: "clean", rc: ioutil.NopCloser(strings.NewReader("OK"))},
+	}
+
+	redactor, err := redact.New(redact.DefaultRules)
+	require.NoError(t, err)
+
+	done := make(chan []string)
+	go collectAll(context.Background(), done, dataFile, workdir, collectors, node{}, BundleOptions{}, redactor, SizeLimits{}, time.Second, 2,
+		newBundleProgress(collectors, nil))
+	assert.Empty(t, <-done)
+
+	b, err := ioutil.ReadFile(dataFile.Name())
+	require.NoError(t, err)
+	files := readZip(t, bytes.NewBuffer(b))
+
+	m := manifest{}
+	require.NoError(t, json.Unmarshal([]byte(files[manifestFileName]), &m))
+	delete(files, manifestFileName)
+
+	assert.Equal(t, map[string]string{
+		"ps":    "java -Dpassword=[REDACTED]\nsleep 10\n",
+		"state": `{"token":"[REDACTED]","secret":"[REDACTED]"}`,
+		"clean": "OK",
+	}, files)
+
+	require.Len(t, m.Entries, 3)
+	assert.Equal(t, 1, m.Entries[0].Redactions)
+	assert.Equal(t, 2, m.Entries[1].Redactions)
+	assert.Equal(t, 0, m.Entries[2].Redactions)
+	assert.EqualValues(t, len(files["ps"]), m.Entries[0].Size)
+}
+
+// multiCollector produces a file for every entry of files and fails to open files with error content
+type multiCollector struct {
+	MockCollector
+	files map[string]string
+}
+
+func (m multiCollector) CollectOutputs(ctx context.Context, window collector.TimeWindow) ([]collector.Output, error) {
+	var outputs []collector.Output
+	for _, name := range sortedKeys(m.files) {
+		content := m.files[name]
+		outputs = append(outputs, collector.Output{Name: name, Open: func(context.Context) (io.ReadCloser, error) {
+			if content == "error" {
+				return nil, fmt.Errorf("could not open")
+			}
+			return ioutil.NopCloser(strings.NewReader(content)), nil
+		}})
+	}
+	return outputs, nil
+}
+
+func TestCollectAllWritesEveryFileOfMultiCollector(t *testing.T) {
+	t.Parallel()
+
+	workdir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workdir)
+
+	dataFile, err := os.Create(filepath.Join(workdir, dataFileName))
+	require.NoError(t, err)
+
+	collectors := []collector.Collector{
+		multiCollector{MockCollector: MockCollector{name: "metrics"}, files: map[string]string{
+			"metrics.prom": "up 1\n",
+			"metrics.json": `{"families":[]}`,
+		}},
+		multiCollector{MockCollector: MockCollector{name: "logs"}, files: map[string]string{
+			"logs/a.log": "OK",
+			"logs/b.log": "error",
+		}},
+	}
+
+	progress := newBundleProgress(collectors, nil)
+	done := make(chan []string)
+	go collectAll(context.Background(), done, dataFile, workdir, collectors, node{}, BundleOptions{}, nil, SizeLimits{}, time.Second, 2, progress)
+	assert.Equal(t, []string{"could not collect logs/b.log: could not open"}, <-done)
+
+	b, err := ioutil.ReadFile(dataFile.Name())
+	require.NoError(t, err)
+	files := readZip(t, bytes.NewBuffer(b))
+
+	m := manifest{}
+	require.NoError(t, json.Unmarshal([]byte(files[manifestFileName]), &m))
+	delete(files, manifestFileName)
+	delete(files, summaryErrorsReportFileName)
+
+	assert.Equal(t, map[string]string{
+		"metrics.json": `{"families":[]}`,
+		"metrics.prom": "up 1\n",
+		"logs/a.log":   "OK",
+	}, files)
+
+	require.Len(t, m.Entries, 4)
+	var paths []string
+	for _, e := range m.Entries {
+		paths = append(paths, e.Path)
+	}
+	assert.Equal(t, []string{"metrics.json", "metrics.prom", "logs/a.log", ""}, paths)
+	assert.Equal(t, "metrics", m.Entries[1].Collector)
+	assert.EqualValues(t, 5, m.Entries[1].Size)
+	assert.Equal(t, manifestEntry{
+		Collector: "logs",
+		Failed:    true,
+		Err:       "could not collect logs/b.log: could not open",
+	}, withoutTimes(m.Entries[3]))
+
+	reports := progress.snapshot()
+	assert.EqualValues(t, 20, reports[0].Size)
+	assert.Equal(t, CollectorDone, reports[0].Status)
+	assert.Equal(t, CollectorFailed, reports[1].Status)
+}
+
+func withoutTimes(e manifestEntry) manifestEntry {
+	e.Started = time.Time{}
+	e.Stopped = time.Time{}
+	return e
+}
+
+func TestCollectAllWithSingleWorkerReportsTimeouts(t *testing.T) {
+	t.Parallel()
+
+	workdir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workdir)
+
+	dataFile, err := os.Create(filepath.Join(workdir, dataFileName))
+	require.NoError(t, err)
+
+	started := &sync.WaitGroup{}
+	started.Add(2)
+	collectors := []collector.Collector{
+		barrierCollector{name: "collector-1", started: started},
+		barrierCollector{name: "collector-2", started: started},
+	}
+
+	done := make(chan []string)
+	progress := newBundleProgress(collectors, nil)
+	go collectAll(context.Background(), done, dataFile, workdir, collectors, node{}, BundleOptions{}, nil, SizeLimits{}, time.Millisecond, 1, progress)
+	assert.Equal(t, []string{"could not collect collector-1: context deadline exceeded"}, <-done)
+	assert.Equal(t, []collectorReport{
+		{Name: "collector-1", Status: CollectorFailed},
+		{Name: "collector-2", Status: CollectorDone, Size: int64(len("collector-2"))},
+	}, withoutDurations(&Bundle{Collectors: progress.snapshot()}).Collectors)
+}
+
+// failingWriter fails every write
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, fmt.Errorf("disk is full")
+}
+
+// failingReader fails every read
+type failingReader struct{}
+
+func (failingReader) Read(p []byte) (int, error) {
+	return 0, fmt.Errorf("connection reset")
+}
+
+func (failingWriter) Close() error {
+	return nil
+}
+
+func TestCollectAllReportsArchiveErrorsOfFailedFiles(t *testing.T) {
+	t.Parallel()
+
+	workdir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workdir)
+
+	// random data is not compressed so it's flushed to the failing writer
+	data := make([]byte, 64*1024)
+	_, err = rand.New(rand.NewSource(1)).Read(data)
+	require.NoError(t, err)
+	// reading fails after all data is read, so the file is spooled with an error
+	rc := ioutil.NopCloser(io.MultiReader(bytes.NewReader(data), failingReader{}))
+	collectors := []collector.Collector{MockCollector{name: "collector", rc: rc}}
+
+	done := make(chan []string)
+	progress := newBundleProgress(collectors, nil)
+	go collectAll(context.Background(), done, failingWriter{}, workdir, collectors, node{}, BundleOptions{}, nil, SizeLimits{}, time.Second, 1, progress)
+	errors := <-done
+	require.NotEmpty(t, errors)
+	assert.Contains(t, errors[0], "could not copy collector data to zip: connection reset")
+	assert.Contains(t, errors[0], "could not copy collector data to archive: disk is full")
+	assert.Equal(t, CollectorFailed, progress.snapshot()[0].Status)
+}
+
+// MockClock is a monotonic clock. Every call to Now() adds one hour
+type MockClock struct {
+	now time.Time
+}
+
+func (m *MockClock) Now() time.Time {
+	m.now = m.now.Add(time.Hour)
+	return m.now
+}
+
+type MockCollector struct {
+	name     string
+	optional bool
+	rc       io.ReadCloser
+	err      error
+}
+
+func (m MockCollector) Name() string {
+	return m.name
+}
+
+func (m MockCollector) Optional() bool {
+	return m.optional
+}
+
+func (m MockCollector) Collect(ctx context.Context) (io.ReadCloser, error) {
+	return diagio.ReadCloserWithContext(ctx, m.rc), m.err
+}
+
+type slowReader struct {
+	delay time.Duration
+}
+
+func (s slowReader) Read(p []byte) (n int, err error) {
+	time.Sleep(s.delay)
+	return 0, nil
+}
+
+func (s slowReader) Close() error {
+	return nil
+}
+
+// barrierCollector returns its name as collected data once all collectors sharing
+// the same started group are running
+type barrierCollector struct {
+	name    string
+	started *sync.WaitGroup
+}
+
+func (b barrierCollector) Name() string {
+	return b.name
+}
+
+func (b barrierCollector) Optional() bool {
+	return false
+}
+
+func (b barrierCollector) Collect(ctx context.Context) (io.ReadCloser, error) {
+	b.started.Done()
+
+	allStarted := make(chan struct{})
+	go func() {
+		b.started.Wait()
+		close(allStarted)
+	}()
+
+	select {
+	case <-allStarted:
+		return ioutil.NopCloser(bytes.NewReader([]byte(b.name))), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// blockingReader returns some data once unblock channel is closed
+type blockingReader struct {
+	unblock <-chan struct{}
+	read    bool
+}
+
+func (b *blockingReader) Read(p []byte) (n int, err error) {
+	if b.read {
+		return 0, io.EOF
+	}
+	<-b.unblock
+	b.read = true
+	return copy(p, "DONE"), nil
+}
+
+func (b *blockingReader) Close() error {
+	return nil
+}
+
+func TestIfGetFileSupportsResumingWithChecksumETag(t *testing.T) {
+	t.Parallel()
+	workdir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workdir)
+
+	checksum := "f2ca1bb6c7e907d06dafe4687e579fce76b37e4e93b7605022da52e6ccc26fd2"
+	writeBundle(t, workdir, Bundle{ID: "bundle-0", Status: Done, Checksum: checksum}, make([]byte, 10))
+
+	bh, err := NewBundleHandler(workdir, nil, time.Millisecond, collectorTimeout, 1, BundleHandlerOptions{})
+	require.NoError(t, err)
+
+	router := mux.NewRouter()
+	router.HandleFunc(bundleFileEndpoint, bh.GetFile)
+
+	req, err := http.NewRequest(http.MethodGet, bundlesEndpoint+"/bundle-0/file", nil)
+	require.NoError(t, err)
+	req.Header.Set("Range", "bytes=4-")
+	req.Header.Set("If-Range", `"`+checksum+`"`)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusPartialContent, rr.Code)
+	assert.Equal(t, `"`+checksum+`"`, rr.Header().Get("ETag"))
+	assert.Equal(t, "bytes 4-9/10", rr.Header().Get("Content-Range"))
+	assert.Len(t, rr.Body.Bytes(), 6)
+
+	// bundle file was changed so the whole file is sent
+	req.Header.Set("If-Range", `"other"`)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Len(t, rr.Body.Bytes(), 10)
+}
+
+func TestIfCreateRunsOnlySelectedCollectors(t *testing.T) {
+	t.Parallel()
+	workdir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workdir)
+
+	collectors := []collector.Collector{
+		MockCollector{name: "collector-1", rc: ioutil.NopCloser(bytes.NewReader([]byte("1")))},
+		MockCollector{name: "collector-2", rc: ioutil.NopCloser(bytes.NewReader([]byte("2")))},
+		MockCollector{name: "other", rc: ioutil.NopCloser(bytes.NewReader([]byte("3")))},
+	}
+
+	bh, err := NewBundleHandler(workdir, collectors, time.Second, time.Second, 1, BundleHandlerOptions{})
+	require.NoError(t, err)
+
+	router := mux.NewRouter()
+	router.HandleFunc(bundleEndpoint, bh.Create).Methods(http.MethodPut)
+	router.HandleFunc(bundleEndpoint, bh.Get).Methods(http.MethodGet)
+
+	req, err := http.NewRequest(http.MethodPut, bundlesEndpoint+"/bundle-0",
+		strings.NewReader(`{"type": "Local", "collectors": {"include": ["collector-*"], "exclude": ["collector-2"]}}`))
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	bundle := &Bundle{}
+	for !bundle.IsFinished() {
+		req, err := http.NewRequest(http.MethodGet, bundlesEndpoint+"/bundle-0", nil)
+		require.NoError(t, err)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), bundle))
+	}
+
+	assert.Equal(t, Done, bundle.Status)
+	assert.Equal(t, []collectorReport{{Name: "collector-1", Status: CollectorDone, Size: 1}},
+		withoutDurations(bundle).Collectors)
+
+	reader, err := zip.OpenReader(filepath.Join(workdir, "bundle-0", dataFileName))
+	require.NoError(t, err)
+	defer reader.Close()
+	require.Len(t, reader.File, 2)
+	assert.Equal(t, "collector-1", reader.File[0].Name)
+	assert.Equal(t, manifestFileName, reader.File[1].Name)
+}
+
+// windowCollector records the window it was asked to collect
+type windowCollector struct {
+	MockCollector
+	windows chan collector.TimeWindow
+}
+
+func (m windowCollector) CollectWindow(ctx context.Context, window collector.TimeWindow) (io.ReadCloser, error) {
+	m.windows <- window
+	return m.Collect(ctx)
+}
+
+func TestIfCreatePassesTimeWindowToCollectors(t *testing.T) {
+	t.Parallel()
+	workdir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workdir)
+
+	windows := make(chan collector.TimeWindow, 1)
+	collectors := []collector.Collector{
+		windowCollector{
+			MockCollector: MockCollector{name: "log", rc: ioutil.NopCloser(bytes.NewReader([]byte("log")))},
+			windows:       windows,
+		},
+		MockCollector{name: "other", rc: ioutil.NopCloser(bytes.NewReader([]byte("other")))},
+	}
+
+	bh, err := NewBundleHandler(workdir, collectors, time.Second, time.Second, 1, BundleHandlerOptions{})
+	require.NoError(t, err)
+
+	router := mux.NewRouter()
+	router.HandleFunc(bundleEndpoint, bh.Create).Methods(http.MethodPut)
+	router.HandleFunc(bundleEndpoint, bh.Get).Methods(http.MethodGet)
+
+	req, err := http.NewRequest(http.MethodPut, bundlesEndpoint+"/bundle-0",
+		strings.NewReader(`{"since": "2019-10-01T12:00:00Z", "until": "2019-10-01T13:00:00Z"}`))
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	bundle := &Bundle{}
+	for !bundle.IsFinished() {
+		req, err := http.NewRequest(http.MethodGet, bundlesEndpoint+"/bundle-0", nil)
+		require.NoError(t, err)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), bundle))
+	}
+
+	since := time.Date(2019, 10, 1, 12, 0, 0, 0, time.UTC)
+	until := since.Add(time.Hour)
+	assert.Equal(t, Done, bundle.Status)
+	assert.True(t, since.Equal(*bundle.Since))
+	assert.True(t, until.Equal(*bundle.Until))
+	assert.Equal(t, collector.TimeWindow{Since: since, Until: until}, <-windows)
+}
+
+// journalCollector records journal options it was asked to collect with
+type journalCollector struct {
+	MockCollector
+	options chan collector.JournalOptions
+}
+
+func (m journalCollector) CollectJournal(ctx context.Context, window collector.TimeWindow,
+	options collector.JournalOptions) (io.ReadCloser, error) {
+	m.options <- options
+	return m.Collect(ctx)
+}
+
+func TestIfCreatePassesJournalOptionsToJournalCollectors(t *testing.T) {
+	t.Parallel()
+	workdir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workdir)
+
+	options := make(chan collector.JournalOptions, 1)
+	collectors := []collector.Collector{
+		journalCollector{
+			MockCollector: MockCollector{name: "unit", rc: ioutil.NopCloser(strings.NewReader(`{"MESSAGE":"OK"}`))},
+			options:       options,
+		},
+	}
+
+	bh, err := NewBundleHandler(workdir, collectors, time.Second, time.Second, 1, BundleHandlerOptions{})
+	require.NoError(t, err)
+
+	router := mux.NewRouter()
+	router.HandleFunc(bundleEndpoint, bh.Create).Methods(http.MethodPut)
+
+	req, err := http.NewRequest(http.MethodPut, bundlesEndpoint+"/bundle-0", strings.NewReader(`{"journal": {"format": "json"}}`))
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	assert.Equal(t, collector.JournalOptions{Format: collector.JSON}, <-options)
+}
+
+func TestIfCreateReturns400WhenJournalFormatIsUnknown(t *testing.T) {
+	t.Parallel()
+	workdir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workdir)
+
+	bh, err := NewBundleHandler(workdir, nil, time.Second, time.Second, 1, BundleHandlerOptions{})
+	require.NoError(t, err)
+
+	req, err := http.NewRequest(http.MethodPut, bundlesEndpoint+"/bundle-0", strings.NewReader(`{"journal": {"format": "xml"}}`))
+	require.NoError(t, err)
+
+	router := mux.NewRouter()
+	router.HandleFunc(bundleEndpoint, bh.Create)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.JSONEq(t, `{"code":400,"error":"could not parse request body unknown journal format \"xml\", must be text or json"}`,
+		rr.Body.String())
+	assert.False(t, bh.bundleExists("bundle-0"))
+}
+
+func TestIfCreateReturns400WhenTimeWindowIsInvalid(t *testing.T) {
+	t.Parallel()
+	workdir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workdir)
+
+	bh, err := NewBundleHandler(workdir, nil, time.Second, time.Second, 1, BundleHandlerOptions{})
+	require.NoError(t, err)
+
+	req, err := http.NewRequest(http.MethodPut, bundlesEndpoint+"/bundle-0",
+		strings.NewReader(`{"since": "2019-10-01T13:00:00Z", "until": "2019-10-01T12:00:00Z"}`))
+	require.NoError(t, err)
+
+	router := mux.NewRouter()
+	router.HandleFunc(bundleEndpoint, bh.Create)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.JSONEq(t, `{"code":400,"error":"could not parse request body until 2019-10-01T12:00:00Z is before since 2019-10-01T13:00:00Z"}`,
+		rr.Body.String())
+	assert.False(t, bh.bundleExists("bundle-0"))
+}
+
+func TestIfCreateReturns400WhenCollectorPatternIsInvalid(t *testing.T) {
+	t.Parallel()
+	workdir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workdir)
+
+	bh, err := NewBundleHandler(workdir, nil, time.Second, time.Second, 1, BundleHandlerOptions{})
+	require.NoError(t, err)
+
+	req, err := http.NewRequest(http.MethodPut, bundlesEndpoint+"/bundle-0",
+		strings.NewReader(`{"collectors": {"exclude": ["["]}}`))
+	require.NoError(t, err)
+
+	router := mux.NewRouter()
+	router.HandleFunc(bundleEndpoint, bh.Create)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.JSONEq(t, `{"code":400,"error":"could not parse request body invalid collector pattern \"[\": syntax error in pattern"}`,
+		rr.Body.String())
+	assert.False(t, bh.bundleExists("bundle-0"))
+}
+
+func TestIfCreateWritesBundleInRequestedFormat(t *testing.T) {
+	t.Parallel()
+	workdir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workdir)
+
+	collectors := []collector.Collector{
+		MockCollector{name: "collector-1", rc: ioutil.NopCloser(bytes.NewReader([]byte("1")))},
+		MockCollector{name: "collector-2", rc: ioutil.NopCloser(bytes.NewReader([]byte("2")))},
+	}
+
+	bh, err := NewBundleHandler(workdir, collectors, time.Second, time.Second, 1, BundleHandlerOptions{})
+	require.NoError(t, err)
+
+	router := mux.NewRouter()
+	router.HandleFunc(bundleEndpoint, bh.Create).Methods(http.MethodPut)
+	router.HandleFunc(bundleEndpoint, bh.Get).Methods(http.MethodGet)
+	router.HandleFunc(bundleFileEndpoint, bh.GetFile).Methods(http.MethodGet)
+
+	req, err := http.NewRequest(http.MethodPut, bundlesEndpoint+"/bundle-0", strings.NewReader(`{"format": "tar.gz"}`))
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	bundle := &Bundle{}
+	for !bundle.IsFinished() {
+		req, err := http.NewRequest(http.MethodGet, bundlesEndpoint+"/bundle-0", nil)
+		require.NoError(t, err)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), bundle))
+	}
+	assert.Equal(t, Done, bundle.Status)
+	assert.Equal(t, archive.TarGz, bundle.Format)
+
+	req, err = http.NewRequest(http.MethodGet, bundlesEndpoint+"/bundle-0/file", nil)
+	require.NoError(t, err)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/gzip, application/octet-stream", rr.Header().Get("Content-Type"))
+	assert.Equal(t, "attachment; filename=bundle-0.tar.gz", rr.Header().Get("Content-disposition"))
+
+	path := filepath.Join(workdir, "bundle-0", dataFileName)
+	format, err := archive.DetectFormat(path)
+	require.NoError(t, err)
+	assert.Equal(t, archive.TarGz, format)
+
+	var names []string
+	require.NoError(t, archive.Walk(path, func(h archive.Header, r io.Reader) error {
+		names = append(names, h.Name)
+		return nil
+	}))
+	assert.Equal(t, []string{"collector-1", "collector-2", manifestFileName}, names)
+
+	problems, err := VerifyBundle(path)
+	require.NoError(t, err)
+	assert.Empty(t, problems)
+}
+
+func TestIfCreateReturns400WhenFormatIsUnknown(t *testing.T) {
+	t.Parallel()
+	workdir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workdir)
+
+	bh, err := NewBundleHandler(workdir, nil, time.Second, time.Second, 1, BundleHandlerOptions{})
+	require.NoError(t, err)
+
+	req, err := http.NewRequest(http.MethodPut, bundlesEndpoint+"/bundle-0", strings.NewReader(`{"format": "rar"}`))
+	require.NoError(t, err)
+
+	router := mux.NewRouter()
+	router.HandleFunc(bundleEndpoint, bh.Create)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.JSONEq(t, `{"code":400,"error":"could not parse request body unknown format \"rar\", must be zip, tar.gz or tar.zst"}`,
+		rr.Body.String())
+	assert.False(t, bh.bundleExists("bundle-0"))
 }
@@ -0,0 +1,57 @@
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// loadState reads state of the bundle with given id directly from the work dir
+func (r *BundleRegistry) loadState(workDir string, id string) (Bundle, error) {
+	r.state.RLock()
+	defer r.state.RUnlock()
+	return readBundleState(workDir, id)
+}
+
+func readBundleState(workDir string, id string) (Bundle, error) {
+	bundle := Bundle{}
+	raw, err := ioutil.ReadFile(filepath.Join(workDir, id, stateFileName))
+	if err != nil {
+		return bundle, err
+	}
+	err = json.Unmarshal(raw, &bundle)
+	return bundle, err
+}
+
+// writeState replaces state of the bundle and returns the written state
+func (r *BundleRegistry) writeState(workDir string, bundle Bundle) ([]byte, error) {
+	r.state.Lock()
+	defer r.state.Unlock()
+	raw := jsonMarshal(bundle)
+	return raw, ioutil.WriteFile(filepath.Join(workDir, bundle.ID, stateFileName), raw, filePerm)
+}
+
+// updateState changes the current state of the bundle with given id and writes it back. State is not
+// written when update fails and its error is returned as is. Every change based on previously read state must
+// be done with it, so changes made in the meantime e.g., by deleting the bundle are not overwritten.
+func (r *BundleRegistry) updateState(workDir string, id string, update func(*Bundle) error) (Bundle, error) {
+	r.state.Lock()
+	defer r.state.Unlock()
+
+	bundle, err := readBundleState(workDir, id)
+	if os.IsNotExist(err) {
+		return bundle, err
+	}
+	if err != nil {
+		return bundle, fmt.Errorf("could not read state of bundle %s: %s", id, err)
+	}
+	if err := update(&bundle); err != nil {
+		return bundle, err
+	}
+	if err := ioutil.WriteFile(filepath.Join(workDir, id, stateFileName), jsonMarshal(bundle), filePerm); err != nil {
+		return bundle, fmt.Errorf("could not update state file %s: %s", id, err)
+	}
+	return bundle, nil
+}
@@ -0,0 +1,71 @@
+package rest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateBundleStateKeepsConcurrentChanges(t *testing.T) {
+	workDir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workDir)
+
+	writeBundle(t, workDir, Bundle{ID: "bundle-0", Status: Done}, []byte("data"))
+	bundles := NewBundleRegistry()
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := bundles.updateState(workDir, "bundle-0", func(bundle *Bundle) error {
+				bundle.Errors = append(bundle.Errors, fmt.Sprintf("error-%d", i))
+				return nil
+			})
+			assert.NoError(t, err)
+		}(i)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, err := bundles.updateState(workDir, "bundle-0", func(bundle *Bundle) error {
+			bundle.Status = Deleted
+			return nil
+		})
+		assert.NoError(t, err)
+	}()
+	wg.Wait()
+
+	bundle, err := bundles.loadState(workDir, "bundle-0")
+	require.NoError(t, err)
+	assert.Equal(t, Deleted, bundle.Status)
+	assert.Len(t, bundle.Errors, 20)
+}
+
+func TestUpdateBundleStateDoesNotWriteFailedUpdate(t *testing.T) {
+	workDir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workDir)
+
+	writeBundle(t, workDir, Bundle{ID: "bundle-0", Status: Done}, nil)
+	bundles := NewBundleRegistry()
+
+	_, err = bundles.updateState(workDir, "bundle-0", func(bundle *Bundle) error {
+		bundle.Status = Deleted
+		return fmt.Errorf("bundle is busy")
+	})
+	assert.EqualError(t, err, "bundle is busy")
+
+	bundle, err := bundles.loadState(workDir, "bundle-0")
+	require.NoError(t, err)
+	assert.Equal(t, Done, bundle.Status)
+
+	_, err = bundles.updateState(workDir, "bundle-1", func(bundle *Bundle) error { return nil })
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,47 @@
+package rest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"strings"
+)
+
+// checksumWriter computes SHA-256 of everything written to the underlying writer
+type checksumWriter struct {
+	io.WriteCloser
+	hash hash.Hash
+}
+
+func newChecksumWriter(w io.WriteCloser) *checksumWriter {
+	return &checksumWriter{WriteCloser: w, hash: sha256.New()}
+}
+
+func (c *checksumWriter) Write(p []byte) (int, error) {
+	n, err := c.WriteCloser.Write(p)
+	c.hash.Write(p[:n])
+	return n, err
+}
+
+// sum returns hex encoded SHA-256 of written data
+func (c *checksumWriter) sum() string {
+	return hex.EncodeToString(c.hash.Sum(nil))
+}
+
+// checksumETag returns ETag header value for the given checksum
+func checksumETag(checksum string) string {
+	return `"` + checksum + `"`
+}
+
+// checksumFromETag returns checksum sent in ETag header or empty string when ETag is not a checksum
+func checksumFromETag(etag string) string {
+	checksum := strings.Trim(etag, `"`)
+	if len(checksum) != 2*sha256.Size || strings.HasPrefix(etag, "W/") {
+		return ""
+	}
+	if _, err := hex.DecodeString(checksum); err != nil {
+		return ""
+	}
+	return checksum
+}
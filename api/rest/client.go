@@ -7,59 +7,86 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"os"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
 const bundlesEndpoint = "/system/health/v1/node/diagnostics"
 
+const (
+	// defaultDownloadRetries is the number of times interrupted bundle download is resumed
+	defaultDownloadRetries = 5
+	// defaultDownloadBackoff is the time to wait before the first retry, it doubles with every retry
+	defaultDownloadBackoff = time.Second
+	maxDownloadBackoff     = 30 * time.Second
+)
+
 // Client is an interface that can talk with dcos-diagnostics REST API and manipulate remote bundles
 type Client interface {
-	// CreateBundle requests the given node to start a bundle creation process with that is identified by the given ID
-	CreateBundle(ctx context.Context, node string, ID string) (*Bundle, error)
+	// CreateBundle requests the given node to start a bundle creation process with that is identified by the given ID.
+	// Options limit what is collected.
+	CreateBundle(ctx context.Context, node string, ID string, options BundleOptions) (*Bundle, error)
 	// Status returns the status of the bundle with the given ID on the given node
 	Status(ctx context.Context, node string, ID string) (*Bundle, error)
 	// GetFile downloads the bundle file of the bundle with the given ID from the node
 	// url and save it to local filesystem under given path.
 	// Returns an error if there were a problem.
 	GetFile(ctx context.Context, node string, ID string, path string) (err error)
+	// OpenFile requests the bundle file of the bundle with the given ID from the node. Range and If-Range
+	// headers are passed to the node so only the requested part of the file is sent. Response is returned
+	// when the node sends the file or its part and the caller must close its body.
+	OpenFile(ctx context.Context, node string, ID string, header http.Header) (*http.Response, error)
 	// List will get the list of available bundles on the given node
 	List(ctx context.Context, node string) ([]*Bundle, error)
 	// Delete will delete the bundle with the given id from the given node
 	Delete(ctx context.Context, node string, ID string) error
+	// Cancel will stop creation of the bundle with the given id on the given node
+	Cancel(ctx context.Context, node string, ID string) (*Bundle, error)
+	// Upload will start upload of the bundle with the given id on the given node to the object storage
+	Upload(ctx context.Context, node string, ID string) (*Bundle, error)
 }
 
 type DiagnosticsClient struct {
-	client *http.Client
+	client          *http.Client
+	downloadRetries int
+	downloadBackoff time.Duration
 }
 
 // NewDiagnosticsClient constructs a diagnostics client
 func NewDiagnosticsClient(client *http.Client) DiagnosticsClient {
 	return DiagnosticsClient{
-		client: client,
+		client:          client,
+		downloadRetries: defaultDownloadRetries,
+		downloadBackoff: defaultDownloadBackoff,
 	}
 }
 
-func (d DiagnosticsClient) CreateBundle(ctx context.Context, node string, ID string) (*Bundle, error) {
+func (d DiagnosticsClient) CreateBundle(ctx context.Context, node string, ID string, options BundleOptions) (*Bundle, error) {
 	url := remoteURL(node, ID)
 
 	logrus.WithField("ID", ID).WithField("url", url).Debug("sending bundle creation request")
 
-	type payload struct {
-		Type Type `json:"type"`
+	o := localOptions{
+		Type:       Local,
+		Collectors: options.Collectors,
+		Since:      formatTimeBound(options.Window.Since),
+		Until:      formatTimeBound(options.Window.Until),
+		Format:     string(options.Format),
+		Journal:    newJournalSelection(options.Journal),
 	}
-
-	body := jsonMarshal(payload{
-		Type: Local,
-	})
+	if options.SkipEncryption {
+		encrypt := false
+		o.Encrypt = &encrypt
+	}
+	body := jsonMarshal(o)
 
 	request, err := http.NewRequest(http.MethodPut, url, bytes.NewBuffer(body))
 	if err != nil {
 		return nil, err
 	}
 
-	request.WithContext(ctx)
+	request = request.WithContext(ctx)
 
 	resp, err := d.client.Do(request)
 	if err != nil {
@@ -91,7 +118,7 @@ func (d DiagnosticsClient) Status(ctx context.Context, node string, ID string) (
 		return nil, err
 	}
 
-	request.WithContext(ctx)
+	request = request.WithContext(ctx)
 
 	resp, err := d.client.Do(request)
 	if err != nil {
@@ -114,39 +141,134 @@ func (d DiagnosticsClient) Status(ctx context.Context, node string, ID string) (
 	return bundle, nil
 }
 
+// GetFile downloads the bundle file. Interrupted download is resumed from the last received byte
+// with a Range request after a backoff. Downloaded file is validated against its size and
+// the checksum sent by the node as ETag.
 func (d DiagnosticsClient) GetFile(ctx context.Context, node string, ID string, path string) error {
 	url := fmt.Sprintf("%s/file", remoteURL(node, ID))
 
 	logrus.WithField("ID", ID).WithField("url", url).Debug("downloading local bundle from node")
 
+	f := &fileDownload{url: url, id: ID, path: path, size: -1}
+	defer f.close()
+
+	backoff := d.downloadBackoff
+	for attempt := 0; ; attempt++ {
+		err := d.download(ctx, f)
+		if err == nil {
+			return nil
+		}
+		if _, ok := err.(*downloadInterruptedError); !ok || attempt >= d.downloadRetries {
+			return err
+		}
+
+		logrus.WithError(err).WithField("ID", ID).WithField("url", url).WithField("offset", f.written).
+			Warnf("Download interrupted, retrying in %s", backoff)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > maxDownloadBackoff {
+			backoff = maxDownloadBackoff
+		}
+	}
+}
+
+// OpenFile requests the bundle file or its part described by Range and If-Range headers
+func (d DiagnosticsClient) OpenFile(ctx context.Context, node string, ID string, header http.Header) (*http.Response, error) {
+	url := fmt.Sprintf("%s/file", remoteURL(node, ID))
+
+	logrus.WithField("ID", ID).WithField("url", url).Debug("opening bundle file on node")
+
 	request, err := http.NewRequest(http.MethodGet, url, nil)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	request = request.WithContext(ctx)
+	for _, name := range []string{"Range", "If-Range"} {
+		if value := header.Get(name); value != "" {
+			request.Header.Set(name, value)
+		}
 	}
 
 	resp, err := d.client.Do(request)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusPartialContent, http.StatusRequestedRangeNotSatisfiable:
+		return resp, nil
 	}
 	defer resp.Body.Close()
+	return nil, handleErrorCode(resp, url, ID)
+}
 
-	err = handleErrorCode(resp, url, ID)
+// download requests the part of the file that was not downloaded yet and appends it to the file
+func (d DiagnosticsClient) download(ctx context.Context, f *fileDownload) error {
+	request, err := http.NewRequest(http.MethodGet, f.url, nil)
 	if err != nil {
 		return err
 	}
 
-	destinationFile, err := os.Create(path)
+	request = request.WithContext(ctx)
+	if f.written > 0 {
+		request.Header.Set("Range", fmt.Sprintf("bytes=%d-", f.written))
+		if f.etag != "" {
+			request.Header.Set("If-Range", f.etag)
+		}
+	}
+
+	resp, err := d.client.Do(request)
 	if err != nil {
-		return fmt.Errorf("could not create a file: %s", err)
+		if ctx.Err() != nil {
+			return err
+		}
+		return interrupted(err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		if err := f.reset(); err != nil {
+			return err
+		}
+		f.size = resp.ContentLength
+	case http.StatusPartialContent:
+		start, size, err := parseContentRange(resp.Header.Get("Content-Range"))
+		if err != nil || start != f.written {
+			return f.restart(fmt.Errorf("unexpected content range %q", resp.Header.Get("Content-Range")))
+		}
+		f.size = size
+	case http.StatusRequestedRangeNotSatisfiable:
+		// file was already downloaded when the connection was interrupted
+		_, size, err := parseContentRange(resp.Header.Get("Content-Range"))
+		if err != nil || size != f.written {
+			return f.restart(fmt.Errorf("unexpected content range %q", resp.Header.Get("Content-Range")))
+		}
+		return f.verify()
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return &downloadInterruptedError{err: handleErrorCode(resp, f.url, f.id)}
+	default:
+		return handleErrorCode(resp, f.url, f.id)
+	}
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		f.etag = etag
 	}
-	defer destinationFile.Close()
 
-	_, err = io.Copy(destinationFile, resp.Body)
+	n, err := io.Copy(f.file, resp.Body)
+	f.written += n
 	if err != nil {
-		return err
+		if ctx.Err() != nil {
+			return err
+		}
+		return interrupted(err)
 	}
 
-	return nil
+	return f.verify()
 }
 
 func (d DiagnosticsClient) List(ctx context.Context, node string) ([]*Bundle, error) {
@@ -201,12 +323,97 @@ func (d DiagnosticsClient) Delete(ctx context.Context, node string, id string) e
 	return handleErrorCode(resp, url, id)
 }
 
+func (d DiagnosticsClient) Cancel(ctx context.Context, node string, id string) (*Bundle, error) {
+	url := fmt.Sprintf("%s/cancel", remoteURL(node, id))
+
+	logrus.WithField("node", node).WithField("ID", id).Debug("canceling bundle on node")
+
+	request, err := http.NewRequest(http.MethodPost, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	request = request.WithContext(ctx)
+
+	resp, err := d.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusConflict {
+		return nil, &DiagnosticsBundleNotCancelableError{id: id}
+	}
+
+	err = handleErrorCode(resp, url, id)
+	if err != nil {
+		return nil, err
+	}
+
+	bundle := &Bundle{}
+	err = json.NewDecoder(resp.Body).Decode(bundle)
+	if err != nil {
+		return nil, err
+	}
+
+	return bundle, nil
+}
+
+func (d DiagnosticsClient) Upload(ctx context.Context, node string, id string) (*Bundle, error) {
+	url := fmt.Sprintf("%s/upload", remoteURL(node, id))
+
+	logrus.WithField("node", node).WithField("ID", id).Debug("uploading bundle on node")
+
+	request, err := http.NewRequest(http.MethodPost, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	request = request.WithContext(ctx)
+
+	resp, err := d.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusConflict {
+		errResp := ErrorResponse{}
+		if err := json.NewDecoder(resp.Body).Decode(&errResp); err != nil || errResp.Error == "" {
+			return nil, &DiagnosticsBundleNotUploadableError{id: id}
+		}
+		return nil, &DiagnosticsBundleNotUploadableError{id: id, reason: errResp.Error}
+	}
+
+	if resp.StatusCode != http.StatusAccepted {
+		return nil, handleErrorCode(resp, url, id)
+	}
+
+	bundle := &Bundle{}
+	err = json.NewDecoder(resp.Body).Decode(bundle)
+	if err != nil {
+		return nil, err
+	}
+
+	return bundle, nil
+}
+
 func handleErrorCode(resp *http.Response, url string, bundleID string) error {
 	switch {
 	case resp.StatusCode == http.StatusNotFound:
 		return &DiagnosticsBundleNotFoundError{id: bundleID}
 	case resp.StatusCode == http.StatusInternalServerError:
 		return &DiagnosticsBundleUnreadableError{id: bundleID}
+	case resp.StatusCode == http.StatusInsufficientStorage:
+		storage := InsufficientStorageResponse{}
+		if err := json.NewDecoder(resp.Body).Decode(&storage); err != nil || storage.RequiredBytes == 0 {
+			return fmt.Errorf("received unexpected status code [%d] from %s: %s", resp.StatusCode, url, storage.Error)
+		}
+		return &DiagnosticsBundleInsufficientStorageError{
+			id:        bundleID,
+			required:  storage.RequiredBytes,
+			available: storage.AvailableBytes,
+		}
 	case resp.StatusCode != http.StatusOK:
 		body := make([]byte, 100)
 		resp.Body.Read(body)
@@ -27,3 +27,43 @@ type DiagnosticsBundleAlreadyExists struct {
 func (d *DiagnosticsBundleAlreadyExists) Error() string {
 	return fmt.Sprintf("bundle %s already exists", d.id)
 }
+
+type DiagnosticsBundleNotCancelableError struct {
+	id string
+}
+
+func (d *DiagnosticsBundleNotCancelableError) Error() string {
+	return fmt.Sprintf("bundle %s is already finished and could not be canceled", d.id)
+}
+
+type DiagnosticsBundleNotUploadableError struct {
+	id     string
+	reason string
+}
+
+func (d *DiagnosticsBundleNotUploadableError) Error() string {
+	if d.reason == "" {
+		return fmt.Sprintf("bundle %s could not be uploaded", d.id)
+	}
+	return d.reason
+}
+
+type DiagnosticsBundleInsufficientStorageError struct {
+	id        string
+	required  uint64
+	available uint64
+}
+
+func (d *DiagnosticsBundleInsufficientStorageError) Error() string {
+	return fmt.Sprintf("not enough free disk space to create bundle %s: %d bytes required, %d bytes available",
+		d.id, d.required, d.available)
+}
+
+// downloadInterruptedError is returned when bundle download could be resumed
+type downloadInterruptedError struct {
+	err error
+}
+
+func (d *downloadInterruptedError) Error() string {
+	return fmt.Sprintf("download interrupted: %s", d.err)
+}
@@ -1,15 +1,26 @@
 package rest
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
 	"encoding/json"
+	"fmt"
+	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"strings"
+	"syscall"
 	"testing"
 	"time"
 
+	"github.com/dcos/dcos-diagnostics/archive"
+	"github.com/dcos/dcos-diagnostics/collector"
+	"github.com/dcos/dcos-diagnostics/units"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -21,8 +32,20 @@ func TestCreate(t *testing.T) {
 		Status:  Started,
 	}
 
+	options := BundleOptions{
+		Collectors: CollectorSelection{Include: []string{"dcos-mesos-*", "cmd"}, Exclude: []string{"dcos-mesos-dns.service"}},
+		Window:     collector.TimeWindow{Since: time.Date(2019, 10, 1, 12, 0, 0, 0, time.UTC)},
+		Format:     archive.TarZst,
+		Journal:    collector.JournalOptions{Format: collector.JSON, Boots: []units.Boot{{Offset: -1}}},
+	}
+
 	type payload struct {
-		BundleType Type `json:"type"`
+		BundleType Type               `json:"type"`
+		Collectors CollectorSelection `json:"collectors"`
+		Since      string             `json:"since"`
+		Until      *string            `json:"until"`
+		Format     string             `json:"format"`
+		Journal    JournalSelection   `json:"journal"`
 	}
 	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer r.Body.Close()
@@ -34,6 +57,11 @@ func TestCreate(t *testing.T) {
 		require.NoError(t, err)
 
 		assert.Equal(t, Local, args.BundleType)
+		assert.Equal(t, options.Collectors, args.Collectors)
+		assert.Equal(t, "2019-10-01T12:00:00Z", args.Since)
+		assert.Nil(t, args.Until)
+		assert.Equal(t, "tar.zst", args.Format)
+		assert.Equal(t, JournalSelection{Format: "json", Boots: []string{"-1"}}, args.Journal)
 
 		response := jsonMarshal(expectedBundle)
 		w.WriteHeader(http.StatusOK)
@@ -47,7 +75,7 @@ func TestCreate(t *testing.T) {
 		client: testClient,
 	}
 
-	bundle, err := client.CreateBundle(context.TODO(), testServer.URL, expectedBundle.ID)
+	bundle, err := client.CreateBundle(context.TODO(), testServer.URL, expectedBundle.ID, options)
 	require.NoError(t, err)
 	assert.EqualValues(t, expectedBundle, *bundle)
 }
@@ -84,7 +112,7 @@ func TestCreateShouldErrorWhenMalformedResponse(t *testing.T) {
 		client: testClient,
 	}
 
-	bundle, err := client.CreateBundle(context.TODO(), testServer.URL, expectedBundle.ID)
+	bundle, err := client.CreateBundle(context.TODO(), testServer.URL, expectedBundle.ID, BundleOptions{})
 	assert.EqualError(t, err, "invalid character 'm' looking for beginning of value")
 	assert.Nil(t, bundle)
 }
@@ -178,7 +206,7 @@ func TestCreateReturnsErrorWhenResponseIs500(t *testing.T) {
 	client := DiagnosticsClient{
 		client: testClient,
 	}
-	bundle, err := client.CreateBundle(context.TODO(), testServer.URL, "bundle-0")
+	bundle, err := client.CreateBundle(context.TODO(), testServer.URL, "bundle-0", BundleOptions{})
 	assert.Contains(t, err.Error(), "bundle bundle-0 not readable")
 	assert.Nil(t, bundle)
 }
@@ -224,7 +252,7 @@ func TestGetFileReturnsErrorWhenResponseIs500(t *testing.T) {
 
 func TestClientReturnsErrorWhenNodeIsInvalid(t *testing.T) {
 	client := DiagnosticsClient{client: http.DefaultClient}
-	bundle, err := client.CreateBundle(context.TODO(), ``, "bundle-0")
+	bundle, err := client.CreateBundle(context.TODO(), ``, "bundle-0", BundleOptions{})
 	assert.EqualError(t, err, `Put /system/health/v1/node/diagnostics/bundle-0: unsupported protocol scheme ""`)
 	assert.Nil(t, bundle)
 
@@ -279,6 +307,45 @@ func TestGetFileReturnsErrorWhenBundleIDNotFound(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestOpenFilePassesOnlyRangeHeaders(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/system/health/v1/node/diagnostics/bundle-0/file", r.URL.Path)
+		assert.Equal(t, "bytes=2-", r.Header.Get("Range"))
+		assert.Equal(t, `"0123"`, r.Header.Get("If-Range"))
+		assert.Empty(t, r.Header.Get("Authorization"))
+		w.Header().Set("ETag", `"0123"`)
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader("test"))
+	}))
+	defer testServer.Close()
+
+	client := DiagnosticsClient{client: testServer.Client()}
+
+	header := http.Header{}
+	header.Set("Range", "bytes=2-")
+	header.Set("If-Range", `"0123"`)
+	header.Set("Authorization", "token")
+	resp, err := client.OpenFile(context.TODO(), testServer.URL, "bundle-0", header)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "st", string(body))
+}
+
+func TestOpenFileReturnsErrorWhenBundleIDNotFound(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer testServer.Close()
+
+	client := DiagnosticsClient{client: testServer.Client()}
+
+	_, err := client.OpenFile(context.TODO(), testServer.URL, "bundle-0", http.Header{})
+	assert.IsType(t, &DiagnosticsBundleNotFoundError{}, err)
+}
+
 func TestGetFileReturnsErrorWhenCouldNotCreateAFile(t *testing.T) {
 	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		assert.Equal(t, "/system/health/v1/node/diagnostics/bundle-0/file", r.URL.Path)
@@ -302,6 +369,160 @@ func TestGetFileReturnsErrorWhenCouldNotCreateAFile(t *testing.T) {
 	assert.Contains(t, err.Error(), "could not create a file")
 }
 
+func TestGetFileResumesInterruptedDownload(t *testing.T) {
+	content := []byte(strings.Repeat("test\n", 1000))
+	etag := checksumETag(fmt.Sprintf("%x", sha256.Sum256(content)))
+
+	var ranges []string
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		w.Header().Set("ETag", etag)
+		if len(ranges) == 1 {
+			// connection is broken in the middle of the download
+			w.Header().Set("Content-Length", fmt.Sprintf("%d", len(content)))
+			w.WriteHeader(http.StatusOK)
+			w.Write(content[:3000])
+			panic(http.ErrAbortHandler)
+		}
+		assert.Equal(t, etag, r.Header.Get("If-Range"))
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+	defer testServer.Close()
+
+	client := DiagnosticsClient{client: testServer.Client(), downloadRetries: 1}
+
+	f, err := ioutil.TempFile("", "")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	defer os.RemoveAll(f.Name())
+
+	err = client.GetFile(context.TODO(), testServer.URL, "bundle-0", f.Name())
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"", "bytes=3000-"}, ranges)
+	downloaded, err := ioutil.ReadFile(f.Name())
+	require.NoError(t, err)
+	assert.Equal(t, content, downloaded)
+}
+
+func TestGetFileDownloadsWholeFileAgainWhenChecksumDoesNotMatch(t *testing.T) {
+	content := []byte("test")
+	etag := checksumETag(fmt.Sprintf("%x", sha256.Sum256(content)))
+
+	var ranges []string
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		w.Header().Set("ETag", etag)
+		if len(ranges) == 1 {
+			w.Write([]byte("tset"))
+			return
+		}
+		w.Write(content)
+	}))
+	defer testServer.Close()
+
+	client := DiagnosticsClient{client: testServer.Client(), downloadRetries: 1}
+
+	f, err := ioutil.TempFile("", "")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	defer os.RemoveAll(f.Name())
+
+	err = client.GetFile(context.TODO(), testServer.URL, "bundle-0", f.Name())
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"", ""}, ranges)
+	downloaded, err := ioutil.ReadFile(f.Name())
+	require.NoError(t, err)
+	assert.Equal(t, content, downloaded)
+}
+
+func TestGetFileReturnsErrorWhenRetriesAreExhausted(t *testing.T) {
+	requests := 0
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer testServer.Close()
+
+	client := DiagnosticsClient{client: testServer.Client(), downloadRetries: 2, downloadBackoff: time.Millisecond}
+
+	err := client.GetFile(context.TODO(), testServer.URL, "bundle-0", "")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "download interrupted: received unexpected status code [503]")
+	assert.Equal(t, 3, requests)
+}
+
+func TestGetFileDoesNotRetryPermanentErrors(t *testing.T) {
+	// the client fails before sending any request
+	requests := 0
+	client := DiagnosticsClient{
+		client: &http.Client{Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			requests++
+			return nil, fmt.Errorf("certificate signed by unknown authority")
+		})},
+		downloadRetries: 5,
+		downloadBackoff: time.Hour,
+	}
+
+	err := client.GetFile(context.TODO(), "http://192.0.2.1", "bundle-0", "")
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "download interrupted")
+	assert.Equal(t, 1, requests)
+
+	client.client = http.DefaultClient
+	err = client.GetFile(context.TODO(), "", "bundle-0", "")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `unsupported protocol scheme ""`)
+	assert.NotContains(t, err.Error(), "download interrupted")
+}
+
+func TestInterruptedWrapsOnlyRetryableErrors(t *testing.T) {
+	for _, tc := range []struct {
+		err       error
+		retryable bool
+	}{
+		{err: io.ErrUnexpectedEOF, retryable: true},
+		{err: &url.Error{Op: "Get", URL: "http://192.0.2.1", Err: io.ErrUnexpectedEOF}, retryable: true},
+		{err: &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, retryable: true},
+		{err: &url.Error{Op: "Get", URL: "http://192.0.2.1", Err: timeoutError{}}, retryable: true},
+		{err: &url.Error{Op: "Get", URL: "/file", Err: fmt.Errorf(`unsupported protocol scheme ""`)}},
+		{err: &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}},
+	} {
+		_, ok := interrupted(tc.err).(*downloadInterruptedError)
+		assert.Equal(t, tc.retryable, ok, tc.err.Error())
+	}
+}
+
+// roundTripperFunc sends requests with the function
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// timeoutError is a net.Error of timed out connection
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestGetFileDoesNotRetryWhenBundleIsNotFound(t *testing.T) {
+	requests := 0
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer testServer.Close()
+
+	client := NewDiagnosticsClient(testServer.Client())
+
+	err := client.GetFile(context.TODO(), testServer.URL, "bundle-0", "")
+	assert.IsType(t, &DiagnosticsBundleNotFoundError{}, err)
+	assert.Equal(t, 1, requests)
+}
+
 func TestList(t *testing.T) {
 	expectedResponse := []*Bundle{
 		{
@@ -417,3 +638,111 @@ func TestDeleteWhenBundleUnreadable(t *testing.T) {
 	err := client.Delete(context.TODO(), testServer.URL, "bundle-0")
 	assert.IsType(t, &DiagnosticsBundleUnreadableError{}, err)
 }
+
+func TestCancel(t *testing.T) {
+	expectedBundle := Bundle{
+		ID:     "bundle-0",
+		Status: Canceled,
+	}
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/system/health/v1/node/diagnostics/bundle-0/cancel", r.URL.Path)
+		assert.Equal(t, http.MethodPost, r.Method)
+
+		w.WriteHeader(http.StatusOK)
+		w.Write(jsonMarshal(expectedBundle))
+	}))
+
+	client := DiagnosticsClient{
+		client: testServer.Client(),
+	}
+
+	bundle, err := client.Cancel(context.TODO(), testServer.URL, "bundle-0")
+	require.NoError(t, err)
+	assert.EqualValues(t, expectedBundle, *bundle)
+}
+
+func TestCancelWhenBundleIsFinished(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/system/health/v1/node/diagnostics/bundle-0/cancel", r.URL.Path)
+		assert.Equal(t, http.MethodPost, r.Method)
+
+		w.WriteHeader(http.StatusConflict)
+	}))
+
+	client := DiagnosticsClient{
+		client: testServer.Client(),
+	}
+
+	bundle, err := client.Cancel(context.TODO(), testServer.URL, "bundle-0")
+	assert.Nil(t, bundle)
+	assert.IsType(t, &DiagnosticsBundleNotCancelableError{}, err)
+}
+
+func TestCancelWhenBundleNotFound(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+
+	client := DiagnosticsClient{
+		client: testServer.Client(),
+	}
+
+	bundle, err := client.Cancel(context.TODO(), testServer.URL, "bundle-0")
+	assert.Nil(t, bundle)
+	assert.EqualError(t, err, "bundle bundle-0 not found")
+}
+
+func TestUpload(t *testing.T) {
+	expectedBundle := Bundle{
+		ID:     "bundle-0",
+		Status: Done,
+		Upload: &BundleUpload{Status: Uploading},
+	}
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/system/health/v1/node/diagnostics/bundle-0/upload", r.URL.Path)
+		assert.Equal(t, http.MethodPost, r.Method)
+
+		w.WriteHeader(http.StatusAccepted)
+		w.Write(jsonMarshal(expectedBundle))
+	}))
+
+	client := DiagnosticsClient{
+		client: testServer.Client(),
+	}
+
+	bundle, err := client.Upload(context.TODO(), testServer.URL, "bundle-0")
+	require.NoError(t, err)
+	assert.EqualValues(t, expectedBundle, *bundle)
+}
+
+func TestUploadWhenBundleIsNotDone(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSONError(w, http.StatusConflict, fmt.Errorf("bundle bundle-0 is already being uploaded"))
+	}))
+
+	client := DiagnosticsClient{
+		client: testServer.Client(),
+	}
+
+	bundle, err := client.Upload(context.TODO(), testServer.URL, "bundle-0")
+	assert.Nil(t, bundle)
+	assert.IsType(t, &DiagnosticsBundleNotUploadableError{}, err)
+	assert.EqualError(t, err, "bundle bundle-0 is already being uploaded")
+}
+
+func TestCreateBundleWhenThereIsNotEnoughSpace(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeInsufficientStorage(w, &InsufficientStorageError{Required: 1024, Available: 512})
+	}))
+
+	client := DiagnosticsClient{
+		client: testServer.Client(),
+	}
+
+	bundle, err := client.CreateBundle(context.TODO(), testServer.URL, "bundle-0", BundleOptions{})
+	assert.Nil(t, bundle)
+	assert.IsType(t, &DiagnosticsBundleInsufficientStorageError{}, err)
+	assert.EqualError(t, err, "not enough free disk space to create bundle bundle-0: 1024 bytes required, 512 bytes available")
+}
@@ -1,18 +1,20 @@
 package rest
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"net"
 	"net/http"
 	"os"
 	"path/filepath"
 	"time"
 
+	"github.com/dcos/dcos-diagnostics/archive"
 	"github.com/dcos/dcos-diagnostics/dcos"
+	"github.com/dcos/dcos-diagnostics/encrypt"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
@@ -29,14 +31,25 @@ type ClusterBundleHandler struct {
 	timeout    time.Duration
 	clock      Clock
 	urlBuilder dcos.NodeURLBuilder
+	space      *DiskSpaceGuard
+	recipients []encrypt.Recipient // cluster bundles are encrypted for recipients, empty disables encryption
+	exporter   *Exporter           // uploads cluster bundles to the object storage, nil disables export
+	notifier   *Notifier           // sends cluster bundle lifecycle events to webhooks, nil disables webhooks
+	bundles    *BundleRegistry     // tracks running bundles and guards their state files
+	// lookupHost resolves hostnames of selected hosts, nil uses net.LookupHost
+	lookupHost func(string) ([]string, error)
 }
 
 func NewClusterBundleHandler(c Coordinator, client Client, tools dcos.Tooler, workDir string, timeout time.Duration,
-	urlBuilder dcos.NodeURLBuilder) (*ClusterBundleHandler, error) {
+	urlBuilder dcos.NodeURLBuilder, space *DiskSpaceGuard, recipients []encrypt.Recipient,
+	exporter *Exporter, notifier *Notifier, bundles *BundleRegistry) (*ClusterBundleHandler, error) {
 	err := initializeWorkDir(workDir)
 	if err != nil {
 		return nil, err
 	}
+	if bundles == nil {
+		bundles = NewBundleRegistry()
+	}
 
 	return &ClusterBundleHandler{
 		coord:      c,
@@ -46,6 +59,11 @@ func NewClusterBundleHandler(c Coordinator, client Client, tools dcos.Tooler, wo
 		tools:      tools,
 		clock:      &realClock{},
 		urlBuilder: urlBuilder,
+		space:      space,
+		recipients: recipients,
+		exporter:   exporter,
+		notifier:   notifier,
+		bundles:    bundles,
 	}, nil
 }
 
@@ -55,71 +73,122 @@ func (c *ClusterBundleHandler) Create(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	options, err := getOptionsFromRequest(r)
+	options, bundleOptions, err := parseOptions(r.Body, time.Now())
 	if err != nil {
 		writeJSONError(w, http.StatusBadRequest, fmt.Errorf("could not parse request body %s", err))
 		return
 	}
 
-	if c.bundleExists(id) {
-		writeJSONError(w, http.StatusConflict, fmt.Errorf("bundle %s already exists", id))
+	bundleStatus, err := c.create(id, options, bundleOptions)
+	if err != nil {
+		writeCreateError(w, err)
 		return
 	}
+	write(w, bundleStatus)
+}
+
+// CreateBundle starts creating the cluster bundle with options given in JSON the same way as in the body
+// of the creation request
+func (c *ClusterBundleHandler) CreateBundle(id string, options []byte) error {
+	o, bundleOptions, err := parseOptions(bytes.NewReader(options), time.Now())
+	if err != nil {
+		return fmt.Errorf("invalid options: %s", err)
+	}
+	_, err = c.create(id, o, bundleOptions)
+	return err
+}
+
+// create starts collecting node bundles and merging them in the background and returns the bundle state
+func (c *ClusterBundleHandler) create(id string, o options, bundleOptions BundleOptions) ([]byte, error) {
+	if c.bundleExists(id) {
+		return nil, &createError{code: http.StatusConflict, err: fmt.Errorf("bundle %s already exists", id)}
+	}
+
+	if e := c.space.admit(Cluster); e != nil {
+		return nil, e
+	}
 
 	bundleWorkDir := filepath.Join(c.workDir, id)
-	err = os.MkdirAll(bundleWorkDir, dirPerm)
+	err := os.MkdirAll(bundleWorkDir, dirPerm)
 	if err != nil {
-		writeJSONError(w, http.StatusInsufficientStorage, fmt.Errorf("could not create bundle %s workdir: %s", id, err))
-		return
+		return nil, &createError{code: http.StatusInsufficientStorage,
+			err: fmt.Errorf("could not create bundle %s workdir: %s", id, err)}
 	}
 
 	bundle := Bundle{
-		ID:      id,
-		Type:    Cluster,
-		Started: c.clock.Now(),
-		Status:  Started,
+		ID:        id,
+		Type:      Cluster,
+		Started:   c.clock.Now(),
+		Status:    Started,
+		Format:    bundleOptions.Format,
+		Encrypted: len(c.recipients) > 0,
+		Since:     timePtr(bundleOptions.Window.Since),
+		Until:     timePtr(bundleOptions.Window.Until),
 	}
 
 	bundleStatus, err := c.writeStateFile(bundle)
 	if err != nil {
-		writeJSONError(w, http.StatusInsufficientStorage, err)
-		return
+		return nil, &createError{code: http.StatusInsufficientStorage, err: err}
 	}
+	c.notifier.notify(bundle)
 
 	dataFile, err := os.Create(filepath.Join(c.workDir, id, dataFileName))
 	if err != nil {
 		if e := c.failed(bundle, err); e != nil {
 			logrus.WithField("ID", bundle.ID).Error(e.Error())
 		}
-		writeJSONError(w, http.StatusInsufficientStorage, fmt.Errorf("could not create data file %s: %s", id, err))
-		return
+		return nil, &createError{code: http.StatusInsufficientStorage,
+			err: fmt.Errorf("could not create data file %s: %s", id, err)}
 	}
 
+	checksum := newChecksumWriter(dataFile)
+	data, err := bundleDataWriter(bundle, checksum, c.recipients)
+	if err != nil {
+		dataFile.Close()
+		if e := c.failed(bundle, err); e != nil {
+			logrus.WithField("ID", bundle.ID).Error(e.Error())
+		}
+		return nil, err
+	}
+	// data is closed once the bundle is collected, bundles failing before that are closed here
+	collecting := false
+	defer func() {
+		if !collecting {
+			data.Close()
+		}
+	}()
+
 	var masters, agents []dcos.Node
 
-	if options.Masters {
+	if o.Masters {
 		masters, err = c.tools.GetMasterNodes()
 		if err != nil {
 			if e := c.failed(bundle, err); e != nil {
 				logrus.WithField("ID", bundle.ID).Error(e.Error())
 			}
-			writeJSONError(w, http.StatusInternalServerError, fmt.Errorf("error getting master nodes for bundle %s: %s", id, err))
-			return
+			return nil, fmt.Errorf("error getting master nodes for bundle %s: %s", id, err)
 		}
 	}
 
-	if options.Agents {
+	if o.Agents {
 		agents, err = c.tools.GetAgentNodes()
 		if err != nil {
 			if e := c.failed(bundle, err); e != nil {
 				logrus.WithField("ID", bundle.ID).Error(e.Error())
 			}
-			writeJSONError(w, http.StatusInternalServerError, fmt.Errorf("error getting agent nodes for bundle %s: %s", id, err))
-			return
+			return nil, fmt.Errorf("error getting agent nodes for bundle %s: %s", id, err)
+		}
+	}
+
+	allNodes, err := o.Targets.filter(append(masters, agents...), c.lookupHost)
+	if err != nil {
+		if e := c.failed(bundle, err); e != nil {
+			logrus.WithField("ID", bundle.ID).Error(e.Error())
 		}
+		return nil, &createError{code: http.StatusBadRequest,
+			err: fmt.Errorf("could not select nodes for bundle %s: %s", id, err)}
 	}
 
-	allNodes := append(masters, agents...)
 	nodes := make([]node, 0, len(allNodes))
 	for _, n := range allNodes {
 		ip := net.ParseIP(n.IP)
@@ -137,28 +206,45 @@ func (c *ClusterBundleHandler) Create(w http.ResponseWriter, r *http.Request) {
 		})
 	}
 
-	//TODO(janisz): use context cancel function to cancel bundle creation https://jira.mesosphere.com/browse/DCOS_OSS-5222
-	//nolint:govet
-	ctx, _ := context.WithTimeout(context.Background(), c.timeout)
-
 	localBundleID, err := uuid.NewUUID()
 	if err != nil {
 		if e := c.failed(bundle, err); e != nil {
 			logrus.WithField("ID", bundle.ID).Error(e.Error())
 		}
-		writeJSONError(w, http.StatusInternalServerError, fmt.Errorf("unable to create local bundle id for bundle %s: %s", id, err))
-		return
+		return nil, fmt.Errorf("unable to create local bundle id for bundle %s: %s", id, err)
 	}
-	statuses := c.coord.CreateBundle(ctx, localBundleID.String(), nodes)
 
-	go c.waitAndCollectRemoteBundle(ctx, bundle, len(nodes), dataFile, statuses)
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	c.bundles.running.add(id, cancel)
+	stopWatching := c.space.watch(cancel)
 
-	write(w, bundleStatus)
+	statuses := c.coord.CreateBundle(ctx, localBundleID.String(), nodes, bundleOptions)
+
+	collecting = true
+	go func() {
+		defer c.bundles.running.remove(id)
+		defer cancel()
+		c.waitAndCollectRemoteBundle(ctx, bundle, len(nodes), data, checksum, statuses, stopWatching)
+	}()
+
+	return bundleStatus, nil
 }
 
 type options struct {
 	Masters bool `json:"masters"`
 	Agents  bool `json:"agents"`
+	// Targets narrow down nodes found with Masters and Agents
+	Targets NodeSelection `json:"targets"`
+	// Collectors are passed to every node, they are not validated against nodes' collectors
+	// because every node could have different collectors
+	Collectors CollectorSelection `json:"collectors"`
+	// Since and Until are resolved once so every node collects logs from the same time window
+	Since string `json:"since,omitempty"`
+	Until string `json:"until,omitempty"`
+	// Format of the cluster bundle archive, nodes create their bundles in the same format
+	Format string `json:"format,omitempty"`
+	// Journal is passed to every node
+	Journal JournalSelection `json:"journal"`
 }
 
 var defaultOptions = options{
@@ -166,66 +252,180 @@ var defaultOptions = options{
 	Agents:  true,
 }
 
-func getOptionsFromRequest(r *http.Request) (options, error) {
+// parseOptions reads cluster bundle options and options of every node bundle from the body
+// of the cluster bundle creation request
+func parseOptions(body io.Reader, now time.Time) (options, BundleOptions, error) {
 	o := defaultOptions
-	if r.Body != nil {
-		if err := json.NewDecoder(r.Body).Decode(&o); err != nil {
+	if body != nil {
+		if err := json.NewDecoder(body).Decode(&o); err != nil {
 			if err != io.EOF { // Accept empty body
-				return o, err
+				return o, BundleOptions{}, err
 			}
 		}
 	}
-	return o, nil
+	if err := o.Collectors.validate(); err != nil {
+		return o, BundleOptions{}, err
+	}
+	if err := o.Targets.validate(); err != nil {
+		return o, BundleOptions{}, err
+	}
+	format, err := archive.ParseFormat(o.Format)
+	if err != nil {
+		return o, BundleOptions{}, err
+	}
+	journal, err := o.Journal.parse()
+	if err != nil {
+		return o, BundleOptions{}, err
+	}
+	window, err := parseTimeWindow(o.Since, o.Until, now)
+	// node bundles are not encrypted because they are merged here and the cluster bundle is encrypted
+	return o, BundleOptions{Collectors: o.Collectors, Window: window, Format: format, SkipEncryption: true,
+		Journal: journal}, err
 }
 
 func (c *ClusterBundleHandler) failed(bundle Bundle, err error) error {
 	bundle.Failed(c.clock.Now(), err)
 	_, e := c.writeStateFile(bundle)
+	c.notifier.notify(bundle)
 	return e
 }
 
+// waitAndCollectRemoteBundle merges node bundles into dataFile. Checksum must be computed
+// over the data stored in the file, after it's encrypted.
 func (c *ClusterBundleHandler) waitAndCollectRemoteBundle(ctx context.Context, bundle Bundle, numBundles int,
-	dataFile io.WriteCloser, statuses <-chan BundleStatus) {
+	dataFile io.WriteCloser, checksum *checksumWriter, statuses <-chan BundleStatus, stopWatching func() error) {
 
 	defer dataFile.Close()
 
-	bundleFilePath, err := c.coord.CollectBundle(ctx, bundle.ID, numBundles, statuses)
-	if err != nil {
-		bundle.Errors = append(bundle.Errors, err.Error())
+	statuses, stopTracking := c.trackProgress(bundle, numBundles, statuses)
+	report, err := c.coord.CollectBundle(ctx, bundle.ID, numBundles, statuses, bundle.Format, dataFile)
+	stopTracking()
+	abortReason := stopWatching()
+	bundle.Nodes = report.Nodes
+
+	if abortReason != nil {
+		c.aborted(bundle, dataFile, abortReason)
+		return
 	}
 
-	bundleFile, err := os.Open(bundleFilePath)
-	if err != nil {
-		logrus.WithError(err).WithField("ID", bundle.ID).Error("unable to open bundle for copying")
-		if e := c.failed(bundle, err); e != nil {
-			logrus.WithField("ID", bundle.ID).Error(e.Error())
-		}
+	if ctx.Err() == context.Canceled {
+		bundle.Errors = append(bundle.Errors, ctx.Err().Error())
+		c.canceled(bundle, dataFile)
 		return
 	}
 
-	_, err = io.Copy(dataFile, bundleFile)
+	if err == nil {
+		err = dataFile.Close()
+	}
 	if err != nil {
-		logrus.WithError(err).WithField("ID", bundle.ID).Error("unable to copy bundle from temp dir working directory")
-		if e := c.failed(bundle, err); e != nil {
-			logrus.WithField("ID", bundle.ID).Error(e.Error())
-		}
+		logrus.WithError(err).WithField("ID", bundle.ID).Error("unable to merge node bundles")
+		c.aborted(bundle, dataFile, err)
 		return
 	}
 
 	bundle.Stopped = c.clock.Now()
 	bundle.Status = Done
+	bundle.ProgressPercentage = 100
+	bundle.Checksum = checksum.sum()
 
 	_, err = c.writeStateFile(bundle)
 	if err != nil {
 		logrus.WithError(err).WithField("ID", bundle.ID).Error("Could not update state file.")
 		return
 	}
+
+	c.notifier.notify(bundle)
+	c.exporter.bundleDone(bundle.ID)
+}
+
+// trackProgress passes statuses through and keeps bundle state file updated with
+// progress of every node. Returned channel should be used instead of the given one.
+// Returned function stops tracking and must be called before bundle state is updated by anyone else.
+func (c *ClusterBundleHandler) trackProgress(bundle Bundle, numBundles int, statuses <-chan BundleStatus) (<-chan BundleStatus, func()) {
+	out := make(chan BundleStatus)
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+
+		bundle.Status = InProgress
+		bundle.Nodes = make(map[string]nodeBundleReport, numBundles)
+
+		for finishedBundles := 0; finishedBundles < numBundles; {
+			var s BundleStatus
+			select {
+			case s = <-statuses:
+			case <-stop:
+				return
+			}
+
+			n := nodeBundleReport{Status: InProgress, Progress: s.progress}
+			if s.done {
+				finishedBundles++
+				n = nodeBundleReport{Status: Done, Progress: 100}
+				if s.err != nil {
+					n = nodeBundleReport{Status: Failed, Err: s.err.Error(), Progress: 100}
+				}
+			}
+			bundle.Nodes[s.node.IP.String()] = n
+
+			var sum float32
+			for _, n := range bundle.Nodes {
+				sum += n.Progress
+			}
+			bundle.ProgressPercentage = sum / float32(numBundles)
+
+			if _, err := c.writeStateFile(bundle); err != nil {
+				logrus.WithError(err).WithField("ID", bundle.ID).Warn("Could not update bundle progress")
+			}
+
+			select {
+			case out <- s:
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	return out, func() {
+		close(stop)
+		<-stopped
+	}
+}
+
+// canceled removes partial bundle data and marks bundle as Canceled
+func (c *ClusterBundleHandler) canceled(bundle Bundle, dataFile io.Closer) {
+	c.removeDataFile(bundle, dataFile)
+
+	bundle.Status = Canceled
+	bundle.Stopped = c.clock.Now()
+	if _, err := c.writeStateFile(bundle); err != nil {
+		logrus.WithError(err).WithField("ID", bundle.ID).Error("Could not update state file.")
+	}
+	c.notifier.notify(bundle)
+}
+
+// aborted removes partial bundle data and marks bundle as Failed with the given reason
+func (c *ClusterBundleHandler) aborted(bundle Bundle, dataFile io.Closer, reason error) {
+	c.removeDataFile(bundle, dataFile)
+
+	if err := c.failed(bundle, reason); err != nil {
+		logrus.WithError(err).WithField("ID", bundle.ID).Error("Could not update state file.")
+	}
+}
+
+func (c *ClusterBundleHandler) removeDataFile(bundle Bundle, dataFile io.Closer) {
+	if err := dataFile.Close(); err != nil {
+		logrus.WithError(err).WithField("ID", bundle.ID).Warn("Could not close data file")
+	}
+	if err := os.Remove(filepath.Join(c.workDir, bundle.ID, dataFileName)); err != nil {
+		logrus.WithError(err).WithField("ID", bundle.ID).Error("Could not remove partial data file")
+	}
 }
 
 func (c *ClusterBundleHandler) writeStateFile(bundle Bundle) ([]byte, error) {
-	stateFilePath := filepath.Join(c.workDir, bundle.ID, stateFileName)
-	bundleStatus := jsonMarshal(bundle)
-	err := ioutil.WriteFile(stateFilePath, bundleStatus, filePerm)
+	bundleStatus, err := c.bundles.writeState(c.workDir, bundle)
 	if err != nil {
 		err = fmt.Errorf("could not update state file %s: %s", bundle.ID, err)
 	}
@@ -324,13 +524,86 @@ func (c *ClusterBundleHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Cancel will stop creation of the given bundle, proxying the call to the master
+// the bundle is created on. Nodes' bundles are canceled and partial data is removed.
+func (c *ClusterBundleHandler) Cancel(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	masters, err := c.getMasterNodes()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Errorf("unable to get list of masters: %s", err))
+		return
+	}
+
+	ctx := context.Background()
+
+	for _, n := range masters {
+		bundle, err := c.client.Cancel(ctx, n.baseURL, id)
+		if err != nil {
+			switch err.(type) {
+			case *DiagnosticsBundleNotFoundError:
+				continue
+			case *DiagnosticsBundleNotCancelableError:
+				writeJSONError(w, http.StatusConflict, err)
+				return
+			default:
+				writeJSONError(w, http.StatusInternalServerError, err)
+				return
+			}
+		}
+
+		write(w, jsonMarshal(bundle))
+		return
+	}
+
+	writeJSONError(w, http.StatusNotFound, fmt.Errorf("bundle %s not found on any master", id))
+}
+
+// Upload will start upload of the given bundle to the object storage, proxying the call to the master
+// the bundle is stored on
+func (c *ClusterBundleHandler) Upload(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	masters, err := c.getMasterNodes()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Errorf("unable to get list of masters: %s", err))
+		return
+	}
+
+	ctx := context.Background()
+
+	for _, n := range masters {
+		bundle, err := c.client.Upload(ctx, n.baseURL, id)
+		if err != nil {
+			switch err.(type) {
+			case *DiagnosticsBundleNotFoundError:
+				continue
+			case *DiagnosticsBundleNotUploadableError:
+				writeJSONError(w, http.StatusConflict, err)
+				return
+			default:
+				writeJSONError(w, http.StatusInternalServerError, err)
+				return
+			}
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+		write(w, jsonMarshal(bundle))
+		return
+	}
+
+	writeJSONError(w, http.StatusNotFound, fmt.Errorf("bundle %s not found on any master", id))
+}
+
 // Download will download the given bundle, proxying the call to the appropriate master
 func (c *ClusterBundleHandler) Download(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 
 	// TODO: for this one specifically, it would be ideal to detect if the bundle exists on the calling master
-	// first since then we can skip the intermediate download
+	// first since then we can serve it without proxying
 	masters, err := c.getMasterNodes()
 	if err != nil {
 		writeJSONError(w, http.StatusInternalServerError, fmt.Errorf("unable to get list of masters: %s", err))
@@ -340,6 +613,9 @@ func (c *ClusterBundleHandler) Download(w http.ResponseWriter, r *http.Request)
 	ctx := context.Background()
 
 	var masterWithBundle node
+	var checksum string
+	var format archive.Format
+	var encrypted bool
 	found := false
 	for _, n := range masters {
 		bundle, statusErr := c.client.Status(ctx, n.baseURL, id)
@@ -355,6 +631,9 @@ func (c *ClusterBundleHandler) Download(w http.ResponseWriter, r *http.Request)
 
 		if bundle.Status == Done {
 			masterWithBundle = n
+			checksum = bundle.Checksum
+			format = bundle.Format
+			encrypted = bundle.Encrypted
 			found = true
 			break
 		}
@@ -364,23 +643,28 @@ func (c *ClusterBundleHandler) Download(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	bundleDir, err := ioutil.TempDir("", "bundle-")
+	// the file is streamed from the master, Range requests are passed to it so resumed downloads
+	// don't transfer the whole file again
+	resp, err := c.client.OpenFile(r.Context(), masterWithBundle.baseURL, id, r.Header)
 	if err != nil {
-		writeJSONError(w, http.StatusInternalServerError, fmt.Errorf("error opening temp file to download bundle %s", err))
+		writeJSONError(w, http.StatusInternalServerError, fmt.Errorf("error downloading bundle: %s", err))
 		return
 	}
-	defer os.RemoveAll(bundleDir)
-
-	bundleFilename := filepath.Join(bundleDir, "bundle.zip")
+	defer resp.Body.Close()
 
-	err = c.client.GetFile(ctx, masterWithBundle.baseURL, id, bundleFilename)
-	if err != nil {
-		writeJSONError(w, http.StatusInternalServerError, fmt.Errorf("error downloading bundle: %s", err))
-		return
+	setBundleFileHeaders(w, id, format, encrypted)
+	for _, name := range []string{"Accept-Ranges", "Content-Length", "Content-Range", "Last-Modified"} {
+		if value := resp.Header.Get(name); value != "" {
+			w.Header().Set(name, value)
+		}
+	}
+	if checksum != "" {
+		w.Header().Set("ETag", checksumETag(checksum))
+	}
+	w.WriteHeader(resp.StatusCode)
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		logrus.WithError(err).WithField("ID", id).Warn("Could not send bundle file")
 	}
-	w.Header().Add("Content-Type", "application/zip, application/octet-stream")
-	w.Header().Add("Content-disposition", fmt.Sprintf("attachment; filename=%s.zip", id))
-	http.ServeFile(w, r, bundleFilename)
 }
 
 func (c *ClusterBundleHandler) getMasterNodes() ([]node, error) {
@@ -4,6 +4,7 @@ import (
 	"archive/zip"
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -17,6 +18,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/dcos/dcos-diagnostics/archive"
+	"github.com/dcos/dcos-diagnostics/collector"
 	"github.com/dcos/dcos-diagnostics/dcos"
 
 	"github.com/gorilla/mux"
@@ -39,6 +42,7 @@ func TestRemoteBundleCreationConflictErrorWhenBundleExists(t *testing.T) {
 	coord := new(mockCoordinator)
 	bh := ClusterBundleHandler{
 		workDir:    workdir,
+		bundles:    NewBundleRegistry(),
 		coord:      coord,
 		tools:      tools,
 		timeout:    time.Second,
@@ -66,6 +70,7 @@ func TestRemoteBundleCreationErrorWhenOptionsAreInvalid(t *testing.T) {
 	coord := new(mockCoordinator)
 	bh := ClusterBundleHandler{
 		workDir:    workdir,
+		bundles:    NewBundleRegistry(),
 		coord:      coord,
 		timeout:    time.Second,
 		urlBuilder: MockURLBuilder{},
@@ -120,6 +125,7 @@ func TestDeleteBundle(t *testing.T) {
 	coord := new(mockCoordinator)
 	bh := ClusterBundleHandler{
 		workDir:    workdir,
+		bundles:    NewBundleRegistry(),
 		coord:      coord,
 		client:     client,
 		tools:      tools,
@@ -176,6 +182,7 @@ func TestDeleteAlreadyDeletedBundle(t *testing.T) {
 	coord := new(mockCoordinator)
 	bh := ClusterBundleHandler{
 		workDir:    workdir,
+		bundles:    NewBundleRegistry(),
 		coord:      coord,
 		client:     client,
 		tools:      tools,
@@ -232,6 +239,7 @@ func TestDeleteBundleThatIsntFound(t *testing.T) {
 	coord := new(mockCoordinator)
 	bh := ClusterBundleHandler{
 		workDir:    workdir,
+		bundles:    NewBundleRegistry(),
 		coord:      coord,
 		client:     client,
 		tools:      tools,
@@ -288,6 +296,7 @@ func TestDeleteUnreadableBundle(t *testing.T) {
 	coord := new(mockCoordinator)
 	bh := ClusterBundleHandler{
 		workDir:    workdir,
+		bundles:    NewBundleRegistry(),
 		coord:      coord,
 		client:     client,
 		tools:      tools,
@@ -349,6 +358,7 @@ func TestStatusForBundle(t *testing.T) {
 	coord := new(mockCoordinator)
 	bh := ClusterBundleHandler{
 		workDir:    workdir,
+		bundles:    NewBundleRegistry(),
 		coord:      coord,
 		client:     client,
 		tools:      tools,
@@ -412,6 +422,7 @@ func TestStatusOnMissingBundle(t *testing.T) {
 	coord := new(mockCoordinator)
 	bh := ClusterBundleHandler{
 		workDir:    workdir,
+		bundles:    NewBundleRegistry(),
 		coord:      coord,
 		client:     client,
 		tools:      tools,
@@ -458,6 +469,7 @@ func TestStatusForUnreadableBundle(t *testing.T) {
 	coord := new(mockCoordinator)
 	bh := ClusterBundleHandler{
 		workDir:    workdir,
+		bundles:    NewBundleRegistry(),
 		coord:      coord,
 		client:     client,
 		tools:      tools,
@@ -529,17 +541,16 @@ func TestDownloadBundle(t *testing.T) {
 		Type:   Cluster,
 		Status: Done,
 	}, nil)
-	client.On("GetFile", ctx, "http://192.0.2.5", id, mock.AnythingOfType("string")).Return(func(ctx context.Context, url string, id string, tempZipFile string) error {
-		// copy the testdata zip to the location Client is expected to put the downloaded zip
-		f, err := os.Create(tempZipFile)
-		require.NoError(t, err)
-		io.Copy(f, bytes.NewBuffer(expectedBytes))
-		return nil
-	})
+	client.On("OpenFile", mock.Anything, "http://192.0.2.5", id, mock.Anything).Return(&http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(bytes.NewReader(expectedBytes)),
+	}, nil)
 
 	coord := new(mockCoordinator)
 	bh := ClusterBundleHandler{
 		workDir:    workdir,
+		bundles:    NewBundleRegistry(),
 		coord:      coord,
 		client:     client,
 		tools:      tools,
@@ -562,6 +573,73 @@ func TestDownloadBundle(t *testing.T) {
 	assert.Equal(t, bytes.NewBuffer(expectedBytes), rr.Body)
 }
 
+func TestDownloadPassesRangeRequestsToMaster(t *testing.T) {
+	workdir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workdir)
+
+	masterWorkdir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(masterWorkdir)
+
+	bundle := Bundle{ID: "bundle-0", Type: Cluster, Status: Done, Format: archive.TarGz, Checksum: "0123"}
+	writeBundle(t, masterWorkdir, bundle, []byte("bundle data"))
+
+	local, err := NewBundleHandler(masterWorkdir, nil, time.Second, time.Second, 1, BundleHandlerOptions{})
+	require.NoError(t, err)
+	masterRouter := mux.NewRouter()
+	masterRouter.HandleFunc(bundleFileEndpoint, local.GetFile).Methods(http.MethodGet)
+	master := httptest.NewServer(masterRouter)
+	defer master.Close()
+
+	tools := new(MockedTools)
+	tools.On("GetMasterNodes").Return([]dcos.Node{{Role: "master", IP: "192.0.2.2"}}, nil)
+
+	client := &MockClient{
+		status: func(ctx context.Context, node string, ID string) (*Bundle, error) {
+			return &bundle, nil
+		},
+		openFile: func(ctx context.Context, node string, ID string, header http.Header) (*http.Response, error) {
+			assert.Equal(t, "http://192.0.2.2", node)
+			return NewDiagnosticsClient(master.Client()).OpenFile(ctx, master.URL, ID, header)
+		},
+	}
+
+	bh := ClusterBundleHandler{
+		workDir:    workdir,
+		bundles:    NewBundleRegistry(),
+		client:     client,
+		tools:      tools,
+		urlBuilder: MockURLBuilder{},
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc(bundleFileEndpoint, bh.Download).Methods(http.MethodGet)
+
+	req, err := http.NewRequest(http.MethodGet, bundlesEndpoint+"/bundle-0/file", nil)
+	require.NoError(t, err)
+	req.Header.Set("Range", "bytes=7-")
+	req.Header.Set("If-Range", checksumETag(bundle.Checksum))
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusPartialContent, rr.Code)
+	assert.Equal(t, "bytes 7-10/11", rr.Header().Get("Content-Range"))
+	assert.Equal(t, checksumETag(bundle.Checksum), rr.Header().Get("ETag"))
+	assert.Equal(t, "attachment; filename=bundle-0.tar.gz", rr.Header().Get("Content-disposition"))
+	assert.Equal(t, "data", rr.Body.String())
+
+	// the file changed since the client started the download so the whole file is sent
+	req.Header.Set("If-Range", checksumETag("3210"))
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "bundle data", rr.Body.String())
+}
+
 func TestDownloadMissingBundle(t *testing.T) {
 	workdir, err := ioutil.TempDir("", "work-dir")
 	require.NoError(t, err)
@@ -598,6 +676,7 @@ func TestDownloadMissingBundle(t *testing.T) {
 	coord := new(mockCoordinator)
 	bh := ClusterBundleHandler{
 		workDir:    workdir,
+		bundles:    NewBundleRegistry(),
 		coord:      coord,
 		client:     client,
 		tools:      tools,
@@ -654,6 +733,7 @@ func TestDownloadUnreadableBundle(t *testing.T) {
 	coord := new(mockCoordinator)
 	bh := ClusterBundleHandler{
 		workDir:    workdir,
+		bundles:    NewBundleRegistry(),
 		coord:      coord,
 		client:     client,
 		tools:      tools,
@@ -724,6 +804,7 @@ func TestListWithBundlesOnMultipleMasters(t *testing.T) {
 	coord := new(mockCoordinator)
 	bh := ClusterBundleHandler{
 		workDir:    workdir,
+		bundles:    NewBundleRegistry(),
 		coord:      coord,
 		client:     client,
 		tools:      tools,
@@ -757,6 +838,7 @@ func TestRemoteBundleCreationShouldFailWhenCantFindMasters(t *testing.T) {
 
 	bh := ClusterBundleHandler{
 		workDir:    workdir,
+		bundles:    NewBundleRegistry(),
 		coord:      nil,
 		client:     nil,
 		tools:      tools,
@@ -811,6 +893,7 @@ func TestRemoteBundleCreationShouldFailWhenCantFindAgents(t *testing.T) {
 
 	bh := ClusterBundleHandler{
 		workDir:    workdir,
+		bundles:    NewBundleRegistry(),
 		coord:      nil,
 		client:     nil,
 		tools:      tools,
@@ -918,6 +1001,7 @@ func TestRemoteBundleCreation(t *testing.T) {
 			coord := new(mockCoordinator)
 			bh := ClusterBundleHandler{
 				workDir:    workdir,
+				bundles:    NewBundleRegistry(),
 				coord:      coord,
 				client:     client,
 				tools:      tools,
@@ -1057,6 +1141,7 @@ func TestRemoteBundleCreationWithFiltering(t *testing.T) {
 			coord := new(mockCoordinator)
 			bh := ClusterBundleHandler{
 				workDir:    workdir,
+				bundles:    NewBundleRegistry(),
 				coord:      coord,
 				tools:      tools,
 				timeout:    time.Second,
@@ -1085,6 +1170,423 @@ func TestRemoteBundleCreationWithFiltering(t *testing.T) {
 	}
 }
 
+func TestRemoteBundleCreationTargetsSelectedNodes(t *testing.T) {
+	tools := new(MockedTools)
+	tools.On("GetMasterNodes").Return([]dcos.Node{{Leader: true, Role: "master", IP: "192.0.2.2"}}, nil)
+	tools.On("GetAgentNodes").Return([]dcos.Node{
+		{Role: "agent", IP: "192.0.2.3", MesosID: "S3", Attributes: map[string]string{"rack": "r12"}},
+		{Role: "agent", IP: "192.0.2.4", MesosID: "S4", Attributes: map[string]string{"rack": "r13"}},
+		{Role: "agent_public", IP: "192.0.2.5", MesosID: "S5", Attributes: map[string]string{"rack": "r12", "public_ip": "true"}},
+	}, nil)
+
+	for _, tc := range []struct {
+		targets  string
+		expected []string
+	}{
+		{targets: `{"attributes": ["rack=r12"]}`, expected: []string{"192.0.2.3", "192.0.2.5"}},
+		{targets: `{"roles": ["agent"], "attributes": ["rack=r12"]}`, expected: []string{"192.0.2.3"}},
+		{targets: `{"roles": ["master", "agent_public"]}`, expected: []string{"192.0.2.2", "192.0.2.5"}},
+		{targets: `{"hosts": ["192.0.2.2"], "agent_ids": ["S4"]}`, expected: []string{}},
+		{targets: `{"agent_ids": ["S4", "S5"]}`, expected: []string{"192.0.2.4", "192.0.2.5"}},
+	} {
+		t.Run(tc.targets, func(t *testing.T) {
+			workdir, err := ioutil.TempDir("", "work-dir")
+			require.NoError(t, err)
+			defer os.RemoveAll(workdir)
+
+			coord := &nodesCoordinator{nodes: make(chan []node, 1)}
+			bh := ClusterBundleHandler{
+				workDir:    workdir,
+				bundles:    NewBundleRegistry(),
+				coord:      coord,
+				tools:      tools,
+				timeout:    time.Second,
+				clock:      &MockClock{},
+				urlBuilder: MockURLBuilder{},
+			}
+
+			router := mux.NewRouter()
+			router.HandleFunc(bundleEndpoint, bh.Create).Methods(http.MethodPut)
+
+			req, err := http.NewRequest(http.MethodPut, bundlesEndpoint+"/bundle-0",
+				strings.NewReader(`{"targets": `+tc.targets+`}`))
+			require.NoError(t, err)
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if len(tc.expected) == 0 {
+				assert.Equal(t, http.StatusBadRequest, rr.Code)
+				assert.JSONEq(t, `{"code":400,"error":"could not select nodes for bundle bundle-0: no nodes match the selection"}`,
+					rr.Body.String())
+				return
+			}
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+			ips := []string{}
+			for _, n := range <-coord.nodes {
+				ips = append(ips, n.IP.String())
+			}
+			assert.Equal(t, tc.expected, ips)
+		})
+	}
+}
+
+func TestRemoteBundleCreationFailsWhenTargetIsUnknown(t *testing.T) {
+	workdir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workdir)
+
+	tools := new(MockedTools)
+	tools.On("GetMasterNodes").Return([]dcos.Node{{Leader: true, Role: "master", IP: "192.0.2.2"}}, nil)
+	tools.On("GetAgentNodes").Return([]dcos.Node{{Role: "agent", IP: "192.0.2.3", MesosID: "S3"}}, nil)
+
+	bh := ClusterBundleHandler{
+		workDir:    workdir,
+		bundles:    NewBundleRegistry(),
+		coord:      mockCoordinator{},
+		tools:      tools,
+		timeout:    time.Second,
+		clock:      &MockClock{},
+		urlBuilder: MockURLBuilder{},
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc(bundleEndpoint, bh.Create).Methods(http.MethodPut)
+
+	body := `{"targets": {"hosts": ["192.0.2.3", "192.0.2.9"], "agent_ids": ["S9"], "attributes": ["rack=r99"]}}`
+	req, err := http.NewRequest(http.MethodPut, bundlesEndpoint+"/bundle-0", strings.NewReader(body))
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.JSONEq(t, `{
+		"code":400,
+		"error":"could not select nodes for bundle bundle-0: unknown targets: host 192.0.2.9, agent ID S9, attribute rack=r99"
+	}`, rr.Body.String())
+
+	bundle, err := readBundleState(workdir, "bundle-0")
+	require.NoError(t, err)
+	assert.Equal(t, Failed, bundle.Status)
+}
+
+func TestRemoteBundleCreationReturns400WhenTargetsAreInvalid(t *testing.T) {
+	workdir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workdir)
+
+	bh := ClusterBundleHandler{workDir: workdir, bundles: NewBundleRegistry(), clock: &MockClock{}}
+
+	router := mux.NewRouter()
+	router.HandleFunc(bundleEndpoint, bh.Create).Methods(http.MethodPut)
+
+	for body, expected := range map[string]string{
+		`{"targets": {"roles": ["slave"]}}`:     `unknown role \"slave\", must be master, agent or agent_public`,
+		`{"targets": {"attributes": ["rack"]}}`: `invalid attribute selector \"rack\", must be name=value`,
+	} {
+		req, err := http.NewRequest(http.MethodPut, bundlesEndpoint+"/bundle-0", strings.NewReader(body))
+		require.NoError(t, err)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.JSONEq(t, `{"code":400,"error":"could not parse request body `+expected+`"}`, rr.Body.String())
+	}
+	assert.False(t, bh.bundleExists("bundle-0"))
+}
+
+func TestRemoteBundleCreationPassesOptionsToNodes(t *testing.T) {
+	workdir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workdir)
+
+	tools := new(MockedTools)
+	tools.On("GetMasterNodes").Return([]dcos.Node{{Leader: true, Role: "master", IP: "192.0.2.2"}}, nil)
+
+	coord := &optionsCoordinator{options: make(chan BundleOptions, 1)}
+	bh := ClusterBundleHandler{
+		workDir:    workdir,
+		bundles:    NewBundleRegistry(),
+		coord:      coord,
+		tools:      tools,
+		timeout:    time.Second,
+		clock:      &MockClock{},
+		urlBuilder: MockURLBuilder{},
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc(bundleEndpoint, bh.Create).Methods(http.MethodPut)
+
+	body := `{
+		"agents": false,
+		"collectors": {"include": ["dcos-mesos-*"], "exclude": ["cmd"]},
+		"since": "2019-10-01T12:00:00Z",
+		"until": "2019-10-01T12:20:00Z",
+		"format": "tar.zst"
+	}`
+	req, err := http.NewRequest(http.MethodPut, bundlesEndpoint+"/bundle-0", strings.NewReader(body))
+	require.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	since := time.Date(2019, 10, 1, 12, 0, 0, 0, time.UTC)
+	until := since.Add(20 * time.Minute)
+	assert.Equal(t, BundleOptions{
+		Collectors:     CollectorSelection{Include: []string{"dcos-mesos-*"}, Exclude: []string{"cmd"}},
+		Window:         collector.TimeWindow{Since: since, Until: until},
+		Format:         archive.TarZst,
+		SkipEncryption: true,
+	}, <-coord.options)
+
+	bundle, err := readBundleState(workdir, "bundle-0")
+	require.NoError(t, err)
+	assert.Equal(t, &since, bundle.Since)
+	assert.Equal(t, &until, bundle.Until)
+	assert.Equal(t, archive.TarZst, bundle.Format)
+}
+
+func TestRemoteBundleCreationErrorWhenCollectorPatternIsInvalid(t *testing.T) {
+	workdir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workdir)
+
+	bh := ClusterBundleHandler{
+		workDir:    workdir,
+		bundles:    NewBundleRegistry(),
+		coord:      mockCoordinator{},
+		timeout:    time.Second,
+		urlBuilder: MockURLBuilder{},
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc(bundleEndpoint, bh.Create).Methods(http.MethodPut)
+
+	req, err := http.NewRequest(http.MethodPut, bundlesEndpoint+"/bundle-0",
+		strings.NewReader(`{"collectors": {"include": ["dcos-["]}}`))
+	require.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.JSONEq(t, `{"code":400,"error":"could not parse request body invalid collector pattern \"dcos-[\": syntax error in pattern"}`,
+		rr.Body.String())
+	assert.False(t, bh.bundleExists("bundle-0"))
+}
+
+func TestCancelBundle(t *testing.T) {
+	workdir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workdir)
+
+	tools := new(MockedTools)
+	tools.On("GetMasterNodes").Return([]dcos.Node{
+		{Role: "master", IP: "192.0.2.2"},
+		{Role: "master", IP: "192.0.2.4"},
+	}, nil)
+
+	id := "bundle-0"
+	client := &MockClient{
+		cancel: func(ctx context.Context, node string, ID string) (*Bundle, error) {
+			assert.Equal(t, id, ID)
+			if node == "http://192.0.2.4" {
+				return &Bundle{ID: id, Type: Cluster, Status: Canceled}, nil
+			}
+			return nil, &DiagnosticsBundleNotFoundError{id: ID}
+		},
+	}
+
+	bh := ClusterBundleHandler{
+		workDir:    workdir,
+		bundles:    NewBundleRegistry(),
+		client:     client,
+		tools:      tools,
+		timeout:    time.Second,
+		urlBuilder: MockURLBuilder{},
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc(bundleCancelEndpoint, bh.Cancel).Methods(http.MethodPost)
+
+	req, err := http.NewRequest(http.MethodPost, bundlesEndpoint+"/"+id+"/cancel", nil)
+	require.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"id":"bundle-0","type":"Cluster","status":"Canceled","started_at":"0001-01-01T00:00:00Z","stopped_at":"0001-01-01T00:00:00Z"}`, rr.Body.String())
+}
+
+func TestCancelFinishedBundle(t *testing.T) {
+	workdir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workdir)
+
+	tools := new(MockedTools)
+	tools.On("GetMasterNodes").Return([]dcos.Node{
+		{Role: "master", IP: "192.0.2.2"},
+	}, nil)
+
+	client := &MockClient{
+		cancel: func(ctx context.Context, node string, ID string) (*Bundle, error) {
+			return nil, &DiagnosticsBundleNotCancelableError{id: ID}
+		},
+	}
+
+	bh := ClusterBundleHandler{
+		workDir:    workdir,
+		bundles:    NewBundleRegistry(),
+		client:     client,
+		tools:      tools,
+		timeout:    time.Second,
+		urlBuilder: MockURLBuilder{},
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc(bundleCancelEndpoint, bh.Cancel).Methods(http.MethodPost)
+
+	req, err := http.NewRequest(http.MethodPost, bundlesEndpoint+"/bundle-0/cancel", nil)
+	require.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	assert.JSONEq(t, `{"code":409,"error":"bundle bundle-0 is already finished and could not be canceled"}`, rr.Body.String())
+}
+
+func TestRunningClusterBundleCanBeCanceledWithNodeAPI(t *testing.T) {
+	workdir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workdir)
+
+	now, err := time.Parse(time.RFC3339, "2015-08-05T08:40:51.620Z")
+	require.NoError(t, err)
+
+	tools := new(MockedTools)
+	tools.On("GetMasterNodes").Return([]dcos.Node{{Role: "master", IP: "192.0.2.2"}}, nil)
+	tools.On("GetAgentNodes").Return([]dcos.Node{{Role: "agent", IP: "192.0.2.1"}}, nil)
+
+	bundles := NewBundleRegistry()
+	cbh := ClusterBundleHandler{
+		workDir:    workdir,
+		bundles:    bundles,
+		coord:      blockingCoordinator{},
+		tools:      tools,
+		timeout:    time.Hour,
+		clock:      &MockClock{now: now},
+		urlBuilder: MockURLBuilder{},
+	}
+
+	bh, err := NewBundleHandler(workdir, nil, time.Hour, time.Hour, 1, BundleHandlerOptions{Registry: bundles})
+	require.NoError(t, err)
+
+	router := mux.NewRouter()
+	router.HandleFunc(bundleEndpoint, cbh.Create).Methods(http.MethodPut)
+	router.HandleFunc(bundleCancelEndpoint, bh.Cancel).Methods(http.MethodPost)
+
+	req, err := http.NewRequest(http.MethodPut, bundlesEndpoint+"/bundle-0", nil)
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	req, err = http.NewRequest(http.MethodPost, bundlesEndpoint+"/bundle-0/cancel", nil)
+	require.NoError(t, err)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, string(jsonMarshal(Bundle{
+		ID:      "bundle-0",
+		Type:    Cluster,
+		Status:  Canceled,
+		Started: now.Add(time.Hour),
+		Stopped: now.Add(2 * time.Hour),
+		Errors:  []string{"context canceled"},
+		Nodes: map[string]nodeBundleReport{
+			"192.0.2.1": {Status: Canceled},
+			"192.0.2.2": {Status: Canceled},
+		},
+	})), rr.Body.String())
+
+	_, err = os.Stat(filepath.Join(workdir, "bundle-0", dataFileName))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestTrackProgressUpdatesStateFile(t *testing.T) {
+	workdir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workdir)
+
+	bundle := Bundle{ID: "bundle-0", Type: Cluster, Status: Started}
+	require.NoError(t, os.MkdirAll(filepath.Join(workdir, bundle.ID), dirPerm))
+
+	bh := ClusterBundleHandler{workDir: workdir, bundles: NewBundleRegistry()}
+
+	agent := node{IP: net.ParseIP("192.0.2.1"), Role: "agent"}
+	master := node{IP: net.ParseIP("192.0.2.2"), Role: "master"}
+
+	statuses := make(chan BundleStatus)
+	out, stop := bh.trackProgress(bundle, 2, statuses)
+	defer stop()
+
+	readState := func() Bundle {
+		raw, err := ioutil.ReadFile(filepath.Join(workdir, bundle.ID, stateFileName))
+		require.NoError(t, err)
+		state := Bundle{}
+		require.NoError(t, json.Unmarshal(raw, &state))
+		return state
+	}
+
+	statuses <- BundleStatus{id: "local", node: agent, progress: 50}
+	assert.Equal(t, agent, (<-out).node)
+	assert.Equal(t, Bundle{
+		ID:                 "bundle-0",
+		Type:               Cluster,
+		Status:             InProgress,
+		ProgressPercentage: 25,
+		Nodes: map[string]nodeBundleReport{
+			"192.0.2.1": {Status: InProgress, Progress: 50},
+		},
+	}, readState())
+
+	statuses <- BundleStatus{id: "local", node: master, done: true, err: fmt.Errorf("some error")}
+	<-out
+	statuses <- BundleStatus{id: "local", node: agent, done: true}
+	<-out
+	assert.Equal(t, Bundle{
+		ID:                 "bundle-0",
+		Type:               Cluster,
+		Status:             InProgress,
+		ProgressPercentage: 100,
+		Nodes: map[string]nodeBundleReport{
+			"192.0.2.1": {Status: Done, Progress: 100},
+			"192.0.2.2": {Status: Failed, Err: "some error", Progress: 100},
+		},
+	}, readState())
+}
+
+func TestTrackProgressStopsWhenStatusesAreNotConsumed(t *testing.T) {
+	workdir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workdir)
+
+	bundle := Bundle{ID: "bundle-0", Type: Cluster, Status: Started}
+	require.NoError(t, os.MkdirAll(filepath.Join(workdir, bundle.ID), dirPerm))
+
+	bh := ClusterBundleHandler{workDir: workdir, bundles: NewBundleRegistry()}
+
+	statuses := make(chan BundleStatus, 1)
+	statuses <- BundleStatus{id: "local", node: node{IP: net.ParseIP("192.0.2.1")}, done: true}
+	_, stop := bh.trackProgress(bundle, 2, statuses)
+
+	stop() // should not block even if nobody reads returned channel
+}
+
 func TestClusterBundleHandlerWorkDirIsCreatedIfNotExists(t *testing.T) {
 	t.Parallel()
 
@@ -1097,7 +1599,7 @@ func TestClusterBundleHandlerWorkDirIsCreatedIfNotExists(t *testing.T) {
 	client := &MockClient{}
 	tools := &MockedTools{}
 	urlBuilder := MockURLBuilder{}
-	_, err = NewClusterBundleHandler(coord, client, tools, workdir, time.Millisecond, urlBuilder)
+	_, err = NewClusterBundleHandler(coord, client, tools, workdir, time.Millisecond, urlBuilder, nil, nil, nil, nil, nil)
 	require.NoError(t, err)
 
 	assert.DirExists(t, workdir)
@@ -1114,13 +1616,13 @@ func TestClusterBundleHandlerWorkDirInitFailsWhenFileExists(t *testing.T) {
 	client := &MockClient{}
 	tools := &MockedTools{}
 	urlBuilder := MockURLBuilder{}
-	_, err = NewClusterBundleHandler(coord, client, tools, workdir.Name(), time.Millisecond, urlBuilder)
+	_, err = NewClusterBundleHandler(coord, client, tools, workdir.Name(), time.Millisecond, urlBuilder, nil, nil, nil, nil, nil)
 	assert.Error(t, err)
 }
 
 type mockCoordinator struct{}
 
-func (c mockCoordinator) CreateBundle(ctx context.Context, id string, nodes []node) <-chan BundleStatus {
+func (c mockCoordinator) CreateBundle(ctx context.Context, id string, nodes []node, _ BundleOptions) <-chan BundleStatus {
 	statuses := make(chan BundleStatus, len(nodes))
 
 	for _, n := range nodes {
@@ -1135,8 +1637,37 @@ func (c mockCoordinator) CreateBundle(ctx context.Context, id string, nodes []no
 	return statuses
 }
 
-func (c mockCoordinator) CollectBundle(ctx context.Context, id string, numBundles int, statuses <-chan BundleStatus) (string, error) {
-	return filepath.Abs(filepath.Join("testdata", "combined.zip"))
+func (c mockCoordinator) CollectBundle(ctx context.Context, id string, numBundles int, statuses <-chan BundleStatus,
+	_ archive.Format, dst io.Writer) (bundleReport, error) {
+	f, err := os.Open(filepath.Join("testdata", "combined.zip"))
+	if err != nil {
+		return bundleReport{ID: id}, err
+	}
+	defer f.Close()
+	_, err = io.Copy(dst, f)
+	return bundleReport{ID: id}, err
+}
+
+// nodesCoordinator records nodes of created bundles
+type nodesCoordinator struct {
+	mockCoordinator
+	nodes chan []node
+}
+
+func (c *nodesCoordinator) CreateBundle(ctx context.Context, id string, nodes []node, options BundleOptions) <-chan BundleStatus {
+	c.nodes <- nodes
+	return c.mockCoordinator.CreateBundle(ctx, id, nodes, options)
+}
+
+// optionsCoordinator records options of created bundles
+type optionsCoordinator struct {
+	mockCoordinator
+	options chan BundleOptions
+}
+
+func (c *optionsCoordinator) CreateBundle(ctx context.Context, id string, nodes []node, options BundleOptions) <-chan BundleStatus {
+	c.options <- options
+	return c.mockCoordinator.CreateBundle(ctx, id, nodes, options)
 }
 
 type MockURLBuilder struct{}
@@ -1144,3 +1675,25 @@ type MockURLBuilder struct{}
 func (m MockURLBuilder) BaseURL(ip net.IP, _ string) (string, error) {
 	return fmt.Sprintf("http://%s", ip), nil
 }
+
+// blockingCoordinator never finishes bundle until context is done
+type blockingCoordinator struct{}
+
+func (c blockingCoordinator) CreateBundle(ctx context.Context, id string, nodes []node, _ BundleOptions) <-chan BundleStatus {
+	statuses := make(chan BundleStatus, len(nodes))
+	for _, n := range nodes {
+		statuses <- BundleStatus{id: id, node: n}
+	}
+	return statuses
+}
+
+func (c blockingCoordinator) CollectBundle(ctx context.Context, id string, numBundles int, statuses <-chan BundleStatus,
+	_ archive.Format, _ io.Writer) (bundleReport, error) {
+	<-ctx.Done()
+	report := bundleReport{ID: id, Nodes: map[string]nodeBundleReport{}}
+	for i := 0; i < numBundles; i++ {
+		s := <-statuses
+		report.Nodes[s.node.IP.String()] = nodeBundleReport{Status: Canceled}
+	}
+	return report, ctx.Err()
+}
@@ -0,0 +1,128 @@
+package rest
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/dcos/dcos-diagnostics/archive"
+	"github.com/dcos/dcos-diagnostics/collector"
+	"github.com/dcos/dcos-diagnostics/units"
+)
+
+// BundleOptions customize what is collected on every node
+type BundleOptions struct {
+	Collectors CollectorSelection
+	Window     collector.TimeWindow
+	Format     archive.Format
+	// SkipEncryption disables encryption of bundles on nodes configured to encrypt them
+	SkipEncryption bool
+	Journal        collector.JournalOptions
+}
+
+// JournalSelection is the JSON form of journal options
+type JournalSelection struct {
+	// Format is text or json, empty is text
+	Format string `json:"format,omitempty"`
+	// Priority is the name or number of the least important syslog priority of collected entries e.g., warning
+	Priority string `json:"priority,omitempty"`
+	// Boots are boot IDs or offsets e.g., -1 for the previous boot
+	Boots []string `json:"boots,omitempty"`
+	// Message is a regular expression matching messages of collected entries
+	Message string `json:"message,omitempty"`
+}
+
+// parse validates journal selection and returns options understood by collectors
+func (s JournalSelection) parse() (collector.JournalOptions, error) {
+	format, err := collector.ParseJournalFormat(s.Format)
+	if err != nil {
+		return collector.JournalOptions{}, err
+	}
+	options := collector.JournalOptions{Format: format}
+
+	if s.Priority != "" {
+		p, err := units.ParsePriority(s.Priority)
+		if err != nil {
+			return collector.JournalOptions{}, err
+		}
+		options.MaxPriority = &p
+	}
+	for _, b := range s.Boots {
+		boot, err := units.ParseBoot(b)
+		if err != nil {
+			return collector.JournalOptions{}, err
+		}
+		options.Boots = append(options.Boots, boot)
+	}
+	if s.Message != "" {
+		options.Message, err = regexp.Compile(s.Message)
+		if err != nil {
+			return collector.JournalOptions{}, fmt.Errorf("invalid message pattern %q: %s", s.Message, err)
+		}
+	}
+	return options, nil
+}
+
+func newJournalSelection(o collector.JournalOptions) JournalSelection {
+	s := JournalSelection{Format: string(o.Format)}
+	if o.MaxPriority != nil {
+		s.Priority = o.MaxPriority.String()
+	}
+	for _, b := range o.Boots {
+		s.Boots = append(s.Boots, b.String())
+	}
+	if o.Message != nil {
+		s.Message = o.Message.String()
+	}
+	return s
+}
+
+// CollectorSelection limits collectors run during bundle creation. Every pattern is a collector name,
+// a glob over collector names (see path.Match) or a collector type e.g., "systemd" or "cmd".
+// When Include is empty all collectors are included. Excluded collectors are never run.
+type CollectorSelection struct {
+	Include []string `json:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+// validate checks if all patterns are valid globs
+func (s CollectorSelection) validate() error {
+	for _, pattern := range append(append([]string{}, s.Include...), s.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid collector pattern %q: %s", pattern, err)
+		}
+	}
+	return nil
+}
+
+// filter returns selected collectors in the order they are defined
+func (s CollectorSelection) filter(collectors []collector.Collector) []collector.Collector {
+	if len(s.Include) == 0 && len(s.Exclude) == 0 {
+		return collectors
+	}
+
+	selected := make([]collector.Collector, 0, len(collectors))
+	for _, c := range collectors {
+		if len(s.Include) > 0 && !matchesAny(c, s.Include) {
+			continue
+		}
+		if matchesAny(c, s.Exclude) {
+			continue
+		}
+		selected = append(selected, c)
+	}
+	return selected
+}
+
+func matchesAny(c collector.Collector, patterns []string) bool {
+	for _, pattern := range patterns {
+		if strings.EqualFold(pattern, collectorType(c)) {
+			return true
+		}
+		if matched, _ := path.Match(pattern, c.Name()); matched {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+package rest
+
+import (
+	"testing"
+
+	"github.com/dcos/dcos-diagnostics/collector"
+	"github.com/dcos/dcos-diagnostics/units"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func collectorNames(collectors []collector.Collector) []string {
+	names := []string{}
+	for _, c := range collectors {
+		names = append(names, c.Name())
+	}
+	return names
+}
+
+func TestCollectorSelectionFilter(t *testing.T) {
+	collectors := []collector.Collector{
+		collector.NewSystemd("dcos-mesos-master.service", false, "dcos-mesos-master.service", 0),
+		collector.NewSystemd("dcos-mesos-dns.service", false, "dcos-mesos-dns.service", 0),
+		collector.NewSystemd("dcos-adminrouter.service", false, "dcos-adminrouter.service", 0),
+		collector.NewCmd("ps_aux.output", false, []string{"ps", "aux"}),
+		collector.NewFile("var/log/mesos/mesos-master.log", false, "/var/log/mesos/mesos-master.log"),
+	}
+
+	for _, tc := range []struct {
+		name      string
+		selection CollectorSelection
+		expected  []string
+	}{
+		{
+			name:      "all",
+			selection: CollectorSelection{},
+			expected: []string{"dcos-mesos-master.service", "dcos-mesos-dns.service", "dcos-adminrouter.service",
+				"ps_aux.output", "var/log/mesos/mesos-master.log"},
+		},
+		{
+			name:      "names and globs",
+			selection: CollectorSelection{Include: []string{"dcos-mesos-*", "var/log/mesos/*"}},
+			expected:  []string{"dcos-mesos-master.service", "dcos-mesos-dns.service", "var/log/mesos/mesos-master.log"},
+		},
+		{
+			name:      "types",
+			selection: CollectorSelection{Include: []string{"cmd", "File"}},
+			expected:  []string{"ps_aux.output", "var/log/mesos/mesos-master.log"},
+		},
+		{
+			name:      "exclude",
+			selection: CollectorSelection{Exclude: []string{"systemd", "ps_aux.output"}},
+			expected:  []string{"var/log/mesos/mesos-master.log"},
+		},
+		{
+			name:      "include and exclude",
+			selection: CollectorSelection{Include: []string{"systemd"}, Exclude: []string{"*dns*"}},
+			expected:  []string{"dcos-mesos-master.service", "dcos-adminrouter.service"},
+		},
+		{
+			name:      "nothing matches",
+			selection: CollectorSelection{Include: []string{"not-existing"}},
+			expected:  []string{},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.NoError(t, tc.selection.validate())
+			assert.Equal(t, tc.expected, collectorNames(tc.selection.filter(collectors)))
+		})
+	}
+}
+
+func TestCollectorSelectionValidateRejectsInvalidPatterns(t *testing.T) {
+	assert.EqualError(t, CollectorSelection{Include: []string{"dcos-["}}.validate(),
+		`invalid collector pattern "dcos-[": syntax error in pattern`)
+	assert.EqualError(t, CollectorSelection{Exclude: []string{"[]"}}.validate(),
+		`invalid collector pattern "[]": syntax error in pattern`)
+}
+
+func TestJournalSelectionParse(t *testing.T) {
+	s := JournalSelection{Format: "json", Priority: "4", Boots: []string{"-1", "0"}, Message: "(?i)killed process"}
+	options, err := s.parse()
+	require.NoError(t, err)
+
+	assert.Equal(t, collector.JSON, options.Format)
+	require.NotNil(t, options.MaxPriority)
+	assert.Equal(t, units.PriorityWarning, *options.MaxPriority)
+	assert.Equal(t, []units.Boot{{Offset: -1}, {Offset: 0}}, options.Boots)
+	assert.True(t, options.Message.MatchString("Out of memory: Killed process 42 (java)"))
+	assert.False(t, options.Message.MatchString("link is up"))
+
+	assert.Equal(t, JournalSelection{Format: "json", Priority: "warning", Boots: []string{"-1", "0"}, Message: "(?i)killed process"},
+		newJournalSelection(options))
+}
+
+func TestJournalSelectionParseReturnsErrorOnInvalidFilters(t *testing.T) {
+	_, err := JournalSelection{Priority: "warn"}.parse()
+	assert.EqualError(t, err,
+		`unknown priority "warn", must be one of emerg, alert, crit, err, warning, notice, info, debug or a number from 0 to 7`)
+
+	_, err = JournalSelection{Boots: []string{"previous"}}.parse()
+	assert.EqualError(t, err, `invalid boot "previous", must be a boot ID or an offset e.g., -1 for the previous boot`)
+
+	_, err = JournalSelection{Message: "("}.parse()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid message pattern "(": `)
+}
@@ -4,6 +4,7 @@ import (
 	"archive/zip"
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -11,8 +12,11 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/dcos/dcos-diagnostics/archive"
+
 	"github.com/sirupsen/logrus"
 )
 
@@ -22,10 +26,11 @@ const reportFileName = "report.json"
 
 // BundleStatus tracks the status of local bundle creation requests
 type BundleStatus struct {
-	id   string
-	node node
-	done bool
-	err  error
+	id       string
+	node     node
+	done     bool
+	err      error
+	progress float32 // local bundle progress percentage as reported by the node
 }
 
 // golangcli-lint marks this as dead code because nothing uses the interface
@@ -33,12 +38,14 @@ type BundleStatus struct {
 // coordinator is an interface to coordinate the creation of diagnostics bundles
 // across a cluster of nodes
 type Coordinator interface {
-	// CreateBundle starts the bundle creation process. Status updates be monitored
-	// on the returned channel.
-	CreateBundle(ctx context.Context, id string, nodes []node) <-chan BundleStatus
-	// CollectBundle waits until all the nodes' bundles have finished, downloads,
-	// and merges them. The resulting bundle zip file path is returned.
-	CollectBundle(ctx context.Context, bundleID string, numBundles int, statuses <-chan BundleStatus) (string, error)
+	// CreateBundle starts the bundle creation process with given options on every node.
+	// Status updates be monitored on the returned channel.
+	CreateBundle(ctx context.Context, id string, nodes []node, options BundleOptions) <-chan BundleStatus
+	// CollectBundle waits until all the nodes' bundles have finished, downloads them
+	// and streams their content into dst as a single archive in the given format. Per node report is returned.
+	// When ctx is canceled nodes' bundles are canceled and dst content is incomplete.
+	CollectBundle(ctx context.Context, bundleID string, numBundles int, statuses <-chan BundleStatus,
+		format archive.Format, dst io.Writer) (bundleReport, error)
 }
 
 // ParallelCoordinator implements Coordinator interface to coordinate bundle
@@ -67,8 +74,9 @@ type bundleReport struct {
 }
 
 type nodeBundleReport struct {
-	Status Status `json:"status"`
-	Err    string `json:"error,omitempty"`
+	Status   Status  `json:"status"`
+	Err      string  `json:"error,omitempty"`
+	Progress float32 `json:"progress_percentage,omitempty"`
 }
 
 type bundleToDelete struct {
@@ -99,7 +107,7 @@ func worker(ctx context.Context, jobs <-chan job, statuses chan<- BundleStatus)
 
 // CreateBundle starts the bundle creation process. Status updates be monitored
 // on the returned channel.
-func (c ParallelCoordinator) CreateBundle(ctx context.Context, id string, nodes []node) <-chan BundleStatus {
+func (c ParallelCoordinator) CreateBundle(ctx context.Context, id string, nodes []node, options BundleOptions) <-chan BundleStatus {
 
 	jobs := make(chan job, len(nodes))
 	statuses := make(chan BundleStatus, len(nodes))
@@ -112,62 +120,126 @@ func (c ParallelCoordinator) CreateBundle(ctx context.Context, id string, nodes
 		// necessary to prevent the closure from giving the same node to all the calls
 		tmpNode := n
 		jobs <- func(ctx context.Context) BundleStatus {
-			return c.createBundle(ctx, tmpNode, id, jobs)
+			return c.createBundle(ctx, tmpNode, id, options, jobs)
 		}
 	}
 
 	return statuses
 }
 
-// CollectBundle waits until all the nodes' bundles have finished, downloads,
-// and merges them. The resulting bundle zip file path is returned.
-func (c ParallelCoordinator) CollectBundle(ctx context.Context, bundleID string, numBundles int, statuses <-chan BundleStatus) (string, error) {
-
-	// holds the paths to the downloaded local bundles before merging
-	var bundlePaths []string
+// CollectBundle waits until all the nodes' bundles have finished, downloads them
+// and streams their content into dst as a single archive in the given format. Per node report is returned.
+// Every node bundle is merged as soon as it's downloaded and then removed, so only
+// one node bundle is stored in the work dir at a time.
+// When ctx is canceled unfinished nodes' bundles are canceled right away and dst content is incomplete.
+func (c ParallelCoordinator) CollectBundle(ctx context.Context, bundleID string, numBundles int,
+	statuses <-chan BundleStatus, format archive.Format, dst io.Writer) (bundleReport, error) {
 
 	report := bundleReport{
 		ID:    bundleID,
 		Nodes: make(map[string]nodeBundleReport, numBundles),
 	}
 
+	merger, err := newBundleMerger(dst, format)
+	if err != nil {
+		return report, err
+	}
+
 	var bundlesToDelete = make([]bundleToDelete, numBundles)
+	// bundles of nodes that are not finished yet by node base URL
+	unfinished := make(map[string]bundleToDelete)
+	// nodes whose bundles were canceled as soon as ctx was canceled
+	canceledNodes := make(map[string]bool)
+	cancels := &sync.WaitGroup{}
+	cancel := func(b bundleToDelete) {
+		canceledNodes[b.baseURL] = true
+		cancels.Add(1)
+		go func() {
+			defer cancels.Done()
+			c.cancelLocalBundle(context.Background(), b)
+		}()
+	}
+	done := ctx.Done()
 
 	for finishedBundles := 0; finishedBundles < numBundles; {
 
-		s := <-statuses
+		var s BundleStatus
+		select {
+		case s = <-statuses:
+		case <-done:
+			// nodes are canceled right away, their bundles could run long before the next status check
+			done = nil
+			if ctx.Err() == context.Canceled {
+				for _, b := range unfinished {
+					cancel(b)
+				}
+			}
+			continue
+		}
 
 		if !s.done {
+			b := bundleToDelete{baseURL: s.node.baseURL, localBundleID: s.id}
+			unfinished[b.baseURL] = b
+			if ctx.Err() == context.Canceled && !canceledNodes[b.baseURL] {
+				cancel(b)
+			}
 			logrus.WithError(s.err).WithField("IP", s.node.IP).WithField("ID", s.id).Info("Got status update. Bundle not ready.")
 			continue
 		}
 
+		delete(unfinished, s.node.baseURL)
 		bundlesToDelete[finishedBundles] = bundleToDelete{baseURL: s.node.baseURL, localBundleID: s.id}
 		// even if the bundle finished with an error, it's now finished so increment finishedBundles
 		finishedBundles++
+		if ctx.Err() == context.Canceled {
+			report.Nodes[s.node.IP.String()] = nodeBundleReport{Status: Canceled}
+			logrus.WithField("IP", s.node.IP).WithField("ID", s.id).Info("Bundle canceled")
+			continue
+		}
 		if s.err != nil {
 			report.Nodes[s.node.IP.String()] = nodeBundleReport{Status: Failed, Err: s.err.Error()}
 			logrus.WithError(s.err).WithField("IP", s.node.IP).WithField("ID", s.id).Warn("Bundle errored")
 			continue
 		}
 
-		bundlePath := filepath.Join(c.workDir, nodeBundleFilename(s.node))
+		// bundle ID prevents collisions with node bundles of other cluster bundles created at the same time
+		bundlePath := filepath.Join(c.workDir, bundleID+"-"+nodeBundleFilename(s.node))
 		err := c.client.GetFile(ctx, s.node.baseURL, s.id, bundlePath)
+		if err == nil && ctx.Err() == context.Canceled {
+			err = ctx.Err()
+		}
+		if err == nil {
+			err = merger.append(bundlePath, s.node)
+		}
+		if e := os.Remove(bundlePath); e != nil && !os.IsNotExist(e) {
+			logrus.WithError(e).WithField("path", bundlePath).Warn("Could not remove node bundle")
+		}
+		if ctx.Err() == context.Canceled {
+			report.Nodes[s.node.IP.String()] = nodeBundleReport{Status: Canceled}
+			logrus.WithField("IP", s.node.IP).WithField("ID", s.id).Info("Bundle canceled")
+			continue
+		}
 		if err != nil {
 			report.Nodes[s.node.IP.String()] = nodeBundleReport{Status: Failed, Err: err.Error()}
-			logrus.WithError(err).WithField("IP", s.node.IP).WithField("ID", s.id).Warn("Could not download file")
+			logrus.WithError(err).WithField("IP", s.node.IP).WithField("ID", s.id).Warn("Could not download or merge file")
 			continue
 		}
 
 		logrus.WithError(s.err).WithField("IP", s.node.IP).WithField("ID", s.id).Info("Got status update. Bundle READY.")
 		report.Nodes[s.node.IP.String()] = nodeBundleReport{Status: Done}
-		bundlePaths = append(bundlePaths, bundlePath)
 	}
 
+	canceled := ctx.Err() == context.Canceled
+
 	// Run cleanup in separated goroutine so it will not block bundle generation process
 	go func() {
+		// bundles are deleted after they are canceled
+		cancels.Wait()
 		for _, b := range bundlesToDelete {
 			// Using context.Background prevents interruptions during cleanup
+			if canceled && !canceledNodes[b.baseURL] {
+				c.cancelLocalBundle(context.Background(), b)
+			}
 			err := c.client.Delete(context.Background(), b.baseURL, b.localBundleID)
 			if err != nil {
 				logrus.WithError(err).WithField("URL", b.baseURL).
@@ -176,112 +248,289 @@ func (c ParallelCoordinator) CollectBundle(ctx context.Context, bundleID string,
 		}
 	}()
 
-	return mergeZips(report, bundlePaths, c.workDir)
-}
+	if canceled {
+		for ip, n := range report.Nodes {
+			if n.Status == Done {
+				report.Nodes[ip] = nodeBundleReport{Status: Canceled}
+			}
+		}
+		return report, ctx.Err()
+	}
 
-func mergeZips(report bundleReport, bundlePaths []string, workDir string) (string, error) {
+	return report, merger.close(report)
+}
 
-	bundlePath := filepath.Join(workDir, fmt.Sprintf("bundle-%s.zip", report.ID))
-	mergedZip, err := os.Create(bundlePath)
-	if err != nil {
-		return "", err
+func (c ParallelCoordinator) cancelLocalBundle(ctx context.Context, b bundleToDelete) {
+	_, err := c.client.Cancel(ctx, b.baseURL, b.localBundleID)
+	switch err.(type) {
+	case nil, *DiagnosticsBundleNotFoundError, *DiagnosticsBundleNotCancelableError:
+		return
 	}
-	defer mergedZip.Close()
+	logrus.WithError(err).WithField("URL", b.baseURL).
+		WithField("ID", b.localBundleID).Warn("Could not cancel local bundle")
+}
 
-	zipWriter := zip.NewWriter(mergedZip)
-	defer zipWriter.Close()
+// bundleMerger streams content of node bundles into a single cluster bundle
+type bundleMerger struct {
+	zip      *rawZipWriter  // set for zip bundles, node bundles files are copied without recompression
+	archive  archive.Writer // set for other formats
+	manifest manifest
+	errors   bytes.Buffer // summary of node bundles errors
+}
 
-	reportFile, err := zipWriter.Create(reportFileName)
+func newBundleMerger(dst io.Writer, format archive.Format) (*bundleMerger, error) {
+	m := &bundleMerger{manifest: manifest{Entries: []manifestEntry{}}}
+	if format == "" || format == archive.Zip {
+		m.zip = newRawZipWriter(dst)
+		return m, nil
+	}
+	w, err := archive.NewWriter(format, dst)
 	if err != nil {
-		return "", fmt.Errorf("could not create file %s: %s", reportFileName, err)
+		return nil, err
+	}
+	m.archive = w
+	return m, nil
+}
+
+// append copies content of the node bundle from given path. Zip bundles accept only zip node bundles,
+// other formats accept node bundles in any format e.g., zip bundles of nodes running older versions.
+func (m *bundleMerger) append(path string, n node) error {
+	var rc io.ReadCloser
+	var entries []manifestEntry
+	var err error
+	if m.zip != nil {
+		rc, entries, err = appendToZip(m.zip, path, n)
+	} else {
+		rc, entries, err = appendToArchive(m.archive, path, n)
 	}
-	_, err = io.Copy(reportFile, bytes.NewReader(jsonMarshal(report)))
 	if err != nil {
-		return "", fmt.Errorf("could not copy file %s to zip: %s", reportFileName, err)
+		return err
+	}
+	defer rc.Close()
+
+	if _, err := io.Copy(&m.errors, rc); err != nil {
+		return err
 	}
+	m.manifest.Entries = append(m.manifest.Entries, entries...)
+	return nil
+}
 
-	errorBuffer := bytes.NewBuffer(nil)
+// close writes errors summary, report and manifest and finishes the cluster bundle
+func (m *bundleMerger) close(report bundleReport) error {
+	now := time.Now()
 
-	for _, p := range bundlePaths {
-		rc, e := appendToZip(zipWriter, p)
-		if e != nil {
-			return "", e
-		}
-		_, e = io.Copy(errorBuffer, rc)
-		if e != nil {
-			return "", e
+	if m.errors.Len() > 0 {
+		if err := m.writeFile(summaryErrorsReportFileName, m.errors.Bytes(), now); err != nil {
+			return fmt.Errorf("could not create file %s: %s", summaryErrorsReportFileName, err)
 		}
 	}
 
-	if errorBuffer.Len() > 0 {
-		summaryErrorsReportFile, err := zipWriter.Create(summaryErrorsReportFileName)
-		if err != nil {
-			return "", fmt.Errorf("could not create file %s: %s", summaryErrorsReportFileName, err)
-		}
-		_, err = io.Copy(summaryErrorsReportFile, errorBuffer)
-		if err != nil {
-			return "", fmt.Errorf("could not copy file %s to zip: %s", summaryErrorsReportFileName, err)
-		}
+	if err := m.writeFile(reportFileName, jsonMarshal(report), now); err != nil {
+		return fmt.Errorf("could not create file %s: %s", reportFileName, err)
 	}
 
-	return mergedZip.Name(), nil
+	if err := m.writeFile(manifestFileName, jsonMarshal(m.manifest), now); err != nil {
+		return fmt.Errorf("could not create file %s: %s", manifestFileName, err)
+	}
+
+	if m.zip != nil {
+		return m.zip.close()
+	}
+	return m.archive.Close()
 }
 
-func appendToZip(writer *zip.Writer, path string) (io.ReadCloser, error) {
+func (m *bundleMerger) writeFile(name string, data []byte, modified time.Time) error {
+	if m.zip != nil {
+		return m.zip.writeFile(name, data, modified)
+	}
+	return archive.WriteFile(m.archive, name, data, modified)
+}
+
+// appendToZip copies content of the node bundle from given path to the writer. Files are copied
+// without decompression. It returns node bundle errors summary and manifest entries of the copied files.
+func appendToZip(writer *rawZipWriter, path string, n node) (io.ReadCloser, []manifestEntry, error) {
 	rc := ioutil.NopCloser(bytes.NewReader(nil))
-	r, err := zip.OpenReader(path)
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not open %s: %s", path, err)
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not open %s: %s", path, err)
+	}
+
+	r, err := zip.NewReader(file, stat.Size())
 	if err != nil {
-		return nil, fmt.Errorf("could not open %s: %s", path, err)
+		return nil, nil, fmt.Errorf("could not open %s: %s", path, err)
 	}
-	defer r.Close()
 
-	base := strings.TrimSuffix(filepath.Base(path), ".zip")
+	base := nodeBundleDir(n)
+
+	// node manifest is not copied. Its entries are part of the cluster bundle manifest.
+	entries, described := splitManifest(readManifest(r.File), n)
 
 	for _, f := range r.File {
+		if f.Name == manifestFileName {
+			continue
+		}
 		if f.Name == summaryErrorsReportFileName {
 			fileReader, err := f.Open()
 			if err != nil {
-				return nil, fmt.Errorf("could not open %s from zip: %s", f.Name, err)
+				return nil, nil, fmt.Errorf("could not open %s from zip: %s", f.Name, err)
 			}
 
 			buf := bytes.NewBuffer(nil)
 			_, err = io.Copy(buf, fileReader)
 			if err != nil {
-				return nil, fmt.Errorf("could not read %s from zip: %s", f.Name, err)
+				return nil, nil, fmt.Errorf("could not read %s from zip: %s", f.Name, err)
 			}
 			rc = ioutil.NopCloser(buf)
 			continue
 		}
-		if err := addFileToZip(writer, f, base); err != nil {
-			return nil, err
+		entry, err := addFileToZip(writer, file, f, base)
+		if err != nil {
+			return nil, nil, err
 		}
+		// checksum is not computed because file is not decompressed, the one computed by the node is used
+		entries = append(entries, describedEntry(entry, f.Name, described, n))
 	}
 
-	return rc, nil
+	return rc, entries, nil
 }
 
-func addFileToZip(writer *zip.Writer, f *zip.File, base string) error {
-	rc, err := f.Open()
+// appendToArchive copies content of the node bundle in any format from given path to the writer.
+// It returns node bundle errors summary and manifest entries of the copied files.
+func appendToArchive(writer archive.Writer, path string, n node) (io.ReadCloser, []manifestEntry, error) {
+	// node bundle is read twice so it's validated before anything is written and a corrupted
+	// node bundle could not leave a partially written file in the cluster bundle
+	nodeManifest := manifest{}
+	summary := &bytes.Buffer{}
+	err := archive.Walk(path, func(h archive.Header, r io.Reader) error {
+		switch h.Name {
+		case manifestFileName:
+			if err := json.NewDecoder(r).Decode(&nodeManifest); err != nil {
+				logrus.WithError(err).Warn("Could not read node bundle manifest")
+				nodeManifest = manifest{}
+			}
+		case summaryErrorsReportFileName:
+			if _, err := io.Copy(summary, r); err != nil {
+				return fmt.Errorf("could not read %s from %s: %s", h.Name, path, err)
+			}
+		}
+		if _, err := io.Copy(ioutil.Discard, r); err != nil {
+			return fmt.Errorf("could not read %s from %s: %s", h.Name, path, err)
+		}
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("could not open %s from zip: %s", f.Name, err)
+		return nil, nil, err
 	}
-	defer rc.Close()
 
+	base := nodeBundleDir(n)
+
+	// node manifest is not copied. Its entries are part of the cluster bundle manifest.
+	entries, described := splitManifest(nodeManifest, n)
+
+	err = archive.Walk(path, func(h archive.Header, r io.Reader) error {
+		if h.Name == manifestFileName || h.Name == summaryErrorsReportFileName {
+			return nil
+		}
+		fileName, err := sanitizeExtractPath(h.Name, base)
+		if err != nil {
+			return err
+		}
+		f, err := writer.Create(archive.Header{Name: fileName, Size: h.Size, Modified: h.Modified})
+		if err != nil {
+			return fmt.Errorf("could not create file %s: %s", fileName, err)
+		}
+		size, err := io.Copy(f, r)
+		if err != nil {
+			return fmt.Errorf("could not copy file %s: %s", fileName, err)
+		}
+		entries = append(entries, describedEntry(manifestEntry{Path: fileName, Size: size}, h.Name, described, n))
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return ioutil.NopCloser(summary), entries, nil
+}
+
+// splitManifest returns node manifest entries without files and the node files entries by their paths
+func splitManifest(nodeManifest manifest, n node) ([]manifestEntry, map[string]manifestEntry) {
+	described := make(map[string]manifestEntry, len(nodeManifest.Entries))
+	var entries []manifestEntry
+	for _, e := range nodeManifest.Entries {
+		if e.Path == "" {
+			e.NodeIP = n.IP.String()
+			e.NodeRole = n.Role
+			entries = append(entries, e)
+			continue
+		}
+		described[e.Path] = e
+	}
+	return entries, described
+}
+
+// describedEntry returns entry of the file copied from the node bundle
+// with details described by the node manifest
+func describedEntry(entry manifestEntry, name string, described map[string]manifestEntry, n node) manifestEntry {
+	if e, ok := described[name]; ok {
+		e.Path, e.Size = entry.Path, entry.Size
+		entry = e
+	}
+	entry.NodeIP = n.IP.String()
+	entry.NodeRole = n.Role
+	return entry
+}
+
+// readManifest returns manifest from given zip files. Empty manifest is returned
+// when there is no manifest or it's malformed e.g., bundle was created by older version.
+func readManifest(files []*zip.File) manifest {
+	m := manifest{}
+	for _, f := range files {
+		if f.Name != manifestFileName {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			logrus.WithError(err).Warn("Could not open node bundle manifest")
+			return m
+		}
+		defer rc.Close()
+		if err := json.NewDecoder(rc).Decode(&m); err != nil {
+			logrus.WithError(err).Warn("Could not read node bundle manifest")
+			return manifest{}
+		}
+		return m
+	}
+	return m
+}
+
+// addFileToZip copies compressed content of the given file from the node bundle to the writer
+// and returns manifest entry describing its copy
+func addFileToZip(writer *rawZipWriter, bundle io.ReaderAt, f *zip.File, base string) (manifestEntry, error) {
 	fileName, err := sanitizeExtractPath(f.Name, base)
 	if err != nil {
-		return err
+		return manifestEntry{}, err
 	}
 
-	file, err := writer.Create(fileName)
+	offset, err := f.DataOffset()
 	if err != nil {
-		return fmt.Errorf("could not create file %s: %s", fileName, err)
+		return manifestEntry{}, fmt.Errorf("could not open %s from zip: %s", f.Name, err)
 	}
-	_, err = io.Copy(file, rc)
+
+	fh := f.FileHeader
+	fh.Name = fileName
+	err = writer.copyRaw(fh, io.NewSectionReader(bundle, offset, int64(f.CompressedSize64)))
 	if err != nil {
-		return fmt.Errorf("could not copy file %s to zip: %s", fileName, err)
+		return manifestEntry{}, fmt.Errorf("could not copy file %s to zip: %s", fileName, err)
 	}
 
-	return nil
+	return manifestEntry{Path: fileName, Size: int64(f.UncompressedSize64)}, nil
 }
 
 // see: https://snyk.io/research/zip-slip-vulnerability
@@ -293,8 +542,9 @@ func sanitizeExtractPath(filePath string, destination string) (string, error) {
 	return destpath, nil
 }
 
-func (c ParallelCoordinator) createBundle(ctx context.Context, node node, id string, jobs chan<- job) BundleStatus {
-	_, err := c.client.CreateBundle(ctx, node.baseURL, id)
+func (c ParallelCoordinator) createBundle(ctx context.Context, node node, id string, options BundleOptions,
+	jobs chan<- job) BundleStatus {
+	_, err := c.client.CreateBundle(ctx, node.baseURL, id, options)
 	if err != nil {
 		// Return done status with error. To mark node as errored so file will not be downloaded
 		return BundleStatus{
@@ -340,7 +590,7 @@ func (c ParallelCoordinator) waitForDone(ctx context.Context, node node, id stri
 		logrus.WithField("IP", node.IP).WithError(err).Error("Error occurred checking bundle status, continuing")
 		// then schedule next check in given time.
 		// It will only add check to job queue so interval might increase but it's OK.
-		time.AfterFunc(c.statusCheckInterval, statusCheck)
+		c.scheduleStatusCheck(ctx, statusCheck)
 		// Return status with error. Do not mark bundle as done yet. It might change it status
 		return BundleStatus{id: id, node: node, err: fmt.Errorf("could not check status: %s", err)}
 	}
@@ -353,11 +603,30 @@ func (c ParallelCoordinator) waitForDone(ctx context.Context, node node, id stri
 	// If bundle is still in progress (InProgress, Unknown or Started)
 	// then schedule next check in given time
 	// It will only add check to job queue so interval might increase but it's OK.
-	time.AfterFunc(c.statusCheckInterval, statusCheck)
+	c.scheduleStatusCheck(ctx, statusCheck)
 	// Return undone status with no error. Do not mark bundle as done yet. It might change it status
-	return BundleStatus{id: id, node: node}
+	return BundleStatus{id: id, node: node, progress: bundle.ProgressPercentage}
+}
+
+// scheduleStatusCheck runs check after the status check interval or as soon as ctx is done,
+// so canceled bundles are reported without waiting for the whole interval
+func (c ParallelCoordinator) scheduleStatusCheck(ctx context.Context, check func()) {
+	go func() {
+		timer := time.NewTimer(c.statusCheckInterval)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+		}
+		check()
+	}()
 }
 
 func nodeBundleFilename(n node) string {
-	return fmt.Sprintf("%s_%s.zip", n.IP, n.Role)
+	return nodeBundleDir(n) + ".zip"
+}
+
+// nodeBundleDir returns directory of the node files in the cluster bundle
+func nodeBundleDir(n node) string {
+	return fmt.Sprintf("%s_%s", n.IP, n.Role)
 }
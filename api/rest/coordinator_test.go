@@ -2,16 +2,22 @@ package rest
 
 import (
 	"archive/zip"
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/dcos/dcos-diagnostics/archive"
+
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -40,7 +46,7 @@ func TestCoordinator_CreatorShouldCreateAbundleAndReturnUpdateChan(t *testing.T)
 	expected := []BundleStatus{}
 
 	for _, n := range testNodes {
-		client.On("CreateBundle", ctx, n.baseURL, localBundleID).Return(&Bundle{ID: localBundleID, Status: Started}, nil)
+		client.On("CreateBundle", ctx, n.baseURL, localBundleID, BundleOptions{}).Return(&Bundle{ID: localBundleID, Status: Started}, nil)
 		client.On("Status", ctx, n.baseURL, localBundleID).Return(&Bundle{ID: localBundleID, Status: Done}, nil)
 
 		expected = append(expected,
@@ -48,7 +54,7 @@ func TestCoordinator_CreatorShouldCreateAbundleAndReturnUpdateChan(t *testing.T)
 			BundleStatus{id: localBundleID, node: n, done: true},
 		)
 	}
-	s := c.CreateBundle(context.TODO(), localBundleID, testNodes)
+	s := c.CreateBundle(context.TODO(), localBundleID, testNodes, BundleOptions{})
 
 	var statuses []BundleStatus
 
@@ -62,8 +68,9 @@ func TestCoordinator_CreatorShouldCreateAbundleAndReturnUpdateChan(t *testing.T)
 }
 
 func TestCoordinatorCreateAndCollect(t *testing.T) {
-	workDir, err := filepath.Abs("testdata")
+	workDir, err := ioutil.TempDir("", "work-dir")
 	require.NoError(t, err)
+	defer os.RemoveAll(workDir)
 
 	bundleID := "bundle-0"
 	localBundleID := "bundle-local"
@@ -83,7 +90,7 @@ func TestCoordinatorCreateAndCollect(t *testing.T) {
 	downloaded := make(chan bool)
 
 	client := &MockClient{
-		createBundle: func(ctx context.Context, node string, ID string) (bundle *Bundle, e error) {
+		createBundle: func(ctx context.Context, node string, ID string, _ BundleOptions) (bundle *Bundle, e error) {
 			return &Bundle{ID: localBundleID, Status: Started}, nil
 		},
 		status: func(ctx context.Context, node string, ID string) (bundle *Bundle, e error) {
@@ -97,7 +104,13 @@ func TestCoordinatorCreateAndCollect(t *testing.T) {
 			if node == failingNode.baseURL {
 				return fmt.Errorf("some error")
 			}
-			return nil
+			ip := strings.TrimPrefix(node, "http://")
+			for _, n := range testNodes {
+				if n.IP.String() == ip {
+					return copyFile(filepath.Join("testdata", nodeBundleFilename(n)), path)
+				}
+			}
+			return fmt.Errorf("unknown node %s", node)
 		},
 		delete: func(ctx context.Context, node string, ID string) (err error) {
 			if node == failingNode.baseURL {
@@ -107,38 +120,47 @@ func TestCoordinatorCreateAndCollect(t *testing.T) {
 		},
 	}
 
+	defer cancel()
+
 	go func() {
-		count := 0
+		// bundle on nodeInProgress is never finished so we need to wait for deadline
 		for range downloaded {
-			count++
-			if count == 4 {
-				break
-			}
 		}
-		cancel()
 	}()
 
 	c := NewParallelCoordinator(client, time.Microsecond, workDir)
 
-	statuses := c.CreateBundle(ctx, localBundleID, testNodes)
+	statuses := c.CreateBundle(ctx, localBundleID, testNodes, BundleOptions{})
+
+	bundle := &bytes.Buffer{}
+	_, err = c.CollectBundle(ctx, bundleID, len(testNodes), statuses, archive.Zip, bundle)
+	require.NoError(t, err)
 
-	bundlePath, err := c.CollectBundle(ctx, bundleID, len(testNodes), statuses)
+	// node bundles should be removed once they are merged
+	leftovers, err := ioutil.ReadDir(workDir)
 	require.NoError(t, err)
-	// ensure that the bundle is placed in the specified directory
-	assert.True(t, filepath.HasPrefix(bundlePath, workDir))
-	defer os.RemoveAll(bundlePath)
-	require.NotEmpty(t, bundlePath)
+	assert.Empty(t, leftovers)
 
-	zipReader, err := zip.OpenReader(bundlePath)
+	zipReader, err := zip.NewReader(bytes.NewReader(bundle.Bytes()), int64(bundle.Len()))
 	require.NoError(t, err)
-	defer zipReader.Close()
 
 	expectedFiles := map[string]string{
 		filepath.Join("192.0.2.1_agent", "test.txt"):        "test\n",
 		filepath.Join("192.0.2.2_master", "test.txt"):       "test\n",
 		filepath.Join("192.0.2.3_public_agent", "test.txt"): "test\n",
-		summaryErrorsReportFileName: "errorerrorerror",
-		reportFileName: `{"id":"bundle-0","nodes":{"192.0.2.1":{"status":"Done"},"192.0.2.2":{"status":"Done"},"192.0.2.3":{"status":"Done"},"192.0.2.4":{"status":"Failed","error":"some error"},"192.0.2.5":{"status":"Failed","error":"bundle creation context finished before bundle creation finished"}}}`,
+		summaryErrorsReportFileName:                         "errorerrorerror",
+		reportFileName:                                      `{"id":"bundle-0","nodes":{"192.0.2.1":{"status":"Done"},"192.0.2.2":{"status":"Done"},"192.0.2.3":{"status":"Done"},"192.0.2.4":{"status":"Failed","error":"some error"},"192.0.2.5":{"status":"Failed","error":"bundle creation context finished before bundle creation finished"}}}`,
+	}
+
+	// node bundles have no manifests so there are no checksums of their files
+	var expectedManifestEntries []manifestEntry
+	for _, n := range []node{node1, node2, node3} {
+		expectedManifestEntries = append(expectedManifestEntries, manifestEntry{
+			Path:     filepath.Join(strings.TrimSuffix(nodeBundleFilename(n), ".zip"), "test.txt"),
+			NodeIP:   n.IP.String(),
+			NodeRole: n.Role,
+			Size:     5,
+		})
 	}
 
 	files := map[string]string{}
@@ -150,6 +172,11 @@ func TestCoordinatorCreateAndCollect(t *testing.T) {
 		files[f.Name] = string(raw)
 	}
 
+	m := manifest{}
+	require.NoError(t, json.Unmarshal([]byte(files[manifestFileName]), &m))
+	delete(files, manifestFileName)
+	assert.ElementsMatch(t, expectedManifestEntries, m.Entries)
+
 	assert.Equal(t, expectedFiles, files)
 }
 
@@ -166,21 +193,18 @@ func TestCoordinatorCreateAndCollectNoNodes(t *testing.T) {
 
 	c := NewParallelCoordinator(nil, time.Microsecond, workDir)
 
-	statuses := c.CreateBundle(ctx, localBundleID, testNodes)
+	statuses := c.CreateBundle(ctx, localBundleID, testNodes, BundleOptions{})
 
-	bundlePath, err := c.CollectBundle(ctx, bundleID, len(testNodes), statuses)
+	bundle := &bytes.Buffer{}
+	_, err = c.CollectBundle(ctx, bundleID, len(testNodes), statuses, archive.Zip, bundle)
 	require.NoError(t, err)
-	// ensure that the bundle is placed in the specified directory
-	assert.True(t, filepath.HasPrefix(bundlePath, workDir))
-	defer os.RemoveAll(bundlePath)
-	require.NotEmpty(t, bundlePath)
 
-	zipReader, err := zip.OpenReader(bundlePath)
+	zipReader, err := zip.NewReader(bytes.NewReader(bundle.Bytes()), int64(bundle.Len()))
 	require.NoError(t, err)
-	defer zipReader.Close()
 
 	expectedFiles := map[string]string{
-		reportFileName: `{"id":"bundle-0","nodes":{}}`,
+		reportFileName:   `{"id":"bundle-0","nodes":{}}`,
+		manifestFileName: `{"entries":[]}`,
 	}
 
 	files := map[string]string{}
@@ -195,6 +219,314 @@ func TestCoordinatorCreateAndCollectNoNodes(t *testing.T) {
 	assert.Equal(t, expectedFiles, files)
 }
 
+func TestCoordinatorReportsNodeProgress(t *testing.T) {
+	n := node{IP: net.ParseIP("192.0.2.1"), Role: "agent", baseURL: "http://192.0.2.1"}
+
+	client := &MockClient{
+		createBundle: func(ctx context.Context, node string, ID string, _ BundleOptions) (bundle *Bundle, e error) {
+			return &Bundle{ID: ID, Status: Started}, nil
+		},
+		status: func(ctx context.Context, node string, ID string) (bundle *Bundle, e error) {
+			return &Bundle{ID: ID, Status: InProgress, ProgressPercentage: 42}, nil
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	c := NewParallelCoordinator(client, time.Hour, "testdata")
+	statuses := c.CreateBundle(ctx, "bundle-0", []node{n}, BundleOptions{})
+
+	assert.Equal(t, BundleStatus{id: "bundle-0", node: n}, <-statuses, "bundle creation status")
+	assert.Equal(t, BundleStatus{id: "bundle-0", node: n, progress: 42}, <-statuses, "bundle progress status")
+}
+
+func TestCoordinatorCreateAndCollectCanceled(t *testing.T) {
+	workDir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workDir)
+
+	bundleID := "bundle-0"
+	localBundleID := "bundle-local"
+
+	doneNode := node{IP: net.ParseIP("192.0.2.1"), Role: "agent", baseURL: "http://192.0.2.1"}
+	nodeInProgress := node{IP: net.ParseIP("192.0.2.2"), Role: "master", baseURL: "http://192.0.2.2"}
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	canceled := make(chan string, 2)
+	deleted := make(chan string, 2)
+
+	client := &MockClient{
+		createBundle: func(ctx context.Context, node string, ID string, _ BundleOptions) (bundle *Bundle, e error) {
+			return &Bundle{ID: localBundleID, Status: Started}, nil
+		},
+		status: func(ctx context.Context, node string, ID string) (bundle *Bundle, e error) {
+			if node == nodeInProgress.baseURL {
+				return &Bundle{ID: localBundleID, Status: InProgress}, nil
+			}
+			return &Bundle{ID: localBundleID, Status: Done}, nil
+		},
+		getFile: func(ctx context.Context, node string, ID string, path string) (err error) {
+			// bundle is canceled while node bundle is being downloaded
+			defer cancel()
+			return ioutil.WriteFile(path, []byte("partial"), filePerm)
+		},
+		cancel: func(ctx context.Context, node string, ID string) (*Bundle, error) {
+			canceled <- node
+			return &Bundle{ID: localBundleID, Status: Canceled}, nil
+		},
+		delete: func(ctx context.Context, node string, ID string) (err error) {
+			deleted <- node
+			return nil
+		},
+	}
+
+	c := NewParallelCoordinator(client, time.Microsecond, workDir)
+
+	statuses := c.CreateBundle(ctx, localBundleID, []node{doneNode, nodeInProgress}, BundleOptions{})
+
+	report, err := c.CollectBundle(ctx, bundleID, 2, statuses, archive.Zip, ioutil.Discard)
+	assert.EqualError(t, err, "context canceled")
+	assert.Equal(t, bundleReport{
+		ID: bundleID,
+		Nodes: map[string]nodeBundleReport{
+			"192.0.2.1": {Status: Canceled},
+			"192.0.2.2": {Status: Canceled},
+		},
+	}, report)
+
+	// partial node bundles should be removed
+	files, err := ioutil.ReadDir(workDir)
+	require.NoError(t, err)
+	assert.Empty(t, files)
+
+	for i := 0; i < 2; i++ {
+		assert.Contains(t, []string{doneNode.baseURL, nodeInProgress.baseURL}, <-canceled)
+		assert.Contains(t, []string{doneNode.baseURL, nodeInProgress.baseURL}, <-deleted)
+	}
+}
+
+func TestCoordinatorCancelsNodesRightAway(t *testing.T) {
+	workDir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workDir)
+
+	localBundleID := "bundle-local"
+	nodes := []node{
+		{IP: net.ParseIP("192.0.2.1"), Role: "agent", baseURL: "http://192.0.2.1"},
+		{IP: net.ParseIP("192.0.2.2"), Role: "master", baseURL: "http://192.0.2.2"},
+	}
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	canceled := make(chan string, 2)
+	deleted := make(chan string, 2)
+
+	client := &MockClient{
+		createBundle: func(ctx context.Context, node string, ID string, _ BundleOptions) (bundle *Bundle, e error) {
+			return &Bundle{ID: localBundleID, Status: Started}, nil
+		},
+		status: func(ctx context.Context, node string, ID string) (bundle *Bundle, e error) {
+			return &Bundle{ID: localBundleID, Status: InProgress}, nil
+		},
+		cancel: func(ctx context.Context, node string, ID string) (*Bundle, error) {
+			canceled <- node
+			return &Bundle{ID: localBundleID, Status: Canceled}, nil
+		},
+		delete: func(ctx context.Context, node string, ID string) (err error) {
+			deleted <- node
+			return nil
+		},
+	}
+
+	// status of nodes bundles is not checked again before the test times out
+	c := NewParallelCoordinator(client, time.Hour, workDir)
+
+	statuses := c.CreateBundle(ctx, localBundleID, nodes, BundleOptions{})
+
+	type result struct {
+		report bundleReport
+		err    error
+	}
+	results := make(chan result)
+	go func() {
+		report, err := c.CollectBundle(ctx, "bundle-0", len(nodes), statuses, archive.Zip, ioutil.Discard)
+		results <- result{report: report, err: err}
+	}()
+
+	// wait for status checks of both nodes
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	select {
+	case r := <-results:
+		assert.EqualError(t, r.err, "context canceled")
+		assert.Equal(t, map[string]nodeBundleReport{
+			"192.0.2.1": {Status: Canceled},
+			"192.0.2.2": {Status: Canceled},
+		}, r.report.Nodes)
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "bundle collection should stop as soon as it's canceled")
+	}
+
+	for i := 0; i < 2; i++ {
+		assert.Contains(t, []string{nodes[0].baseURL, nodes[1].baseURL}, <-canceled)
+		assert.Contains(t, []string{nodes[0].baseURL, nodes[1].baseURL}, <-deleted)
+	}
+	assert.Empty(t, canceled, "nodes should be canceled once")
+}
+
+func TestMergeZipsMergesNodesManifests(t *testing.T) {
+	workDir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workDir)
+
+	started := time.Date(2015, time.August, 5, 9, 40, 51, 0, time.UTC)
+	stopped := started.Add(time.Second)
+
+	n := node{IP: net.ParseIP("192.0.2.1"), Role: "agent"}
+	nodeBundlePath := filepath.Join(workDir, nodeBundleFilename(n))
+	f, err := os.Create(nodeBundlePath)
+	require.NoError(t, err)
+	w := zip.NewWriter(f)
+	file, err := w.Create("collector-1")
+	require.NoError(t, err)
+	_, err = file.Write([]byte("test\n"))
+	require.NoError(t, err)
+	file, err = w.Create(manifestFileName)
+	require.NoError(t, err)
+	_, err = file.Write(jsonMarshal(manifest{Entries: []manifestEntry{
+		{Path: "collector-1", Collector: "collector-1", Type: "Cmd", Started: started, Stopped: stopped, Size: 5, SHA256: "sha"},
+		{Collector: "collector-2", Type: "Endpoint", Started: started, Stopped: stopped, Failed: true, Err: "some error"},
+	}}))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.NoError(t, f.Close())
+
+	bundle := &bytes.Buffer{}
+	merger, err := newBundleMerger(bundle, archive.Zip)
+	require.NoError(t, err)
+	require.NoError(t, merger.append(nodeBundlePath, n))
+	require.NoError(t, merger.close(bundleReport{ID: "bundle-0"}))
+
+	zipReader, err := zip.NewReader(bytes.NewReader(bundle.Bytes()), int64(bundle.Len()))
+	require.NoError(t, err)
+
+	var names []string
+	m := manifest{}
+	for _, f := range zipReader.File {
+		names = append(names, f.Name)
+		if f.Name == manifestFileName {
+			rc, err := f.Open()
+			require.NoError(t, err)
+			require.NoError(t, json.NewDecoder(rc).Decode(&m))
+		}
+	}
+
+	assert.Equal(t, []string{filepath.Join("192.0.2.1_agent", "collector-1"), reportFileName, manifestFileName}, names)
+	assert.Equal(t, []manifestEntry{
+		{
+			Collector: "collector-2",
+			Type:      "Endpoint",
+			NodeIP:    "192.0.2.1",
+			NodeRole:  "agent",
+			Started:   started,
+			Stopped:   stopped,
+			Failed:    true,
+			Err:       "some error",
+		},
+		{
+			Path:      filepath.Join("192.0.2.1_agent", "collector-1"),
+			Collector: "collector-1",
+			Type:      "Cmd",
+			NodeIP:    "192.0.2.1",
+			NodeRole:  "agent",
+			Started:   started,
+			Stopped:   stopped,
+			Size:      5,
+			SHA256:    "sha",
+		},
+	}, m.Entries)
+}
+
+func TestMergeBundlesInTarFormats(t *testing.T) {
+	for _, format := range []archive.Format{archive.TarGz, archive.TarZst} {
+		format := format
+		t.Run(string(format), func(t *testing.T) {
+			workDir, err := ioutil.TempDir("", "work-dir")
+			require.NoError(t, err)
+			defer os.RemoveAll(workDir)
+
+			// node running older version returns zip bundle
+			zipNode := node{IP: net.ParseIP("192.0.2.1"), Role: "agent"}
+			zipBundlePath := filepath.Join(workDir, "zip-bundle")
+			writeTestZip(t, zipBundlePath, map[string]string{
+				"collector-1":               "test\n",
+				summaryErrorsReportFileName: "some error",
+				manifestFileName: string(jsonMarshal(manifest{Entries: []manifestEntry{
+					{Path: "collector-1", Collector: "collector-1", Size: 5, SHA256: "sha"},
+				}})),
+			})
+
+			tarNode := node{IP: net.ParseIP("192.0.2.2"), Role: "master"}
+			tarBundlePath := filepath.Join(workDir, "tar-bundle")
+			f, err := os.Create(tarBundlePath)
+			require.NoError(t, err)
+			w, err := archive.NewWriter(format, f)
+			require.NoError(t, err)
+			require.NoError(t, archive.WriteFile(w, "collector-2", []byte("OK"), time.Now()))
+			require.NoError(t, w.Close())
+			require.NoError(t, f.Close())
+
+			bundle := &bytes.Buffer{}
+			merger, err := newBundleMerger(bundle, format)
+			require.NoError(t, err)
+			require.NoError(t, merger.append(zipBundlePath, zipNode))
+			require.NoError(t, merger.append(tarBundlePath, tarNode))
+			require.NoError(t, merger.close(bundleReport{ID: "bundle-0"}))
+
+			bundlePath := filepath.Join(workDir, "bundle")
+			require.NoError(t, ioutil.WriteFile(bundlePath, bundle.Bytes(), filePerm))
+			detected, err := archive.DetectFormat(bundlePath)
+			require.NoError(t, err)
+			assert.Equal(t, format, detected)
+
+			files := map[string]string{}
+			require.NoError(t, archive.Walk(bundlePath, func(h archive.Header, r io.Reader) error {
+				content, err := ioutil.ReadAll(r)
+				files[h.Name] = string(content)
+				return err
+			}))
+
+			m := manifest{}
+			require.NoError(t, json.Unmarshal([]byte(files[manifestFileName]), &m))
+			assert.Equal(t, []manifestEntry{
+				{
+					Path:      filepath.Join("192.0.2.1_agent", "collector-1"),
+					Collector: "collector-1",
+					NodeIP:    "192.0.2.1",
+					NodeRole:  "agent",
+					Size:      5,
+					SHA256:    "sha",
+				},
+				{
+					Path:     filepath.Join("192.0.2.2_master", "collector-2"),
+					NodeIP:   "192.0.2.2",
+					NodeRole: "master",
+					Size:     2,
+				},
+			}, m.Entries)
+
+			delete(files, manifestFileName)
+			assert.Equal(t, map[string]string{
+				filepath.Join("192.0.2.1_agent", "collector-1"):  "test\n",
+				filepath.Join("192.0.2.2_master", "collector-2"): "OK",
+				summaryErrorsReportFileName:                      "some error",
+				reportFileName:                                   `{"id":"bundle-0","nodes":null}`,
+			}, files)
+		})
+	}
+}
+
 func TestAppendToZipErrorsWithMalformedZip(t *testing.T) {
 
 	testDataDir, err := filepath.Abs("testdata")
@@ -207,11 +539,12 @@ func TestAppendToZipErrorsWithMalformedZip(t *testing.T) {
 	defer os.Remove(bundlePath)
 	defer testZip.Close()
 
-	zipWriter := zip.NewWriter(testZip)
-	defer zipWriter.Close()
+	zipWriter := newRawZipWriter(testZip)
+	defer zipWriter.close()
 
 	invalidZipPath := filepath.Join(testDataDir, "not_a_zip.txt")
-	rc, err := appendToZip(zipWriter, invalidZipPath)
+	rc, entries, err := appendToZip(zipWriter, invalidZipPath, node{})
+	assert.Nil(t, entries)
 	assert.Nil(t, rc)
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "zip: not a valid zip file")
@@ -230,13 +563,13 @@ func TestHandlingForBundleUpdateInProgress(t *testing.T) {
 
 	n := node{IP: net.ParseIP("127.0.0.1"), Role: "master", baseURL: "http://127.0.0.1"}
 
-	client.On("CreateBundle", ctx, n.baseURL, localBundleID).Return(&Bundle{ID: localBundleID, Status: Started}, nil)
+	client.On("CreateBundle", ctx, n.baseURL, localBundleID, BundleOptions{}).Return(&Bundle{ID: localBundleID, Status: Started}, nil)
 
 	// The `Once`s here are necessary for it to find the calls in the expected order
 	client.On("Status", ctx, n.baseURL, localBundleID).Return(&Bundle{ID: localBundleID, Status: InProgress}, nil).Once()
 	client.On("Status", ctx, n.baseURL, localBundleID).Return(&Bundle{ID: localBundleID, Status: Done}, nil).Once()
 
-	statuses := c.CreateBundle(ctx, localBundleID, []node{n})
+	statuses := c.CreateBundle(ctx, localBundleID, []node{n}, BundleOptions{})
 
 	expected := []BundleStatus{
 		{
@@ -280,9 +613,9 @@ func TestErrorHandlingFromClientCreateBundle(t *testing.T) {
 	n := node{IP: net.ParseIP("127.0.0.1"), Role: "master", baseURL: "http://127.0.0.1"}
 
 	expectedErr := errors.New("this stands in for any of the possible errors CreateBundle could throw")
-	client.On("CreateBundle", ctx, n.baseURL, localBundleID).Return(nil, expectedErr)
+	client.On("CreateBundle", ctx, n.baseURL, localBundleID, BundleOptions{}).Return(nil, expectedErr)
 
-	s := c.CreateBundle(ctx, localBundleID, []node{n})
+	s := c.CreateBundle(ctx, localBundleID, []node{n}, BundleOptions{})
 
 	expected := BundleStatus{
 		id:   localBundleID,
@@ -310,13 +643,13 @@ func TestErrorHandlingFromClientStatus(t *testing.T) {
 
 	expectedErr := errors.New("this stands in for any of the possible errors Status could throw")
 
-	client.On("CreateBundle", ctx, n.baseURL, localBundleID).Return(&Bundle{ID: localBundleID, Status: Started}, nil)
+	client.On("CreateBundle", ctx, n.baseURL, localBundleID, BundleOptions{}).Return(&Bundle{ID: localBundleID, Status: Started}, nil)
 
 	// The `Once`s here are necessary for it to find the calls in the expected order
 	client.On("Status", ctx, n.baseURL, localBundleID).Return(nil, expectedErr).Once()
 	client.On("Status", ctx, n.baseURL, localBundleID).Return(&Bundle{ID: localBundleID, Status: Done}, nil).Once()
 
-	statuses := c.CreateBundle(ctx, localBundleID, []node{n})
+	statuses := c.CreateBundle(ctx, localBundleID, []node{n}, BundleOptions{})
 
 	expected := []BundleStatus{
 		{
@@ -361,12 +694,12 @@ func TestHandlingForCanceledContext(t *testing.T) {
 
 	n := node{IP: net.ParseIP("127.0.0.1"), Role: "master", baseURL: "http://127.0.0.1"}
 
-	client.On("CreateBundle", ctx, n.baseURL, localBundleID).Return(&Bundle{ID: localBundleID, Status: Started}, nil)
+	client.On("CreateBundle", ctx, n.baseURL, localBundleID, BundleOptions{}).Return(&Bundle{ID: localBundleID, Status: Started}, nil)
 
 	// stay in progress forever until the context is canceled
 	client.On("Status", ctx, n.baseURL, localBundleID).Return(&Bundle{ID: localBundleID, Status: InProgress}, nil)
 
-	statuses := c.CreateBundle(ctx, localBundleID, []node{n})
+	statuses := c.CreateBundle(ctx, localBundleID, []node{n}, BundleOptions{})
 
 	var results []BundleStatus
 
@@ -403,3 +736,11 @@ func TestHandlingForCanceledContext(t *testing.T) {
 		assert.Contains(t, expected, s)
 	}
 }
+
+func copyFile(src, dst string) error {
+	data, err := ioutil.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(dst, data, filePerm)
+}
@@ -0,0 +1,206 @@
+package rest
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/shirou/gopsutil/disk"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// bundleSizeHistory is the number of recent bundles used to estimate the size of a new one
+	bundleSizeHistory = 5
+	// clusterBundleSpaceFactor reflects that during creation cluster bundle data file is stored
+	// together with the node bundle being merged into it, which could be as big as the data file
+	clusterBundleSpaceFactor = 2
+	// diskSpaceCheckInterval is how often free disk space is checked while bundle is being created
+	diskSpaceCheckInterval = 5 * time.Second
+)
+
+// InsufficientStorageError is returned when there is not enough free disk space to create a bundle
+type InsufficientStorageError struct {
+	Required  uint64
+	Available uint64
+}
+
+func (e *InsufficientStorageError) Error() string {
+	return fmt.Sprintf("not enough free disk space to create bundle: %d bytes required, %d bytes available",
+		e.Required, e.Available)
+}
+
+// InsufficientStorageResponse is returned with 507 status when there is not enough free disk space to create a bundle
+type InsufficientStorageResponse struct {
+	ErrorResponse
+	RequiredBytes  uint64 `json:"required_bytes"`
+	AvailableBytes uint64 `json:"available_bytes"`
+}
+
+// DiskSpaceGuard prevents bundles from filling the disk. It rejects bundles that will not fit
+// in the free disk space and aborts bundles when free disk space drops below the minimum.
+// Nil guard accepts all bundles.
+type DiskSpaceGuard struct {
+	workDir  string
+	minFree  uint64 // number of bytes that must stay free on the work dir partition
+	interval time.Duration
+	usage    func(path string) (*disk.UsageStat, error)
+}
+
+func NewDiskSpaceGuard(workDir string, minFree uint64) *DiskSpaceGuard {
+	return &DiskSpaceGuard{
+		workDir:  workDir,
+		minFree:  minFree,
+		interval: diskSpaceCheckInterval,
+		usage:    disk.Usage,
+	}
+}
+
+// admit checks if bundle of the given type fits on the disk. Required space is estimated based on
+// the sizes of recent bundles of the same type and the minimum free disk space.
+func (g *DiskSpaceGuard) admit(t Type) *InsufficientStorageError {
+	if g == nil {
+		return nil
+	}
+
+	free, err := g.free()
+	if err != nil {
+		logrus.WithError(err).WithField("workDir", g.workDir).Warn("Could not check free disk space, bundle is accepted")
+		return nil
+	}
+
+	required := g.minFree + estimateBundleSize(g.workDir, t)
+	if free < required {
+		return &InsufficientStorageError{Required: required, Available: free}
+	}
+	return nil
+}
+
+// watch calls cancel when free disk space drops below the minimum. Returned function stops
+// watching and returns the reason why bundle creation was canceled, or nil if it was not.
+func (g *DiskSpaceGuard) watch(cancel context.CancelFunc) func() error {
+	if g == nil {
+		return func() error { return nil }
+	}
+
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	var reason error
+
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(g.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+
+			free, err := g.free()
+			if err != nil {
+				logrus.WithError(err).WithField("workDir", g.workDir).Warn("Could not check free disk space")
+				continue
+			}
+			if free < g.minFree {
+				reason = fmt.Errorf("bundle creation aborted: free disk space dropped to %d bytes, minimum is %d bytes",
+					free, g.minFree)
+				cancel()
+				return
+			}
+		}
+	}()
+
+	return func() error {
+		close(stop)
+		<-stopped
+		return reason
+	}
+}
+
+func (g *DiskSpaceGuard) free() (uint64, error) {
+	usage, err := g.usage(g.workDir)
+	if err != nil {
+		return 0, err
+	}
+	return usage.Free, nil
+}
+
+// estimateBundleSize returns the number of bytes needed to create a bundle of the given type.
+// It's the biggest of recent bundles of this type. Local bundle size is the size of its data file or
+// the sum of bytes collected by its collectors (they are spooled on disk before they are zipped),
+// whichever is bigger. Collectors history is kept even when bundle data was deleted.
+func estimateBundleSize(workDir string, t Type) uint64 {
+	infos, err := ioutil.ReadDir(workDir)
+	if err != nil {
+		logrus.WithError(err).WithField("workDir", workDir).Warn("Could not read bundles history")
+		return 0
+	}
+
+	type sample struct {
+		started time.Time
+		size    uint64
+	}
+	var history []sample
+
+	for _, info := range infos {
+		if !info.IsDir() {
+			continue
+		}
+		// state is read without the lock, a state being written at the same time is just skipped
+		bundle, err := readBundleState(workDir, info.Name())
+		if err != nil || bundle.Type != t || (bundle.Status != Done && bundle.Status != Deleted) {
+			continue
+		}
+
+		var size uint64
+		if s, err := os.Stat(filepath.Join(workDir, info.Name(), dataFileName)); err == nil {
+			size = uint64(s.Size())
+		}
+		var collected uint64
+		for _, c := range bundle.Collectors {
+			collected += uint64(c.Size)
+		}
+		if collected > size {
+			size = collected
+		}
+		if size > 0 {
+			history = append(history, sample{started: bundle.Started, size: size})
+		}
+	}
+
+	sort.Slice(history, func(i, j int) bool { return history[i].started.After(history[j].started) })
+	if len(history) > bundleSizeHistory {
+		history = history[:bundleSizeHistory]
+	}
+
+	var estimate uint64
+	for _, s := range history {
+		if s.size > estimate {
+			estimate = s.size
+		}
+	}
+
+	if t == Cluster {
+		estimate *= clusterBundleSpaceFactor
+	}
+	return estimate
+}
+
+func writeInsufficientStorage(w http.ResponseWriter, e *InsufficientStorageError) {
+	logrus.WithError(e).Warn("Bundle rejected")
+
+	w.WriteHeader(http.StatusInsufficientStorage)
+	write(w, jsonMarshal(InsufficientStorageResponse{
+		ErrorResponse:  ErrorResponse{Code: http.StatusInsufficientStorage, Error: e.Error()},
+		RequiredBytes:  e.Required,
+		AvailableBytes: e.Available,
+	}))
+}
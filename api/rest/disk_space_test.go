@@ -0,0 +1,262 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dcos/dcos-diagnostics/collector"
+	"github.com/gorilla/mux"
+	"github.com/shirou/gopsutil/disk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestDiskSpaceGuard(workDir string, minFree uint64, free uint64) *DiskSpaceGuard {
+	g := NewDiskSpaceGuard(workDir, minFree)
+	g.interval = time.Millisecond
+	g.usage = func(string) (*disk.UsageStat, error) { return &disk.UsageStat{Free: free}, nil }
+	return g
+}
+
+func TestEstimateBundleSizeWithoutHistory(t *testing.T) {
+	workDir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workDir)
+
+	assert.Zero(t, estimateBundleSize(workDir, Local))
+	assert.Zero(t, estimateBundleSize(workDir, Cluster))
+	assert.Zero(t, estimateBundleSize(filepath.Join(workDir, "not-existing"), Local))
+}
+
+func TestEstimateBundleSizeUsesRecentBundlesAndCollectorsHistory(t *testing.T) {
+	workDir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workDir)
+
+	now := time.Now()
+
+	// the biggest local bundle, but too old to be taken into account
+	writeBundle(t, workDir, Bundle{ID: "old", Status: Done, Started: now.Add(-time.Hour)}, make([]byte, 10000))
+	for i := 0; i < bundleSizeHistory-1; i++ {
+		writeBundle(t, workDir, Bundle{ID: fmt.Sprintf("local-%d", i), Status: Done, Started: now}, make([]byte, 100))
+	}
+	// deleted bundle has no data but its collectors show how much data was collected
+	writeBundle(t, workDir, Bundle{
+		ID:      "deleted",
+		Status:  Deleted,
+		Started: now,
+		Collectors: []collectorReport{
+			{Name: "collector-1", Status: CollectorDone, Size: 300},
+			{Name: "collector-2", Status: CollectorDone, Size: 200},
+		},
+	}, nil)
+	// failed and unfinished bundles are ignored
+	writeBundle(t, workDir, Bundle{ID: "failed", Status: Failed, Started: now}, make([]byte, 5000))
+	writeBundle(t, workDir, Bundle{ID: "running", Status: InProgress, Started: now}, make([]byte, 5000))
+
+	writeBundle(t, workDir, Bundle{ID: "cluster", Type: Cluster, Status: Done, Started: now}, make([]byte, 1000))
+
+	assert.EqualValues(t, 500, estimateBundleSize(workDir, Local))
+	assert.EqualValues(t, 1000*clusterBundleSpaceFactor, estimateBundleSize(workDir, Cluster))
+}
+
+func TestDiskSpaceGuardAdmit(t *testing.T) {
+	workDir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workDir)
+
+	writeBundle(t, workDir, Bundle{ID: "bundle-0", Status: Done, Started: time.Now()}, make([]byte, 1000))
+
+	assert.Nil(t, newTestDiskSpaceGuard(workDir, 100, 1100).admit(Local))
+	assert.Nil(t, newTestDiskSpaceGuard(workDir, 100, 100).admit(Cluster))
+	assert.Equal(t,
+		&InsufficientStorageError{Required: 1100, Available: 1099},
+		newTestDiskSpaceGuard(workDir, 100, 1099).admit(Local),
+	)
+
+	var g *DiskSpaceGuard
+	assert.Nil(t, g.admit(Local))
+
+	g = NewDiskSpaceGuard(workDir, 100)
+	g.usage = func(string) (*disk.UsageStat, error) { return nil, fmt.Errorf("some error") }
+	assert.Nil(t, g.admit(Local))
+}
+
+func TestDiskSpaceGuardWatchCancelsWhenFreeSpaceIsLow(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stopWatching := newTestDiskSpaceGuard("", 100, 99).watch(cancel)
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("context should be canceled")
+	}
+	assert.EqualError(t, stopWatching(),
+		"bundle creation aborted: free disk space dropped to 99 bytes, minimum is 100 bytes")
+}
+
+func TestDiskSpaceGuardWatchDoesNotCancelWhenThereIsEnoughSpace(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stopWatching := newTestDiskSpaceGuard("", 100, 100).watch(cancel)
+	time.Sleep(10 * time.Millisecond)
+
+	assert.NoError(t, stopWatching())
+	assert.NoError(t, ctx.Err())
+
+	var g *DiskSpaceGuard
+	assert.NoError(t, g.watch(cancel)())
+}
+
+func TestIfCreateReturns507WhenBundleWillNotFit(t *testing.T) {
+	t.Parallel()
+	workdir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workdir)
+
+	bh, err := NewBundleHandler(workdir, nil, time.Millisecond, collectorTimeout, 1,
+		BundleHandlerOptions{Space: newTestDiskSpaceGuard(workdir, 1024, 1000)})
+	require.NoError(t, err)
+
+	req, err := http.NewRequest(http.MethodPut, bundlesEndpoint+"/bundle-0", nil)
+	require.NoError(t, err)
+
+	router := mux.NewRouter()
+	router.HandleFunc(bundleEndpoint, bh.Create)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusInsufficientStorage, rr.Code)
+	assert.JSONEq(t, `{
+		"code": 507,
+		"error": "not enough free disk space to create bundle: 1024 bytes required, 1000 bytes available",
+		"required_bytes": 1024,
+		"available_bytes": 1000
+	}`, rr.Body.String())
+	assert.False(t, bh.bundleExists("bundle-0"))
+}
+
+func TestIfClusterCreateReturns507WhenBundleWillNotFit(t *testing.T) {
+	t.Parallel()
+	workdir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workdir)
+
+	writeBundle(t, workdir, Bundle{ID: "bundle-0", Type: Cluster, Status: Done, Started: time.Now()}, make([]byte, 100))
+
+	bh := ClusterBundleHandler{
+		workDir: workdir,
+		bundles: NewBundleRegistry(),
+		clock:   &MockClock{},
+		space:   newTestDiskSpaceGuard(workdir, 1000, 1199),
+	}
+
+	req, err := http.NewRequest(http.MethodPut, bundlesEndpoint+"/bundle-1", nil)
+	require.NoError(t, err)
+
+	router := mux.NewRouter()
+	router.HandleFunc(bundleEndpoint, bh.Create)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusInsufficientStorage, rr.Code)
+
+	resp := InsufficientStorageResponse{}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.EqualValues(t, 1000+100*clusterBundleSpaceFactor, resp.RequiredBytes)
+	assert.EqualValues(t, 1199, resp.AvailableBytes)
+	assert.False(t, bh.bundleExists("bundle-1"))
+}
+
+func TestIfBundleIsAbortedWhenFreeSpaceDropsBelowMinimum(t *testing.T) {
+	t.Parallel()
+	workdir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workdir)
+
+	collectors := []collector.Collector{
+		MockCollector{name: "collector-1", rc: slowReader{delay: time.Millisecond}},
+	}
+
+	guard := newTestDiskSpaceGuard(workdir, 100, 1000)
+	freeSpace := make(chan uint64, 1)
+	freeSpace <- 1000
+	guard.usage = func(string) (*disk.UsageStat, error) {
+		free := <-freeSpace
+		freeSpace <- 10
+		return &disk.UsageStat{Free: free}, nil
+	}
+
+	bh, err := NewBundleHandler(workdir, collectors, time.Hour, time.Hour, 1, BundleHandlerOptions{Space: guard})
+	require.NoError(t, err)
+
+	router := mux.NewRouter()
+	router.HandleFunc(bundleEndpoint, bh.Create).Methods(http.MethodPut)
+	router.HandleFunc(bundleEndpoint, bh.Get).Methods(http.MethodGet)
+
+	req, err := http.NewRequest(http.MethodPut, bundlesEndpoint+"/bundle-0", nil)
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	bundle := Bundle{}
+	for i := 0; i < 1000 && !bundle.IsFinished(); i++ {
+		time.Sleep(time.Millisecond)
+		req, err = http.NewRequest(http.MethodGet, bundlesEndpoint+"/bundle-0", nil)
+		require.NoError(t, err)
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &bundle))
+	}
+
+	assert.Equal(t, Failed, bundle.Status)
+	assert.Contains(t, bundle.Errors,
+		"bundle creation aborted: free disk space dropped to 10 bytes, minimum is 100 bytes")
+	_, err = os.Stat(filepath.Join(workdir, "bundle-0", dataFileName))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestIfClusterBundleIsAbortedWhenFreeSpaceDropsBelowMinimum(t *testing.T) {
+	t.Parallel()
+	workdir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workdir)
+
+	bundle := Bundle{ID: "bundle-0", Type: Cluster, Status: Started}
+	writeBundle(t, workdir, bundle, make([]byte, 0))
+	dataFile, err := os.OpenFile(filepath.Join(workdir, bundle.ID, dataFileName), os.O_WRONLY, filePerm)
+	require.NoError(t, err)
+
+	bh := ClusterBundleHandler{
+		workDir: workdir,
+		bundles: NewBundleRegistry(),
+		clock:   &MockClock{},
+		coord:   blockingCoordinator{},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stopWatching := newTestDiskSpaceGuard(workdir, 100, 10).watch(cancel)
+
+	bh.waitAndCollectRemoteBundle(ctx, bundle, 0, dataFile, newChecksumWriter(dataFile), make(chan BundleStatus), stopWatching)
+
+	state, err := readBundleState(workdir, bundle.ID)
+	require.NoError(t, err)
+	assert.Equal(t, Failed, state.Status)
+	assert.Contains(t, state.Errors,
+		"bundle creation aborted: free disk space dropped to 10 bytes, minimum is 100 bytes")
+	_, err = os.Stat(filepath.Join(workdir, bundle.ID, dataFileName))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,124 @@
+package rest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// fileDownload keeps the state of a bundle download between retries
+type fileDownload struct {
+	url     string
+	id      string
+	path    string
+	file    *os.File // created when the first response is received
+	written int64    // number of bytes already in the file
+	size    int64    // expected file size, -1 when unknown
+	etag    string
+}
+
+// reset truncates the file so it could be downloaded from the beginning
+func (f *fileDownload) reset() error {
+	if f.file == nil {
+		file, err := os.Create(f.path)
+		if err != nil {
+			return fmt.Errorf("could not create a file: %s", err)
+		}
+		f.file = file
+	}
+	f.written = 0
+	if err := f.file.Truncate(0); err != nil {
+		return err
+	}
+	_, err := f.file.Seek(0, io.SeekStart)
+	return err
+}
+
+// interrupted returns downloadInterruptedError when the download failed because of the connection
+// and could be resumed, other errors e.g., invalid URLs are returned unchanged
+func interrupted(err error) error {
+	cause := err
+	if e, ok := cause.(*url.Error); ok {
+		cause = e.Err
+	}
+	if cause == io.ErrUnexpectedEOF {
+		return &downloadInterruptedError{err: err}
+	}
+	if e, ok := cause.(*net.OpError); ok {
+		if e, ok := e.Err.(*os.SyscallError); ok && e.Err == syscall.ECONNRESET {
+			return &downloadInterruptedError{err: err}
+		}
+	}
+	if e, ok := cause.(net.Error); ok && (e.Timeout() || e.Temporary()) {
+		return &downloadInterruptedError{err: err}
+	}
+	return err
+}
+
+// restart drops downloaded content so the next try downloads the whole file
+func (f *fileDownload) restart(reason error) error {
+	if err := f.reset(); err != nil {
+		return err
+	}
+	f.etag = ""
+	return &downloadInterruptedError{err: reason}
+}
+
+// verify checks if the downloaded file has the expected size and checksum
+func (f *fileDownload) verify() error {
+	if f.size >= 0 && f.written != f.size {
+		return &downloadInterruptedError{err: fmt.Errorf("got %d bytes, expected %d", f.written, f.size)}
+	}
+
+	expected := checksumFromETag(f.etag)
+	if expected == "" {
+		return nil
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(hash, io.NewSectionReader(f.file, 0, f.written)); err != nil {
+		return fmt.Errorf("could not compute checksum: %s", err)
+	}
+	if checksum := hex.EncodeToString(hash.Sum(nil)); checksum != expected {
+		return f.restart(fmt.Errorf("checksum mismatch: got %s, expected %s", checksum, expected))
+	}
+	return nil
+}
+
+func (f *fileDownload) close() {
+	if f.file != nil {
+		f.file.Close()
+	}
+}
+
+// parseContentRange returns the first byte position and the complete length from
+// Content-Range header e.g., "bytes 100-199/1000" or "bytes */1000"
+func parseContentRange(header string) (int64, int64, error) {
+	invalid := fmt.Errorf("invalid content range %q", header)
+
+	if !strings.HasPrefix(header, "bytes ") {
+		return 0, 0, invalid
+	}
+	parts := strings.SplitN(strings.TrimPrefix(header, "bytes "), "/", 2)
+	if len(parts) != 2 {
+		return 0, 0, invalid
+	}
+	size, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, 0, invalid
+	}
+	if parts[0] == "*" {
+		return 0, size, nil
+	}
+	start, err := strconv.ParseInt(strings.SplitN(parts[0], "-", 2)[0], 10, 64)
+	if err != nil {
+		return 0, 0, invalid
+	}
+	return start, size, nil
+}
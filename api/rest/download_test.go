@@ -0,0 +1,42 @@
+package rest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseContentRange(t *testing.T) {
+	for _, tc := range []struct {
+		header string
+		start  int64
+		size   int64
+		err    bool
+	}{
+		{header: "bytes 100-199/1000", start: 100, size: 1000},
+		{header: "bytes 0-0/1", start: 0, size: 1},
+		{header: "bytes */1000", size: 1000},
+		{header: "", err: true},
+		{header: "bytes 100-199", err: true},
+		{header: "bytes 100-199/*", err: true},
+		{header: "items 100-199/1000", err: true},
+	} {
+		start, size, err := parseContentRange(tc.header)
+		if tc.err {
+			assert.Error(t, err, tc.header)
+			continue
+		}
+		assert.NoError(t, err, tc.header)
+		assert.Equal(t, tc.start, start, tc.header)
+		assert.Equal(t, tc.size, size, tc.header)
+	}
+}
+
+func TestChecksumFromETag(t *testing.T) {
+	checksum := "f2ca1bb6c7e907d06dafe4687e579fce76b37e4e93b7605022da52e6ccc26fd2"
+
+	assert.Equal(t, checksum, checksumFromETag(checksumETag(checksum)))
+	assert.Empty(t, checksumFromETag(`W/"`+checksum+`"`))
+	assert.Empty(t, checksumFromETag(`"abc"`))
+	assert.Empty(t, checksumFromETag(""))
+}
@@ -0,0 +1,49 @@
+package rest
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/dcos/dcos-diagnostics/archive"
+	"github.com/dcos/dcos-diagnostics/encrypt"
+)
+
+// encryptedFile encrypts data written to the underlying file. Close finishes encryption and closes the file.
+type encryptedFile struct {
+	*encrypt.Writer
+	file io.Closer
+}
+
+func (e encryptedFile) Close() error {
+	err := e.Writer.Close()
+	if closeErr := e.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// bundleDataWriter returns writer of the bundle data. Data is encrypted for recipients when bundle is encrypted.
+// Checksum is computed over the stored data, so it always describes the file served to clients.
+func bundleDataWriter(bundle Bundle, checksum *checksumWriter, recipients []encrypt.Recipient) (io.WriteCloser, error) {
+	if !bundle.Encrypted {
+		return checksum, nil
+	}
+	w, err := encrypt.NewWriter(checksum, recipients)
+	if err != nil {
+		return nil, fmt.Errorf("could not encrypt bundle %s: %s", bundle.ID, err)
+	}
+	return encryptedFile{Writer: w, file: checksum}, nil
+}
+
+// setBundleFileHeaders describes the bundle file so clients could save it under the right name
+func setBundleFileHeaders(w http.ResponseWriter, id string, format archive.Format, encrypted bool) {
+	contentType := format.ContentType() + ", application/octet-stream"
+	filename := id + format.Extension()
+	if encrypted {
+		contentType = "application/octet-stream"
+		filename += encrypt.Extension
+	}
+	w.Header().Add("Content-Type", contentType)
+	w.Header().Add("Content-disposition", fmt.Sprintf("attachment; filename=%s", filename))
+}
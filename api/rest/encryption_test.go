@@ -0,0 +1,203 @@
+package rest
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dcos/dcos-diagnostics/collector"
+	"github.com/dcos/dcos-diagnostics/dcos"
+	"github.com/dcos/dcos-diagnostics/encrypt"
+	"github.com/dcos/dcos-diagnostics/encrypt/encrypttest"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func decryptFile(t *testing.T, path string, key *rsa.PrivateKey) []byte {
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	r, err := encrypt.NewReader(f, key)
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	return data
+}
+
+func fileChecksum(t *testing.T, path string) string {
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestIfCreateEncryptsBundleForRecipients(t *testing.T) {
+	t.Parallel()
+	workdir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workdir)
+
+	key, recipient := encrypttest.GenerateKey(t)
+	collectors := []collector.Collector{
+		MockCollector{name: "collector-1", rc: ioutil.NopCloser(strings.NewReader("customer data"))},
+	}
+	bh, err := NewBundleHandler(workdir, collectors, time.Second, time.Second, 1,
+		BundleHandlerOptions{Recipients: []encrypt.Recipient{recipient}})
+	require.NoError(t, err)
+
+	router := mux.NewRouter()
+	router.HandleFunc(bundleEndpoint, bh.Create).Methods(http.MethodPut)
+	router.HandleFunc(bundleEndpoint, bh.Get).Methods(http.MethodGet)
+	router.HandleFunc(bundleFileEndpoint, bh.GetFile).Methods(http.MethodGet)
+
+	for _, tc := range []struct {
+		id        string
+		body      string
+		encrypted bool
+	}{
+		{id: "encrypted", body: `{"format": "tar.gz"}`, encrypted: true},
+		{id: "not-encrypted", body: `{"encrypt": false}`, encrypted: false},
+	} {
+		req, err := http.NewRequest(http.MethodPut, bundlesEndpoint+"/"+tc.id, strings.NewReader(tc.body))
+		require.NoError(t, err)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		bundle := &Bundle{}
+		for !bundle.IsFinished() {
+			req, err := http.NewRequest(http.MethodGet, bundlesEndpoint+"/"+tc.id, nil)
+			require.NoError(t, err)
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), bundle))
+		}
+		require.Equal(t, Done, bundle.Status)
+		assert.Equal(t, tc.encrypted, bundle.Encrypted)
+
+		path := filepath.Join(workdir, tc.id, dataFileName)
+		assert.Equal(t, fileChecksum(t, path), bundle.Checksum)
+
+		encrypted, err := encrypt.IsEncrypted(path)
+		require.NoError(t, err)
+		assert.Equal(t, tc.encrypted, encrypted)
+
+		req, err = http.NewRequest(http.MethodGet, bundlesEndpoint+"/"+tc.id+"/file", nil)
+		require.NoError(t, err)
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		if !tc.encrypted {
+			assert.Equal(t, "attachment; filename=not-encrypted.zip", rr.Header().Get("Content-disposition"))
+			continue
+		}
+		assert.Equal(t, "application/octet-stream", rr.Header().Get("Content-Type"))
+		assert.Equal(t, "attachment; filename=encrypted.tar.gz.enc", rr.Header().Get("Content-disposition"))
+		assert.NotContains(t, rr.Body.String(), "customer data")
+
+		decryptedPath := filepath.Join(workdir, "decrypted.tar.gz")
+		require.NoError(t, ioutil.WriteFile(decryptedPath, decryptFile(t, path, key), filePerm))
+		problems, err := VerifyBundle(decryptedPath)
+		require.NoError(t, err)
+		assert.Empty(t, problems)
+	}
+}
+
+func TestRemoteBundleCreationEncryptsMergedBundle(t *testing.T) {
+	workdir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workdir)
+
+	key, recipient := encrypttest.GenerateKey(t)
+
+	tools := new(MockedTools)
+	tools.On("GetMasterNodes").Return([]dcos.Node{{Leader: true, Role: "master", IP: "192.0.2.2"}}, nil)
+
+	coord := &optionsCoordinator{options: make(chan BundleOptions, 1)}
+	bh := ClusterBundleHandler{
+		workDir:    workdir,
+		bundles:    NewBundleRegistry(),
+		coord:      coord,
+		tools:      tools,
+		timeout:    time.Second,
+		clock:      &MockClock{},
+		urlBuilder: MockURLBuilder{},
+		recipients: []encrypt.Recipient{recipient},
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc(bundleEndpoint, bh.Create).Methods(http.MethodPut)
+
+	req, err := http.NewRequest(http.MethodPut, bundlesEndpoint+"/bundle-0", strings.NewReader(`{"agents": false}`))
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	// node bundles are merged by the master so they must not be encrypted
+	assert.True(t, (<-coord.options).SkipEncryption)
+
+	// state file is rewritten while the bundle is collected so it could be read partially written
+	bundle := Bundle{}
+	for err != nil || !bundle.IsFinished() {
+		bundle, err = readBundleState(workdir, "bundle-0")
+	}
+	require.Equal(t, Done, bundle.Status)
+	assert.True(t, bundle.Encrypted)
+
+	path := filepath.Join(workdir, "bundle-0", dataFileName)
+	assert.Equal(t, fileChecksum(t, path), bundle.Checksum)
+
+	expected, err := ioutil.ReadFile(filepath.Join("testdata", "combined.zip"))
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(expected, decryptFile(t, path, key)))
+}
+
+func TestRemoteBundleCreationClosesEncryptedDataWhenItFails(t *testing.T) {
+	workdir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workdir)
+
+	key, recipient := encrypttest.GenerateKey(t)
+
+	tools := new(MockedTools)
+	tools.On("GetMasterNodes").Return([]dcos.Node{}, fmt.Errorf("some error"))
+
+	bh := ClusterBundleHandler{
+		workDir:    workdir,
+		bundles:    NewBundleRegistry(),
+		tools:      tools,
+		clock:      &MockClock{},
+		recipients: []encrypt.Recipient{recipient},
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc(bundleEndpoint, bh.Create).Methods(http.MethodPut)
+
+	req, err := http.NewRequest(http.MethodPut, bundlesEndpoint+"/bundle-0", nil)
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusInternalServerError, rr.Code)
+
+	bundle, err := readBundleState(workdir, "bundle-0")
+	require.NoError(t, err)
+	assert.Equal(t, Failed, bundle.Status)
+
+	// encrypted data is complete only when the writer is closed
+	assert.Empty(t, decryptFile(t, filepath.Join(workdir, "bundle-0", dataFileName), key))
+}
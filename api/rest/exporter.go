@@ -0,0 +1,209 @@
+package rest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/dcos/dcos-diagnostics/encrypt"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+)
+
+// statuses of the bundle upload
+const (
+	Uploading    = "Uploading"
+	Uploaded     = "Uploaded"
+	UploadFailed = "Failed"
+)
+
+var exporterUploads = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "bundle_exporter_uploads_total",
+	Help: "Number of finished bundle uploads",
+}, []string{"status"})
+
+// Uploader stores bundle files outside of the cluster
+type Uploader interface {
+	// Upload stores size bytes read from r under the given name and returns the key of the stored object
+	Upload(ctx context.Context, name string, r io.ReaderAt, size int64) (string, error)
+}
+
+// BundleUpload describes the last upload of the bundle
+type BundleUpload struct {
+	Status  string    `json:"status"`
+	Key     string    `json:"key,omitempty"`
+	Started time.Time `json:"started_at"`
+	Stopped time.Time `json:"stopped_at,omitempty"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// Exporter uploads finished bundles from the work dir on request or automatically when they are done.
+// Nil exporter means export is not configured.
+type Exporter struct {
+	workDir  string
+	uploader Uploader
+	node     string        // local bundles of every node have the same ID so their objects are named after the node
+	auto     bool          // upload every bundle when it's done
+	timeout  time.Duration // limits how long single upload could take
+	clock    Clock
+	bundles  *BundleRegistry // guards state files the upload status is written to
+
+	mu        sync.Mutex // guards uploading
+	uploading map[string]bool
+}
+
+func NewExporter(workDir string, uploader Uploader, node string, auto bool, timeout time.Duration,
+	bundles *BundleRegistry) (*Exporter, error) {
+	err := initializeWorkDir(workDir)
+	if err != nil {
+		return nil, err
+	}
+	if bundles == nil {
+		bundles = NewBundleRegistry()
+	}
+
+	return &Exporter{
+		workDir:   workDir,
+		uploader:  uploader,
+		node:      node,
+		auto:      auto,
+		timeout:   timeout,
+		clock:     realClock{},
+		bundles:   bundles,
+		uploading: make(map[string]bool),
+	}, nil
+}
+
+// bundleDone starts upload of the bundle when automatic upload is enabled
+func (e *Exporter) bundleDone(id string) {
+	if e == nil || !e.auto {
+		return
+	}
+	if _, err := e.upload(id); err != nil {
+		logrus.WithError(err).WithField("ID", id).Error("Could not upload bundle")
+	}
+}
+
+// serveUpload starts upload of the bundle with the given id and responds with its state
+func (e *Exporter) serveUpload(w http.ResponseWriter, id string) {
+	if e == nil {
+		writeJSONError(w, http.StatusNotImplemented, fmt.Errorf("bundle export is not configured"))
+		return
+	}
+
+	bundle, err := e.upload(id)
+	if err != nil {
+		code := http.StatusInternalServerError
+		switch err.(type) {
+		case *DiagnosticsBundleNotFoundError:
+			code = http.StatusNotFound
+		case *DiagnosticsBundleNotUploadableError:
+			code = http.StatusConflict
+		}
+		writeJSONError(w, code, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	write(w, jsonMarshal(bundle))
+}
+
+// upload starts upload of a Done bundle in the background and returns its state
+func (e *Exporter) upload(id string) (Bundle, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	bundle, err := e.bundles.updateState(e.workDir, id, func(bundle *Bundle) error {
+		if bundle.Status != Done {
+			return &DiagnosticsBundleNotUploadableError{
+				id:     id,
+				reason: fmt.Sprintf("bundle %s is %s, only Done bundles could be uploaded", id, bundle.Status),
+			}
+		}
+		if e.uploading[id] {
+			return &DiagnosticsBundleNotUploadableError{
+				id:     id,
+				reason: fmt.Sprintf("bundle %s is already being uploaded", id),
+			}
+		}
+		bundle.Upload = &BundleUpload{Status: Uploading, Started: e.clock.Now()}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return bundle, &DiagnosticsBundleNotFoundError{id: id}
+	}
+	if err != nil {
+		return bundle, err
+	}
+	e.uploading[id] = true
+
+	go e.run(bundle)
+
+	return bundle, nil
+}
+
+func (e *Exporter) run(bundle Bundle) {
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+
+	key, err := e.uploadFile(ctx, bundle)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.uploading, bundle.ID)
+
+	upload := *bundle.Upload
+	upload.Key = key
+	upload.Stopped = e.clock.Now()
+	upload.Status = Uploaded
+	if err != nil {
+		logrus.WithError(err).WithField("ID", bundle.ID).Error("Could not upload bundle")
+		upload.Status = UploadFailed
+		upload.Error = err.Error()
+	}
+	exporterUploads.WithLabelValues(upload.Status).Inc()
+
+	// bundle could be deleted in the meantime so its latest state is updated
+	_, err = e.bundles.updateState(e.workDir, bundle.ID, func(current *Bundle) error {
+		current.Upload = &upload
+		return nil
+	})
+	if err != nil {
+		logrus.WithError(err).WithField("ID", bundle.ID).Error("Could not update state file")
+	}
+}
+
+func (e *Exporter) uploadFile(ctx context.Context, bundle Bundle) (string, error) {
+	f, err := os.Open(filepath.Join(e.workDir, bundle.ID, dataFileName))
+	if err != nil {
+		return "", fmt.Errorf("could not open bundle %s: %s", bundle.ID, err)
+	}
+	defer f.Close()
+
+	s, err := f.Stat()
+	if err != nil {
+		return "", fmt.Errorf("could not stat bundle %s: %s", bundle.ID, err)
+	}
+
+	return e.uploader.Upload(ctx, e.objectName(bundle), f, s.Size())
+}
+
+// objectName returns name of the object the bundle is stored in. Cluster bundles are named after their ID
+// and local bundles are grouped by the node that created them.
+func (e *Exporter) objectName(bundle Bundle) string {
+	name := bundle.ID + bundle.Format.Extension()
+	if bundle.Encrypted {
+		name += encrypt.Extension
+	}
+	if bundle.Type == Local {
+		name = e.node + "/" + name
+	}
+	return name
+}
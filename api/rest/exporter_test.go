@@ -0,0 +1,269 @@
+package rest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dcos/dcos-diagnostics/archive"
+	"github.com/dcos/dcos-diagnostics/collector"
+	"github.com/dcos/dcos-diagnostics/dcos"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryUploader keeps uploaded objects in memory. When release is set uploads wait until it's closed.
+type memoryUploader struct {
+	mu      sync.Mutex
+	objects map[string]string
+	release chan struct{}
+	err     error
+}
+
+func (m *memoryUploader) Upload(ctx context.Context, name string, r io.ReaderAt, size int64) (string, error) {
+	if m.release != nil {
+		<-m.release
+	}
+	if m.err != nil {
+		return "prefix/" + name, m.err
+	}
+	data, err := ioutil.ReadAll(io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return "", err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects["prefix/"+name] = string(data)
+	return "prefix/" + name, nil
+}
+
+func waitForUpload(t *testing.T, workdir, id string) Bundle {
+	for i := 0; i < 1000; i++ {
+		bundle, err := readBundleState(workdir, id)
+		if err == nil && bundle.Upload != nil && bundle.Upload.Status != Uploading {
+			return bundle
+		}
+		time.Sleep(time.Millisecond)
+	}
+	require.FailNow(t, "bundle was not uploaded")
+	return Bundle{}
+}
+
+func TestIfBundleIsUploadedWhenItIsDone(t *testing.T) {
+	workdir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workdir)
+
+	uploader := &memoryUploader{objects: map[string]string{}}
+	bundles := NewBundleRegistry()
+	exporter, err := NewExporter(workdir, uploader, "node-1", true, time.Second, bundles)
+	require.NoError(t, err)
+
+	collectors := []collector.Collector{
+		MockCollector{name: "collector-1", rc: ioutil.NopCloser(strings.NewReader("data"))},
+	}
+	bh, err := NewBundleHandler(workdir, collectors, time.Second, time.Second, 1, BundleHandlerOptions{Exporter: exporter, Registry: bundles})
+	require.NoError(t, err)
+
+	router := mux.NewRouter()
+	router.HandleFunc(bundleEndpoint, bh.Create).Methods(http.MethodPut)
+
+	req, err := http.NewRequest(http.MethodPut, bundlesEndpoint+"/bundle-0", nil)
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	bundle := waitForUpload(t, workdir, "bundle-0")
+
+	assert.Equal(t, Done, bundle.Status)
+	assert.Equal(t, Uploaded, bundle.Upload.Status)
+	assert.Equal(t, "prefix/node-1/bundle-0.zip", bundle.Upload.Key)
+	assert.Empty(t, bundle.Upload.Error)
+
+	data, err := ioutil.ReadFile(filepath.Join(workdir, "bundle-0", dataFileName))
+	require.NoError(t, err)
+	assert.Equal(t, string(data), uploader.objects["prefix/node-1/bundle-0.zip"])
+}
+
+func TestIfUploadStartsUploadOfDoneBundle(t *testing.T) {
+	workdir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workdir)
+
+	bundle := Bundle{ID: "bundle-0", Type: Cluster, Status: Done, Format: archive.TarGz, Encrypted: true}
+	writeBundle(t, workdir, bundle, []byte("encrypted"))
+
+	uploader := &memoryUploader{objects: map[string]string{}, release: make(chan struct{})}
+	bundles := NewBundleRegistry()
+	exporter, err := NewExporter(workdir, uploader, "node-1", false, time.Second, bundles)
+	require.NoError(t, err)
+	exporter.clock = &MockClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	bh, err := NewBundleHandler(workdir, nil, time.Second, time.Second, 1,
+		BundleHandlerOptions{Exporter: exporter, Registry: bundles})
+	require.NoError(t, err)
+
+	router := mux.NewRouter()
+	router.HandleFunc(bundleUploadEndpoint, bh.Upload).Methods(http.MethodPost)
+
+	upload := func() *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodPost, bundlesEndpoint+"/bundle-0/upload", nil)
+		require.NoError(t, err)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := upload()
+	assert.Equal(t, http.StatusAccepted, rr.Code)
+	assert.JSONEq(t, `{
+		"id": "bundle-0",
+		"type": "Cluster",
+		"status": "Done",
+		"format": "tar.gz",
+		"encrypted": true,
+		"started_at": "0001-01-01T00:00:00Z",
+		"stopped_at": "0001-01-01T00:00:00Z",
+		"upload": {"status": "Uploading", "started_at": "2020-01-01T01:00:00Z", "stopped_at": "0001-01-01T00:00:00Z"}
+	}`, rr.Body.String())
+
+	rr = upload()
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	assert.JSONEq(t, `{"code":409,"error":"bundle bundle-0 is already being uploaded"}`, rr.Body.String())
+
+	close(uploader.release)
+	bundle = waitForUpload(t, workdir, "bundle-0")
+
+	assert.Equal(t, Uploaded, bundle.Upload.Status)
+	assert.Equal(t, "prefix/bundle-0.tar.gz.enc", bundle.Upload.Key)
+	assert.Equal(t, "encrypted", uploader.objects["prefix/bundle-0.tar.gz.enc"])
+
+	// uploaded bundle could be uploaded again e.g., when the object was removed
+	rr = upload()
+	assert.Equal(t, http.StatusAccepted, rr.Code)
+	waitForUpload(t, workdir, "bundle-0")
+}
+
+func TestIfUploadFailureIsRecordedInBundleState(t *testing.T) {
+	workdir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workdir)
+
+	writeBundle(t, workdir, Bundle{ID: "bundle-0", Status: Done}, []byte("data"))
+
+	uploader := &memoryUploader{err: fmt.Errorf("access denied")}
+	exporter, err := NewExporter(workdir, uploader, "node-1", false, time.Second, nil)
+	require.NoError(t, err)
+
+	_, err = exporter.upload("bundle-0")
+	require.NoError(t, err)
+
+	bundle := waitForUpload(t, workdir, "bundle-0")
+	assert.Equal(t, Done, bundle.Status)
+	assert.Equal(t, UploadFailed, bundle.Upload.Status)
+	assert.Equal(t, "prefix/node-1/bundle-0.zip", bundle.Upload.Key)
+	assert.Equal(t, "access denied", bundle.Upload.Error)
+}
+
+func TestIfUploadReturnsErrorWhenBundleCouldNotBeUploaded(t *testing.T) {
+	workdir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workdir)
+
+	writeBundle(t, workdir, Bundle{ID: "in-progress", Status: InProgress}, []byte(""))
+	writeBundle(t, workdir, Bundle{ID: "deleted", Status: Deleted}, []byte(""))
+
+	exporter, err := NewExporter(workdir, &memoryUploader{}, "node-1", false, time.Second, nil)
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		id       string
+		exporter *Exporter
+		code     int
+		body     string
+	}{
+		{id: "missing", exporter: exporter, code: http.StatusNotFound, body: "404 page not found\n"},
+		{id: "in-progress", exporter: exporter, code: http.StatusConflict,
+			body: `{"code":409,"error":"bundle in-progress is InProgress, only Done bundles could be uploaded"}`},
+		{id: "deleted", exporter: exporter, code: http.StatusConflict,
+			body: `{"code":409,"error":"bundle deleted is Deleted, only Done bundles could be uploaded"}`},
+		{id: "in-progress", exporter: nil, code: http.StatusNotImplemented,
+			body: `{"code":501,"error":"bundle export is not configured"}`},
+	} {
+		bh, err := NewBundleHandler(workdir, nil, time.Second, time.Second, 1, BundleHandlerOptions{Exporter: tc.exporter})
+		require.NoError(t, err)
+
+		router := mux.NewRouter()
+		router.HandleFunc(bundleUploadEndpoint, bh.Upload).Methods(http.MethodPost)
+
+		req, err := http.NewRequest(http.MethodPost, bundlesEndpoint+"/"+tc.id+"/upload", nil)
+		require.NoError(t, err)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, tc.code, rr.Code, tc.id)
+		assert.Equal(t, tc.body, rr.Body.String(), tc.id)
+	}
+}
+
+func TestUploadClusterBundle(t *testing.T) {
+	tools := new(MockedTools)
+	tools.On("GetMasterNodes").Return([]dcos.Node{
+		{Role: "master", IP: "192.0.2.2"},
+		{Role: "master", IP: "192.0.2.4"},
+	}, nil)
+
+	client := &MockClient{
+		upload: func(ctx context.Context, node string, ID string) (*Bundle, error) {
+			switch {
+			case ID == "in-progress":
+				return nil, &DiagnosticsBundleNotUploadableError{id: ID, reason: "bundle in-progress is InProgress"}
+			case ID == "bundle-0" && node == "http://192.0.2.4":
+				return &Bundle{ID: ID, Type: Cluster, Status: Done, Upload: &BundleUpload{Status: Uploading}}, nil
+			}
+			return nil, &DiagnosticsBundleNotFoundError{id: ID}
+		},
+	}
+
+	bh := ClusterBundleHandler{
+		bundles:    NewBundleRegistry(),
+		client:     client,
+		tools:      tools,
+		timeout:    time.Second,
+		urlBuilder: MockURLBuilder{},
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc(bundleUploadEndpoint, bh.Upload).Methods(http.MethodPost)
+
+	for _, tc := range []struct {
+		id   string
+		code int
+		body string
+	}{
+		{id: "bundle-0", code: http.StatusAccepted, body: `{"id":"bundle-0","type":"Cluster","status":"Done",
+			"started_at":"0001-01-01T00:00:00Z","stopped_at":"0001-01-01T00:00:00Z",
+			"upload":{"status":"Uploading","started_at":"0001-01-01T00:00:00Z","stopped_at":"0001-01-01T00:00:00Z"}}`},
+		{id: "in-progress", code: http.StatusConflict, body: `{"code":409,"error":"bundle in-progress is InProgress"}`},
+		{id: "missing", code: http.StatusNotFound, body: `{"code":404,"error":"bundle missing not found on any master"}`},
+	} {
+		req, err := http.NewRequest(http.MethodPost, bundlesEndpoint+"/"+tc.id+"/upload", nil)
+		require.NoError(t, err)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, tc.code, rr.Code, tc.id)
+		assert.JSONEq(t, tc.body, rr.Body.String(), tc.id)
+	}
+}
@@ -0,0 +1,20 @@
+package rest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// writeBundle writes the state file and data file of the bundle into workDir, nil data writes only the state
+func writeBundle(t *testing.T, workDir string, bundle Bundle, data []byte) {
+	bundleDir := filepath.Join(workDir, bundle.ID)
+	require.NoError(t, os.MkdirAll(bundleDir, dirPerm))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(bundleDir, stateFileName), jsonMarshal(bundle), filePerm))
+	if data != nil {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(bundleDir, dataFileName), data, filePerm))
+	}
+}
@@ -0,0 +1,262 @@
+package rest
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/shirou/gopsutil/disk"
+	"github.com/sirupsen/logrus"
+)
+
+// orphanedBundleGracePeriod is the time after which not finished bundle that is not
+// being created (e.g., because of the daemon restart) could be removed
+const orphanedBundleGracePeriod = time.Minute
+
+// reasons why bundle was removed by the janitor
+const (
+	reclaimMaxAge       = "max_age"
+	reclaimMaxCount     = "max_count"
+	reclaimMaxTotalSize = "max_total_size"
+	reclaimMinFreeDisk  = "min_free_disk"
+)
+
+var (
+	janitorReclaimedBundles = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "bundle_janitor_reclaimed_bundles_total",
+		Help: "Number of bundles removed by the janitor",
+	}, []string{"reason"})
+	janitorReclaimedBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "bundle_janitor_reclaimed_bytes_total",
+		Help: "Number of bytes reclaimed by the janitor",
+	}, []string{"reason"})
+	janitorBundles = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "bundle_janitor_bundles",
+		Help: "Number of bundles left in the work dir after the last janitor run",
+	})
+	janitorBundlesBytes = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "bundle_janitor_bundles_bytes",
+		Help: "Size of bundles left in the work dir after the last janitor run",
+	})
+)
+
+// RetentionPolicy describes how many bundles could be kept in the work dir.
+// Zero value of any field disables given limit.
+type RetentionPolicy struct {
+	MaxAge             time.Duration // bundles older than this are removed
+	MaxTotalSize       int64         // total size of all bundles in bytes
+	MaxCount           int           // number of bundles
+	MinFreeDiskPercent float64       // oldest bundles are removed until there is at least this much free space
+}
+
+// Janitor periodically removes bundles from the work dir according to the retention policy.
+// Only bundles that are not being created are removed.
+type Janitor struct {
+	workDir   string
+	policy    RetentionPolicy
+	interval  time.Duration
+	notifier  *Notifier       // sends Deleted events of removed bundles, nil disables webhooks
+	bundles   *BundleRegistry // tells which bundles are being created
+	clock     Clock
+	diskUsage func(path string) (*disk.UsageStat, error)
+}
+
+func NewJanitor(workDir string, policy RetentionPolicy, interval time.Duration, notifier *Notifier,
+	bundles *BundleRegistry) (*Janitor, error) {
+	err := initializeWorkDir(workDir)
+	if err != nil {
+		return nil, err
+	}
+	if bundles == nil {
+		bundles = NewBundleRegistry()
+	}
+
+	return &Janitor{
+		workDir:   workDir,
+		policy:    policy,
+		interval:  interval,
+		notifier:  notifier,
+		bundles:   bundles,
+		clock:     realClock{},
+		diskUsage: disk.Usage,
+	}, nil
+}
+
+// Run removes bundles every interval until ctx is done
+func (j *Janitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		j.clean()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// janitorBundle is a bundle stored in the work dir
+type janitorBundle struct {
+	id      string
+	created time.Time
+	size    int64
+	running bool
+}
+
+// clean removes bundles that do not fit into the retention policy, the oldest first
+func (j *Janitor) clean() {
+	bundles, err := j.listBundles()
+	if err != nil {
+		logrus.WithError(err).WithField("workDir", j.workDir).Error("Janitor could not list bundles")
+		return
+	}
+
+	var totalSize int64
+	for _, b := range bundles {
+		totalSize += b.size
+	}
+	count := len(bundles)
+
+	remove := func(b janitorBundle, reason string) bool {
+		if err := removeBundle(j.bundles, j.workDir, b.id, j.notifier); err != nil {
+			logrus.WithError(err).WithField("ID", b.id).Error("Janitor could not remove bundle")
+			return false
+		}
+		logrus.WithField("ID", b.id).WithField("reason", reason).WithField("bytes", b.size).Info("Janitor removed bundle")
+		janitorReclaimedBundles.WithLabelValues(reason).Inc()
+		janitorReclaimedBytes.WithLabelValues(reason).Add(float64(b.size))
+		totalSize -= b.size
+		count--
+		return true
+	}
+
+	now := j.clock.Now()
+	// bundles are sorted from the oldest so every limit removes the oldest bundles first
+	kept := bundles[:0]
+	for _, b := range bundles {
+		if b.running {
+			kept = append(kept, b)
+			continue
+		}
+		switch {
+		case j.policy.MaxAge > 0 && now.Sub(b.created) > j.policy.MaxAge:
+			if remove(b, reclaimMaxAge) {
+				continue
+			}
+		case j.policy.MaxCount > 0 && count > j.policy.MaxCount:
+			if remove(b, reclaimMaxCount) {
+				continue
+			}
+		case j.policy.MaxTotalSize > 0 && totalSize > j.policy.MaxTotalSize:
+			if remove(b, reclaimMaxTotalSize) {
+				continue
+			}
+		case j.policy.MinFreeDiskPercent > 0 && j.freeDiskPercent() < j.policy.MinFreeDiskPercent:
+			if remove(b, reclaimMinFreeDisk) {
+				continue
+			}
+		}
+		kept = append(kept, b)
+	}
+
+	janitorBundles.Set(float64(count))
+	janitorBundlesBytes.Set(float64(totalSize))
+
+	if j.policy.MinFreeDiskPercent > 0 && j.freeDiskPercent() < j.policy.MinFreeDiskPercent {
+		logrus.WithField("workDir", j.workDir).WithField("bundles", len(kept)).
+			Warn("Janitor could not reclaim enough disk space")
+	}
+}
+
+// removeBundle removes the bundle with all its files and notifies webhooks it was deleted
+// unless it was already deleted with the API
+func removeBundle(bundles *BundleRegistry, workDir, id string, notifier *Notifier) error {
+	bundle, err := bundles.loadState(workDir, id)
+	if err != nil {
+		bundle = Bundle{ID: id}
+	}
+	if err := os.RemoveAll(filepath.Join(workDir, id)); err != nil {
+		return err
+	}
+	if bundle.Status != Deleted {
+		bundle.Status = Deleted
+		notifier.notify(bundle)
+	}
+	return nil
+}
+
+// freeDiskPercent returns percent of free space on the work dir partition. When it could
+// not be checked 100 is returned so no bundle is removed by mistake.
+func (j *Janitor) freeDiskPercent() float64 {
+	usage, err := j.diskUsage(j.workDir)
+	if err != nil {
+		logrus.WithError(err).WithField("workDir", j.workDir).Warn("Janitor could not check disk usage")
+		return 100
+	}
+	return 100 - usage.UsedPercent
+}
+
+// listBundles returns bundles stored in the work dir sorted from the oldest
+func (j *Janitor) listBundles() ([]janitorBundle, error) {
+	infos, err := ioutil.ReadDir(j.workDir)
+	if err != nil {
+		return nil, err
+	}
+
+	now := j.clock.Now()
+
+	var bundles []janitorBundle
+	for _, info := range infos {
+		if !info.IsDir() {
+			continue
+		}
+		id := info.Name()
+		b := janitorBundle{
+			id:      id,
+			created: info.ModTime(),
+			size:    dirSize(filepath.Join(j.workDir, id)),
+			running: j.bundles.running.isRunning(id),
+		}
+
+		if bundle, err := j.bundles.loadState(j.workDir, id); err == nil {
+			if !bundle.Started.IsZero() {
+				b.created = bundle.Started
+			}
+			// bundle creation could just begin and it's not registered as running yet
+			if !bundle.IsFinished() && now.Sub(info.ModTime()) < orphanedBundleGracePeriod {
+				b.running = true
+			}
+		}
+
+		bundles = append(bundles, b)
+	}
+
+	sort.SliceStable(bundles, func(i, k int) bool { return bundles[i].created.Before(bundles[k].created) })
+
+	return bundles, nil
+}
+
+// dirSize returns size of all regular files in the given dir
+func dirSize(path string) int64 {
+	var size int64
+	err := filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		logrus.WithError(err).WithField("path", path).Warn("Could not compute bundle size")
+	}
+	return size
+}
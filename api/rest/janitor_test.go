@@ -0,0 +1,205 @@
+package rest
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/shirou/gopsutil/disk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var janitorNow = time.Date(2019, 10, 1, 12, 0, 0, 0, time.UTC)
+
+type fixedClock struct {
+	now time.Time
+}
+
+func (f fixedClock) Now() time.Time { return f.now }
+
+func newTestJanitor(t *testing.T, policy RetentionPolicy) (*Janitor, string) {
+	workDir, err := ioutil.TempDir("", "janitor")
+	require.NoError(t, err)
+
+	j, err := NewJanitor(workDir, policy, time.Minute, nil, nil)
+	require.NoError(t, err)
+	j.clock = fixedClock{now: janitorNow}
+	j.diskUsage = func(string) (*disk.UsageStat, error) { return &disk.UsageStat{UsedPercent: 50}, nil }
+
+	return j, workDir
+}
+
+// agedBundle returns a bundle started age before janitorNow
+func agedBundle(id string, status Status, age time.Duration) Bundle {
+	return Bundle{ID: id, Status: status, Started: janitorNow.Add(-age)}
+}
+
+func bundlesInWorkDir(t *testing.T, workDir string) []string {
+	infos, err := ioutil.ReadDir(workDir)
+	require.NoError(t, err)
+
+	var ids []string
+	for _, info := range infos {
+		ids = append(ids, info.Name())
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func counterValue(t *testing.T, c *prometheus.CounterVec, reason string) float64 {
+	m := &dto.Metric{}
+	require.NoError(t, c.WithLabelValues(reason).Write(m))
+	return m.GetCounter().GetValue()
+}
+
+func TestJanitorRemovesBundlesOlderThanMaxAge(t *testing.T) {
+	j, workDir := newTestJanitor(t, RetentionPolicy{MaxAge: 24 * time.Hour})
+	defer os.RemoveAll(workDir)
+
+	writeBundle(t, workDir, agedBundle("old", Done, 48*time.Hour), make([]byte, 10))
+	writeBundle(t, workDir, agedBundle("canceled", Canceled, 25*time.Hour), make([]byte, 10))
+	writeBundle(t, workDir, agedBundle("new", Done, time.Hour), make([]byte, 10))
+
+	reclaimedBundles := counterValue(t, janitorReclaimedBundles, reclaimMaxAge)
+	reclaimedBytes := counterValue(t, janitorReclaimedBytes, reclaimMaxAge)
+
+	j.clean()
+
+	assert.Equal(t, []string{"new"}, bundlesInWorkDir(t, workDir))
+	assert.Equal(t, reclaimedBundles+2, counterValue(t, janitorReclaimedBundles, reclaimMaxAge))
+	assert.True(t, counterValue(t, janitorReclaimedBytes, reclaimMaxAge) >= reclaimedBytes+20)
+}
+
+func TestJanitorNotifiesWebhooksAboutRemovedBundles(t *testing.T) {
+	j, workDir := newTestJanitor(t, RetentionPolicy{MaxAge: 24 * time.Hour})
+	defer os.RemoveAll(workDir)
+
+	receiver, server := newWebhookReceiver()
+	defer server.Close()
+	notifier, err := NewNotifier(workDir, []Webhook{{URL: server.URL}}, 0, http.DefaultClient)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go notifier.Run(ctx)
+	j.notifier = notifier
+
+	writeBundle(t, workDir, agedBundle("old", Done, 48*time.Hour), make([]byte, 10))
+	// bundles deleted with the API were already notified
+	writeBundle(t, workDir, agedBundle("deleted", Deleted, 48*time.Hour), nil)
+
+	j.clean()
+	assert.Empty(t, bundlesInWorkDir(t, workDir))
+
+	for i := 0; i < 1000 && len(receiver.events()) == 0; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, []string{"Deleted"}, receiver.events())
+	assert.Contains(t, string(receiver.bodies[0]), `"id":"old"`)
+	assert.Empty(t, bundlesInWorkDir(t, workDir), "deliveries of removed bundles should not be logged")
+}
+
+func TestJanitorRemovesOldestBundlesAboveMaxCount(t *testing.T) {
+	j, workDir := newTestJanitor(t, RetentionPolicy{MaxCount: 2})
+	defer os.RemoveAll(workDir)
+
+	for i := 0; i < 5; i++ {
+		writeBundle(t, workDir, agedBundle(fmt.Sprintf("bundle-%d", i), Done, time.Duration(i)*time.Hour), make([]byte, 10))
+	}
+
+	reclaimedBundles := counterValue(t, janitorReclaimedBundles, reclaimMaxCount)
+
+	j.clean()
+
+	assert.Equal(t, []string{"bundle-0", "bundle-1"}, bundlesInWorkDir(t, workDir))
+	assert.Equal(t, reclaimedBundles+3, counterValue(t, janitorReclaimedBundles, reclaimMaxCount))
+}
+
+func TestJanitorRemovesOldestBundlesAboveMaxTotalSize(t *testing.T) {
+	j, workDir := newTestJanitor(t, RetentionPolicy{MaxTotalSize: 2500})
+	defer os.RemoveAll(workDir)
+
+	writeBundle(t, workDir, agedBundle("oldest", Done, 3*time.Hour), make([]byte, 1000))
+	writeBundle(t, workDir, agedBundle("older", Deleted, 2*time.Hour), make([]byte, 1000))
+	writeBundle(t, workDir, agedBundle("newest", Done, time.Hour), make([]byte, 1000))
+
+	j.clean()
+
+	assert.Equal(t, []string{"newest", "older"}, bundlesInWorkDir(t, workDir))
+}
+
+func TestJanitorRemovesOldestBundlesUntilThereIsEnoughFreeDisk(t *testing.T) {
+	j, workDir := newTestJanitor(t, RetentionPolicy{MinFreeDiskPercent: 10})
+	defer os.RemoveAll(workDir)
+
+	writeBundle(t, workDir, agedBundle("oldest", Done, 3*time.Hour), make([]byte, 10))
+	writeBundle(t, workDir, agedBundle("older", Done, 2*time.Hour), make([]byte, 10))
+	writeBundle(t, workDir, agedBundle("newest", Done, time.Hour), make([]byte, 10))
+
+	// every removed bundle frees 3 percent of the disk
+	j.diskUsage = func(path string) (*disk.UsageStat, error) {
+		assert.Equal(t, workDir, path)
+		removed := 3 - len(bundlesInWorkDir(t, workDir))
+		return &disk.UsageStat{UsedPercent: 95 - 3*float64(removed)}, nil
+	}
+
+	j.clean()
+
+	assert.Equal(t, []string{"newest"}, bundlesInWorkDir(t, workDir))
+}
+
+func TestJanitorDoesNotRemoveBundlesWhenDiskUsageIsUnknown(t *testing.T) {
+	j, workDir := newTestJanitor(t, RetentionPolicy{MinFreeDiskPercent: 10})
+	defer os.RemoveAll(workDir)
+
+	writeBundle(t, workDir, agedBundle("bundle", Done, time.Hour), make([]byte, 10))
+	j.diskUsage = func(string) (*disk.UsageStat, error) { return nil, fmt.Errorf("some error") }
+
+	j.clean()
+
+	assert.Equal(t, []string{"bundle"}, bundlesInWorkDir(t, workDir))
+}
+
+func TestJanitorDoesNotRemoveRunningBundles(t *testing.T) {
+	j, workDir := newTestJanitor(t, RetentionPolicy{MaxCount: 1, MaxAge: time.Hour})
+	defer os.RemoveAll(workDir)
+
+	writeBundle(t, workDir, agedBundle("running", InProgress, 48*time.Hour), make([]byte, 10))
+	j.bundles.running.add("running", func() {})
+	defer j.bundles.running.remove("running")
+
+	writeBundle(t, workDir, agedBundle("just-started", Started, 48*time.Hour), make([]byte, 10))
+	writeBundle(t, workDir, agedBundle("orphaned", InProgress, 48*time.Hour), make([]byte, 10))
+	orphanedModTime := time.Now().Add(-2 * orphanedBundleGracePeriod)
+	require.NoError(t, os.Chtimes(filepath.Join(workDir, "orphaned"), orphanedModTime, orphanedModTime))
+	j.clock = fixedClock{now: time.Now()}
+
+	j.clean()
+
+	assert.Equal(t, []string{"just-started", "running"}, bundlesInWorkDir(t, workDir))
+}
+
+func TestJanitorWithoutPolicyKeepsEverything(t *testing.T) {
+	j, workDir := newTestJanitor(t, RetentionPolicy{})
+	defer os.RemoveAll(workDir)
+
+	writeBundle(t, workDir, agedBundle("bundle-0", Done, 1000*time.Hour), make([]byte, 10))
+	writeBundle(t, workDir, agedBundle("bundle-1", Unknown, 1000*time.Hour), make([]byte, 10))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(workDir, "node.zip"), []byte("not a bundle"), filePerm))
+
+	j.clean()
+
+	assert.Equal(t, []string{"bundle-0", "bundle-1", "node.zip"}, bundlesInWorkDir(t, workDir))
+
+	m := &dto.Metric{}
+	require.NoError(t, janitorBundles.Write(m))
+	assert.Equal(t, 2.0, m.GetGauge().GetValue())
+}
@@ -0,0 +1,25 @@
+package rest
+
+import (
+	"github.com/sirupsen/logrus"
+)
+
+// Leader tells whether the node is the Mesos leader. Every master runs the same cluster wide jobs e.g.,
+// scheduled cluster bundles, so only the leading master runs them to not repeat them on every master.
+type Leader interface {
+	IsLeader() (bool, error)
+}
+
+// isLeader returns true when the node is the Mesos leader or leader is nil
+func isLeader(leader Leader) bool {
+	if leader == nil {
+		return true
+	}
+	ok, err := leader.IsLeader()
+	if err != nil {
+		// not leading masters could report an error too, it's not worth a warning
+		logrus.WithError(err).Debug("Could not check if node is the Mesos leader")
+		return false
+	}
+	return ok
+}
@@ -0,0 +1,54 @@
+package rest
+
+import (
+	"time"
+
+	"github.com/dcos/dcos-diagnostics/collector"
+)
+
+const manifestFileName = "manifest.json" // bundle content description
+
+// manifest describes what was collected in the bundle
+type manifest struct {
+	Entries []manifestEntry `json:"entries"`
+}
+
+// manifestEntry describes a single collector result and the file it produced in the bundle.
+// Multi collectors have an entry for every file they produced.
+type manifestEntry struct {
+	Path       string    `json:"path,omitempty"` // location in the bundle, empty when nothing was collected
+	Collector  string    `json:"collector,omitempty"`
+	Type       string    `json:"type,omitempty"` // one of Cmd, Systemd, Kernel, Endpoint, File, Prometheus or Dir
+	NodeIP     string    `json:"node_ip,omitempty"`
+	NodeRole   string    `json:"node_role,omitempty"`
+	Started    time.Time `json:"started_at"`
+	Stopped    time.Time `json:"stopped_at"`
+	Size       int64     `json:"size"`
+	SHA256     string    `json:"sha256,omitempty"`
+	Redactions int       `json:"redactions,omitempty"` // number of secrets removed from the file
+	Truncated  bool      `json:"truncated,omitempty"`  // true when data exceeded the size limit and was truncated
+	Optional   bool      `json:"optional"`
+	Failed     bool      `json:"failed"`
+	Err        string    `json:"error,omitempty"`
+}
+
+// collectorType returns the name of the collector kind
+func collectorType(c collector.Collector) string {
+	switch c.(type) {
+	case *collector.Cmd, collector.Cmd:
+		return "Cmd"
+	case *collector.Systemd, collector.Systemd:
+		return "Systemd"
+	case *collector.Kernel, collector.Kernel:
+		return "Kernel"
+	case *collector.Endpoint, collector.Endpoint:
+		return "Endpoint"
+	case *collector.File, collector.File:
+		return "File"
+	case *collector.Prometheus, collector.Prometheus:
+		return "Prometheus"
+	case *collector.Dir, collector.Dir:
+		return "Dir"
+	}
+	return ""
+}
@@ -0,0 +1,20 @@
+package rest
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/dcos/dcos-diagnostics/collector"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollectorType(t *testing.T) {
+	assert.Equal(t, "Cmd", collectorType(collector.NewCmd("cmd", false, []string{"echo"})))
+	assert.Equal(t, "Systemd", collectorType(collector.NewSystemd("systemd", false, "unit", time.Hour)))
+	assert.Equal(t, "Kernel", collectorType(collector.NewKernel("kernel", false, time.Hour)))
+	assert.Equal(t, "Endpoint", collectorType(collector.NewEndpoint("endpoint", false, "http://127.0.0.1", http.DefaultClient)))
+	assert.Equal(t, "File", collectorType(collector.NewFile("file", false, "/dev/null")))
+	assert.Equal(t, "", collectorType(MockCollector{}))
+}
@@ -3,6 +3,7 @@
 package rest
 
 import context "context"
+import http "net/http"
 import mock "github.com/stretchr/testify/mock"
 
 // TestifyMockClient is an autogenerated mock type for the Client type
@@ -10,8 +11,35 @@ type TestifyMockClient struct {
 	mock.Mock
 }
 
-// CreateBundle provides a mock function with given fields: ctx, node, ID
-func (_m *TestifyMockClient) CreateBundle(ctx context.Context, node string, ID string) (*Bundle, error) {
+// CreateBundle provides a mock function with given fields: ctx, node, ID, options
+func (_m *TestifyMockClient) CreateBundle(ctx context.Context, node string, ID string, options BundleOptions) (*Bundle, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	ret := _m.Called(ctx, node, ID, options)
+
+	var r0 *Bundle
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, BundleOptions) *Bundle); ok {
+		r0 = rf(ctx, node, ID, options)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*Bundle)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, BundleOptions) error); ok {
+		r1 = rf(ctx, node, ID, options)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Cancel provides a mock function with given fields: ctx, node, ID
+func (_m *TestifyMockClient) Cancel(ctx context.Context, node string, ID string) (*Bundle, error) {
 	if ctx.Err() != nil {
 		return nil, ctx.Err()
 	}
@@ -73,6 +101,33 @@ func (_m *TestifyMockClient) GetFile(ctx context.Context, node string, ID string
 	return r0
 }
 
+// OpenFile provides a mock function with given fields: ctx, node, ID, header
+func (_m *TestifyMockClient) OpenFile(ctx context.Context, node string, ID string, header http.Header) (*http.Response, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	ret := _m.Called(ctx, node, ID, header)
+
+	var r0 *http.Response
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, http.Header) *http.Response); ok {
+		r0 = rf(ctx, node, ID, header)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*http.Response)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, http.Header) error); ok {
+		r1 = rf(ctx, node, ID, header)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // List provides a mock function with given fields: ctx, node
 func (_m *TestifyMockClient) List(ctx context.Context, node string) ([]*Bundle, error) {
 	if ctx.Err() != nil {
@@ -126,3 +181,30 @@ func (_m *TestifyMockClient) Status(ctx context.Context, node string, ID string)
 
 	return r0, r1
 }
+
+// Upload provides a mock function with given fields: ctx, node, ID
+func (_m *TestifyMockClient) Upload(ctx context.Context, node string, ID string) (*Bundle, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	ret := _m.Called(ctx, node, ID)
+
+	var r0 *Bundle
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) *Bundle); ok {
+		r0 = rf(ctx, node, ID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*Bundle)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(ctx, node, ID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
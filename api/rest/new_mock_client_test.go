@@ -1,17 +1,23 @@
 package rest
 
-import "context"
+import (
+	"context"
+	"net/http"
+)
 
 type MockClient struct {
-	createBundle func(ctx context.Context, node string, ID string) (*Bundle, error)
+	createBundle func(ctx context.Context, node string, ID string, options BundleOptions) (*Bundle, error)
 	status       func(ctx context.Context, node string, ID string) (*Bundle, error)
 	getFile      func(ctx context.Context, node string, ID string, path string) (err error)
+	openFile     func(ctx context.Context, node string, ID string, header http.Header) (*http.Response, error)
 	list         func(ctx context.Context, node string) ([]*Bundle, error)
 	delete       func(ctx context.Context, node string, ID string) error
+	cancel       func(ctx context.Context, node string, ID string) (*Bundle, error)
+	upload       func(ctx context.Context, node string, ID string) (*Bundle, error)
 }
 
-func (_m *MockClient) CreateBundle(ctx context.Context, node string, ID string) (*Bundle, error) {
-	return _m.createBundle(ctx, node, ID)
+func (_m *MockClient) CreateBundle(ctx context.Context, node string, ID string, options BundleOptions) (*Bundle, error) {
+	return _m.createBundle(ctx, node, ID, options)
 }
 
 func (_m *MockClient) Delete(ctx context.Context, node string, ID string) error {
@@ -22,6 +28,10 @@ func (_m *MockClient) GetFile(ctx context.Context, node string, ID string, path
 	return _m.getFile(ctx, node, ID, path)
 }
 
+func (_m *MockClient) OpenFile(ctx context.Context, node string, ID string, header http.Header) (*http.Response, error) {
+	return _m.openFile(ctx, node, ID, header)
+}
+
 func (_m *MockClient) List(ctx context.Context, node string) ([]*Bundle, error) {
 	return _m.list(ctx, node)
 }
@@ -29,3 +39,11 @@ func (_m *MockClient) List(ctx context.Context, node string) ([]*Bundle, error)
 func (_m *MockClient) Status(ctx context.Context, node string, ID string) (*Bundle, error) {
 	return _m.status(ctx, node, ID)
 }
+
+func (_m *MockClient) Cancel(ctx context.Context, node string, ID string) (*Bundle, error) {
+	return _m.cancel(ctx, node, ID)
+}
+
+func (_m *MockClient) Upload(ctx context.Context, node string, ID string) (*Bundle, error) {
+	return _m.upload(ctx, node, ID)
+}
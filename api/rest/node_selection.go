@@ -0,0 +1,180 @@
+package rest
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/dcos/dcos-diagnostics/dcos"
+	"github.com/sirupsen/logrus"
+)
+
+// NodeSelection targets cluster bundle at specific nodes. A node is selected when it matches
+// at least one value of every non-empty criterion. Empty selection matches all nodes.
+type NodeSelection struct {
+	// Roles are node roles: master, agent or agent_public
+	Roles []string `json:"roles,omitempty"`
+	// Hosts are node IPs or hostnames
+	Hosts []string `json:"hosts,omitempty"`
+	// AgentIDs are Mesos agent IDs
+	AgentIDs []string `json:"agent_ids,omitempty"`
+	// Attributes are Mesos attribute selectors in the form name=value e.g., rack=r12
+	Attributes []string `json:"attributes,omitempty"`
+}
+
+// IsZero returns true when selection does not limit nodes
+func (s NodeSelection) IsZero() bool {
+	return len(s.Roles) == 0 && len(s.Hosts) == 0 && len(s.AgentIDs) == 0 && len(s.Attributes) == 0
+}
+
+// validate checks if roles are known and attribute selectors are well formed
+func (s NodeSelection) validate() error {
+	for _, role := range s.Roles {
+		if role != dcos.MasterRole && role != dcos.AgentRole && role != dcos.AgentPublicRole {
+			return fmt.Errorf("unknown role %q, must be %s, %s or %s", role,
+				dcos.MasterRole, dcos.AgentRole, dcos.AgentPublicRole)
+		}
+	}
+	for _, selector := range s.Attributes {
+		if _, _, err := parseAttributeSelector(selector); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// filter returns selected nodes. It fails when any host, agent ID or attribute selector
+// does not match any of the given nodes or when no node matches the whole selection.
+// Hostnames are resolved with lookupHost only when hosts are selected, nil uses net.LookupHost.
+func (s NodeSelection) filter(nodes []dcos.Node, lookupHost func(string) ([]string, error)) ([]dcos.Node, error) {
+	if s.IsZero() {
+		return nodes, nil
+	}
+
+	hosts := newHostResolver(lookupHost)
+	var unknown []string
+	for _, host := range s.Hosts {
+		if !anyNode(nodes, func(n dcos.Node) bool { return hosts.matches(n, host) }) {
+			unknown = append(unknown, fmt.Sprintf("host %s", host))
+		}
+	}
+	for _, id := range s.AgentIDs {
+		if !anyNode(nodes, func(n dcos.Node) bool { return n.MesosID == id }) {
+			unknown = append(unknown, fmt.Sprintf("agent ID %s", id))
+		}
+	}
+	for _, selector := range s.Attributes {
+		if !anyNode(nodes, func(n dcos.Node) bool { return matchesAttribute(n, selector) }) {
+			unknown = append(unknown, fmt.Sprintf("attribute %s", selector))
+		}
+	}
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("unknown targets: %s", strings.Join(unknown, ", "))
+	}
+
+	selected := make([]dcos.Node, 0, len(nodes))
+	for _, n := range nodes {
+		if s.matches(n, hosts) {
+			selected = append(selected, n)
+		}
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("no nodes match the selection")
+	}
+	return selected, nil
+}
+
+func (s NodeSelection) matches(n dcos.Node, hosts *hostResolver) bool {
+	return matchesAnyValue(s.Roles, func(role string) bool { return n.Role == role }) &&
+		matchesAnyValue(s.Hosts, func(host string) bool { return hosts.matches(n, host) }) &&
+		matchesAnyValue(s.AgentIDs, func(id string) bool { return n.MesosID == id }) &&
+		matchesAnyValue(s.Attributes, func(selector string) bool { return matchesAttribute(n, selector) })
+}
+
+// matchesAnyValue returns true when there are no values or any of them matches
+func matchesAnyValue(values []string, match func(string) bool) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if match(v) {
+			return true
+		}
+	}
+	return false
+}
+
+func anyNode(nodes []dcos.Node, match func(dcos.Node) bool) bool {
+	for _, n := range nodes {
+		if match(n) {
+			return true
+		}
+	}
+	return false
+}
+
+// hostResolver matches nodes by IPs or hostnames. Nodes could be registered with hostnames and selected
+// with IPs or the other way around so hostnames are resolved, at most once per selection.
+type hostResolver struct {
+	lookupHost func(string) ([]string, error)
+	ips        map[string][]string
+}
+
+func newHostResolver(lookupHost func(string) ([]string, error)) *hostResolver {
+	if lookupHost == nil {
+		lookupHost = net.LookupHost
+	}
+	return &hostResolver{lookupHost: lookupHost, ips: make(map[string][]string)}
+}
+
+// matches returns true when host is the node IP or hostname or they resolve to the same IP
+func (r *hostResolver) matches(n dcos.Node, host string) bool {
+	return r.same(n.IP, host) || (n.Host != "" && r.same(n.Host, host))
+}
+
+func (r *hostResolver) same(a, b string) bool {
+	if a == b {
+		return true
+	}
+	for _, x := range r.resolve(a) {
+		for _, y := range r.resolve(b) {
+			if x == y {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// resolve returns IPs of the host, the host itself when it's an IP
+func (r *hostResolver) resolve(host string) []string {
+	if net.ParseIP(host) != nil {
+		return []string{host}
+	}
+	if ips, ok := r.ips[host]; ok {
+		return ips
+	}
+	ips, err := r.lookupHost(host)
+	if err != nil {
+		logrus.WithError(err).WithField("host", host).Debug("Could not resolve host")
+	}
+	r.ips[host] = ips
+	return ips
+}
+
+func matchesAttribute(n dcos.Node, selector string) bool {
+	name, value, err := parseAttributeSelector(selector)
+	if err != nil {
+		return false
+	}
+	v, ok := n.Attributes[name]
+	return ok && v == value
+}
+
+func parseAttributeSelector(selector string) (string, string, error) {
+	parts := strings.SplitN(selector, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return "", "", fmt.Errorf("invalid attribute selector %q, must be name=value", selector)
+	}
+	return parts[0], parts[1], nil
+}
@@ -0,0 +1,45 @@
+package rest
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/dcos/dcos-diagnostics/dcos"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNodeSelectionMatchesHostsByResolvedIPs(t *testing.T) {
+	nodes := []dcos.Node{
+		{Role: dcos.AgentRole, IP: "192.0.2.3", MesosID: "S3"},
+		// agents started with a hostname are registered with it
+		{Role: dcos.AgentRole, IP: "agent-6.example.com", MesosID: "S6"},
+		{Role: dcos.AgentRole, IP: "192.0.2.7", MesosID: "S7"},
+	}
+	var lookups []string
+	lookupHost := func(host string) ([]string, error) {
+		lookups = append(lookups, host)
+		switch host {
+		case "agent-3.example.com":
+			return []string{"192.0.2.3"}, nil
+		case "agent-6.example.com":
+			return []string{"192.0.2.6"}, nil
+		}
+		return nil, fmt.Errorf("lookup %s: no such host", host)
+	}
+
+	selected, err := NodeSelection{Hosts: []string{"agent-3.example.com", "192.0.2.6"}}.filter(nodes, lookupHost)
+	require.NoError(t, err)
+	assert.Equal(t, nodes[:2], selected)
+	assert.ElementsMatch(t, []string{"agent-3.example.com", "agent-6.example.com"}, lookups, "hosts should be resolved once")
+
+	_, err = NodeSelection{Hosts: []string{"agent-9.example.com"}}.filter(nodes, lookupHost)
+	assert.EqualError(t, err, "unknown targets: host agent-9.example.com")
+
+	lookups = nil
+	selected, err = NodeSelection{AgentIDs: []string{"S6"}}.filter(nodes, lookupHost)
+	require.NoError(t, err)
+	assert.Equal(t, nodes[1:2], selected)
+	assert.Empty(t, lookups, "hosts should be resolved only when they are selected")
+}
@@ -0,0 +1,124 @@
+package rest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/dcos/dcos-diagnostics/collector"
+)
+
+// collectorReport describes how far a single collector is with gathering its data
+type collectorReport struct {
+	Name     string          `json:"name"`
+	Status   CollectorStatus `json:"status"`
+	Size     int64           `json:"size,omitempty"`     // number of collected bytes
+	Duration string          `json:"duration,omitempty"` // how long collector was running
+	// Truncated is true when collected data exceeded the size limit and was truncated
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// bundleProgress tracks status of every collector taking part in local bundle creation.
+// It is safe to use it from multiple goroutines.
+type bundleProgress struct {
+	mu       sync.Mutex
+	reports  []collectorReport
+	started  []time.Time
+	onUpdate func(reports []collectorReport) // called with a copy of reports every time any of them changes
+}
+
+func newBundleProgress(collectors []collector.Collector, onUpdate func(reports []collectorReport)) *bundleProgress {
+	reports := make([]collectorReport, len(collectors))
+	for i, c := range collectors {
+		reports[i] = collectorReport{Name: c.Name(), Status: CollectorPending}
+	}
+	return &bundleProgress{
+		reports:  reports,
+		started:  make([]time.Time, len(collectors)),
+		onUpdate: onUpdate,
+	}
+}
+
+// running marks i-th collector as running
+func (p *bundleProgress) running(i int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.started[i] = time.Now()
+	p.reports[i].Status = CollectorRunning
+	p.update()
+}
+
+// done marks i-th collector as finished with given number of bytes collected
+func (p *bundleProgress) done(i int, size int64) {
+	p.finished(i, CollectorDone, size)
+}
+
+// failed marks i-th collector as failed with given number of bytes collected
+func (p *bundleProgress) failed(i int, size int64) {
+	p.finished(i, CollectorFailed, size)
+}
+
+// truncated marks data of i-th collector as truncated
+func (p *bundleProgress) truncated(i int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.reports[i].Truncated = true
+	p.update()
+}
+
+func (p *bundleProgress) finished(i int, status CollectorStatus, size int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.reports[i].Status = status
+	p.reports[i].Size = size
+	if !p.started[i].IsZero() {
+		p.reports[i].Duration = time.Since(p.started[i]).String()
+	}
+	p.update()
+}
+
+// snapshot returns a copy of current collectors' reports
+func (p *bundleProgress) snapshot() []collectorReport {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.copyReports()
+}
+
+func (p *bundleProgress) update() {
+	if p.onUpdate != nil {
+		p.onUpdate(p.copyReports())
+	}
+}
+
+func (p *bundleProgress) copyReports() []collectorReport {
+	reports := make([]collectorReport, len(p.reports))
+	copy(reports, p.reports)
+	return reports
+}
+
+// truncatedCollectors returns names of collectors whose data was truncated
+func truncatedCollectors(reports []collectorReport) []string {
+	var names []string
+	for _, r := range reports {
+		if r.Truncated {
+			names = append(names, r.Name)
+		}
+	}
+	return names
+}
+
+// progressPercentage returns percentage of collectors that already finished
+func progressPercentage(reports []collectorReport) float32 {
+	if len(reports) == 0 {
+		return 100
+	}
+	finished := 0
+	for _, r := range reports {
+		if r.Status == CollectorDone || r.Status == CollectorFailed {
+			finished++
+		}
+	}
+	return float32(finished) * 100 / float32(len(reports))
+}
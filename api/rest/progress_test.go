@@ -0,0 +1,47 @@
+package rest
+
+import (
+	"testing"
+
+	"github.com/dcos/dcos-diagnostics/collector"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProgressPercentage(t *testing.T) {
+	assert.Equal(t, float32(100), progressPercentage(nil))
+	assert.Equal(t, float32(0), progressPercentage([]collectorReport{
+		{Status: CollectorPending},
+		{Status: CollectorRunning},
+	}))
+	assert.Equal(t, float32(50), progressPercentage([]collectorReport{
+		{Status: CollectorDone},
+		{Status: CollectorFailed},
+		{Status: CollectorRunning},
+		{Status: CollectorPending},
+	}))
+}
+
+func TestBundleProgressNotifiesAboutEveryUpdate(t *testing.T) {
+	var updates [][]collectorReport
+	progress := newBundleProgress([]collector.Collector{
+		MockCollector{name: "collector-1"},
+		MockCollector{name: "collector-2"},
+	}, func(reports []collectorReport) {
+		updates = append(updates, withoutDurations(&Bundle{Collectors: reports}).Collectors)
+	})
+
+	progress.running(1)
+	progress.failed(1, 3)
+	progress.failed(0, 0)
+
+	assert.Equal(t, [][]collectorReport{
+		{{Name: "collector-1", Status: CollectorPending}, {Name: "collector-2", Status: CollectorRunning}},
+		{{Name: "collector-1", Status: CollectorPending}, {Name: "collector-2", Status: CollectorFailed, Size: 3}},
+		{{Name: "collector-1", Status: CollectorFailed}, {Name: "collector-2", Status: CollectorFailed, Size: 3}},
+	}, updates)
+
+	reports := progress.snapshot()
+	assert.NotEmpty(t, reports[1].Duration)
+	assert.Empty(t, reports[0].Duration, "collector that never run has no duration")
+}
@@ -0,0 +1,75 @@
+package rest
+
+import (
+	"context"
+	"sync"
+)
+
+// BundleRegistry keeps track of bundles that are being created and guards their state files.
+// Local and cluster bundles on a master share the same work dir with the exporter, the janitor
+// and the scheduler, so all of them must share the same registry. This way cluster bundle can be
+// canceled with node level API, the same way it's deleted.
+type BundleRegistry struct {
+	running runningBundles
+	state   sync.RWMutex // guards state files of bundles
+}
+
+// NewBundleRegistry returns registry with no running bundles
+func NewBundleRegistry() *BundleRegistry {
+	return &BundleRegistry{running: runningBundles{bundles: make(map[string]runningBundle)}}
+}
+
+// runningBundle holds information needed to stop bundle creation and
+// wait until it is finished
+type runningBundle struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// runningBundles keeps track of bundles that are being created
+// so they could be canceled
+type runningBundles struct {
+	mu      sync.Mutex
+	bundles map[string]runningBundle
+}
+
+// add registers bundle with given id as running. Given cancel function will be called
+// when bundle is canceled.
+func (r *runningBundles) add(id string, cancel context.CancelFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.bundles[id] = runningBundle{cancel: cancel, done: make(chan struct{})}
+}
+
+// remove marks bundle as finished and notifies everyone waiting for it
+func (r *runningBundles) remove(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b, ok := r.bundles[id]
+	if !ok {
+		return
+	}
+	delete(r.bundles, id)
+	close(b.done)
+}
+
+// cancel calls cancel function of bundle with given id. Returned channel will be closed when
+// bundle is finished. If there is no running bundle with given id false is returned.
+func (r *runningBundles) cancel(id string) (<-chan struct{}, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b, ok := r.bundles[id]
+	if !ok {
+		return nil, false
+	}
+	b.cancel()
+	return b.done, true
+}
+
+// isRunning returns true if bundle with given id is being created
+func (r *runningBundles) isRunning(id string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.bundles[id]
+	return ok
+}
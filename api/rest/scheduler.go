@@ -0,0 +1,330 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dcos/dcos-diagnostics/archive"
+	"github.com/dcos/dcos-diagnostics/cron"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+)
+
+// scheduledBundleTimeFormat is used in IDs of scheduled bundles so they are sorted by creation time
+const scheduledBundleTimeFormat = "20060102T150405Z"
+
+// results of the scheduled run
+const (
+	scheduleCreated = "created"
+	scheduleFailed  = "failed"
+	scheduleSkipped = "skipped"
+)
+
+// scheduleName is used as a prefix of bundle IDs so it must be a valid part of URL path
+var scheduleName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+var schedulerRuns = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "bundle_scheduler_runs_total",
+	Help: "Number of scheduled bundle creations",
+}, []string{"schedule", "result"})
+
+// BundleCreator starts creating a bundle with options given in JSON the same way as in the body
+// of the bundle creation request
+type BundleCreator interface {
+	CreateBundle(id string, options []byte) error
+}
+
+// Schedule describes bundles created periodically
+type Schedule struct {
+	Name string `json:"name"`
+	// Cron is a cron expression e.g., "0 2 * * *" or a descriptor e.g., "@daily" evaluated in the daemon's time zone
+	Cron string `json:"cron"`
+	Type Type   `json:"type"`
+	// Keep is the number of the newest bundles created by the schedule that are kept, 0 keeps all of them
+	Keep int `json:"keep,omitempty"`
+	// Options is the body of the bundle creation request e.g., selected collectors or relative log time window
+	Options json.RawMessage `json:"options,omitempty"`
+}
+
+// LoadSchedules reads schedules from a JSON file containing an array of schedules
+func LoadSchedules(path string) ([]Schedule, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read schedules: %s", err)
+	}
+	var schedules []Schedule
+	if err := json.Unmarshal(content, &schedules); err != nil {
+		return nil, fmt.Errorf("could not parse schedules %s: %s", path, err)
+	}
+	return schedules, nil
+}
+
+// ScheduleStatus describes the schedule and its last run
+type ScheduleStatus struct {
+	Schedule
+	Next       time.Time `json:"next_run_at"`
+	LastRun    time.Time `json:"last_run_at,omitempty"`
+	LastBundle string    `json:"last_bundle,omitempty"`
+	LastError  string    `json:"last_error,omitempty"`
+	// Skipped is the number of runs skipped because the previous bundle was still being created
+	Skipped int `json:"skipped"`
+}
+
+type scheduled struct {
+	Schedule
+	cron   *cron.Schedule
+	create BundleCreator
+
+	status ScheduleStatus // guarded by Scheduler.mu
+}
+
+// Scheduler creates local or cluster bundles on cron schedules. Bundles are created the same way the API
+// creates them so they are not different from requested ones. Their IDs are the schedule name
+// followed by the scheduled time. Local bundles are created on every node and cluster bundles only
+// on the Mesos leader.
+type Scheduler struct {
+	workDir   string
+	schedules []*scheduled
+	clock     Clock
+	leader    Leader          // nil leader creates cluster bundles on every master
+	notifier  *Notifier       // sends Deleted events of pruned bundles, nil disables webhooks
+	bundles   *BundleRegistry // tells which bundles are being created
+
+	mu sync.Mutex // guards schedules statuses
+}
+
+// NewScheduler validates schedules. Local bundles are created with local creator and cluster bundles
+// with cluster creator.
+func NewScheduler(workDir string, schedules []Schedule, local, cluster BundleCreator, leader Leader,
+	notifier *Notifier, bundles *BundleRegistry) (*Scheduler, error) {
+	err := initializeWorkDir(workDir)
+	if err != nil {
+		return nil, err
+	}
+	if bundles == nil {
+		bundles = NewBundleRegistry()
+	}
+
+	s := &Scheduler{
+		workDir:  workDir,
+		clock:    realClock{},
+		leader:   leader,
+		notifier: notifier,
+		bundles:  bundles,
+	}
+
+	names := make(map[string]bool)
+	for _, schedule := range schedules {
+		if !scheduleName.MatchString(schedule.Name) {
+			return nil, fmt.Errorf("invalid schedule name %q, must contain only letters, digits, '.', '_' and '-'", schedule.Name)
+		}
+		if names[schedule.Name] {
+			return nil, fmt.Errorf("schedule %s is defined more than once", schedule.Name)
+		}
+		names[schedule.Name] = true
+
+		c, err := cron.Parse(schedule.Cron)
+		if err != nil {
+			return nil, fmt.Errorf("schedule %s: %s", schedule.Name, err)
+		}
+		if schedule.Keep < 0 {
+			return nil, fmt.Errorf("schedule %s: keep must not be negative, got %d", schedule.Name, schedule.Keep)
+		}
+		if err := validateScheduleOptions(schedule); err != nil {
+			return nil, fmt.Errorf("schedule %s: invalid options: %s", schedule.Name, err)
+		}
+
+		create := local
+		if schedule.Type == Cluster {
+			create = cluster
+		}
+
+		sc := &scheduled{Schedule: schedule, cron: c, create: create}
+		sc.status = ScheduleStatus{Schedule: schedule, Next: c.Next(s.clock.Now())}
+		if ids := s.bundlesOf(schedule.Name); len(ids) > 0 {
+			sc.status.LastBundle = ids[len(ids)-1]
+		}
+		s.schedules = append(s.schedules, sc)
+	}
+
+	return s, nil
+}
+
+// validateScheduleOptions checks options the same way bundle creation request is checked
+// except the time window that is resolved when the bundle is created
+func validateScheduleOptions(schedule Schedule) error {
+	if len(schedule.Options) == 0 {
+		return nil
+	}
+	var (
+		collectors CollectorSelection
+		format     string
+		journal    JournalSelection
+	)
+	if schedule.Type == Cluster {
+		o := defaultOptions
+		if err := json.Unmarshal(schedule.Options, &o); err != nil {
+			return err
+		}
+		if err := o.Targets.validate(); err != nil {
+			return err
+		}
+		collectors, format, journal = o.Collectors, o.Format, o.Journal
+	} else {
+		o := localOptions{}
+		if err := json.Unmarshal(schedule.Options, &o); err != nil {
+			return err
+		}
+		collectors, format, journal = o.Collectors, o.Format, o.Journal
+	}
+	if err := collectors.validate(); err != nil {
+		return err
+	}
+	if _, err := journal.parse(); err != nil {
+		return err
+	}
+	_, err := archive.ParseFormat(format)
+	return err
+}
+
+// Run creates bundles when they are scheduled until ctx is done
+func (s *Scheduler) Run(ctx context.Context) {
+	wg := sync.WaitGroup{}
+	for _, sc := range s.schedules {
+		wg.Add(1)
+		go func(sc *scheduled) {
+			defer wg.Done()
+			for {
+				next := sc.cron.Next(s.clock.Now())
+				if next.IsZero() {
+					logrus.WithField("schedule", sc.Name).Warnf("Schedule %s never runs", sc.Cron)
+					return
+				}
+				s.mu.Lock()
+				sc.status.Next = next
+				s.mu.Unlock()
+
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(next.Sub(s.clock.Now())):
+				}
+				s.run(sc, next)
+			}
+		}(sc)
+	}
+	wg.Wait()
+}
+
+// run creates the scheduled bundle unless the previous one is still being created
+// and removes bundles that exceed the schedule retention
+func (s *Scheduler) run(sc *scheduled, at time.Time) {
+	log := logrus.WithField("schedule", sc.Name)
+
+	if sc.Type == Cluster && !isLeader(s.leader) {
+		log.Debug("Node is not the Mesos leader, skipping cluster bundle")
+		return
+	}
+
+	s.mu.Lock()
+	last := sc.status.LastBundle
+	s.mu.Unlock()
+
+	if last != "" && s.bundles.running.isRunning(last) {
+		log.WithField("ID", last).Warn("Previous scheduled bundle is still being created, skipping")
+		schedulerRuns.WithLabelValues(sc.Name, scheduleSkipped).Inc()
+		s.mu.Lock()
+		sc.status.Skipped++
+		s.mu.Unlock()
+		return
+	}
+
+	id := sc.Name + "-" + at.UTC().Format(scheduledBundleTimeFormat)
+	err := sc.create.CreateBundle(id, sc.Options)
+
+	s.mu.Lock()
+	sc.status.LastRun = at
+	sc.status.LastError = ""
+	if err != nil {
+		sc.status.LastError = err.Error()
+	} else {
+		sc.status.LastBundle = id
+	}
+	s.mu.Unlock()
+
+	if err != nil {
+		log.WithError(err).WithField("ID", id).Error("Could not create scheduled bundle")
+		schedulerRuns.WithLabelValues(sc.Name, scheduleFailed).Inc()
+	} else {
+		log.WithField("ID", id).Info("Scheduled bundle created")
+		schedulerRuns.WithLabelValues(sc.Name, scheduleCreated).Inc()
+	}
+
+	s.prune(sc)
+}
+
+// prune removes the oldest bundles of the schedule that are not being created
+// when there are more of them than the schedule keeps
+func (s *Scheduler) prune(sc *scheduled) {
+	if sc.Keep == 0 {
+		return
+	}
+	ids := s.bundlesOf(sc.Name)
+	for i := 0; i < len(ids)-sc.Keep; i++ {
+		if s.bundles.running.isRunning(ids[i]) {
+			continue
+		}
+		if err := removeBundle(s.bundles, s.workDir, ids[i], s.notifier); err != nil {
+			logrus.WithError(err).WithField("ID", ids[i]).Error("Could not remove scheduled bundle")
+			continue
+		}
+		logrus.WithField("schedule", sc.Name).WithField("ID", ids[i]).Info("Removed old scheduled bundle")
+	}
+}
+
+// bundlesOf returns IDs of bundles created by the schedule sorted from the oldest
+func (s *Scheduler) bundlesOf(name string) []string {
+	infos, err := ioutil.ReadDir(s.workDir)
+	if err != nil {
+		logrus.WithError(err).WithField("workDir", s.workDir).Error("Could not list scheduled bundles")
+		return nil
+	}
+	var ids []string
+	prefix := name + "-"
+	for _, info := range infos {
+		if !info.IsDir() || !strings.HasPrefix(info.Name(), prefix) {
+			continue
+		}
+		// other schedule name could start with this one
+		if _, err := time.Parse(scheduledBundleTimeFormat, strings.TrimPrefix(info.Name(), prefix)); err != nil {
+			continue
+		}
+		ids = append(ids, info.Name())
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// List returns all schedules with their last runs
+func (s *Scheduler) List(w http.ResponseWriter, r *http.Request) {
+	statuses := make([]ScheduleStatus, 0)
+	if s != nil {
+		s.mu.Lock()
+		for _, sc := range s.schedules {
+			statuses = append(statuses, sc.status)
+		}
+		s.mu.Unlock()
+	}
+
+	write(w, jsonMarshal(statuses))
+}
@@ -0,0 +1,276 @@
+package rest
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dcos/dcos-diagnostics/collector"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingCreator creates bundle dirs and records IDs and bodies of creation requests
+type recordingCreator struct {
+	workDir string
+	ids     []string
+	bodies  []string
+}
+
+func (c *recordingCreator) CreateBundle(id string, options []byte) error {
+	c.ids = append(c.ids, id)
+	c.bodies = append(c.bodies, string(options))
+	return os.MkdirAll(filepath.Join(c.workDir, id), dirPerm)
+}
+
+// conflictingCreator fails to create every bundle because it already exists
+type conflictingCreator struct{}
+
+func (conflictingCreator) CreateBundle(id string, options []byte) error {
+	return &DiagnosticsBundleAlreadyExists{id: id}
+}
+
+func TestIfSchedulerCreatesLocalBundle(t *testing.T) {
+	workdir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workdir)
+
+	collectors := []collector.Collector{
+		MockCollector{name: "collector-1", rc: ioutil.NopCloser(strings.NewReader("data 1"))},
+		MockCollector{name: "collector-2", rc: ioutil.NopCloser(strings.NewReader("data 2"))},
+	}
+	bh, err := NewBundleHandler(workdir, collectors, time.Second, time.Second, 1, BundleHandlerOptions{})
+	require.NoError(t, err)
+
+	s, err := NewScheduler(workdir, []Schedule{{
+		Name:    "nightly",
+		Cron:    "0 2 * * *",
+		Type:    Local,
+		Options: json.RawMessage(`{"collectors": {"include": ["collector-2"]}, "since": "24h"}`),
+	}}, bh, nil, nil, nil, bh.bundles)
+	require.NoError(t, err)
+
+	at := time.Date(2020, 5, 15, 2, 0, 0, 0, time.UTC)
+	s.run(s.schedules[0], at)
+
+	id := "nightly-20200515T020000Z"
+	var bundle Bundle
+	for i := 0; i < 1000; i++ {
+		bundle, err = readBundleState(workdir, id)
+		if err == nil && bundle.IsFinished() {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	require.NoError(t, err)
+	assert.Equal(t, Done, bundle.Status)
+	require.NotNil(t, bundle.Since)
+	require.Len(t, bundle.Collectors, 1)
+	assert.Equal(t, "collector-2", bundle.Collectors[0].Name)
+
+	status := s.schedules[0].status
+	assert.Equal(t, at, status.LastRun)
+	assert.Equal(t, id, status.LastBundle)
+	assert.Empty(t, status.LastError)
+}
+
+func TestIfSchedulerUsesClusterHandlerForClusterBundles(t *testing.T) {
+	workdir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workdir)
+
+	local := &recordingCreator{workDir: workdir}
+	cluster := &recordingCreator{workDir: workdir}
+	s, err := NewScheduler(workdir, []Schedule{
+		{Name: "local", Cron: "@hourly"},
+		{Name: "cluster", Cron: "@daily", Type: Cluster, Options: json.RawMessage(`{"agents": false}`)},
+	}, local, cluster, nil, nil, nil)
+	require.NoError(t, err)
+
+	at := time.Date(2020, 5, 15, 0, 0, 0, 0, time.UTC)
+	for _, sc := range s.schedules {
+		s.run(sc, at)
+	}
+
+	assert.Equal(t, []string{"local-20200515T000000Z"}, local.ids)
+	assert.Equal(t, []string{""}, local.bodies)
+	assert.Equal(t, []string{"cluster-20200515T000000Z"}, cluster.ids)
+	assert.Equal(t, []string{`{"agents": false}`}, cluster.bodies)
+}
+
+func TestIfSchedulerCreatesClusterBundlesOnlyOnLeader(t *testing.T) {
+	workdir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workdir)
+
+	local := &recordingCreator{workDir: workdir}
+	cluster := &recordingCreator{workDir: workdir}
+	leader := mockLeader(false)
+	s, err := NewScheduler(workdir, []Schedule{
+		{Name: "local", Cron: "@hourly"},
+		{Name: "cluster", Cron: "@daily", Type: Cluster},
+	}, local, cluster, &leader, nil, nil)
+	require.NoError(t, err)
+
+	at := time.Date(2020, 5, 15, 0, 0, 0, 0, time.UTC)
+	for _, sc := range s.schedules {
+		s.run(sc, at)
+	}
+	assert.Equal(t, []string{"local-20200515T000000Z"}, local.ids)
+	assert.Empty(t, cluster.ids)
+	assert.True(t, s.schedules[1].status.LastRun.IsZero())
+
+	leader = true
+	s.run(s.schedules[1], at.Add(24*time.Hour))
+	assert.Equal(t, []string{"cluster-20200516T000000Z"}, cluster.ids)
+}
+
+func TestIfSchedulerSkipsRunWhenPreviousBundleIsBeingCreated(t *testing.T) {
+	workdir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workdir)
+
+	creator := &recordingCreator{workDir: workdir}
+	s, err := NewScheduler(workdir, []Schedule{{Name: "hourly", Cron: "@hourly"}}, creator, nil, nil, nil, nil)
+	require.NoError(t, err)
+	sc := s.schedules[0]
+
+	at := time.Date(2020, 5, 15, 0, 0, 0, 0, time.UTC)
+	s.run(sc, at)
+	s.bundles.running.add("hourly-20200515T000000Z", func() {})
+
+	s.run(sc, at.Add(time.Hour))
+	assert.Equal(t, []string{"hourly-20200515T000000Z"}, creator.ids)
+	assert.Equal(t, 1, sc.status.Skipped)
+	assert.Equal(t, at, sc.status.LastRun)
+
+	s.bundles.running.remove("hourly-20200515T000000Z")
+	s.run(sc, at.Add(2*time.Hour))
+	assert.Equal(t, []string{"hourly-20200515T000000Z", "hourly-20200515T020000Z"}, creator.ids)
+	assert.Equal(t, "hourly-20200515T020000Z", sc.status.LastBundle)
+}
+
+func TestIfSchedulerKeepsOnlyNewestBundles(t *testing.T) {
+	workdir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workdir)
+
+	// bundles of other schedules and requested bundles are not removed
+	for _, id := range []string{"hourly-20200514T220000Z", "hourly-20200514T230000Z", "hourly-extra-20200514T000000Z", "hourly-bundle"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(workdir, id), dirPerm))
+	}
+	running := "hourly-20200514T210000Z"
+	require.NoError(t, os.MkdirAll(filepath.Join(workdir, running), dirPerm))
+	bundles := NewBundleRegistry()
+	bundles.running.add(running, func() {})
+	defer bundles.running.remove(running)
+
+	creator := &recordingCreator{workDir: workdir}
+	s, err := NewScheduler(workdir, []Schedule{{Name: "hourly", Cron: "@hourly", Keep: 2}}, creator, nil, nil, nil, bundles)
+	require.NoError(t, err)
+	assert.Equal(t, "hourly-20200514T230000Z", s.schedules[0].status.LastBundle)
+
+	s.run(s.schedules[0], time.Date(2020, 5, 15, 0, 0, 0, 0, time.UTC))
+
+	infos, err := ioutil.ReadDir(workdir)
+	require.NoError(t, err)
+	var ids []string
+	for _, info := range infos {
+		ids = append(ids, info.Name())
+	}
+	assert.Equal(t, []string{
+		"hourly-20200514T210000Z",
+		"hourly-20200514T230000Z",
+		"hourly-20200515T000000Z",
+		"hourly-bundle",
+		"hourly-extra-20200514T000000Z",
+	}, ids)
+}
+
+func TestIfSchedulerRecordsCreationError(t *testing.T) {
+	workdir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workdir)
+
+	s, err := NewScheduler(workdir, []Schedule{{Name: "daily", Cron: "@daily"}}, conflictingCreator{}, nil, nil, nil, nil)
+	require.NoError(t, err)
+	s.clock = &MockClock{now: time.Date(2020, 5, 15, 0, 30, 0, 0, time.UTC)}
+	s.schedules[0].status.Next = s.schedules[0].cron.Next(s.clock.Now())
+
+	s.run(s.schedules[0], time.Date(2020, 5, 15, 0, 0, 0, 0, time.UTC))
+
+	router := mux.NewRouter()
+	router.HandleFunc("/schedules", s.List).Methods(http.MethodGet)
+	req, err := http.NewRequest(http.MethodGet, "/schedules", nil)
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `[{
+		"name": "daily",
+		"cron": "@daily",
+		"type": "Local",
+		"next_run_at": "2020-05-16T00:00:00Z",
+		"last_run_at": "2020-05-15T00:00:00Z",
+		"last_error": "bundle daily-20200515T000000Z already exists",
+		"skipped": 0
+	}]`, rr.Body.String())
+}
+
+func TestListWithoutSchedules(t *testing.T) {
+	var s *Scheduler
+	rr := httptest.NewRecorder()
+	s.List(rr, nil)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `[]`, rr.Body.String())
+}
+
+func TestNewSchedulerValidatesSchedules(t *testing.T) {
+	workdir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workdir)
+
+	for _, tc := range []struct {
+		schedules []Schedule
+		err       string
+	}{
+		{
+			schedules: []Schedule{{Name: "nightly bundle", Cron: "@daily"}},
+			err:       `invalid schedule name "nightly bundle", must contain only letters, digits, '.', '_' and '-'`,
+		},
+		{
+			schedules: []Schedule{{Name: "nightly", Cron: "@daily"}, {Name: "nightly", Cron: "@hourly"}},
+			err:       "schedule nightly is defined more than once",
+		},
+		{
+			schedules: []Schedule{{Name: "nightly", Cron: "0 25 * * *"}},
+			err:       `schedule nightly: invalid schedule "0 25 * * *": invalid hour "25", must be between 0 and 23`,
+		},
+		{
+			schedules: []Schedule{{Name: "nightly", Cron: "@daily", Keep: -1}},
+			err:       "schedule nightly: keep must not be negative, got -1",
+		},
+		{
+			schedules: []Schedule{{Name: "nightly", Cron: "@daily", Options: json.RawMessage(`{"format": "rar"}`)}},
+			err:       `schedule nightly: invalid options: unknown format "rar", must be zip, tar.gz or tar.zst`,
+		},
+		{
+			schedules: []Schedule{{Name: "nightly", Cron: "@daily", Type: Cluster,
+				Options: json.RawMessage(`{"collectors": {"include": ["["]}}`)}},
+			err: `schedule nightly: invalid options: invalid collector pattern "[": syntax error in pattern`,
+		},
+	} {
+		_, err := NewScheduler(workdir, tc.schedules, nil, nil, nil, nil, nil)
+		assert.EqualError(t, err, tc.err)
+	}
+}
@@ -0,0 +1,222 @@
+package rest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// Truncation tells which part of collected data is kept when it exceeds the size limit
+type Truncation string
+
+const (
+	// TruncateHead keeps the beginning of collected data, collection stops when the limit is reached
+	TruncateHead Truncation = "head"
+	// TruncateTail keeps the end of collected data
+	TruncateTail Truncation = "tail"
+	// TruncateHeadTail keeps the beginning and the end of collected data, half of the limit each
+	TruncateHeadTail Truncation = "head+tail"
+)
+
+// ParseTruncation returns truncation with the given name, empty name is TruncateHead
+func ParseTruncation(name string) (Truncation, error) {
+	switch t := Truncation(name); t {
+	case "":
+		return TruncateHead, nil
+	case TruncateHead, TruncateTail, TruncateHeadTail:
+		return t, nil
+	}
+	return "", fmt.Errorf("unknown truncation %q, must be %s, %s or %s", name, TruncateHead, TruncateTail, TruncateHeadTail)
+}
+
+// SizeLimit limits the number of bytes a single collector writes into the bundle
+type SizeLimit struct {
+	// MaxSize is the number of bytes written into all files of the collector, 0 disables the limit
+	MaxSize    int64
+	Truncation Truncation
+}
+
+// SizeLimits limit the number of bytes collectors write into the bundle. Truncated files are marked where
+// their data was cut.
+type SizeLimits struct {
+	// Default limits collectors not listed in Collectors
+	Default SizeLimit
+	// Collectors are limits of collectors by their names
+	Collectors map[string]SizeLimit
+	// MaxBundleSize is the number of bytes written by all collectors, 0 disables the limit.
+	// Files that do not fit are truncated the same way their collector truncates them.
+	MaxBundleSize int64
+}
+
+func (l SizeLimits) collector(name string) SizeLimit {
+	if limit, ok := l.Collectors[name]; ok {
+		return limit
+	}
+	return l.Default
+}
+
+// truncationMarker is written in place of the data that was cut
+func truncationMarker(limit int64) []byte {
+	return []byte(fmt.Sprintf("\n[... truncated by dcos-diagnostics, data exceeded the limit of %d bytes ...]\n", limit))
+}
+
+// errLimitReached stops reading collected data when the rest of it would not be kept
+var errLimitReached = errors.New("limit reached")
+
+// truncatingWriter keeps at most head bytes from the beginning and tail bytes from the end of written data
+// in the file. The end is written to a ring buffer placed in the file after the beginning.
+type truncatingWriter struct {
+	file *os.File
+	head int64
+	tail int64
+	n    int64 // number of bytes written so far
+}
+
+func newTruncatingWriter(file *os.File, limit int64, truncation Truncation) *truncatingWriter {
+	w := &truncatingWriter{file: file}
+	if limit < 0 {
+		limit = 0
+	}
+	switch truncation {
+	case TruncateTail:
+		w.tail = limit
+	case TruncateHeadTail:
+		w.head = limit / 2
+		w.tail = limit - w.head
+	default:
+		w.head = limit
+	}
+	return w
+}
+
+// Write returns errLimitReached when only the beginning is kept and it was already written
+func (w *truncatingWriter) Write(p []byte) (int, error) {
+	written := 0
+	if w.n < w.head {
+		k := len(p)
+		if int64(k) > w.head-w.n {
+			k = int(w.head - w.n)
+		}
+		if _, err := w.file.WriteAt(p[:k], w.n); err != nil {
+			return 0, err
+		}
+		w.n += int64(k)
+		written += k
+		p = p[k:]
+	}
+	if len(p) > 0 && w.tail == 0 {
+		w.n += int64(len(p))
+		return written, errLimitReached
+	}
+	for len(p) > 0 {
+		offset := (w.n - w.head) % w.tail
+		k := len(p)
+		if int64(k) > w.tail-offset {
+			k = int(w.tail - offset)
+		}
+		if _, err := w.file.WriteAt(p[:k], w.head+offset); err != nil {
+			return written, err
+		}
+		w.n += int64(k)
+		written += k
+		p = p[k:]
+	}
+	return written, nil
+}
+
+func (w *truncatingWriter) truncated() bool {
+	return w.n > w.head+w.tail
+}
+
+// rewrite writes kept data in order with the marker into a new temporary file in dir and removes the written
+// file. It returns the new file with its size and hex encoded SHA-256.
+func (w *truncatingWriter) rewrite(dir string, marker []byte) (*os.File, int64, string, error) {
+	f, err := ioutil.TempFile(dir, "collector-*")
+	if err != nil {
+		return nil, 0, "", fmt.Errorf("could not create a spool file: %s", err)
+	}
+	defer func() {
+		w.file.Close()
+		os.Remove(w.file.Name())
+	}()
+
+	parts := []io.Reader{io.NewSectionReader(w.file, 0, w.head)}
+	parts = append(parts, bytes.NewReader(marker))
+	if w.tail > 0 {
+		offset := (w.n - w.head) % w.tail
+		parts = append(parts,
+			io.NewSectionReader(w.file, w.head+offset, w.tail-offset),
+			io.NewSectionReader(w.file, w.head, offset))
+	}
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(f, hash), io.MultiReader(parts...))
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, 0, "", fmt.Errorf("could not truncate spool file: %s", err)
+	}
+	return f, size, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// max returns the number of bytes that could be written after written bytes, negative when there is no limit
+func (l SizeLimit) max(written int64) int64 {
+	if l.MaxSize <= 0 {
+		return -1
+	}
+	if written > l.MaxSize {
+		return 0
+	}
+	return l.MaxSize - written
+}
+
+// markedLimit returns the number of data bytes that fit into budget together with their truncation marker,
+// negative when even the marker does not fit
+func markedLimit(budget int64) int64 {
+	limit := budget - int64(len(truncationMarker(budget)))
+	// the marker of a smaller limit may be shorter
+	for limit >= -1 && limit+1+int64(len(truncationMarker(limit+1))) <= budget {
+		limit++
+	}
+	return limit
+}
+
+// truncateSpool truncates the spooled file so its data with the truncation marker takes at most budget bytes,
+// its spool file is replaced with a new one in dir. When the marker does not fit the file is left empty.
+func truncateSpool(f spooledFile, budget int64, truncation Truncation, dir string) spooledFile {
+	spool := f.spool
+	defer func() {
+		spool.Close()
+		os.Remove(spool.Name())
+	}()
+	f.spool = nil
+
+	tmp, err := ioutil.TempFile(dir, "collector-*")
+	if err != nil {
+		f.err = fmt.Errorf("could not create a %s spool file: %s", f.name, err)
+		return f
+	}
+	limit := markedLimit(budget)
+	marker := truncationMarker(limit)
+	if limit < 0 {
+		marker = nil
+	}
+	w := newTruncatingWriter(tmp, limit, truncation)
+	if _, err := io.Copy(w, io.NewSectionReader(spool, 0, f.size)); err != nil && err != errLimitReached {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		f.err = fmt.Errorf("could not truncate %s: %s", f.name, err)
+		return f
+	}
+	f.spool, f.size, f.sha256, err = w.rewrite(dir, marker)
+	if err != nil {
+		f.err = fmt.Errorf("could not truncate %s: %s", f.name, err)
+	}
+	f.truncated = true
+	return f
+}
@@ -0,0 +1,255 @@
+package rest
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/dcos/dcos-diagnostics/collector"
+	"github.com/gorilla/mux"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readSpool(t *testing.T, f spooledFile) string {
+	require.NoError(t, f.err)
+	_, err := f.spool.Seek(0, 0)
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(f.spool)
+	require.NoError(t, err)
+	require.NoError(t, f.spool.Close())
+	assert.EqualValues(t, len(data), f.size)
+	return string(data)
+}
+
+func TestSpoolFileTruncatesData(t *testing.T) {
+	t.Parallel()
+
+	workdir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workdir)
+
+	data := "0123456789abcdefghij"
+	marker := string(truncationMarker(8))
+	for _, tc := range []struct {
+		max        int64
+		truncation Truncation
+		expected   string
+		truncated  bool
+	}{
+		{max: -1, truncation: TruncateHead, expected: data},
+		{max: 20, truncation: TruncateTail, expected: data},
+		{max: 20, truncation: TruncateHeadTail, expected: data},
+		{max: 8, truncation: TruncateHead, expected: "01234567" + marker, truncated: true},
+		{max: 8, truncation: TruncateTail, expected: marker + "cdefghij", truncated: true},
+		{max: 8, truncation: TruncateHeadTail, expected: "0123" + marker + "ghij", truncated: true},
+		{max: 0, truncation: TruncateTail, expected: string(truncationMarker(0)), truncated: true},
+	} {
+		// small reads exercise wrapping of the ring buffer keeping the end of data
+		rc := ioutil.NopCloser(iotest.OneByteReader(strings.NewReader(data)))
+		f, err := spoolFile("test", rc, nil, tc.max, tc.truncation, workdir)
+		require.NoError(t, err)
+
+		assert.Equal(t, tc.expected, readSpool(t, f), "%d %s", tc.max, tc.truncation)
+		assert.Equal(t, tc.truncated, f.truncated, "%d %s", tc.max, tc.truncation)
+	}
+
+	files, err := ioutil.ReadDir(workdir)
+	require.NoError(t, err)
+	assert.Len(t, files, 7, "replaced spool files should be removed")
+}
+
+func TestCollectAllTruncatesCollectorsExceedingLimits(t *testing.T) {
+	t.Parallel()
+
+	workdir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workdir)
+
+	dataFile, err := os.Create(filepath.Join(workdir, dataFileName))
+	require.NoError(t, err)
+
+	collectors := []collector.Collector{
+		MockCollector{name: "mesos-master.log", rc: ioutil.NopCloser(strings.NewReader("started\nrunning\nfailed\n"))},
+		MockCollector{name: "ps.output", rc: ioutil.NopCloser(strings.NewReader("1 init\n"))},
+		MockCollector{name: "dmesg.output", rc: ioutil.NopCloser(strings.NewReader(strings.Repeat("line\n", 40)))},
+	}
+	limits := SizeLimits{
+		Default:       SizeLimit{MaxSize: 20, Truncation: TruncateHead},
+		Collectors:    map[string]SizeLimit{"mesos-master.log": {MaxSize: 7, Truncation: TruncateTail}},
+		MaxBundleSize: int64(7 + len(truncationMarker(7)) + 7 + 3 + len(truncationMarker(3))),
+	}
+
+	done := make(chan []string)
+	progress := newBundleProgress(collectors, nil)
+	go collectAll(context.Background(), done, dataFile, workdir, collectors, node{}, BundleOptions{}, nil, limits, time.Second, 1, progress)
+	assert.Empty(t, <-done)
+
+	var truncated []bool
+	for _, r := range progress.snapshot() {
+		truncated = append(truncated, r.Truncated)
+	}
+	assert.Equal(t, []bool{true, false, true}, truncated)
+	assert.Equal(t, []string{"mesos-master.log", "dmesg.output"}, truncatedCollectors(progress.snapshot()))
+
+	reader, err := zip.OpenReader(dataFile.Name())
+	require.NoError(t, err)
+	defer reader.Close()
+
+	content := make(map[string]string)
+	for _, f := range reader.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+		data, err := ioutil.ReadAll(rc)
+		require.NoError(t, err)
+		content[f.Name] = string(data)
+	}
+	assert.Equal(t, string(truncationMarker(7))+"failed\n", content["mesos-master.log"])
+	assert.Equal(t, "1 init\n", content["ps.output"])
+	assert.Equal(t, "lin"+string(truncationMarker(3)), content["dmesg.output"])
+
+	m := manifest{}
+	require.NoError(t, json.Unmarshal([]byte(content[manifestFileName]), &m))
+	require.Len(t, m.Entries, 3)
+	assert.True(t, m.Entries[0].Truncated)
+	assert.False(t, m.Entries[1].Truncated)
+	assert.True(t, m.Entries[2].Truncated)
+	assert.EqualValues(t, len(content["dmesg.output"]), m.Entries[2].Size)
+}
+
+func TestCollectAllKeepsBundleWithinLimitWhenManyFilesOverflow(t *testing.T) {
+	t.Parallel()
+
+	workdir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workdir)
+
+	dataFile, err := os.Create(filepath.Join(workdir, dataFileName))
+	require.NoError(t, err)
+
+	// data is longer than the truncation marker
+	data := strings.Repeat("0123456789", 20)
+	var collectors []collector.Collector
+	for _, name := range []string{"first", "second", "third", "fourth"} {
+		collectors = append(collectors, MockCollector{name: name, rc: ioutil.NopCloser(strings.NewReader(data))})
+	}
+	limits := SizeLimits{
+		Default:       SizeLimit{Truncation: TruncateTail},
+		MaxBundleSize: int64(len(data) + 5 + len(truncationMarker(5))),
+	}
+
+	done := make(chan []string)
+	progress := newBundleProgress(collectors, nil)
+	go collectAll(context.Background(), done, dataFile, workdir, collectors, node{}, BundleOptions{}, nil, limits, time.Second, 1, progress)
+	assert.Empty(t, <-done)
+	assert.Equal(t, []string{"second", "third", "fourth"}, truncatedCollectors(progress.snapshot()))
+
+	reader, err := zip.OpenReader(dataFile.Name())
+	require.NoError(t, err)
+	defer reader.Close()
+
+	content := make(map[string]string)
+	for _, f := range reader.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+		data, err := ioutil.ReadAll(rc)
+		require.NoError(t, err)
+		content[f.Name] = string(data)
+	}
+	assert.Equal(t, data, content["first"])
+	assert.Equal(t, string(truncationMarker(5))+"56789", content["second"])
+	assert.Empty(t, content["third"], "data should not be written when the marker does not fit")
+	assert.Empty(t, content["fourth"])
+
+	m := manifest{}
+	require.NoError(t, json.Unmarshal([]byte(content[manifestFileName]), &m))
+	var size int64
+	for _, e := range m.Entries {
+		assert.False(t, e.Failed, e.Err)
+		size += e.Size
+	}
+	assert.True(t, size <= limits.MaxBundleSize, "%d bytes exceed the limit of %d", size, limits.MaxBundleSize)
+}
+
+func TestTruncatingWriterClampsNegativeLimit(t *testing.T) {
+	f, err := ioutil.TempFile("", "collector-*")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	for _, truncation := range []Truncation{TruncateHead, TruncateTail, TruncateHeadTail} {
+		w := newTruncatingWriter(f, -10, truncation)
+		n, err := w.Write([]byte("data"))
+		assert.Equal(t, 0, n)
+		assert.Equal(t, errLimitReached, err)
+		assert.True(t, w.truncated())
+	}
+}
+
+func TestParseTruncation(t *testing.T) {
+	for name, expected := range map[string]Truncation{
+		"":          TruncateHead,
+		"head":      TruncateHead,
+		"tail":      TruncateTail,
+		"head+tail": TruncateHeadTail,
+	} {
+		truncation, err := ParseTruncation(name)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, truncation)
+	}
+
+	_, err := ParseTruncation("middle")
+	assert.EqualError(t, err, `unknown truncation "middle", must be head, tail or head+tail`)
+}
+
+func TestIfCreateListsTruncatedCollectorsInState(t *testing.T) {
+	t.Parallel()
+	workdir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workdir)
+
+	collectors := []collector.Collector{
+		MockCollector{name: "big", rc: ioutil.NopCloser(strings.NewReader("big collector output"))},
+		MockCollector{name: "small", rc: ioutil.NopCloser(strings.NewReader("OK"))},
+	}
+	limits := SizeLimits{Default: SizeLimit{MaxSize: 3, Truncation: TruncateHeadTail}}
+
+	bh, err := NewBundleHandler(workdir, collectors, time.Second, time.Second, 1, BundleHandlerOptions{Limits: limits})
+	require.NoError(t, err)
+
+	router := mux.NewRouter()
+	router.HandleFunc(bundleEndpoint, bh.Create).Methods(http.MethodPut)
+	router.HandleFunc(bundleEndpoint, bh.Get).Methods(http.MethodGet)
+
+	req, err := http.NewRequest(http.MethodPut, bundlesEndpoint+"/bundle-0", nil)
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	bundle := &Bundle{}
+	for !bundle.IsFinished() {
+		req, err := http.NewRequest(http.MethodGet, bundlesEndpoint+"/bundle-0", nil)
+		require.NoError(t, err)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), bundle))
+	}
+
+	assert.Equal(t, Done, bundle.Status)
+	assert.Equal(t, []string{"big"}, bundle.Truncated)
+	require.Len(t, bundle.Collectors, 2)
+	assert.True(t, bundle.Collectors[0].Truncated)
+	assert.EqualValues(t, 3+len(truncationMarker(3)), bundle.Collectors[0].Size)
+	assert.False(t, bundle.Collectors[1].Truncated)
+}
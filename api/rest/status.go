@@ -61,3 +61,50 @@ func (s *Status) UnmarshalJSON(b []byte) error {
 	*s = toID[j]
 	return nil
 }
+
+// CollectorStatus represents a status of a single collector run during local bundle creation
+type CollectorStatus int
+
+const (
+	CollectorPending CollectorStatus = iota // Collector is waiting to be run
+	CollectorRunning                        // Collector is gathering data
+	CollectorDone                           // Collector data was added to the bundle
+	CollectorFailed                         // Collector could not gather data or it was not run at all
+)
+
+func (s CollectorStatus) String() string {
+	return collectorStatusToString[s]
+}
+
+var collectorStatusToString = map[CollectorStatus]string{
+	CollectorPending: "Pending",
+	CollectorRunning: "Running",
+	CollectorDone:    "Done",
+	CollectorFailed:  "Failed",
+}
+
+var collectorStatusToID = map[string]CollectorStatus{
+	"Pending": CollectorPending,
+	"Running": CollectorRunning,
+	"Done":    CollectorDone,
+	"Failed":  CollectorFailed,
+}
+
+// MarshalJSON marshals the enum as a quoted json string
+func (s CollectorStatus) MarshalJSON() ([]byte, error) {
+	buffer := bytes.NewBufferString(`"`)
+	buffer.WriteString(collectorStatusToString[s])
+	buffer.WriteString(`"`)
+	return buffer.Bytes(), nil
+}
+
+// UnmarshalJSON unmashals a quoted json string to the enum value
+func (s *CollectorStatus) UnmarshalJSON(b []byte) error {
+	var j string
+	err := json.Unmarshal(b, &j)
+	if err != nil {
+		return err
+	}
+	*s = collectorStatusToID[j]
+	return nil
+}
@@ -0,0 +1,36 @@
+package rest
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollectorStatus_MarshalUnmarshalJSON(t *testing.T) {
+	for _, tt := range []struct {
+		s      string
+		j      string
+		actual CollectorStatus
+	}{
+		{"Pending", `"Pending"`, CollectorPending},
+		{"Running", `"Running"`, CollectorRunning},
+		{"Done", `"Done"`, CollectorDone},
+		{"Failed", `"Failed"`, CollectorFailed},
+	} {
+
+		t.Run(tt.s, func(t *testing.T) {
+			var actual CollectorStatus
+
+			err := json.Unmarshal([]byte(tt.j), &actual)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.actual, actual)
+
+			assert.Equal(t, tt.s, actual.String())
+
+			b, err := json.Marshal(actual)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.j, string(b))
+		})
+	}
+}
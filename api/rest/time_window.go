@@ -0,0 +1,60 @@
+package rest
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dcos/dcos-diagnostics/collector"
+)
+
+// parseTimeWindow returns log time window from the bundle creation request. Every bound is either
+// RFC 3339 timestamp or a duration before now e.g., "72h". Empty bound means there is no limit.
+func parseTimeWindow(since, until string, now time.Time) (collector.TimeWindow, error) {
+	window := collector.TimeWindow{}
+	var err error
+
+	if window.Since, err = parseTimeBound(since, now); err != nil {
+		return window, fmt.Errorf("invalid since: %s", err)
+	}
+	if window.Until, err = parseTimeBound(until, now); err != nil {
+		return window, fmt.Errorf("invalid until: %s", err)
+	}
+	if !window.Since.IsZero() && !window.Until.IsZero() && window.Until.Before(window.Since) {
+		return window, fmt.Errorf("until %s is before since %s",
+			window.Until.Format(time.RFC3339), window.Since.Format(time.RFC3339))
+	}
+	return window, nil
+}
+
+func parseTimeBound(bound string, now time.Time) (time.Time, error) {
+	if bound == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, bound); err == nil {
+		return t, nil
+	}
+	d, err := time.ParseDuration(bound)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither RFC 3339 timestamp nor duration", bound)
+	}
+	if d < 0 {
+		d = -d
+	}
+	return now.Add(-d), nil
+}
+
+// formatTimeBound returns bound in the format accepted by parseTimeWindow
+func formatTimeBound(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+// timePtr returns nil for zero time so it's omitted in JSON
+func timePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
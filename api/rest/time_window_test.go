@@ -0,0 +1,76 @@
+package rest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dcos/dcos-diagnostics/collector"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTimeWindow(t *testing.T) {
+	now := time.Date(2019, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		name     string
+		since    string
+		until    string
+		expected collector.TimeWindow
+		err      string
+	}{
+		{name: "no limits"},
+		{
+			name:     "timestamps",
+			since:    "2019-10-01T10:00:00Z",
+			until:    "2019-10-01T11:30:00.5+01:00",
+			expected: collector.TimeWindow{Since: now.Add(-2 * time.Hour), Until: time.Date(2019, 10, 1, 10, 30, 0, 5e8, time.UTC)},
+		},
+		{
+			name:     "durations",
+			since:    "72h",
+			until:    "-1h",
+			expected: collector.TimeWindow{Since: now.Add(-72 * time.Hour), Until: now.Add(-time.Hour)},
+		},
+		{
+			name:     "only until",
+			until:    "30m",
+			expected: collector.TimeWindow{Until: now.Add(-30 * time.Minute)},
+		},
+		{
+			name:  "invalid since",
+			since: "yesterday",
+			err:   `invalid since: "yesterday" is neither RFC 3339 timestamp nor duration`,
+		},
+		{
+			name:  "invalid until",
+			until: "2019-10-01",
+			err:   `invalid until: "2019-10-01" is neither RFC 3339 timestamp nor duration`,
+		},
+		{
+			name:  "until before since",
+			since: "1h",
+			until: "2h",
+			err:   "until 2019-10-01T10:00:00Z is before since 2019-10-01T11:00:00Z",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			window, err := parseTimeWindow(tc.since, tc.until, now)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.True(t, tc.expected.Since.Equal(window.Since), "expected since %s got %s", tc.expected.Since, window.Since)
+			assert.True(t, tc.expected.Until.Equal(window.Until), "expected until %s got %s", tc.expected.Until, window.Until)
+		})
+	}
+}
+
+func TestFormatTimeBoundIsParsedBack(t *testing.T) {
+	assert.Empty(t, formatTimeBound(time.Time{}))
+
+	bound := time.Date(2019, 10, 1, 12, 0, 0, 123, time.UTC)
+	parsed, err := parseTimeBound(formatTimeBound(bound), time.Now())
+	assert.NoError(t, err)
+	assert.True(t, bound.Equal(parsed))
+}
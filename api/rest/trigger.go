@@ -0,0 +1,231 @@
+package rest
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dcos/dcos-diagnostics/collector"
+	"github.com/dcos/dcos-diagnostics/dcos"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+)
+
+// unit health values reported by nodes, dcos.Healthy and dcos.Unhealthy names are swapped
+// so the values are used directly
+const (
+	unitHealthy   dcos.Health = 0
+	unitUnhealthy dcos.Health = 1
+)
+
+// results of the unhealthy unit observation
+const (
+	triggerCreated  = "created"
+	triggerFailed   = "failed"
+	triggerCooldown = "cooldown"
+	triggerLimit    = "limit"
+)
+
+// triggerPollInterval is how often status of the automatic bundle is checked
+const triggerPollInterval = 5 * time.Second
+
+var triggerBundles = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "bundle_trigger_bundles_total",
+	Help: "Number of times unit turned unhealthy by what happened with the automatic bundle",
+}, []string{"result"})
+
+// TriggerPolicy describes when and what automatic bundles are created
+type TriggerPolicy struct {
+	// Units are glob patterns (see path.Match) of unit names that trigger bundles, empty matches no unit
+	Units []string
+	// Cooldown is the minimal time between two automatic bundles on the same node
+	Cooldown time.Duration
+	// Collectors run in automatic bundles
+	Collectors CollectorSelection
+	// Since limits logs to the given time before the unit was found unhealthy, 0 collects all logs
+	Since time.Duration
+	// MaxConcurrent limits how many automatic bundles could be created at the same time in the cluster
+	MaxConcurrent int
+}
+
+// Trigger creates a local bundle on the node where a unit turned from healthy to unhealthy.
+// Bundles are created with the v2 bundle API of the node. Nil trigger creates no bundles.
+// Every master observes the cluster health so only the Mesos leader creates bundles.
+type Trigger struct {
+	client       Client
+	urlBuilder   dcos.NodeURLBuilder
+	leader       Leader // nil leader creates bundles on every master
+	policy       TriggerPolicy
+	timeout      time.Duration // how long automatic bundle is considered running
+	pollInterval time.Duration
+	clock        Clock
+
+	mu        sync.Mutex
+	health    map[string]map[string]dcos.Health // the last health of every unit on every node
+	triggered map[string]time.Time              // when the last automatic bundle was created on the node
+	running   int
+}
+
+func NewTrigger(client Client, urlBuilder dcos.NodeURLBuilder, leader Leader, policy TriggerPolicy,
+	timeout time.Duration) (*Trigger, error) {
+	for _, pattern := range policy.Units {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid unit pattern %q: %s", pattern, err)
+		}
+	}
+	if err := policy.Collectors.validate(); err != nil {
+		return nil, err
+	}
+	if policy.MaxConcurrent <= 0 {
+		return nil, fmt.Errorf("max concurrent automatic bundles must be positive, got %d", policy.MaxConcurrent)
+	}
+
+	return &Trigger{
+		client:       client,
+		urlBuilder:   urlBuilder,
+		leader:       leader,
+		policy:       policy,
+		timeout:      timeout,
+		pollInterval: triggerPollInterval,
+		clock:        realClock{},
+		health:       make(map[string]map[string]dcos.Health),
+		triggered:    make(map[string]time.Time),
+	}, nil
+}
+
+// Observe updates units health with the result of the cluster health pull and starts bundles on nodes where
+// matching units turned unhealthy. Units seen for the first time do not trigger bundles so the daemon restart
+// does not create bundles for units that are unhealthy for a long time. Masters that do not lead only
+// update units health so they are ready to create bundles when they become the leader.
+func (t *Trigger) Observe(nodes map[string]dcos.Node) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	leader := isLeader(t.leader)
+
+	// nodes are sorted so the same nodes get bundles when there are too many of them
+	ips := make([]string, 0, len(nodes))
+	for ip := range nodes {
+		ips = append(ips, ip)
+	}
+	sort.Strings(ips)
+
+	now := t.clock.Now()
+	for _, ip := range ips {
+		n := nodes[ip]
+		units := t.turnedUnhealthy(n)
+		if len(units) == 0 || !leader {
+			continue
+		}
+		log := logrus.WithField("node", n.IP).WithField("units", units)
+
+		if last, ok := t.triggered[n.IP]; ok && now.Sub(last) < t.policy.Cooldown {
+			log.Info("Units turned unhealthy but automatic bundle was created recently")
+			triggerBundles.WithLabelValues(triggerCooldown).Inc()
+			continue
+		}
+		if t.running >= t.policy.MaxConcurrent {
+			log.Warn("Units turned unhealthy but too many automatic bundles are being created")
+			triggerBundles.WithLabelValues(triggerLimit).Inc()
+			continue
+		}
+
+		t.triggered[n.IP] = now
+		t.running++
+		go t.capture(n, units, now)
+	}
+}
+
+// turnedUnhealthy returns sorted names of matching units that were healthy and are unhealthy on the node
+func (t *Trigger) turnedUnhealthy(n dcos.Node) []string {
+	health, ok := t.health[n.IP]
+	if !ok {
+		health = make(map[string]dcos.Health)
+		t.health[n.IP] = health
+	}
+
+	var units []string
+	for _, u := range n.Units {
+		previous, seen := health[u.UnitName]
+		health[u.UnitName] = u.Health
+		if seen && previous == unitHealthy && u.Health == unitUnhealthy && t.matches(u.UnitName) {
+			units = append(units, u.UnitName)
+		}
+	}
+	sort.Strings(units)
+	return units
+}
+
+func (t *Trigger) matches(unit string) bool {
+	for _, pattern := range t.policy.Units {
+		if matched, _ := path.Match(pattern, unit); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// capture creates the bundle on the node and waits until it's finished so it's counted as running
+func (t *Trigger) capture(n dcos.Node, units []string, at time.Time) {
+	defer func() {
+		t.mu.Lock()
+		t.running--
+		t.mu.Unlock()
+	}()
+
+	id := "unhealthy-" + strings.TrimSuffix(units[0], ".service") + "-" + at.UTC().Format(scheduledBundleTimeFormat)
+	log := logrus.WithField("node", n.IP).WithField("ID", id).WithField("units", units)
+
+	baseURL, err := t.urlBuilder.BaseURL(net.ParseIP(n.IP), n.Role)
+	if err != nil {
+		log.WithError(err).Error("Could not build node URL for automatic bundle")
+		triggerBundles.WithLabelValues(triggerFailed).Inc()
+		return
+	}
+
+	options := BundleOptions{Collectors: t.policy.Collectors}
+	if t.policy.Since > 0 {
+		options.Window = collector.TimeWindow{Since: at.Add(-t.policy.Since)}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), t.timeout)
+	defer cancel()
+
+	if _, err := t.client.CreateBundle(ctx, baseURL, id, options); err != nil {
+		log.WithError(err).Error("Could not create automatic bundle")
+		triggerBundles.WithLabelValues(triggerFailed).Inc()
+		return
+	}
+	log.Info("Units turned unhealthy, automatic bundle created")
+	triggerBundles.WithLabelValues(triggerCreated).Inc()
+
+	ticker := time.NewTicker(t.pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Warn("Automatic bundle is not finished in time")
+			return
+		case <-ticker.C:
+		}
+		bundle, err := t.client.Status(ctx, baseURL, id)
+		if err != nil {
+			log.WithError(err).Debug("Could not check automatic bundle status")
+			continue
+		}
+		if bundle.IsFinished() {
+			return
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package rest
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dcos/dcos-diagnostics/collector"
+	"github.com/dcos/dcos-diagnostics/dcos"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createdBundle is a bundle creation request sent by the trigger
+type createdBundle struct {
+	node    string
+	id      string
+	options BundleOptions
+}
+
+// triggerClient records created bundles, their status is InProgress until finish is closed
+type triggerClient struct {
+	MockClient
+	mu      sync.Mutex
+	created []createdBundle
+	finish  chan struct{}
+}
+
+func newTriggerClient() *triggerClient {
+	c := &triggerClient{finish: make(chan struct{})}
+	c.createBundle = func(ctx context.Context, node string, ID string, options BundleOptions) (*Bundle, error) {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.created = append(c.created, createdBundle{node: node, id: ID, options: options})
+		return &Bundle{ID: ID, Status: Started}, nil
+	}
+	c.status = func(ctx context.Context, node string, ID string) (*Bundle, error) {
+		select {
+		case <-c.finish:
+			return &Bundle{ID: ID, Status: Done}, nil
+		default:
+			return &Bundle{ID: ID, Status: InProgress}, nil
+		}
+	}
+	return c
+}
+
+func (c *triggerClient) bundles() []createdBundle {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]createdBundle(nil), c.created...)
+}
+
+func waitForRunning(t *testing.T, trigger *Trigger, running int) {
+	for i := 0; i < 1000; i++ {
+		trigger.mu.Lock()
+		r := trigger.running
+		trigger.mu.Unlock()
+		if r == running {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	require.FailNow(t, "unexpected number of running automatic bundles")
+}
+
+func nodeWithUnits(ip string, health map[string]dcos.Health) dcos.Node {
+	n := dcos.Node{IP: ip, Role: dcos.AgentRole}
+	for name, h := range health {
+		n.Units = append(n.Units, dcos.Unit{UnitName: name, Health: h})
+	}
+	return n
+}
+
+func TestIfTriggerCreatesBundleWhenUnitTurnsUnhealthy(t *testing.T) {
+	client := newTriggerClient()
+	close(client.finish)
+	trigger, err := NewTrigger(client, MockURLBuilder{}, nil, TriggerPolicy{
+		Units:         []string{"dcos-mesos-*"},
+		Collectors:    CollectorSelection{Include: []string{"systemd"}},
+		Since:         time.Hour,
+		MaxConcurrent: 1,
+	}, time.Second)
+	require.NoError(t, err)
+	trigger.pollInterval = time.Millisecond
+	trigger.clock = &MockClock{now: time.Date(2020, 5, 15, 0, 0, 0, 0, time.UTC)}
+
+	// units that are unhealthy when they are seen for the first time do not trigger bundles
+	trigger.Observe(map[string]dcos.Node{
+		"192.0.2.1": nodeWithUnits("192.0.2.1", map[string]dcos.Health{"dcos-mesos-slave.service": unitUnhealthy}),
+		"192.0.2.2": nodeWithUnits("192.0.2.2", map[string]dcos.Health{
+			"dcos-mesos-slave.service": unitHealthy, "dcos-net.service": unitHealthy}),
+	})
+	// not matching units do not trigger bundles
+	trigger.Observe(map[string]dcos.Node{
+		"192.0.2.1": nodeWithUnits("192.0.2.1", map[string]dcos.Health{"dcos-mesos-slave.service": unitUnhealthy}),
+		"192.0.2.2": nodeWithUnits("192.0.2.2", map[string]dcos.Health{
+			"dcos-mesos-slave.service": unitHealthy, "dcos-net.service": unitUnhealthy}),
+	})
+	assert.Empty(t, client.bundles())
+
+	trigger.Observe(map[string]dcos.Node{
+		"192.0.2.1": nodeWithUnits("192.0.2.1", map[string]dcos.Health{"dcos-mesos-slave.service": unitUnhealthy}),
+		"192.0.2.2": nodeWithUnits("192.0.2.2", map[string]dcos.Health{
+			"dcos-mesos-slave.service": unitUnhealthy, "dcos-net.service": unitUnhealthy}),
+	})
+	waitForRunning(t, trigger, 0)
+
+	assert.Equal(t, []createdBundle{{
+		node: "http://192.0.2.2",
+		id:   "unhealthy-dcos-mesos-slave-20200515T030000Z",
+		options: BundleOptions{
+			Collectors: CollectorSelection{Include: []string{"systemd"}},
+			Window:     collector.TimeWindow{Since: time.Date(2020, 5, 15, 2, 0, 0, 0, time.UTC)},
+		},
+	}}, client.bundles())
+}
+
+func TestIfTriggerRespectsCooldown(t *testing.T) {
+	client := newTriggerClient()
+	close(client.finish)
+	trigger, err := NewTrigger(client, MockURLBuilder{}, nil, TriggerPolicy{
+		Units:         []string{"*"},
+		Cooldown:      150 * time.Minute,
+		MaxConcurrent: 1,
+	}, time.Second)
+	require.NoError(t, err)
+	trigger.pollInterval = time.Millisecond
+	// every observation is one hour after the previous one
+	trigger.clock = &MockClock{now: time.Date(2020, 5, 15, 0, 0, 0, 0, time.UTC)}
+
+	flap := func(health dcos.Health) {
+		trigger.Observe(map[string]dcos.Node{
+			"192.0.2.1": nodeWithUnits("192.0.2.1", map[string]dcos.Health{"dcos-net.service": health}),
+		})
+		waitForRunning(t, trigger, 0)
+	}
+
+	flap(unitHealthy)
+	flap(unitUnhealthy)
+	flap(unitHealthy)
+	flap(unitUnhealthy)
+	flap(unitHealthy)
+	flap(unitUnhealthy)
+
+	var ids []string
+	for _, b := range client.bundles() {
+		ids = append(ids, b.id)
+		assert.True(t, b.options.Window.IsZero())
+	}
+	assert.Equal(t, []string{"unhealthy-dcos-net-20200515T020000Z", "unhealthy-dcos-net-20200515T060000Z"}, ids)
+}
+
+func TestIfTriggerLimitsConcurrentBundles(t *testing.T) {
+	client := newTriggerClient()
+	trigger, err := NewTrigger(client, MockURLBuilder{}, nil, TriggerPolicy{
+		Units:         []string{"*"},
+		MaxConcurrent: 1,
+	}, time.Second)
+	require.NoError(t, err)
+	trigger.pollInterval = time.Millisecond
+
+	observe := func(health dcos.Health) {
+		trigger.Observe(map[string]dcos.Node{
+			"192.0.2.1": nodeWithUnits("192.0.2.1", map[string]dcos.Health{"dcos-net.service": health}),
+			"192.0.2.2": nodeWithUnits("192.0.2.2", map[string]dcos.Health{"dcos-net.service": health}),
+		})
+	}
+
+	observe(unitHealthy)
+	observe(unitUnhealthy)
+	waitForRunning(t, trigger, 1)
+
+	close(client.finish)
+	waitForRunning(t, trigger, 0)
+	require.Len(t, client.bundles(), 1)
+	assert.Equal(t, "http://192.0.2.1", client.bundles()[0].node)
+
+	trigger.Observe(map[string]dcos.Node{
+		"192.0.2.2": nodeWithUnits("192.0.2.2", map[string]dcos.Health{"dcos-net.service": unitHealthy}),
+	})
+	trigger.Observe(map[string]dcos.Node{
+		"192.0.2.2": nodeWithUnits("192.0.2.2", map[string]dcos.Health{"dcos-net.service": unitUnhealthy}),
+	})
+	waitForRunning(t, trigger, 0)
+	require.Len(t, client.bundles(), 2)
+	assert.Equal(t, "http://192.0.2.2", client.bundles()[1].node)
+}
+
+// mockLeader is the Mesos leader when it's true
+type mockLeader bool
+
+func (l *mockLeader) IsLeader() (bool, error) {
+	return bool(*l), nil
+}
+
+func TestIfTriggerCreatesBundlesOnlyOnLeader(t *testing.T) {
+	client := newTriggerClient()
+	close(client.finish)
+	leader := mockLeader(false)
+	trigger, err := NewTrigger(client, MockURLBuilder{}, &leader, TriggerPolicy{
+		Units:         []string{"*"},
+		MaxConcurrent: 1,
+	}, time.Second)
+	require.NoError(t, err)
+	trigger.pollInterval = time.Millisecond
+	trigger.clock = &MockClock{now: time.Date(2020, 5, 15, 0, 0, 0, 0, time.UTC)}
+
+	health := func(h dcos.Health) map[string]dcos.Node {
+		return map[string]dcos.Node{
+			"192.0.2.1": nodeWithUnits("192.0.2.1", map[string]dcos.Health{"dcos-net.service": h}),
+		}
+	}
+
+	trigger.Observe(health(unitHealthy))
+	trigger.Observe(health(unitUnhealthy))
+	waitForRunning(t, trigger, 0)
+	assert.Empty(t, client.bundles(), "masters that do not lead should not create bundles")
+
+	// health is tracked by every master so the new leader creates bundles right away
+	leader = true
+	trigger.Observe(health(unitHealthy))
+	trigger.Observe(health(unitUnhealthy))
+	waitForRunning(t, trigger, 0)
+	require.Len(t, client.bundles(), 1)
+	assert.Equal(t, "http://192.0.2.1", client.bundles()[0].node)
+}
+
+func TestObserveOnNilTrigger(t *testing.T) {
+	var trigger *Trigger
+	trigger.Observe(map[string]dcos.Node{"192.0.2.1": {}})
+}
+
+func TestNewTriggerValidatesPolicy(t *testing.T) {
+	for _, tc := range []struct {
+		policy TriggerPolicy
+		err    string
+	}{
+		{policy: TriggerPolicy{Units: []string{"["}, MaxConcurrent: 1}, err: `invalid unit pattern "[": syntax error in pattern`},
+		{policy: TriggerPolicy{Collectors: CollectorSelection{Exclude: []string{"["}}, MaxConcurrent: 1},
+			err: `invalid collector pattern "[": syntax error in pattern`},
+		{policy: TriggerPolicy{Units: []string{"*"}}, err: "max concurrent automatic bundles must be positive, got 0"},
+	} {
+		_, err := NewTrigger(nil, MockURLBuilder{}, nil, tc.policy, time.Second)
+		assert.EqualError(t, err, tc.err)
+	}
+}
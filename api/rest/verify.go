@@ -0,0 +1,202 @@
+package rest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dcos/dcos-diagnostics/archive"
+)
+
+// BundleProblem describes a single issue found in the bundle
+type BundleProblem struct {
+	Path   string // bundle entry the problem is related to
+	Reason string
+}
+
+func (p BundleProblem) String() string {
+	return fmt.Sprintf("%s: %s", p.Path, p.Reason)
+}
+
+// bundleEntry summarizes a single bundle entry read during verification
+type bundleEntry struct {
+	size    int64
+	sha256  string // hex encoded SHA-256, empty when entry is broken
+	content []byte // content of manifest and report, nil for other entries
+}
+
+// VerifyBundle checks integrity of the local or cluster bundle stored in the given path in any format.
+// It validates every entry checksum and length, looks for illegal paths and compares bundle content
+// with its manifest and report. Problems found in the bundle are returned. Error is returned only
+// when bundle could not be read at all.
+func VerifyBundle(path string) ([]BundleProblem, error) {
+	var problems []BundleProblem
+	entries := map[string]bundleEntry{}
+	read := 0
+
+	err := archive.Walk(path, func(h archive.Header, r io.Reader) error {
+		read++
+		if _, err := sanitizeExtractPath(h.Name, "bundle"); err != nil {
+			problems = append(problems, BundleProblem{Path: h.Name, Reason: "illegal file path"})
+			return nil
+		}
+		entry, problem := verifyEntry(h, r)
+		entries[h.Name] = entry
+		if problem != "" {
+			problems = append(problems, BundleProblem{Path: h.Name, Reason: problem})
+		}
+		return nil
+	})
+	if err != nil {
+		if read == 0 {
+			return nil, err
+		}
+		// tar based bundles could not be read past a broken entry so the rest of the bundle is reported as broken
+		problems = append(problems, BundleProblem{Path: filepath.Base(path), Reason: err.Error()})
+	}
+
+	problems = append(problems, verifyManifest(entries)...)
+	problems = append(problems, verifyReport(entries)...)
+
+	return problems, nil
+}
+
+// verifyEntry reads whole entry so archive reader could validate it and returns its summary
+func verifyEntry(h archive.Header, r io.Reader) (bundleEntry, string) {
+	hash := sha256.New()
+	w := io.Writer(hash)
+	content := &bytes.Buffer{}
+	if h.Name == manifestFileName || h.Name == reportFileName {
+		w = io.MultiWriter(hash, content)
+	}
+
+	n, err := io.Copy(w, r)
+	entry := bundleEntry{size: n}
+	if err != nil {
+		return entry, fmt.Sprintf("corrupted: %s", err)
+	}
+	if n != h.Size {
+		return entry, fmt.Sprintf("truncated: expected %d bytes got %d", h.Size, n)
+	}
+	entry.sha256 = hex.EncodeToString(hash.Sum(nil))
+	entry.content = content.Bytes()
+	return entry, ""
+}
+
+// verifyManifest compares bundle entries with their manifest description
+func verifyManifest(entries map[string]bundleEntry) []BundleProblem {
+	f, ok := entries[manifestFileName]
+	if !ok {
+		return []BundleProblem{{Path: manifestFileName, Reason: "missing"}}
+	}
+	if f.sha256 == "" {
+		return nil // manifest is already reported as broken
+	}
+
+	m := manifest{}
+	if err := json.Unmarshal(f.content, &m); err != nil {
+		return []BundleProblem{{Path: manifestFileName, Reason: fmt.Sprintf("could not read: %s", err)}}
+	}
+
+	var problems []BundleProblem
+	described := map[string]bool{manifestFileName: true, reportFileName: true, summaryErrorsReportFileName: true}
+	for _, e := range m.Entries {
+		if e.Path == "" {
+			continue
+		}
+		described[e.Path] = true
+
+		f, ok := entries[e.Path]
+		if !ok {
+			problems = append(problems, BundleProblem{Path: e.Path, Reason: "missing"})
+			continue
+		}
+		if f.sha256 == "" {
+			continue // entry is already reported as broken
+		}
+		if f.size != e.Size {
+			problems = append(problems, BundleProblem{
+				Path:   e.Path,
+				Reason: fmt.Sprintf("truncated: manifest size is %d bytes but entry has %d", e.Size, f.size),
+			})
+			continue
+		}
+		if e.SHA256 != "" && e.SHA256 != f.sha256 {
+			problems = append(problems, BundleProblem{Path: e.Path, Reason: "tampered: checksum does not match manifest"})
+		}
+	}
+
+	for _, name := range sortedNames(entries) {
+		if !described[name] && !strings.HasSuffix(name, "/") {
+			problems = append(problems, BundleProblem{Path: name, Reason: "not described in manifest"})
+		}
+	}
+
+	return problems
+}
+
+// verifyReport checks if every node that finished its bundle has its directory in the cluster bundle.
+// Local bundles have no report so nothing is checked for them.
+func verifyReport(entries map[string]bundleEntry) []BundleProblem {
+	f, ok := entries[reportFileName]
+	if !ok || f.sha256 == "" {
+		return nil
+	}
+
+	report := bundleReport{}
+	if err := json.Unmarshal(f.content, &report); err != nil {
+		return []BundleProblem{{Path: reportFileName, Reason: fmt.Sprintf("could not read: %s", err)}}
+	}
+
+	// node directories are named IP_role
+	nodeDirs := map[string]bool{}
+	for name := range entries {
+		if i := strings.IndexAny(name, `/\`); i > 0 {
+			nodeDirs[name[:i]] = true
+		}
+	}
+
+	var problems []BundleProblem
+	nodes := make(map[string]bool, len(report.Nodes))
+	for ip, n := range report.Nodes {
+		nodes[ip] = true
+		if n.Status != Done {
+			continue
+		}
+		found := false
+		for dir := range nodeDirs {
+			if strings.HasPrefix(dir, ip+"_") {
+				found = true
+				break
+			}
+		}
+		if !found {
+			problems = append(problems, BundleProblem{Path: ip, Reason: "node reported as done but its directory is missing"})
+		}
+	}
+
+	for dir := range nodeDirs {
+		ip := strings.SplitN(dir, "_", 2)[0]
+		if !nodes[ip] {
+			problems = append(problems, BundleProblem{Path: dir, Reason: "node directory is not listed in report"})
+		}
+	}
+
+	sort.Slice(problems, func(i, j int) bool { return problems[i].Path < problems[j].Path })
+	return problems
+}
+
+func sortedNames(entries map[string]bundleEntry) []string {
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,177 @@
+package rest
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/dcos/dcos-diagnostics/archive"
+	"github.com/dcos/dcos-diagnostics/collector"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyLocalBundle(t *testing.T) {
+	workdir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workdir)
+
+	dataFile, err := os.Create(filepath.Join(workdir, dataFileName))
+	require.NoError(t, err)
+
+	collectors := []collector.Collector{
+		MockCollector{name: "collector-1", rc: ioutil.NopCloser(bytes.NewReader([]byte("OK")))},
+		MockCollector{name: "collector-2", rc: ioutil.NopCloser(bytes.NewReader([]byte("OK")))},
+	}
+	done := make(chan []string)
+	go collectAll(context.Background(), done, dataFile, workdir, collectors, node{}, BundleOptions{}, nil, SizeLimits{}, time.Second, 1, newBundleProgress(collectors, nil))
+	require.Empty(t, <-done)
+
+	problems, err := VerifyBundle(dataFile.Name())
+	require.NoError(t, err)
+	assert.Empty(t, problems)
+}
+
+func TestVerifyBundleFindsProblems(t *testing.T) {
+	workdir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workdir)
+
+	path := filepath.Join(workdir, "bundle.zip")
+	writeTestZip(t, path, map[string]string{
+		"192.0.2.1_agent/ok":       "OK",
+		"192.0.2.1_agent/tampered": "KO",
+		"192.0.2.1_agent/short":    "O",
+		"192.0.2.1_agent/unknown":  "OK",
+		"192.0.2.9_master/ok":      "OK",
+		"../evil":                  "evil",
+		reportFileName: string(jsonMarshal(bundleReport{ID: "bundle-0", Nodes: map[string]nodeBundleReport{
+			"192.0.2.1": {Status: Done},
+			"192.0.2.2": {Status: Done},
+			"192.0.2.3": {Status: Failed},
+		}})),
+		manifestFileName: string(jsonMarshal(manifest{Entries: []manifestEntry{
+			{Path: "192.0.2.1_agent/ok", Size: 2, SHA256: "565339bc4d33d72817b583024112eb7f5cdf3e5eef0252d6ec1b9c9a94e12bb3"},
+			{Path: "192.0.2.1_agent/tampered", Size: 2, SHA256: "565339bc4d33d72817b583024112eb7f5cdf3e5eef0252d6ec1b9c9a94e12bb3"},
+			{Path: "192.0.2.1_agent/short", Size: 2},
+			{Path: "192.0.2.1_agent/missing", Size: 2},
+			{Path: "192.0.2.9_master/ok", Size: 2},
+			{Collector: "failed", Failed: true},
+		}})),
+	})
+
+	problems, err := VerifyBundle(path)
+	require.NoError(t, err)
+	assert.Equal(t, []BundleProblem{
+		{Path: "../evil", Reason: "illegal file path"},
+		{Path: "192.0.2.1_agent/tampered", Reason: "tampered: checksum does not match manifest"},
+		{Path: "192.0.2.1_agent/short", Reason: "truncated: manifest size is 2 bytes but entry has 1"},
+		{Path: "192.0.2.1_agent/missing", Reason: "missing"},
+		{Path: "192.0.2.1_agent/unknown", Reason: "not described in manifest"},
+		{Path: "192.0.2.2", Reason: "node reported as done but its directory is missing"},
+		{Path: "192.0.2.9_master", Reason: "node directory is not listed in report"},
+	}, problems)
+}
+
+func TestVerifyBundleDetectsCorruptedEntry(t *testing.T) {
+	workdir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workdir)
+
+	path := filepath.Join(workdir, "bundle.zip")
+	writeTestZip(t, path, map[string]string{"file": "some content"})
+
+	raw, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	i := bytes.Index(raw, []byte("some content"))
+	require.True(t, i > 0)
+	raw[i] = 'S'
+	require.NoError(t, ioutil.WriteFile(path, raw, filePerm))
+
+	problems, err := VerifyBundle(path)
+	require.NoError(t, err)
+	assert.Equal(t, []BundleProblem{
+		{Path: "file", Reason: "corrupted: zip: checksum error"},
+		{Path: manifestFileName, Reason: "missing"},
+	}, problems)
+}
+
+func TestVerifyBundleFailsOnTruncatedZip(t *testing.T) {
+	workdir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workdir)
+
+	path := filepath.Join(workdir, "bundle.zip")
+	writeTestZip(t, path, map[string]string{"file": "some content"})
+
+	raw, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(path, raw[:len(raw)/2], filePerm))
+
+	problems, err := VerifyBundle(path)
+	assert.Nil(t, problems)
+	assert.Contains(t, err.Error(), "zip: not a valid zip file")
+}
+
+func TestVerifyBundleReportsCorruptedTar(t *testing.T) {
+	workdir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workdir)
+
+	path := filepath.Join(workdir, "bundle.tar.gz")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	w, err := archive.NewWriter(archive.TarGz, f)
+	require.NoError(t, err)
+	// random content is not compressed so the header is in the first half of the archive
+	content := make([]byte, 64*1024)
+	rand.New(rand.NewSource(1)).Read(content)
+	require.NoError(t, archive.WriteFile(w, "file", content, time.Time{}))
+	require.NoError(t, w.Close())
+	require.NoError(t, f.Close())
+
+	raw, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(path, raw[:len(raw)/2], filePerm))
+
+	problems, err := VerifyBundle(path)
+	require.NoError(t, err)
+	assert.Equal(t, []BundleProblem{
+		{Path: "file", Reason: "corrupted: unexpected EOF"},
+		{Path: "bundle.tar.gz", Reason: "could not read " + path + ": unexpected EOF"},
+		{Path: manifestFileName, Reason: "missing"},
+	}, problems)
+}
+
+// writeTestZip creates not compressed zip in given path with given files
+func writeTestZip(t *testing.T, path string, files map[string]string) {
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	w := zip.NewWriter(f)
+	for _, name := range sortedKeys(files) {
+		file, err := w.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+		require.NoError(t, err)
+		_, err = file.Write([]byte(files[name]))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
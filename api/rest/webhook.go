@@ -0,0 +1,346 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+)
+
+// webhookQueueSize limits how many events could wait for delivery to a single webhook
+const webhookQueueSize = 100
+
+// webhook request headers
+const (
+	webhookEventHeader     = "X-Diagnostics-Event"
+	webhookDeliveryHeader  = "X-Diagnostics-Delivery"
+	webhookTimestampHeader = "X-Diagnostics-Timestamp"
+	webhookSignatureHeader = "X-Diagnostics-Signature"
+)
+
+// webhookEvents are bundle statuses webhooks are notified about
+var webhookEvents = []Status{Started, Done, Failed, Canceled, Deleted}
+
+var webhookDeliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "bundle_webhook_deliveries_total",
+	Help: "Number of finished webhook deliveries",
+}, []string{"event", "delivered"})
+
+// Webhook describes an HTTP endpoint notified about bundle lifecycle events
+type Webhook struct {
+	URL string `json:"url"`
+	// Secret is used to sign payloads with HMAC-SHA256, empty disables signatures
+	Secret string `json:"secret,omitempty"`
+	// Events the webhook is notified about, empty means all events
+	Events []string `json:"events,omitempty"`
+}
+
+// LoadWebhooks reads webhooks from a JSON file containing an array of webhooks
+func LoadWebhooks(path string) ([]Webhook, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read webhooks: %s", err)
+	}
+	var webhooks []Webhook
+	if err := json.Unmarshal(content, &webhooks); err != nil {
+		return nil, fmt.Errorf("could not parse webhooks %s: %s", path, err)
+	}
+	return webhooks, nil
+}
+
+// WebhookDelivery describes a single notification sent to a webhook
+type WebhookDelivery struct {
+	ID         string    `json:"id"`
+	Event      Status    `json:"event"`
+	URL        string    `json:"url"`
+	Delivered  bool      `json:"delivered"`
+	Attempts   int       `json:"attempts"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Sent       time.Time `json:"sent_at"`
+}
+
+// webhookPayload is the body of the webhook request
+type webhookPayload struct {
+	Event   Status                      `json:"event"`
+	ID      string                      `json:"id"`
+	Type    Type                        `json:"type"`
+	Status  Status                      `json:"status"`
+	Size    int64                       `json:"size"`
+	Errors  []string                    `json:"errors,omitempty"`
+	Started time.Time                   `json:"started_at"`
+	Stopped time.Time                   `json:"stopped_at,omitempty"`
+	Nodes   map[string]nodeBundleReport `json:"nodes,omitempty"`
+}
+
+type webhookEvent struct {
+	bundleID string
+	event    Status
+	payload  []byte
+}
+
+type webhookTarget struct {
+	Webhook
+	events map[Status]bool
+	queue  chan webhookEvent
+}
+
+// Notifier sends bundle lifecycle events to webhooks. Every webhook gets events in the order they happened.
+// Deliveries are logged in the bundle work dir. Nil notifier sends nothing.
+type Notifier struct {
+	workDir    string
+	targets    []webhookTarget
+	retries    int // how many times failed delivery is retried
+	retryDelay time.Duration
+	client     *http.Client
+	clock      Clock
+
+	mu sync.Mutex // guards delivery log files
+}
+
+func NewNotifier(workDir string, webhooks []Webhook, retries int, client *http.Client) (*Notifier, error) {
+	if retries < 0 {
+		return nil, fmt.Errorf("webhook retries must not be negative, got %d", retries)
+	}
+
+	targets := make([]webhookTarget, 0, len(webhooks))
+	for _, w := range webhooks {
+		u, err := url.Parse(w.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid webhook URL %q, must be http or https URL", w.URL)
+		}
+		events := make(map[Status]bool)
+		for _, e := range w.Events {
+			s, ok := toID[e]
+			if !ok || !isWebhookEvent(s) {
+				return nil, fmt.Errorf("unknown event %q of webhook %s, must be one of %v", e, w.URL, webhookEvents)
+			}
+			events[s] = true
+		}
+		if len(events) == 0 {
+			for _, s := range webhookEvents {
+				events[s] = true
+			}
+		}
+		targets = append(targets, webhookTarget{Webhook: w, events: events, queue: make(chan webhookEvent, webhookQueueSize)})
+	}
+
+	err := initializeWorkDir(workDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Notifier{
+		workDir:    workDir,
+		targets:    targets,
+		retries:    retries,
+		retryDelay: time.Second,
+		client:     client,
+		clock:      realClock{},
+	}, nil
+}
+
+func isWebhookEvent(s Status) bool {
+	for _, e := range webhookEvents {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Run delivers events to webhooks until ctx is done
+func (n *Notifier) Run(ctx context.Context) {
+	wg := sync.WaitGroup{}
+	for _, t := range n.targets {
+		wg.Add(1)
+		go func(t webhookTarget) {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case e := <-t.queue:
+					n.deliver(ctx, t.Webhook, e)
+				}
+			}
+		}(t)
+	}
+	wg.Wait()
+}
+
+// notify queues event of the bundle current status for every interested webhook
+func (n *Notifier) notify(bundle Bundle) {
+	if n == nil || !isWebhookEvent(bundle.Status) {
+		return
+	}
+
+	payload := webhookPayload{
+		Event:   bundle.Status,
+		ID:      bundle.ID,
+		Type:    bundle.Type,
+		Status:  bundle.Status,
+		Size:    bundle.Size,
+		Errors:  bundle.Errors,
+		Started: bundle.Started,
+		Stopped: bundle.Stopped,
+		Nodes:   bundle.Nodes,
+	}
+	if bundle.Status == Done && payload.Size == 0 {
+		if s, err := os.Stat(filepath.Join(n.workDir, bundle.ID, dataFileName)); err == nil {
+			payload.Size = s.Size()
+		}
+	}
+	e := webhookEvent{bundleID: bundle.ID, event: bundle.Status, payload: jsonMarshal(payload)}
+
+	for _, t := range n.targets {
+		if !t.events[bundle.Status] {
+			continue
+		}
+		select {
+		case t.queue <- e:
+		default:
+			n.log(e.bundleID, WebhookDelivery{
+				ID:    uuid.New().String(),
+				Event: e.event,
+				URL:   t.URL,
+				Error: "too many events waiting for delivery, event dropped",
+				Sent:  n.clock.Now(),
+			})
+		}
+	}
+}
+
+// deliver sends the event to the webhook, failed requests are retried
+func (n *Notifier) deliver(ctx context.Context, w Webhook, e webhookEvent) {
+	d := WebhookDelivery{
+		ID:    uuid.New().String(),
+		Event: e.event,
+		URL:   w.URL,
+		Sent:  n.clock.Now(),
+	}
+
+	for d.Attempts <= n.retries {
+		if d.Attempts > 0 {
+			select {
+			case <-ctx.Done():
+				d.Error = ctx.Err().Error()
+				n.log(e.bundleID, d)
+				return
+			case <-time.After(n.retryDelay << uint(d.Attempts-1)):
+			}
+		}
+		d.Attempts++
+
+		var err error
+		d.StatusCode, err = n.send(ctx, w, d.ID, e)
+		if err == nil {
+			d.Delivered = true
+			d.Error = ""
+			break
+		}
+		d.Error = err.Error()
+		if d.StatusCode != 0 && d.StatusCode < http.StatusInternalServerError && d.StatusCode != http.StatusTooManyRequests {
+			break
+		}
+	}
+
+	if !d.Delivered {
+		logrus.WithField("ID", e.bundleID).WithField("url", w.URL).WithField("event", e.event).
+			Warnf("Could not deliver webhook: %s", d.Error)
+	}
+	n.log(e.bundleID, d)
+}
+
+func (n *Notifier) send(ctx context.Context, w Webhook, deliveryID string, e webhookEvent) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(e.payload))
+	if err != nil {
+		return 0, err
+	}
+	req = req.WithContext(ctx)
+
+	timestamp := strconv.FormatInt(n.clock.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookEventHeader, e.event.String())
+	req.Header.Set(webhookDeliveryHeader, deliveryID)
+	req.Header.Set(webhookTimestampHeader, timestamp)
+	if w.Secret != "" {
+		req.Header.Set(webhookSignatureHeader, "sha256="+signWebhookPayload(w.Secret, timestamp, e.payload))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode/100 != 2 {
+		return resp.StatusCode, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// signWebhookPayload returns hex encoded HMAC-SHA256 of the timestamp and the payload joined with a dot.
+// Timestamp is signed so receivers could reject replayed requests.
+func signWebhookPayload(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// log appends the delivery to the bundle delivery log
+func (n *Notifier) log(bundleID string, d WebhookDelivery) {
+	webhookDeliveries.WithLabelValues(d.Event.String(), strconv.FormatBool(d.Delivered)).Inc()
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	// deliveries of removed bundles are not logged, there is nowhere to keep them
+	if _, err := os.Stat(filepath.Join(n.workDir, bundleID)); os.IsNotExist(err) {
+		return
+	}
+
+	deliveries, err := loadWebhookDeliveries(n.workDir, bundleID)
+	if err != nil {
+		logrus.WithError(err).WithField("ID", bundleID).Warn("Could not read webhook delivery log")
+	}
+	deliveries = append(deliveries, d)
+
+	path := filepath.Join(n.workDir, bundleID, webhooksFileName)
+	if err := ioutil.WriteFile(path, jsonMarshal(deliveries), filePerm); err != nil {
+		logrus.WithError(err).WithField("ID", bundleID).Warn("Could not update webhook delivery log")
+	}
+}
+
+// loadWebhookDeliveries reads delivery log of the bundle, missing log means there were no deliveries
+func loadWebhookDeliveries(workDir, id string) ([]WebhookDelivery, error) {
+	raw, err := ioutil.ReadFile(filepath.Join(workDir, id, webhooksFileName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var deliveries []WebhookDelivery
+	err = json.Unmarshal(raw, &deliveries)
+	return deliveries, err
+}
@@ -0,0 +1,266 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dcos/dcos-diagnostics/collector"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// webhookReceiver records webhook requests and responds with codes returned by respond
+type webhookReceiver struct {
+	mu       sync.Mutex
+	requests []*http.Request
+	bodies   [][]byte
+	respond  func(n int) int
+}
+
+func newWebhookReceiver() (*webhookReceiver, *httptest.Server) {
+	r := &webhookReceiver{respond: func(int) int { return http.StatusOK }}
+	return r, httptest.NewServer(r)
+}
+
+func (wr *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+	wr.requests = append(wr.requests, r)
+	wr.bodies = append(wr.bodies, body)
+	w.WriteHeader(wr.respond(len(wr.requests)))
+}
+
+func (wr *webhookReceiver) events() []string {
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+	var events []string
+	for _, r := range wr.requests {
+		events = append(events, r.Header.Get(webhookEventHeader))
+	}
+	return events
+}
+
+func waitForDeliveries(t *testing.T, workdir, id string, count int) []WebhookDelivery {
+	for i := 0; i < 1000; i++ {
+		deliveries, err := loadWebhookDeliveries(workdir, id)
+		if err == nil && len(deliveries) >= count {
+			return deliveries
+		}
+		time.Sleep(time.Millisecond)
+	}
+	require.FailNow(t, "webhooks were not delivered")
+	return nil
+}
+
+func TestIfWebhooksAreNotifiedAboutBundleLifecycle(t *testing.T) {
+	workdir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workdir)
+
+	receiver, server := newWebhookReceiver()
+	defer server.Close()
+
+	notifier, err := NewNotifier(workdir, []Webhook{{URL: server.URL, Secret: "s3cr3t"}}, 0, http.DefaultClient)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go notifier.Run(ctx)
+
+	collectors := []collector.Collector{
+		MockCollector{name: "collector-1", rc: ioutil.NopCloser(strings.NewReader("data"))},
+	}
+	bh, err := NewBundleHandler(workdir, collectors, time.Second, time.Second, 1, BundleHandlerOptions{Notifier: notifier})
+	require.NoError(t, err)
+
+	router := mux.NewRouter()
+	router.HandleFunc(bundleEndpoint, bh.Create).Methods(http.MethodPut)
+	router.HandleFunc(bundleEndpoint, bh.Get).Methods(http.MethodGet)
+	router.HandleFunc(bundleEndpoint, bh.Delete).Methods(http.MethodDelete)
+
+	req, err := http.NewRequest(http.MethodPut, bundlesEndpoint+"/bundle-0", nil)
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	waitForDeliveries(t, workdir, "bundle-0", 2)
+
+	req, err = http.NewRequest(http.MethodDelete, bundlesEndpoint+"/bundle-0", nil)
+	require.NoError(t, err)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	deliveries := waitForDeliveries(t, workdir, "bundle-0", 3)
+	assert.Equal(t, []string{"Started", "Done", "Deleted"}, receiver.events())
+
+	for i, d := range deliveries {
+		assert.True(t, d.Delivered)
+		assert.Equal(t, 1, d.Attempts)
+		assert.Equal(t, http.StatusOK, d.StatusCode)
+		assert.Equal(t, server.URL, d.URL)
+
+		r := receiver.requests[i]
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Equal(t, d.ID, r.Header.Get(webhookDeliveryHeader))
+		assert.Equal(t, d.Event.String(), r.Header.Get(webhookEventHeader))
+		signature := signWebhookPayload("s3cr3t", r.Header.Get(webhookTimestampHeader), receiver.bodies[i])
+		assert.Equal(t, "sha256="+signature, r.Header.Get(webhookSignatureHeader))
+	}
+
+	done := webhookPayload{}
+	require.NoError(t, json.Unmarshal(receiver.bodies[1], &done))
+	assert.Equal(t, Done, done.Event)
+	assert.Equal(t, "bundle-0", done.ID)
+	assert.Equal(t, Local, done.Type)
+	assert.NotZero(t, done.Size)
+
+	req, err = http.NewRequest(http.MethodGet, bundlesEndpoint+"/bundle-0", nil)
+	require.NoError(t, err)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	bundle := Bundle{}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &bundle))
+	assert.Equal(t, deliveries, bundle.Webhooks)
+}
+
+func TestIfWebhookIsNotifiedOnlyAboutSelectedEvents(t *testing.T) {
+	workdir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workdir)
+
+	receiver, server := newWebhookReceiver()
+	defer server.Close()
+
+	notifier, err := NewNotifier(workdir, []Webhook{{URL: server.URL, Events: []string{"Failed", "Canceled"}}}, 0, http.DefaultClient)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go notifier.Run(ctx)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(workdir, "bundle-0"), dirPerm))
+	notifier.notify(Bundle{ID: "bundle-0", Status: Started})
+	notifier.notify(Bundle{ID: "bundle-0", Status: InProgress})
+	notifier.notify(Bundle{ID: "bundle-0", Status: Failed, Errors: []string{"some error"}})
+
+	deliveries := waitForDeliveries(t, workdir, "bundle-0", 1)
+	assert.Len(t, deliveries, 1)
+	assert.Equal(t, []string{"Failed"}, receiver.events())
+	assert.Empty(t, receiver.requests[0].Header.Get(webhookSignatureHeader))
+	assert.Contains(t, string(receiver.bodies[0]), `"errors":["some error"]`)
+}
+
+func TestIfFailedWebhookDeliveryIsRetried(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		respond   func(n int) int
+		attempts  int
+		delivered bool
+		code      int
+		err       string
+	}{
+		{
+			name: "server errors are retried",
+			respond: func(n int) int {
+				if n < 3 {
+					return http.StatusServiceUnavailable
+				}
+				return http.StatusOK
+			},
+			attempts:  3,
+			delivered: true,
+			code:      http.StatusOK,
+		},
+		{
+			name:     "retries are limited",
+			respond:  func(int) int { return http.StatusTooManyRequests },
+			attempts: 4,
+			code:     http.StatusTooManyRequests,
+			err:      "unexpected status code 429",
+		},
+		{
+			name:     "client errors are not retried",
+			respond:  func(int) int { return http.StatusNotFound },
+			attempts: 1,
+			code:     http.StatusNotFound,
+			err:      "unexpected status code 404",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			workdir, err := ioutil.TempDir("", "work-dir")
+			require.NoError(t, err)
+			defer os.RemoveAll(workdir)
+
+			receiver, server := newWebhookReceiver()
+			defer server.Close()
+			receiver.respond = tc.respond
+
+			notifier, err := NewNotifier(workdir, []Webhook{{URL: server.URL}}, 3, http.DefaultClient)
+			require.NoError(t, err)
+			notifier.retryDelay = time.Millisecond
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go notifier.Run(ctx)
+
+			require.NoError(t, os.MkdirAll(filepath.Join(workdir, "bundle-0"), dirPerm))
+			notifier.notify(Bundle{ID: "bundle-0", Status: Canceled})
+
+			deliveries := waitForDeliveries(t, workdir, "bundle-0", 1)
+			require.Len(t, deliveries, 1)
+			assert.Equal(t, tc.attempts, deliveries[0].Attempts)
+			assert.Equal(t, tc.delivered, deliveries[0].Delivered)
+			assert.Equal(t, tc.code, deliveries[0].StatusCode)
+			assert.Equal(t, tc.err, deliveries[0].Error)
+			assert.Len(t, receiver.events(), tc.attempts)
+		})
+	}
+}
+
+func TestNewNotifierValidatesWebhooks(t *testing.T) {
+	workdir, err := ioutil.TempDir("", "work-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(workdir)
+
+	for _, tc := range []struct {
+		webhook Webhook
+		retries int
+		err     string
+	}{
+		{webhook: Webhook{URL: "example.com/hook"}, err: `invalid webhook URL "example.com/hook", must be http or https URL`},
+		{webhook: Webhook{URL: "ftp://example.com"}, err: `invalid webhook URL "ftp://example.com", must be http or https URL`},
+		{webhook: Webhook{URL: "https://example.com", Events: []string{"InProgress"}},
+			err: `unknown event "InProgress" of webhook https://example.com, must be one of [Started Done Failed Canceled Deleted]`},
+		{webhook: Webhook{URL: "https://example.com"}, retries: -1, err: "webhook retries must not be negative, got -1"},
+	} {
+		_, err := NewNotifier(workdir, []Webhook{tc.webhook}, tc.retries, http.DefaultClient)
+		assert.EqualError(t, err, tc.err)
+	}
+}
+
+func TestLoadWebhooks(t *testing.T) {
+	f, err := ioutil.TempFile("", "webhooks")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(`[{"url": "https://example.com/hook", "secret": "s3cr3t", "events": ["Done"]}]`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	webhooks, err := LoadWebhooks(f.Name())
+	require.NoError(t, err)
+	assert.Equal(t, []Webhook{{URL: "https://example.com/hook", Secret: "s3cr3t", Events: []string{"Done"}}}, webhooks)
+}
@@ -0,0 +1,249 @@
+package rest
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"time"
+	"unicode/utf8"
+)
+
+// zip format constants, see https://pkware.cachefly.net/webdocs/casestudies/APPNOTE.TXT
+const (
+	fileHeaderSignature      = 0x04034b50
+	directoryHeaderSignature = 0x02014b50
+	directoryEndSignature    = 0x06054b50
+	directory64LocSignature  = 0x07064b50
+	directory64EndSignature  = 0x06064b50
+
+	directory64EndLen = 56
+
+	zipVersion20 = 20 // 2.0
+	zipVersion45 = 45 // 4.5 (reads and writes zip64 archives)
+
+	zip64ExtraID   = 0x0001 // Zip64 extended information
+	extTimeExtraID = 0x5455 // Extended timestamp
+
+	flagDataDescriptor = 0x8
+	flagUTF8           = 0x800
+
+	uint16max = (1 << 16) - 1
+	uint32max = (1 << 32) - 1
+)
+
+// rawZipWriter writes zip archives from already compressed entries, so zip entries could be moved
+// between archives without decompressing and compressing them again. archive/zip supports it since Go 1.17.
+type rawZipWriter struct {
+	w      *bufio.Writer
+	offset uint64
+	dir    []rawZipEntry
+}
+
+type rawZipEntry struct {
+	header zip.FileHeader
+	offset uint64
+}
+
+func newRawZipWriter(w io.Writer) *rawZipWriter {
+	return &rawZipWriter{w: bufio.NewWriter(w)}
+}
+
+// copyRaw adds a new entry described by fh with compressed content read from r. CRC32 and sizes
+// in fh must describe the content. Entry is added only when whole content is copied.
+func (z *rawZipWriter) copyRaw(fh zip.FileHeader, r io.Reader) error {
+	fh.Flags &^= flagDataDescriptor
+	if !isASCII(fh.Name) && utf8.ValidString(fh.Name) {
+		fh.Flags |= flagUTF8
+	}
+	fh.CreatorVersion = fh.CreatorVersion&0xff00 | zipVersion20
+	fh.ReaderVersion = zipVersion20
+	fh.Extra = nil
+	if !fh.Modified.IsZero() {
+		fh.ModifiedDate, fh.ModifiedTime = timeToMsDosTime(fh.Modified)
+		fh.Extra = extendedTimestamp(fh.Modified)
+	}
+	zip64 := fh.CompressedSize64 >= uint32max || fh.UncompressedSize64 >= uint32max
+	if zip64 {
+		fh.ReaderVersion = zipVersion45
+	}
+
+	entry := rawZipEntry{header: fh, offset: z.offset}
+
+	extra := fh.Extra
+	b := &bytes.Buffer{}
+	writeUint32(b, fileHeaderSignature)
+	writeUint16(b, fh.ReaderVersion, fh.Flags, fh.Method, fh.ModifiedTime, fh.ModifiedDate)
+	writeUint32(b, fh.CRC32)
+	if zip64 {
+		writeUint32(b, uint32max, uint32max)
+		extra = append(append([]byte{}, extra...), zip64Extra(fh.UncompressedSize64, fh.CompressedSize64)...)
+	} else {
+		writeUint32(b, uint32(fh.CompressedSize64), uint32(fh.UncompressedSize64))
+	}
+	writeUint16(b, uint16(len(fh.Name)), uint16(len(extra)))
+	b.WriteString(fh.Name)
+	b.Write(extra)
+
+	if err := z.write(b.Bytes()); err != nil {
+		return err
+	}
+	n, err := io.CopyN(z.w, r, int64(fh.CompressedSize64))
+	z.offset += uint64(n)
+	if err != nil {
+		return fmt.Errorf("could not copy %s: %s", fh.Name, err)
+	}
+
+	z.dir = append(z.dir, entry)
+	return nil
+}
+
+// writeFile compresses given data and adds it as a new entry
+func (z *rawZipWriter) writeFile(name string, data []byte, modified time.Time) error {
+	compressed := &bytes.Buffer{}
+	fw, err := flate.NewWriter(compressed, flate.DefaultCompression)
+	if err != nil {
+		return err
+	}
+	if _, err := fw.Write(data); err != nil {
+		return err
+	}
+	if err := fw.Close(); err != nil {
+		return err
+	}
+
+	return z.copyRaw(zip.FileHeader{
+		Name:               name,
+		Method:             zip.Deflate,
+		Modified:           modified,
+		CRC32:              crc32.ChecksumIEEE(data),
+		CompressedSize64:   uint64(compressed.Len()),
+		UncompressedSize64: uint64(len(data)),
+	}, compressed)
+}
+
+// close writes the central directory. It does not close the underlying writer.
+func (z *rawZipWriter) close() error {
+	start := z.offset
+	for _, e := range z.dir {
+		fh := e.header
+		extra := fh.Extra
+		b := &bytes.Buffer{}
+		writeUint32(b, directoryHeaderSignature)
+		if fh.CompressedSize64 >= uint32max || fh.UncompressedSize64 >= uint32max || e.offset >= uint32max {
+			fh.ReaderVersion = zipVersion45
+			writeUint16(b, fh.CreatorVersion, fh.ReaderVersion, fh.Flags, fh.Method, fh.ModifiedTime, fh.ModifiedDate)
+			writeUint32(b, fh.CRC32, uint32max, uint32max)
+			extra = append(append([]byte{}, extra...), zip64Extra(fh.UncompressedSize64, fh.CompressedSize64, e.offset)...)
+		} else {
+			writeUint16(b, fh.CreatorVersion, fh.ReaderVersion, fh.Flags, fh.Method, fh.ModifiedTime, fh.ModifiedDate)
+			writeUint32(b, fh.CRC32, uint32(fh.CompressedSize64), uint32(fh.UncompressedSize64))
+		}
+		writeUint16(b, uint16(len(fh.Name)), uint16(len(extra)), uint16(len(fh.Comment)))
+		writeUint16(b, 0, 0) // disk number start, internal file attributes
+		writeUint32(b, fh.ExternalAttrs)
+		if e.offset >= uint32max {
+			writeUint32(b, uint32max)
+		} else {
+			writeUint32(b, uint32(e.offset))
+		}
+		b.WriteString(fh.Name)
+		b.Write(extra)
+		b.WriteString(fh.Comment)
+
+		if err := z.write(b.Bytes()); err != nil {
+			return err
+		}
+	}
+	end := z.offset
+
+	records := uint64(len(z.dir))
+	size := end - start
+	offset := start
+
+	b := &bytes.Buffer{}
+	if records >= uint16max || size >= uint32max || offset >= uint32max {
+		// zip64 end of central directory record
+		writeUint32(b, directory64EndSignature)
+		writeUint64(b, directory64EndLen-12) // length without signature and this field
+		writeUint16(b, zipVersion45, zipVersion45)
+		writeUint32(b, 0, 0) // number of this disk, number of the disk with the central directory
+		writeUint64(b, records, records, size, offset)
+		// zip64 end of central directory locator
+		writeUint32(b, directory64LocSignature, 0)
+		writeUint64(b, end)
+		writeUint32(b, 1) // total number of disks
+
+		// max values in the end record signal that zip64 values should be used
+		records, size, offset = uint16max, uint32max, uint32max
+	}
+	writeUint32(b, directoryEndSignature)
+	writeUint16(b, 0, 0) // number of this disk, number of the disk with the central directory
+	writeUint16(b, uint16(records), uint16(records))
+	writeUint32(b, uint32(size), uint32(offset))
+	writeUint16(b, 0) // comment length
+
+	if err := z.write(b.Bytes()); err != nil {
+		return err
+	}
+	return z.w.Flush()
+}
+
+func (z *rawZipWriter) write(p []byte) error {
+	n, err := z.w.Write(p)
+	z.offset += uint64(n)
+	return err
+}
+
+func zip64Extra(values ...uint64) []byte {
+	b := &bytes.Buffer{}
+	writeUint16(b, zip64ExtraID, uint16(8*len(values)))
+	writeUint64(b, values...)
+	return b.Bytes()
+}
+
+func extendedTimestamp(t time.Time) []byte {
+	b := &bytes.Buffer{}
+	writeUint16(b, extTimeExtraID, 5)
+	b.WriteByte(1) // only modification time is stored
+	writeUint32(b, uint32(t.Unix()))
+	return b.Bytes()
+}
+
+// timeToMsDosTime converts time to MS-DOS date and time, the same way archive/zip does
+func timeToMsDosTime(t time.Time) (uint16, uint16) {
+	date := uint16(t.Day() + int(t.Month())<<5 + (t.Year()-1980)<<9)
+	tm := uint16(t.Second()/2 + t.Minute()<<5 + t.Hour()<<11)
+	return date, tm
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+func writeUint16(b *bytes.Buffer, values ...uint16) {
+	for _, v := range values {
+		_ = binary.Write(b, binary.LittleEndian, v)
+	}
+}
+
+func writeUint32(b *bytes.Buffer, values ...uint32) {
+	for _, v := range values {
+		_ = binary.Write(b, binary.LittleEndian, v)
+	}
+}
+
+func writeUint64(b *bytes.Buffer, values ...uint64) {
+	for _, v := range values {
+		_ = binary.Write(b, binary.LittleEndian, v)
+	}
+}
@@ -0,0 +1,109 @@
+package rest
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readZip(t *testing.T, b *bytes.Buffer) map[string]string {
+	r, err := zip.NewReader(bytes.NewReader(b.Bytes()), int64(b.Len()))
+	require.NoError(t, err)
+
+	files := make(map[string]string, len(r.File))
+	for _, f := range r.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+		content, err := ioutil.ReadAll(rc)
+		require.NoError(t, err, f.Name)
+		require.NoError(t, rc.Close())
+		files[f.Name] = string(content)
+	}
+	return files
+}
+
+func TestRawZipWriterWritesFilesReadableByArchiveZip(t *testing.T) {
+	modified := time.Date(2019, time.October, 1, 12, 30, 10, 0, time.UTC)
+
+	b := &bytes.Buffer{}
+	w := newRawZipWriter(b)
+	require.NoError(t, w.writeFile("test.txt", []byte("test\n"), modified))
+	require.NoError(t, w.writeFile("dir/zażółć.txt", []byte(strings.Repeat("a", 1000)), modified))
+	require.NoError(t, w.writeFile("empty", nil, time.Time{}))
+	require.NoError(t, w.close())
+
+	assert.Equal(t, map[string]string{
+		"test.txt":       "test\n",
+		"dir/zażółć.txt": strings.Repeat("a", 1000),
+		"empty":          "",
+	}, readZip(t, b))
+
+	r, err := zip.NewReader(bytes.NewReader(b.Bytes()), int64(b.Len()))
+	require.NoError(t, err)
+	assert.True(t, modified.Equal(r.File[0].Modified))
+	assert.EqualValues(t, 5, r.File[0].UncompressedSize64)
+}
+
+func TestRawZipWriterCopiesCompressedFilesFromOtherZip(t *testing.T) {
+	src := &bytes.Buffer{}
+	w := zip.NewWriter(src)
+	for i, method := range []uint16{zip.Deflate, zip.Store} {
+		f, err := w.CreateHeader(&zip.FileHeader{Name: fmt.Sprintf("file-%d", i), Method: method})
+		require.NoError(t, err)
+		_, err = f.Write([]byte(strings.Repeat("test\n", 100)))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+
+	r, err := zip.NewReader(bytes.NewReader(src.Bytes()), int64(src.Len()))
+	require.NoError(t, err)
+
+	dst := &bytes.Buffer{}
+	raw := newRawZipWriter(dst)
+	for _, f := range r.File {
+		offset, err := f.DataOffset()
+		require.NoError(t, err)
+		require.NoError(t, raw.copyRaw(f.FileHeader,
+			io.NewSectionReader(bytes.NewReader(src.Bytes()), offset, int64(f.CompressedSize64))))
+	}
+	require.NoError(t, raw.close())
+
+	assert.Equal(t, map[string]string{
+		"file-0": strings.Repeat("test\n", 100),
+		"file-1": strings.Repeat("test\n", 100),
+	}, readZip(t, dst))
+}
+
+func TestRawZipWriterDoesNotAddFileWhenContentIsTruncated(t *testing.T) {
+	b := &bytes.Buffer{}
+	w := newRawZipWriter(b)
+	err := w.copyRaw(zip.FileHeader{Name: "truncated", Method: zip.Store, CompressedSize64: 10, UncompressedSize64: 10},
+		strings.NewReader("short"))
+	assert.EqualError(t, err, "could not copy truncated: EOF")
+	assert.Empty(t, w.dir)
+}
+
+func TestRawZipWriterWritesZip64DirectoryForManyFiles(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+
+	b := &bytes.Buffer{}
+	w := newRawZipWriter(b)
+	for i := 0; i < uint16max+1; i++ {
+		require.NoError(t, w.copyRaw(zip.FileHeader{Name: fmt.Sprintf("%d", i), Method: zip.Store}, strings.NewReader("")))
+	}
+	require.NoError(t, w.close())
+
+	r, err := zip.NewReader(bytes.NewReader(b.Bytes()), int64(b.Len()))
+	require.NoError(t, err)
+	assert.Len(t, r.File, uint16max+1)
+}
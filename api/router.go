@@ -26,6 +26,12 @@ const nodeBundleEndpoint = nodeBundlesEndpoint + "/{id}"
 // Endpoint to download bundle file
 const nodeBundleFileEndpoint = nodeBundleEndpoint + "/file"
 
+// Endpoint to cancel bundle creation
+const nodeBundleCancelEndpoint = nodeBundleEndpoint + "/cancel"
+
+// Endpoint to upload bundle to the object storage
+const nodeBundleUploadEndpoint = nodeBundleEndpoint + "/upload"
+
 // Endpoint for listing all cluster bundles
 const clusterBundlesEndpoint = baseRoute + "/diagnostics"
 
@@ -35,6 +41,15 @@ const clusterBundleEndpoint = clusterBundlesEndpoint + "/{id}"
 // Endpoint to download cluster bundle file
 const clusterBundleFileEndpoint = clusterBundleEndpoint + "/file"
 
+// Endpoint to cancel cluster bundle creation
+const clusterBundleCancelEndpoint = clusterBundleEndpoint + "/cancel"
+
+// Endpoint to upload cluster bundle to the object storage
+const clusterBundleUploadEndpoint = clusterBundleEndpoint + "/upload"
+
+// Endpoint for listing schedules of periodically created bundles
+const bundleSchedulesEndpoint = baseRoute + "/schedules"
+
 type routeHandler struct {
 	url                 string
 	handler             http.HandlerFunc
@@ -229,6 +244,16 @@ func getRoutes(dt *Dt) []routeHandler {
 			handler: bh.GetFile,
 			methods: []string{"GET"},
 		},
+		{
+			url:     nodeBundleCancelEndpoint,
+			handler: bh.Cancel,
+			methods: []string{"POST"},
+		},
+		{
+			url:     nodeBundleUploadEndpoint,
+			handler: bh.Upload,
+			methods: []string{"POST"},
+		},
 		//---- Cluster level API
 		{
 			url:     clusterBundleEndpoint,
@@ -255,6 +280,22 @@ func getRoutes(dt *Dt) []routeHandler {
 			handler: cbh.Download,
 			methods: []string{"GET"},
 		},
+		{
+			url:     clusterBundleCancelEndpoint,
+			handler: cbh.Cancel,
+			methods: []string{"POST"},
+		},
+		{
+			url:     clusterBundleUploadEndpoint,
+			handler: cbh.Upload,
+			methods: []string{"POST"},
+		},
+		//---- Scheduled bundles
+		{
+			url:     bundleSchedulesEndpoint,
+			handler: dt.Scheduler.List,
+			methods: []string{"GET"},
+		},
 		//---------------------------------------------------------------------
 		{
 			// /system/health/v1/report/diagnostics
@@ -76,6 +76,8 @@ type Dt struct {
 	DtDiagnosticsJob     *DiagnosticsJob
 	BundleHandler        rest.BundleHandler
 	ClusterBundleHandler *rest.ClusterBundleHandler
+	Scheduler            *rest.Scheduler
+	Trigger              *rest.Trigger
 	RunPullerChan        chan bool
 	RunPullerDoneChan    chan bool
 	SystemdUnits         *SystemdUnits
@@ -0,0 +1,260 @@
+// Package archive writes and reads bundle archives in every supported format.
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Format of the bundle archive. Empty format is zip, the only format of bundles created by older versions.
+type Format string
+
+const (
+	Zip    Format = "zip"
+	TarGz  Format = "tar.gz"
+	TarZst Format = "tar.zst"
+)
+
+var (
+	zipMagic  = []byte("PK")
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// ParseFormat returns format with the given name
+func ParseFormat(name string) (Format, error) {
+	switch f := Format(name); f {
+	case "", Zip, TarGz, TarZst:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown format %q, must be %s, %s or %s", name, Zip, TarGz, TarZst)
+}
+
+// Extension returns file name extension with leading dot e.g., ".tar.gz"
+func (f Format) Extension() string {
+	if f == "" {
+		return "." + string(Zip)
+	}
+	return "." + string(f)
+}
+
+// ContentType returns MIME type of archives in the format
+func (f Format) ContentType() string {
+	switch f {
+	case TarGz:
+		return "application/gzip"
+	case TarZst:
+		return "application/zstd"
+	}
+	return "application/zip"
+}
+
+// Header describes a single file in the archive
+type Header struct {
+	Name     string
+	Size     int64 // ignored by zip so it could be -1 when size is unknown
+	Modified time.Time
+}
+
+// Writer adds files to the archive one by one
+type Writer interface {
+	// Create adds a file described by the header. Exactly h.Size bytes must be written
+	// to the returned writer before the next file is created.
+	Create(h Header) (io.Writer, error)
+	// Close finishes the archive. It does not close the underlying writer.
+	Close() error
+}
+
+// NewWriter returns writer of archives in the given format
+func NewWriter(f Format, w io.Writer) (Writer, error) {
+	switch f {
+	case "", Zip:
+		return zipWriter{zip.NewWriter(w)}, nil
+	case TarGz:
+		return newTarWriter(gzip.NewWriter(w)), nil
+	case TarZst:
+		zw, err := zstd.NewWriter(w)
+		if err != nil {
+			return nil, fmt.Errorf("could not create zstd writer: %s", err)
+		}
+		return newTarWriter(zw), nil
+	}
+	return nil, fmt.Errorf("unknown format %q", f)
+}
+
+// WriteFile adds a file with the given content
+func WriteFile(w Writer, name string, data []byte, modified time.Time) error {
+	f, err := w.Create(Header{Name: name, Size: int64(len(data)), Modified: modified})
+	if err != nil {
+		return fmt.Errorf("could not create %s: %s", name, err)
+	}
+	if _, err := f.Write(data); err != nil {
+		return fmt.Errorf("could not write %s: %s", name, err)
+	}
+	return nil
+}
+
+type zipWriter struct {
+	w *zip.Writer
+}
+
+func (z zipWriter) Create(h Header) (io.Writer, error) {
+	return z.w.CreateHeader(&zip.FileHeader{Name: h.Name, Method: zip.Deflate, Modified: h.Modified})
+}
+
+func (z zipWriter) Close() error {
+	return z.w.Close()
+}
+
+// tarWriter writes tar archive compressed as a single stream, so similar files compress much better than in zip
+type tarWriter struct {
+	compressor io.WriteCloser
+	w          *tar.Writer
+}
+
+func newTarWriter(compressor io.WriteCloser) *tarWriter {
+	return &tarWriter{compressor: compressor, w: tar.NewWriter(compressor)}
+}
+
+func (t *tarWriter) Create(h Header) (io.Writer, error) {
+	if h.Modified.IsZero() {
+		h.Modified = time.Unix(0, 0)
+	}
+	err := t.w.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     h.Name,
+		Size:     h.Size,
+		Mode:     0644,
+		ModTime:  h.Modified,
+	})
+	return t.w, err
+}
+
+func (t *tarWriter) Close() error {
+	if err := t.w.Close(); err != nil {
+		return err
+	}
+	return t.compressor.Close()
+}
+
+// DetectFormat returns format of the archive stored in the given path based on its content
+func DetectFormat(path string) (Format, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return detect(bufio.NewReader(f))
+}
+
+func detect(r *bufio.Reader) (Format, error) {
+	magic, err := r.Peek(len(zstdMagic))
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	switch {
+	case bytes.HasPrefix(magic, zipMagic):
+		return Zip, nil
+	case bytes.HasPrefix(magic, gzipMagic):
+		return TarGz, nil
+	case bytes.HasPrefix(magic, zstdMagic):
+		return TarZst, nil
+	}
+	return "", fmt.Errorf("unknown archive format")
+}
+
+// Walk calls fn for every file of the archive stored in the given path. Archive format is detected from
+// its content. Walking stops on the first error returned by fn. Data read from r is validated
+// e.g., zip entry checksum is verified when its whole content is read.
+func Walk(path string, fn func(h Header, r io.Reader) error) error {
+	f, err := DetectFormat(path)
+	if err != nil {
+		return fmt.Errorf("could not open %s: %s", path, err)
+	}
+	if f == Zip {
+		return walkZip(path, fn)
+	}
+	return walkTar(path, f, fn)
+}
+
+func walkZip(path string, fn func(h Header, r io.Reader) error) error {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return fmt.Errorf("could not open %s: %s", path, err)
+	}
+	defer r.Close()
+
+	for _, f := range r.File {
+		if err := walkZipFile(f, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func walkZipFile(f *zip.File, fn func(h Header, r io.Reader) error) error {
+	h := Header{Name: f.Name, Size: int64(f.UncompressedSize64), Modified: f.Modified}
+	rc, err := f.Open()
+	if err != nil {
+		return fn(h, errReader{err})
+	}
+	defer rc.Close()
+	return fn(h, rc)
+}
+
+func walkTar(path string, f Format, fn func(h Header, r io.Reader) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("could not open %s: %s", path, err)
+	}
+	defer file.Close()
+
+	var decompressed io.Reader
+	if f == TarGz {
+		gr, err := gzip.NewReader(file)
+		if err != nil {
+			return fmt.Errorf("could not open %s: %s", path, err)
+		}
+		defer gr.Close()
+		decompressed = gr
+	} else {
+		zr, err := zstd.NewReader(file)
+		if err != nil {
+			return fmt.Errorf("could not open %s: %s", path, err)
+		}
+		defer zr.Close()
+		decompressed = zr
+	}
+
+	r := tar.NewReader(decompressed)
+	for {
+		th, err := r.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("could not read %s: %s", path, err)
+		}
+		if err := fn(Header{Name: th.Name, Size: th.Size, Modified: th.ModTime}, r); err != nil {
+			return err
+		}
+	}
+}
+
+// errReader returns err on every read
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
@@ -0,0 +1,121 @@
+package archive
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFormat(t *testing.T) {
+	for _, name := range []string{"", "zip", "tar.gz", "tar.zst"} {
+		f, err := ParseFormat(name)
+		assert.NoError(t, err)
+		assert.Equal(t, Format(name), f)
+	}
+
+	_, err := ParseFormat("rar")
+	assert.EqualError(t, err, `unknown format "rar", must be zip, tar.gz or tar.zst`)
+}
+
+func TestFormatExtensionAndContentType(t *testing.T) {
+	assert.Equal(t, ".zip", Format("").Extension())
+	assert.Equal(t, "application/zip", Format("").ContentType())
+	assert.Equal(t, ".zip", Zip.Extension())
+	assert.Equal(t, "application/zip", Zip.ContentType())
+	assert.Equal(t, ".tar.gz", TarGz.Extension())
+	assert.Equal(t, "application/gzip", TarGz.ContentType())
+	assert.Equal(t, ".tar.zst", TarZst.Extension())
+	assert.Equal(t, "application/zstd", TarZst.ContentType())
+}
+
+func TestWriteAndWalkEveryFormat(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	modified := time.Date(2019, 10, 1, 12, 0, 0, 0, time.UTC)
+	files := map[string]string{
+		"first":                              "first\n",
+		"dir/second":                         strings.Repeat("second\n", 1000),
+		"empty":                              "",
+		strings.Repeat("long/", 30) + "name": "long",
+	}
+	names := []string{"first", "dir/second", "empty", strings.Repeat("long/", 30) + "name"}
+
+	for _, f := range []Format{Zip, TarGz, TarZst} {
+		t.Run(string(f), func(t *testing.T) {
+			path := filepath.Join(dir, "bundle"+f.Extension())
+			file, err := os.Create(path)
+			require.NoError(t, err)
+
+			w, err := NewWriter(f, file)
+			require.NoError(t, err)
+			for _, name := range names {
+				require.NoError(t, WriteFile(w, name, []byte(files[name]), modified))
+			}
+			require.NoError(t, w.Close())
+			require.NoError(t, file.Close())
+
+			detected, err := DetectFormat(path)
+			require.NoError(t, err)
+			assert.Equal(t, f, detected)
+
+			var walked []string
+			err = Walk(path, func(h Header, r io.Reader) error {
+				content, err := ioutil.ReadAll(r)
+				require.NoError(t, err)
+				assert.Equal(t, files[h.Name], string(content), h.Name)
+				assert.EqualValues(t, len(content), h.Size, h.Name)
+				assert.True(t, modified.Equal(h.Modified), h.Name)
+				walked = append(walked, h.Name)
+				return nil
+			})
+			require.NoError(t, err)
+			assert.Equal(t, names, walked)
+		})
+	}
+}
+
+func TestWalkStopsOnError(t *testing.T) {
+	b := &bytes.Buffer{}
+	w, err := NewWriter(TarGz, b)
+	require.NoError(t, err)
+	require.NoError(t, WriteFile(w, "a", []byte("a"), time.Now()))
+	require.NoError(t, WriteFile(w, "b", []byte("b"), time.Now()))
+	require.NoError(t, w.Close())
+
+	f, err := ioutil.TempFile("", "bundle")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.Write(b.Bytes())
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	calls := 0
+	err = Walk(f.Name(), func(h Header, r io.Reader) error {
+		calls++
+		return io.ErrUnexpectedEOF
+	})
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+	assert.Equal(t, 1, calls)
+}
+
+func TestWalkReturnsErrorWhenFormatIsUnknown(t *testing.T) {
+	f, err := ioutil.TempFile("", "bundle")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.WriteString("not an archive")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	err = Walk(f.Name(), func(h Header, r io.Reader) error { return nil })
+	assert.EqualError(t, err, "could not open "+f.Name()+": unknown archive format")
+}
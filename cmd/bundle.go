@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/dcos/dcos-diagnostics/api/rest"
+	"github.com/dcos/dcos-diagnostics/encrypt"
+	"github.com/spf13/cobra"
+)
+
+var (
+	decryptKeyFile string
+	decryptOutput  string
+)
+
+// bundleCmd groups commands working with diagnostics bundles
+var bundleCmd = &cobra.Command{
+	Use:   "bundle",
+	Short: "Work with diagnostics bundles",
+}
+
+// bundleVerifyCmd represents the bundle verify command
+var bundleVerifyCmd = &cobra.Command{
+	Use:   "verify <bundle>",
+	Short: "Check if local or cluster bundle is complete and not corrupted",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return verifyBundle(args[0], os.Stdout)
+	},
+}
+
+// bundleDecryptCmd represents the bundle decrypt command
+var bundleDecryptCmd = &cobra.Command{
+	Use:   "decrypt <bundle>",
+	Short: "Decrypt bundle encrypted for the recipient with the given private key",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return decryptBundle(args[0], decryptKeyFile, decryptOutput)
+	},
+}
+
+func verifyBundle(path string, out io.Writer) error {
+	if encrypted, err := encrypt.IsEncrypted(path); err == nil && encrypted {
+		return fmt.Errorf("bundle %s is encrypted, decrypt it first with: bundle decrypt", path)
+	}
+
+	problems, err := rest.VerifyBundle(path)
+	if err != nil {
+		return err
+	}
+
+	if len(problems) == 0 {
+		_, err = fmt.Fprintf(out, "%s: OK\n", path)
+		return err
+	}
+
+	for _, p := range problems {
+		if _, err := fmt.Fprintln(out, p); err != nil {
+			return fmt.Errorf("could not write output: %s", err)
+		}
+	}
+	return fmt.Errorf("bundle %s has %d problem(s)", path, len(problems))
+}
+
+// decryptBundle decrypts bundle from the given path to the output path. Output is removed when decryption fails
+// so corrupted or tampered bundle is never left half decrypted.
+func decryptBundle(path, keyFile, output string) error {
+	if keyFile == "" {
+		return fmt.Errorf("private key is required, use --key")
+	}
+	if output == "" {
+		if !strings.HasSuffix(path, encrypt.Extension) {
+			return fmt.Errorf("could not guess output path of %s, use --output", path)
+		}
+		output = strings.TrimSuffix(path, encrypt.Extension)
+	}
+
+	key, err := encrypt.LoadPrivateKey(keyFile)
+	if err != nil {
+		return err
+	}
+
+	in, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("could not open bundle: %s", err)
+	}
+	defer in.Close()
+
+	r, err := encrypt.NewReader(in, key)
+	if err != nil {
+		return fmt.Errorf("could not decrypt %s: %s", path, err)
+	}
+
+	out, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("could not create output: %s", err)
+	}
+	_, err = io.Copy(out, r)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(output)
+		return fmt.Errorf("could not decrypt %s: %s", path, err)
+	}
+	return nil
+}
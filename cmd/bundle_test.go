@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"archive/zip"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dcos/dcos-diagnostics/encrypt"
+	"github.com/dcos/dcos-diagnostics/encrypt/encrypttest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_verifyBundle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bundle")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "bundle.zip")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	w := zip.NewWriter(f)
+	file, err := w.Create("manifest.json")
+	require.NoError(t, err)
+	_, err = file.Write([]byte(`{"entries":[]}`))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.NoError(t, f.Close())
+
+	var out strings.Builder
+	err = verifyBundle(path, &out)
+
+	assert.NoError(t, err)
+	assert.Equal(t, path+": OK\n", out.String())
+}
+
+func Test_verifyBundle_with_problems(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bundle")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "bundle.zip")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	w := zip.NewWriter(f)
+	_, err = w.Create("file")
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.NoError(t, f.Close())
+
+	var out strings.Builder
+	err = verifyBundle(path, &out)
+
+	assert.EqualError(t, err, "bundle "+path+" has 1 problem(s)")
+	assert.Equal(t, "manifest.json: missing\n", out.String())
+}
+
+func Test_verifyBundle_not_a_zip(t *testing.T) {
+	var out strings.Builder
+	err := verifyBundle(filepath.Join("testdata", "dcos-diagnostics-config.json"), &out)
+
+	assert.Contains(t, err.Error(), "unknown archive format")
+	assert.Empty(t, out.String())
+}
+
+func Test_decryptBundle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bundle")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	key, recipient := encrypttest.GenerateKey(t)
+	keyPath := filepath.Join(dir, "key.pem")
+	require.NoError(t, ioutil.WriteFile(keyPath,
+		pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), 0600))
+
+	path := filepath.Join(dir, "bundle.zip.enc")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	w, err := encrypt.NewWriter(f, []encrypt.Recipient{recipient})
+	require.NoError(t, err)
+	_, err = w.Write([]byte("bundle data"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.NoError(t, f.Close())
+
+	var out strings.Builder
+	err = verifyBundle(path, &out)
+	assert.EqualError(t, err, "bundle "+path+" is encrypted, decrypt it first with: bundle decrypt")
+
+	assert.EqualError(t, decryptBundle(path, "", ""), "private key is required, use --key")
+
+	require.NoError(t, decryptBundle(path, keyPath, ""))
+	data, err := ioutil.ReadFile(filepath.Join(dir, "bundle.zip"))
+	require.NoError(t, err)
+	assert.Equal(t, "bundle data", string(data))
+
+	err = decryptBundle(path, keyPath, "")
+	assert.Contains(t, err.Error(), "could not create output")
+}
@@ -15,16 +15,22 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"net/http"
 	"net/url"
+	"os"
 	"strconv"
 	"time"
 
 	"github.com/dcos/dcos-diagnostics/api"
 	"github.com/dcos/dcos-diagnostics/api/rest"
+	"github.com/dcos/dcos-diagnostics/config"
 	diagDcos "github.com/dcos/dcos-diagnostics/dcos"
+	"github.com/dcos/dcos-diagnostics/encrypt"
+	"github.com/dcos/dcos-diagnostics/export"
+	"github.com/dcos/dcos-diagnostics/redact"
 	"github.com/dcos/dcos-diagnostics/util"
 
 	"github.com/dcos/dcos-go/dcos"
@@ -63,10 +69,32 @@ func startDiagnosticsDaemon() {
 		logrus.Fatalf("Could not initialize nodeInfo: %s", err)
 	}
 
+	// leadership changes so it must be checked every time
+	leader, err := getNodeInfo(tr, nodeutil.OptionNoCache())
+	if err != nil {
+		logrus.Fatalf("Could not initialize nodeInfo: %s", err)
+	}
+
 	if defaultConfig.FlagDiagnosticsBundleFetchersCount < 1 {
 		logrus.Fatal("workers-count must be greater than 0")
 	}
 
+	if defaultConfig.FlagDiagnosticsBundleCollectorsCount < 1 {
+		logrus.Fatal("collectors-count must be greater than 0")
+	}
+
+	if defaultConfig.FlagBundleJanitorIntervalMinutes < 1 {
+		logrus.Fatal("bundle-janitor-interval must be greater than 0")
+	}
+
+	if defaultConfig.FlagBundleRetentionMinFreeDiskPercent < 0 || defaultConfig.FlagBundleRetentionMinFreeDiskPercent > 100 {
+		logrus.Fatal("bundle-retention-min-free-disk must be between 0 and 100")
+	}
+
+	if defaultConfig.FlagBundleMinFreeSpaceMB < 0 {
+		logrus.Fatal("bundle-min-free-space must not be negative")
+	}
+
 	DCOSTools := &diagDcos.Tools{
 		ExhibitorURL: defaultConfig.FlagExhibitorClusterStatusURL,
 		ForceTLS:     defaultConfig.FlagForceTLS,
@@ -93,17 +121,63 @@ func startDiagnosticsDaemon() {
 
 	client := util.NewHTTPClient(defaultConfig.GetSingleEntryTimeout(), tr)
 
-	collectors, err := api.LoadCollectors(defaultConfig, DCOSTools, client)
+	collectors, limits, err := api.LoadCollectors(defaultConfig, DCOSTools, client)
 	if err != nil {
 		logrus.Fatalf("Could not init collectors properly: %s", err)
 	}
 
+	redactor, err := loadRedactor(defaultConfig)
+	if err != nil {
+		logrus.Fatalf("Could not init redaction rules properly: %s", err)
+	}
+
+	recipients, err := encrypt.LoadRecipients(defaultConfig.FlagBundleEncryptionRecipients)
+	if err != nil {
+		logrus.Fatalf("Could not init bundle encryption properly: %s", err)
+	}
+
+	// every component working in the bundle dir must know which bundles are being created
+	bundles := rest.NewBundleRegistry()
+
 	bundleTimeout := time.Minute * time.Duration(defaultConfig.FlagDiagnosticsJobTimeoutMinutes)
+	exporter, err := loadExporter(defaultConfig, bundleTimeout, bundles)
+	if err != nil {
+		logrus.Fatalf("Could not init bundle export properly: %s", err)
+	}
+
+	notifier, err := loadNotifier(defaultConfig)
+	if err != nil {
+		logrus.Fatalf("Could not init bundle webhooks properly: %s", err)
+	}
+	if notifier != nil {
+		go notifier.Run(context.Background())
+	}
+
+	// local bundles describe the node in their manifests, they are created without it when IP is unknown
+	nodeIP, err := DCOSTools.DetectIP()
+	if err != nil {
+		logrus.WithError(err).Warn("Could not detect node IP, it will be missing in local bundle manifests")
+	}
+
+	diskSpaceGuard := rest.NewDiskSpaceGuard(defaultConfig.FlagDiagnosticsBundleDir,
+		uint64(defaultConfig.FlagBundleMinFreeSpaceMB)*1024*1024)
 	bundleHandler, err := rest.NewBundleHandler(
 		defaultConfig.FlagDiagnosticsBundleDir,
 		collectors,
 		bundleTimeout,
 		defaultConfig.GetSingleEntryTimeout(),
+		defaultConfig.FlagDiagnosticsBundleCollectorsCount,
+		rest.BundleHandlerOptions{
+			Space:      diskSpaceGuard,
+			Redactor:   redactor,
+			Recipients: recipients,
+			Exporter:   exporter,
+			Notifier:   notifier,
+			Limits:     limits,
+			NodeIP:     net.ParseIP(nodeIP),
+			NodeRole:   defaultConfig.FlagRole,
+			Registry:   bundles,
+		},
 	)
 	if err != nil {
 		logrus.WithError(err).Fatal("BundleHandler could not be created")
@@ -112,11 +186,33 @@ func startDiagnosticsDaemon() {
 	coord := rest.NewParallelCoordinator(diagClient, time.Minute, defaultConfig.FlagDiagnosticsBundleDir)
 	urlBuilder := diagDcos.NewURLBuilder(defaultConfig.FlagAgentPort, defaultConfig.FlagMasterPort, defaultConfig.FlagForceTLS)
 	clusterBundleHandler, err := rest.NewClusterBundleHandler(coord, diagClient, DCOSTools, defaultConfig.FlagDiagnosticsBundleDir,
-		bundleTimeout, &urlBuilder)
+		bundleTimeout, &urlBuilder, diskSpaceGuard, recipients, exporter, notifier, bundles)
 	if err != nil {
 		logrus.WithError(err).Fatal("ClusterBundleHandler could not be created")
 	}
 
+	janitor, err := rest.NewJanitor(defaultConfig.FlagDiagnosticsBundleDir, rest.RetentionPolicy{
+		MaxAge:             time.Hour * time.Duration(defaultConfig.FlagBundleRetentionMaxAgeHours),
+		MaxTotalSize:       int64(defaultConfig.FlagBundleRetentionMaxTotalSizeMB) * 1024 * 1024,
+		MaxCount:           defaultConfig.FlagBundleRetentionMaxCount,
+		MinFreeDiskPercent: defaultConfig.FlagBundleRetentionMinFreeDiskPercent,
+	}, time.Minute*time.Duration(defaultConfig.FlagBundleJanitorIntervalMinutes), notifier, bundles)
+	if err != nil {
+		logrus.WithError(err).Fatal("Janitor could not be created")
+	}
+	go janitor.Run(context.Background())
+
+	scheduler, err := loadScheduler(defaultConfig, bundleHandler, clusterBundleHandler, leader, notifier, bundles)
+	if err != nil {
+		logrus.Fatalf("Could not init bundle schedules properly: %s", err)
+	}
+	go scheduler.Run(context.Background())
+
+	trigger, err := loadTrigger(defaultConfig, diagClient, &urlBuilder, leader, bundleTimeout)
+	if err != nil {
+		logrus.Fatalf("Could not init automatic bundles properly: %s", err)
+	}
+
 	// Inject dependencies used for running dcos-diagnostics.
 	dt := &api.Dt{
 		Cfg:                  defaultConfig,
@@ -124,6 +220,8 @@ func startDiagnosticsDaemon() {
 		DtDiagnosticsJob:     diagnosticsJob,
 		BundleHandler:        *bundleHandler,
 		ClusterBundleHandler: clusterBundleHandler,
+		Scheduler:            scheduler,
+		Trigger:              trigger,
 		RunPullerChan:        make(chan bool),
 		RunPullerDoneChan:    make(chan bool),
 		SystemdUnits:         &api.SystemdUnits{},
@@ -159,8 +257,7 @@ func startDiagnosticsDaemon() {
 	logrus.Fatal(http.Serve(listeners[0], router))
 }
 
-func getNodeInfo(tr http.RoundTripper) (nodeutil.NodeInfo, error) {
-	var options []nodeutil.Option
+func getNodeInfo(tr http.RoundTripper, options ...nodeutil.Option) (nodeutil.NodeInfo, error) {
 	defaultStateURL := url.URL{
 		Scheme: "https",
 		Host:   net.JoinHostPort(dcos.DNSRecordLeader, strconv.Itoa(dcos.PortMesosMaster)),
@@ -190,3 +287,95 @@ func initTransport() (http.RoundTripper, error) {
 
 	return tr, nil
 }
+
+// loadExporter returns exporter uploading bundles to the configured object storage or nil when export is not configured
+func loadExporter(cfg *config.Config, timeout time.Duration, bundles *rest.BundleRegistry) (*rest.Exporter, error) {
+	if cfg.FlagBundleExportS3Endpoint == "" {
+		return nil, nil
+	}
+	accessKeyID := cfg.FlagBundleExportS3AccessKeyID
+	if accessKeyID == "" {
+		accessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+	}
+	secretAccessKey := cfg.FlagBundleExportS3SecretAccessKey
+	if secretAccessKey == "" {
+		secretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	}
+	s3, err := export.NewS3(export.S3Config{
+		Endpoint:        cfg.FlagBundleExportS3Endpoint,
+		Region:          cfg.FlagBundleExportS3Region,
+		Bucket:          cfg.FlagBundleExportS3Bucket,
+		Prefix:          cfg.FlagBundleExportS3Prefix,
+		AccessKeyID:     accessKeyID,
+		SecretAccessKey: secretAccessKey,
+		PartSize:        int64(cfg.FlagBundleExportPartSizeMB) * 1024 * 1024,
+		MaxRetries:      cfg.FlagBundleExportRetries,
+	}, &http.Client{})
+	if err != nil {
+		return nil, err
+	}
+	return rest.NewExporter(cfg.FlagDiagnosticsBundleDir, s3, cfg.FlagHostname, cfg.FlagBundleExportAuto, timeout, bundles)
+}
+
+// loadNotifier returns notifier sending bundle events to the configured webhooks or nil when webhooks are not configured
+func loadNotifier(cfg *config.Config) (*rest.Notifier, error) {
+	if cfg.FlagBundleWebhooksFile == "" {
+		return nil, nil
+	}
+	webhooks, err := rest.LoadWebhooks(cfg.FlagBundleWebhooksFile)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Timeout: time.Second * time.Duration(cfg.FlagBundleWebhookTimeoutS)}
+	return rest.NewNotifier(cfg.FlagDiagnosticsBundleDir, webhooks, cfg.FlagBundleWebhookRetries, client)
+}
+
+// loadScheduler returns scheduler creating bundles on configured schedules, it has no schedules
+// when schedules file is not configured
+func loadScheduler(cfg *config.Config, bh *rest.BundleHandler, cbh *rest.ClusterBundleHandler,
+	leader rest.Leader, notifier *rest.Notifier, bundles *rest.BundleRegistry) (*rest.Scheduler, error) {
+	var schedules []rest.Schedule
+	if cfg.FlagBundleSchedulesFile != "" {
+		var err error
+		schedules, err = rest.LoadSchedules(cfg.FlagBundleSchedulesFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return rest.NewScheduler(cfg.FlagDiagnosticsBundleDir, schedules, bh, cbh, leader, notifier, bundles)
+}
+
+// loadTrigger returns trigger creating bundles on nodes where configured units turn unhealthy
+// or nil when no unit is configured
+func loadTrigger(cfg *config.Config, client rest.Client, urlBuilder diagDcos.NodeURLBuilder, leader rest.Leader,
+	timeout time.Duration) (*rest.Trigger, error) {
+	if len(cfg.FlagBundleTriggerUnits) == 0 {
+		return nil, nil
+	}
+	return rest.NewTrigger(client, urlBuilder, leader, rest.TriggerPolicy{
+		Units:         cfg.FlagBundleTriggerUnits,
+		Cooldown:      time.Minute * time.Duration(cfg.FlagBundleTriggerCooldownMinutes),
+		Collectors:    rest.CollectorSelection{Include: cfg.FlagBundleTriggerCollectors},
+		Since:         time.Minute * time.Duration(cfg.FlagBundleTriggerSinceMinutes),
+		MaxConcurrent: cfg.FlagBundleTriggerMaxConcurrent,
+	}, timeout)
+}
+
+// loadRedactor returns redactor with default and configured rules or nil when there are no rules
+func loadRedactor(cfg *config.Config) (*redact.Redactor, error) {
+	var rules []redact.Rule
+	if !cfg.FlagNoDefaultRedactionRules {
+		rules = append(rules, redact.DefaultRules...)
+	}
+	if cfg.FlagRedactionRulesFile != "" {
+		configured, err := redact.LoadRules(cfg.FlagRedactionRulesFile)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, configured...)
+	}
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	return redact.New(rules)
+}
@@ -21,6 +21,7 @@ import (
 	"github.com/dcos/dcos-diagnostics/api"
 	"github.com/dcos/dcos-diagnostics/config"
 	"github.com/dcos/dcos-diagnostics/dcos"
+	"github.com/dcos/dcos-diagnostics/encrypt"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -130,10 +131,103 @@ func init() {
 	daemonCmd.PersistentFlags().IntVar(&defaultConfig.FlagDiagnosticsBundleFetchersCount,
 		"fetchers-count", 1,
 		"Set a number of concurrent fetchers gathering nodes logs")
+	daemonCmd.PersistentFlags().IntVar(&defaultConfig.FlagDiagnosticsBundleCollectorsCount,
+		"collectors-count", 4,
+		"Set a number of collectors running concurrently while creating local bundle")
+	// bundles retention flags
+	daemonCmd.PersistentFlags().IntVar(&defaultConfig.FlagBundleRetentionMaxAgeHours,
+		"bundle-retention-max-age", 0,
+		"Remove bundles older than given number of hours (0 disables the limit)")
+	daemonCmd.PersistentFlags().IntVar(&defaultConfig.FlagBundleRetentionMaxTotalSizeMB,
+		"bundle-retention-max-total-size", 0,
+		"Remove the oldest bundles when all bundles take more than given number of MB (0 disables the limit)")
+	daemonCmd.PersistentFlags().IntVar(&defaultConfig.FlagBundleRetentionMaxCount,
+		"bundle-retention-max-count", 0,
+		"Remove the oldest bundles when there are more than given number of bundles (0 disables the limit)")
+	daemonCmd.PersistentFlags().Float64Var(&defaultConfig.FlagBundleRetentionMinFreeDiskPercent,
+		"bundle-retention-min-free-disk", 0,
+		"Remove the oldest bundles when free disk space is below given percent (0 disables the limit)")
+	daemonCmd.PersistentFlags().IntVar(&defaultConfig.FlagBundleJanitorIntervalMinutes,
+		"bundle-janitor-interval", 10,
+		"Set how often in minutes bundles retention policy is applied")
+	daemonCmd.PersistentFlags().IntVar(&defaultConfig.FlagBundleMinFreeSpaceMB,
+		"bundle-min-free-space", 100,
+		"Reject new bundles that would leave less than given number of MB free and abort running ones when free space drops below it")
+	daemonCmd.PersistentFlags().StringVar(&defaultConfig.FlagRedactionRulesFile,
+		"redaction-rules", "",
+		"Use JSON file with additional rules redacting sensitive data from bundles")
+	daemonCmd.PersistentFlags().BoolVar(&defaultConfig.FlagNoDefaultRedactionRules,
+		"no-default-redaction-rules", false,
+		"Do not redact common secret formats, only rules from redaction-rules are applied")
+	daemonCmd.PersistentFlags().StringSliceVar(&defaultConfig.FlagBundleEncryptionRecipients,
+		"bundle-encryption-recipients", nil,
+		"Encrypt bundles for recipients with given PEM encoded RSA public keys, any of their private keys decrypts bundles")
+	// export flags
+	daemonCmd.PersistentFlags().StringVar(&defaultConfig.FlagBundleExportS3Endpoint,
+		"bundle-export-s3-endpoint", "",
+		"Upload bundles to S3 compatible object storage with given URL e.g., https://s3.us-east-1.amazonaws.com (empty disables export)")
+	daemonCmd.PersistentFlags().StringVar(&defaultConfig.FlagBundleExportS3Region,
+		"bundle-export-s3-region", "us-east-1",
+		"Use region of the object storage to sign requests")
+	daemonCmd.PersistentFlags().StringVar(&defaultConfig.FlagBundleExportS3Bucket,
+		"bundle-export-s3-bucket", "",
+		"Upload bundles to given bucket")
+	daemonCmd.PersistentFlags().StringVar(&defaultConfig.FlagBundleExportS3Prefix,
+		"bundle-export-s3-prefix", "",
+		"Prepend given prefix to keys of uploaded bundles")
+	daemonCmd.PersistentFlags().StringVar(&defaultConfig.FlagBundleExportS3AccessKeyID,
+		"bundle-export-s3-access-key-id", "",
+		"Use access key ID to upload bundles (default is AWS_ACCESS_KEY_ID environment variable)")
+	daemonCmd.PersistentFlags().IntVar(&defaultConfig.FlagBundleExportPartSizeMB,
+		"bundle-export-part-size", 16,
+		"Upload bundles in parts of given number of MB (at least 5)")
+	daemonCmd.PersistentFlags().IntVar(&defaultConfig.FlagBundleExportRetries,
+		"bundle-export-retries", 3,
+		"Retry failed upload requests given number of times")
+	daemonCmd.PersistentFlags().BoolVar(&defaultConfig.FlagBundleExportAuto,
+		"bundle-export-auto", false,
+		"Upload every bundle when it's done")
+	// webhook flags
+	daemonCmd.PersistentFlags().StringVar(&defaultConfig.FlagBundleWebhooksFile,
+		"bundle-webhooks", "",
+		"Notify webhooks from given JSON file about bundle lifecycle events (empty disables webhooks)")
+	daemonCmd.PersistentFlags().IntVar(&defaultConfig.FlagBundleWebhookRetries,
+		"bundle-webhook-retries", 3,
+		"Retry failed webhook deliveries given number of times")
+	daemonCmd.PersistentFlags().IntVar(&defaultConfig.FlagBundleWebhookTimeoutS,
+		"bundle-webhook-timeout", 10,
+		"Set timeout of a single webhook request in seconds")
+	// scheduler flags
+	daemonCmd.PersistentFlags().StringVar(&defaultConfig.FlagBundleSchedulesFile,
+		"bundle-schedules", "",
+		"Create bundles on schedules from given JSON file (empty disables scheduled bundles)")
+	// trigger flags
+	daemonCmd.PersistentFlags().StringSliceVar(&defaultConfig.FlagBundleTriggerUnits,
+		"bundle-trigger-units", nil,
+		"Create local bundle on the node where unit matching any of given glob patterns turns unhealthy (empty disables automatic bundles)")
+	daemonCmd.PersistentFlags().IntVar(&defaultConfig.FlagBundleTriggerCooldownMinutes,
+		"bundle-trigger-cooldown", 30,
+		"Create automatic bundle on the same node at most once in given number of minutes")
+	daemonCmd.PersistentFlags().StringSliceVar(&defaultConfig.FlagBundleTriggerCollectors,
+		"bundle-trigger-collectors", nil,
+		"Run only collectors matching given names, glob patterns or types in automatic bundles (default is all collectors)")
+	daemonCmd.PersistentFlags().IntVar(&defaultConfig.FlagBundleTriggerSinceMinutes,
+		"bundle-trigger-since", 60,
+		"Collect logs from given number of minutes before unit turned unhealthy in automatic bundles (0 collects all logs)")
+	daemonCmd.PersistentFlags().IntVar(&defaultConfig.FlagBundleTriggerMaxConcurrent,
+		"bundle-trigger-max-concurrent", 2,
+		"Create at most given number of automatic bundles at the same time")
 	RootCmd.AddCommand(daemonCmd)
 
 	RootCmd.AddCommand(stateCmd)
 
+	bundleCmd.AddCommand(bundleVerifyCmd)
+	bundleDecryptCmd.Flags().StringVar(&decryptKeyFile, "key", "", "PEM encoded RSA private key of a recipient")
+	bundleDecryptCmd.Flags().StringVarP(&decryptOutput, "output", "o", "",
+		"Write decrypted bundle to given path (default is the bundle path without "+encrypt.Extension+" extension)")
+	bundleCmd.AddCommand(bundleDecryptCmd)
+	RootCmd.AddCommand(bundleCmd)
+
 	RootCmd.PersistentFlags().BoolVar(&version, "version", false, "Print dcos-diagnostics version")
 	RootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.dcos-diagnostics.yaml)")
 	RootCmd.PersistentFlags().BoolVar(&diag, "diag", false,
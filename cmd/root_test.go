@@ -63,6 +63,17 @@ func Test_initConfig(t *testing.T) {
 		FlagDiagnosticsJobGetSingleURLTimeoutMinutes: 1,
 		FlagCommandExecTimeoutSec:                    50,
 		FlagDiagnosticsBundleFetchersCount:           1,
+		FlagDiagnosticsBundleCollectorsCount:         4,
+		FlagBundleJanitorIntervalMinutes:             10,
+		FlagBundleMinFreeSpaceMB:                     100,
+		FlagBundleExportS3Region:                     "us-east-1",
+		FlagBundleExportPartSizeMB:                   16,
+		FlagBundleExportRetries:                      3,
+		FlagBundleWebhookRetries:                     3,
+		FlagBundleWebhookTimeoutS:                    10,
+		FlagBundleTriggerCooldownMinutes:             30,
+		FlagBundleTriggerSinceMinutes:                60,
+		FlagBundleTriggerMaxConcurrent:               2,
 	}
 
 	assert.Equal(t, expected, defaultConfig)
@@ -103,6 +114,17 @@ func Test_initConfig_multiple_endpints_configs(t *testing.T) {
 		FlagDiagnosticsJobGetSingleURLTimeoutMinutes: 1,
 		FlagCommandExecTimeoutSec:                    50,
 		FlagDiagnosticsBundleFetchersCount:           1,
+		FlagDiagnosticsBundleCollectorsCount:         4,
+		FlagBundleJanitorIntervalMinutes:             10,
+		FlagBundleMinFreeSpaceMB:                     100,
+		FlagBundleExportS3Region:                     "us-east-1",
+		FlagBundleExportPartSizeMB:                   16,
+		FlagBundleExportRetries:                      3,
+		FlagBundleWebhookRetries:                     3,
+		FlagBundleWebhookTimeoutS:                    10,
+		FlagBundleTriggerCooldownMinutes:             30,
+		FlagBundleTriggerSinceMinutes:                60,
+		FlagBundleTriggerMaxConcurrent:               2,
 	}
 
 	assert.Equal(t, expected, defaultConfig)
@@ -110,6 +132,20 @@ func Test_initConfig_multiple_endpints_configs(t *testing.T) {
 
 }
 
+func Test_initConfig_s3_secret_access_key(t *testing.T) {
+	cfgFile = filepath.Join("testdata", "dcos-diagnostics-config-s3-secret.json")
+	defer func() {
+		cfgFile = ""
+		defaultConfig.FlagBundleExportS3SecretAccessKey = ""
+	}()
+
+	initConfig()
+
+	// secret has no flag so it's not visible in the process list
+	assert.Nil(t, daemonCmd.PersistentFlags().Lookup("bundle-export-s3-secret-access-key"))
+	assert.Equal(t, "secret", defaultConfig.FlagBundleExportS3SecretAccessKey)
+}
+
 func TestPersistentPreRunSetsLogLevel(t *testing.T) {
 	assert.Equal(t, logrus.InfoLevel, logrus.GetLevel())
 	RootCmd.PersistentPreRun(nil, nil)
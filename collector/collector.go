@@ -25,6 +25,29 @@ type Collector interface {
 	Collect(ctx context.Context) (goio.ReadCloser, error)
 }
 
+// WindowCollector is a Collector that could limit collected data to the given time window
+type WindowCollector interface {
+	Collector
+	// CollectWindow returns data logged in the given time window
+	CollectWindow(ctx context.Context, window TimeWindow) (goio.ReadCloser, error)
+}
+
+// Output is a single file produced by a MultiCollector
+type Output struct {
+	// Name is the path of the file in the bundle
+	Name string
+	// Open returns the file content, it's called at most once and the caller closes returned reader
+	Open func(ctx context.Context) (goio.ReadCloser, error)
+}
+
+// MultiCollector is a Collector that produces many files e.g., all files matching a pattern.
+// Its Collect returns only the main file.
+type MultiCollector interface {
+	Collector
+	// CollectOutputs returns files collected in the given time window, zero window means no time limit
+	CollectOutputs(ctx context.Context, window TimeWindow) ([]Output, error)
+}
+
 // Cmd is a struct implementing Collector interface. It collects command output for given command configured with Cmd field
 type Cmd struct {
 	name     string
@@ -89,6 +112,26 @@ func (c Systemd) Collect(ctx context.Context) (goio.ReadCloser, error) {
 	return rc, err
 }
 
+// CollectWindow returns journal logs from the given window. When window has no start
+// logs from the configured duration before its end are returned.
+func (c Systemd) CollectWindow(ctx context.Context, window TimeWindow) (goio.ReadCloser, error) {
+	return c.CollectJournal(ctx, window, JournalOptions{})
+}
+
+// CollectJournal returns journal logs from the given window in the requested format
+func (c Systemd) CollectJournal(ctx context.Context, window TimeWindow, options JournalOptions) (goio.ReadCloser, error) {
+	if window.IsZero() && options.Format != JSON && !options.filtered() {
+		return c.Collect(ctx)
+	}
+
+	rc, err := readJournal(ctx, units.JournalQuery{Unit: c.unitName}, c.duration, window, options)
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s logs from journal: %s", c.unitName, err)
+	}
+
+	return rc, nil
+}
+
 // Endpoint is a struct implementing Collector interface. It collects HTTP response for given url
 type Endpoint struct {
 	name     string
@@ -144,9 +187,10 @@ func (c Endpoint) Collect(ctx context.Context) (goio.ReadCloser, error) {
 }
 
 type File struct {
-	name     string
-	optional bool
-	filePath string
+	name            string
+	optional        bool
+	filePath        string
+	timestampLayout string // layout of timestamps starting log lines, empty when file is not a log
 }
 
 func NewFile(name string, optional bool, filePath string) *File {
@@ -157,6 +201,18 @@ func NewFile(name string, optional bool, filePath string) *File {
 	}
 }
 
+// NewTimeAwareFile creates File collector that could return only lines logged in the requested time window.
+// Lines should start with a timestamp in the given layout (see time.Parse), lines without a timestamp are
+// treated as a continuation of the previous line.
+func NewTimeAwareFile(name string, optional bool, filePath string, timestampLayout string) *File {
+	return &File{
+		name:            name,
+		optional:        optional,
+		filePath:        filePath,
+		timestampLayout: timestampLayout,
+	}
+}
+
 func (c File) Name() string {
 	return c.name
 }
@@ -172,3 +228,13 @@ func (c File) Collect(ctx context.Context) (goio.ReadCloser, error) {
 	}
 	return io.ReadCloserWithContext(ctx, r), nil
 }
+
+// CollectWindow returns lines logged in the given window. Whole file is returned when
+// the collector was not created with a timestamp layout.
+func (c File) CollectWindow(ctx context.Context, window TimeWindow) (goio.ReadCloser, error) {
+	rc, err := c.Collect(ctx)
+	if err != nil || c.timestampLayout == "" || window.IsZero() {
+		return rc, err
+	}
+	return newWindowFilter(rc, c.timestampLayout, window), nil
+}
@@ -4,9 +4,12 @@ import (
 	"context"
 	"io/ioutil"
 	"os"
+	"regexp"
 	"testing"
 	"time"
 
+	"github.com/dcos/dcos-diagnostics/units"
+
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -31,3 +34,34 @@ func TestSystemd_Collect(t *testing.T) {
 
 	assert.Empty(t, string(raw))
 }
+
+func TestSystemd_CollectJournalWithFilters(t *testing.T) {
+	if os.Getenv("TRAVIS") != "" {
+		t.Skipf("SKIPPING: We can not read from journal in Travis")
+	}
+
+	c := NewSystemd("test", false, "test-unit", time.Second)
+	warning := units.PriorityWarning
+	r, err := c.CollectJournal(context.TODO(), TimeWindow{}, JournalOptions{
+		Format:      JSON,
+		MaxPriority: &warning,
+		Message:     regexp.MustCompile("error"),
+	})
+	require.NoError(t, err)
+
+	raw, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	assert.Empty(t, string(raw))
+}
+
+func TestKernel_Collect(t *testing.T) {
+	if os.Getenv("TRAVIS") != "" {
+		t.Skipf("SKIPPING: We can not read from journal in Travis")
+	}
+
+	r, err := NewKernel("kernel", false, time.Second).Collect(context.TODO())
+	require.NoError(t, err)
+
+	_, err = ioutil.ReadAll(r)
+	assert.NoError(t, err)
+}
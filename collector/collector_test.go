@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
 	"testing"
 	"time"
 
@@ -230,6 +231,30 @@ func TestFile_Collect(t *testing.T) {
 	assert.NoError(t, reader.Close())
 }
 
+func TestFile_CollectWindow(t *testing.T) {
+	f, err := ioutil.TempFile("", "")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+
+	_, err = f.Write([]byte("2019-10-01T11:00:00Z old\n2019-10-01T12:00:00Z new\n"))
+	require.NoError(t, err)
+
+	window := TimeWindow{Since: time.Date(2019, 10, 1, 12, 0, 0, 0, time.UTC)}
+
+	for layout, expected := range map[string]string{
+		"":           "2019-10-01T11:00:00Z old\n2019-10-01T12:00:00Z new\n",
+		time.RFC3339: "2019-10-01T12:00:00Z new\n",
+	} {
+		reader, err := NewTimeAwareFile("test", false, f.Name(), layout).CollectWindow(context.Background(), window)
+		require.NoError(t, err)
+
+		raw, err := ioutil.ReadAll(reader)
+		require.NoError(t, err)
+		assert.Equal(t, expected, string(raw), layout)
+		assert.NoError(t, reader.Close())
+	}
+}
+
 func TestFile_CollectNotExistingFile(t *testing.T) {
 	c := NewFile(
 		"test",
@@ -268,3 +293,29 @@ func TestFile_CollectContextDont(t *testing.T) {
 
 	assert.NoError(t, reader.Close())
 }
+
+func TestSystemdIsJournalCollector(t *testing.T) {
+	assert.Implements(t, (*JournalCollector)(nil), new(Systemd))
+}
+
+func TestParseJournalFormat(t *testing.T) {
+	for _, name := range []string{"", "text", "json"} {
+		format, err := ParseJournalFormat(name)
+		assert.NoError(t, err)
+		assert.Equal(t, JournalFormat(name), format)
+	}
+
+	_, err := ParseJournalFormat("xml")
+	assert.EqualError(t, err, `unknown journal format "xml", must be text or json`)
+}
+
+func TestKernelIsJournalCollector(t *testing.T) {
+	assert.Implements(t, (*JournalCollector)(nil), new(Kernel))
+	assert.Implements(t, (*WindowCollector)(nil), new(Kernel))
+}
+
+func TestKernel_NameAndOptional(t *testing.T) {
+	c := NewKernel("kernel", true, time.Minute)
+	assert.Equal(t, "kernel", c.Name())
+	assert.True(t, c.Optional())
+}
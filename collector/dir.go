@@ -0,0 +1,231 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	goio "io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dcos/dcos-diagnostics/io"
+)
+
+// DirOptions limit files collected by Dir collector. Zero values disable limits.
+type DirOptions struct {
+	// Exclude are glob patterns (see filepath.Match) of paths or base names of files and directories that are not collected
+	Exclude []string
+	// MaxFileSize is the size in bytes of the biggest collected file, bigger files are skipped
+	MaxFileSize int64
+	// MaxTotalSize is the number of bytes collected from all files, files that do not fit are skipped
+	MaxTotalSize int64
+	// ModifiedWithin skips files that were not modified in the given time before the collection
+	ModifiedWithin time.Duration
+}
+
+// Dir is a struct implementing Collector interface. It collects local files matching glob patterns,
+// matched directories are collected recursively. Every file is stored under its own path and the report
+// listing collected and skipped files is stored under the collector name.
+type Dir struct {
+	name     string
+	optional bool
+	patterns []string
+	options  DirOptions
+	now      func() time.Time
+}
+
+func NewDir(name string, optional bool, patterns []string, options DirOptions) (*Dir, error) {
+	for _, pattern := range append(append([]string{}, patterns...), options.Exclude...) {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %s", pattern, err)
+		}
+	}
+	return &Dir{
+		name:     name,
+		optional: optional,
+		patterns: patterns,
+		options:  options,
+		now:      time.Now,
+	}, nil
+}
+
+func (c Dir) Name() string {
+	return c.name
+}
+
+func (c Dir) Optional() bool {
+	return c.optional
+}
+
+// Collect returns only the report listing files that would be collected and skipped
+func (c Dir) Collect(ctx context.Context) (goio.ReadCloser, error) {
+	_, report, err := c.match(ctx, TimeWindow{})
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(report)), nil
+}
+
+// CollectOutputs returns matched files and the report. Files modified before the window started are skipped.
+func (c Dir) CollectOutputs(ctx context.Context, window TimeWindow) ([]Output, error) {
+	files, report, err := c.match(ctx, window)
+	if err != nil {
+		return nil, err
+	}
+
+	outputs := make([]Output, 0, len(files)+1)
+	for _, f := range files {
+		outputs = append(outputs, Output{Name: strings.TrimLeft(f.Path, "/"), Open: openLimited(f.Path, f.Size)})
+	}
+	return append(outputs, Output{Name: c.name, Open: bytesOutput(report)}), nil
+}
+
+// openLimited reads at most size bytes so files growing during the collection do not exceed limits
+func openLimited(path string, size int64) func(ctx context.Context) (goio.ReadCloser, error) {
+	return func(ctx context.Context) (goio.ReadCloser, error) {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadCloserWithContext(ctx, limitedFile{Reader: goio.LimitReader(f, size), Closer: f}), nil
+	}
+}
+
+type limitedFile struct {
+	goio.Reader
+	goio.Closer
+}
+
+// dirReport lists files matched by Dir collector
+type dirReport struct {
+	Collected []collectedFile `json:"collected"`
+	Skipped   []skippedFile   `json:"skipped"`
+}
+
+type collectedFile struct {
+	Path     string    `json:"path"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+}
+
+type skippedFile struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+// match finds files to collect and returns them sorted by path with the JSON report
+func (c Dir) match(ctx context.Context, window TimeWindow) ([]collectedFile, []byte, error) {
+	var modifiedAfter time.Time
+	if c.options.ModifiedWithin > 0 {
+		modifiedAfter = c.now().Add(-c.options.ModifiedWithin)
+	}
+	if window.Since.After(modifiedAfter) {
+		modifiedAfter = window.Since
+	}
+
+	candidates := make(map[string]os.FileInfo)
+	skipped := make(map[string]string)
+	for _, pattern := range c.patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid pattern %q: %s", pattern, err)
+		}
+		for _, m := range matches {
+			if err := c.walk(ctx, m, candidates, skipped); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	paths := make([]string, 0, len(candidates))
+	for path := range candidates {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	report := dirReport{Collected: []collectedFile{}, Skipped: []skippedFile{}}
+	var total int64
+	for _, path := range paths {
+		info := candidates[path]
+		switch {
+		case info.ModTime().Before(modifiedAfter):
+			skipped[path] = fmt.Sprintf("not modified since %s", modifiedAfter.UTC().Format(time.RFC3339))
+		case c.options.MaxFileSize > 0 && info.Size() > c.options.MaxFileSize:
+			skipped[path] = fmt.Sprintf("size %d bytes exceeds the file limit of %d bytes", info.Size(), c.options.MaxFileSize)
+		case c.options.MaxTotalSize > 0 && total+info.Size() > c.options.MaxTotalSize:
+			skipped[path] = fmt.Sprintf("size %d bytes exceeds the remaining total limit of %d bytes",
+				info.Size(), c.options.MaxTotalSize-total)
+		default:
+			total += info.Size()
+			report.Collected = append(report.Collected, collectedFile{Path: path, Size: info.Size(), Modified: info.ModTime()})
+		}
+	}
+
+	skippedPaths := make([]string, 0, len(skipped))
+	for path := range skipped {
+		skippedPaths = append(skippedPaths, path)
+	}
+	sort.Strings(skippedPaths)
+	for _, path := range skippedPaths {
+		report.Skipped = append(report.Skipped, skippedFile{Path: path, Reason: skipped[path]})
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not marshal %s report: %s", c.name, err)
+	}
+	return report.Collected, data, nil
+}
+
+// walk adds regular files found under the root to candidates. Symbolic links to files are followed,
+// symbolic links to directories are not.
+func (c Dir) walk(ctx context.Context, root string, candidates map[string]os.FileInfo, skipped map[string]string) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			skipped[path] = fmt.Sprintf("could not read: %s", err)
+			return nil
+		}
+		if c.excluded(path) {
+			skipped[path] = "excluded"
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			return nil
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			if info, err = os.Stat(path); err != nil {
+				skipped[path] = fmt.Sprintf("could not read: %s", err)
+				return nil
+			}
+		}
+		if !info.Mode().IsRegular() {
+			skipped[path] = "not a regular file"
+			return nil
+		}
+		candidates[path] = info
+		return nil
+	})
+}
+
+func (c Dir) excluded(path string) bool {
+	for _, pattern := range c.options.Exclude {
+		if matched, _ := filepath.Match(pattern, path); matched {
+			return true
+		}
+		if matched, _ := filepath.Match(pattern, filepath.Base(path)); matched {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,161 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createFiles creates files with given content relative to dir and sets their modification time
+func createFiles(t *testing.T, dir string, files map[string]string, modified time.Time) {
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+		require.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+		require.NoError(t, os.Chtimes(path, modified, modified))
+	}
+}
+
+func TestDirIsMultiCollector(t *testing.T) {
+	assert.Implements(t, (*MultiCollector)(nil), new(Dir))
+}
+
+func TestDir_CollectOutputs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dir-collector")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	now := time.Date(2020, 5, 15, 12, 0, 0, 0, time.UTC)
+	createFiles(t, dir, map[string]string{
+		"log/mesos.log":          "recent",
+		"log/mesos.log.1":        "rotated",
+		"log/mesos.log.2.gz":     "compressed",
+		"log/mesos.log.3":        "too big to be collected",
+		"meta/slaves/1/slave.id": "slave1",
+		"meta/tmp/1":             "temporary",
+		"other.log":              "not matched",
+	}, now.Add(-time.Hour))
+	createFiles(t, dir, map[string]string{"log/old.log": "old"}, now.Add(-48*time.Hour))
+	require.NoError(t, os.Symlink(filepath.Join(dir, "log", "mesos.log"), filepath.Join(dir, "meta", "latest")))
+
+	c, err := NewDir("mesos-files.json", false, []string{
+		filepath.Join(dir, "log", "*.log*"),
+		filepath.Join(dir, "meta"),
+		filepath.Join(dir, "missing"),
+	}, DirOptions{
+		Exclude:        []string{"*.gz", filepath.Join(dir, "meta", "tmp")},
+		MaxFileSize:    10,
+		MaxTotalSize:   24,
+		ModifiedWithin: 24 * time.Hour,
+	})
+	require.NoError(t, err)
+	c.now = func() time.Time { return now }
+	assert.Equal(t, "mesos-files.json", c.Name())
+	assert.False(t, c.Optional())
+
+	outputs, err := c.CollectOutputs(context.TODO(), TimeWindow{})
+	require.NoError(t, err)
+	content := readOutputs(t, outputs)
+
+	report := content["mesos-files.json"]
+	delete(content, "mesos-files.json")
+	assert.Equal(t, map[string]string{
+		filepath.Join(dir, "log", "mesos.log")[1:]:   "recent",
+		filepath.Join(dir, "log", "mesos.log.1")[1:]: "rotated",
+		filepath.Join(dir, "meta", "latest")[1:]:     "recent",
+	}, content)
+
+	r := dirReport{}
+	require.NoError(t, json.Unmarshal([]byte(report), &r))
+	var collected []string
+	for _, f := range r.Collected {
+		collected = append(collected, f.Path)
+	}
+	assert.Equal(t, []string{
+		filepath.Join(dir, "log", "mesos.log"),
+		filepath.Join(dir, "log", "mesos.log.1"),
+		filepath.Join(dir, "meta", "latest"),
+	}, collected)
+	assert.Equal(t, []skippedFile{
+		{Path: filepath.Join(dir, "log", "mesos.log.2.gz"), Reason: "excluded"},
+		{Path: filepath.Join(dir, "log", "mesos.log.3"), Reason: "size 23 bytes exceeds the file limit of 10 bytes"},
+		{Path: filepath.Join(dir, "log", "old.log"), Reason: "not modified since 2020-05-14T12:00:00Z"},
+		{Path: filepath.Join(dir, "meta", "slaves", "1", "slave.id"),
+			Reason: "size 6 bytes exceeds the remaining total limit of 5 bytes"},
+		{Path: filepath.Join(dir, "meta", "tmp"), Reason: "excluded"},
+	}, r.Skipped)
+}
+
+func TestDir_CollectOutputsSkipsFilesModifiedBeforeWindow(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dir-collector")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	since := time.Date(2020, 5, 15, 12, 0, 0, 0, time.UTC)
+	createFiles(t, dir, map[string]string{"old.log": "old"}, since.Add(-time.Minute))
+	createFiles(t, dir, map[string]string{"new.log": "new"}, since.Add(time.Minute))
+
+	c, err := NewDir("logs.json", true, []string{dir}, DirOptions{})
+	require.NoError(t, err)
+
+	outputs, err := c.CollectOutputs(context.TODO(), TimeWindow{Since: since})
+	require.NoError(t, err)
+	require.Len(t, outputs, 2)
+	assert.Equal(t, filepath.Join(dir, "new.log")[1:], outputs[0].Name)
+	assert.Equal(t, "logs.json", outputs[1].Name)
+}
+
+func TestDir_CollectReturnsReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dir-collector")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	createFiles(t, dir, map[string]string{"a.log": "a"}, time.Now())
+
+	c, err := NewDir("logs.json", false, []string{filepath.Join(dir, "*.log")}, DirOptions{})
+	require.NoError(t, err)
+
+	rc, err := c.Collect(context.TODO())
+	require.NoError(t, err)
+	r := dirReport{}
+	require.NoError(t, json.NewDecoder(rc).Decode(&r))
+	require.Len(t, r.Collected, 1)
+	assert.Equal(t, filepath.Join(dir, "a.log"), r.Collected[0].Path)
+	assert.EqualValues(t, 1, r.Collected[0].Size)
+	assert.Empty(t, r.Skipped)
+}
+
+func TestDir_CollectOutputsReadsOnlyMatchedSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dir-collector")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	createFiles(t, dir, map[string]string{"a.log": "first line\n"}, time.Now())
+
+	c, err := NewDir("logs.json", false, []string{dir}, DirOptions{})
+	require.NoError(t, err)
+	outputs, err := c.CollectOutputs(context.TODO(), TimeWindow{})
+	require.NoError(t, err)
+
+	f, err := os.OpenFile(filepath.Join(dir, "a.log"), os.O_APPEND|os.O_WRONLY, 0600)
+	require.NoError(t, err)
+	_, err = f.WriteString("line written during collection\n")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	content := readOutputs(t, outputs)
+	assert.Equal(t, "first line\n", content[filepath.Join(dir, "a.log")[1:]])
+}
+
+func TestNewDirValidatesPatterns(t *testing.T) {
+	_, err := NewDir("logs.json", false, []string{"/var/log/["}, DirOptions{})
+	assert.EqualError(t, err, `invalid pattern "/var/log/[": syntax error in pattern`)
+
+	_, err = NewDir("logs.json", false, []string{"/var/log"}, DirOptions{Exclude: []string{"["}})
+	assert.EqualError(t, err, `invalid pattern "[": syntax error in pattern`)
+}
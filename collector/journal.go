@@ -0,0 +1,117 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	goio "io"
+	"regexp"
+	"time"
+
+	"github.com/dcos/dcos-diagnostics/units"
+)
+
+// JournalFormat is the format of collected journal entries, empty format is Text
+type JournalFormat string
+
+const (
+	// Text formats every journal entry as a line with its timestamp and message
+	Text JournalFormat = "text"
+	// JSON formats every journal entry as a JSON object with all its fields in its own line
+	JSON JournalFormat = "json"
+)
+
+// ParseJournalFormat returns journal format with the given name
+func ParseJournalFormat(name string) (JournalFormat, error) {
+	switch f := JournalFormat(name); f {
+	case "", Text, JSON:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown journal format %q, must be %s or %s", name, Text, JSON)
+}
+
+// JournalOptions customize how journal logs are collected, zero fields do not filter collected entries
+type JournalOptions struct {
+	Format JournalFormat
+	// MaxPriority is the least important priority of collected entries, nil collects entries of all priorities
+	MaxPriority *units.Priority
+	// Boots collects only entries logged during any of given boots, whole boots are collected
+	// unless the time window has a start
+	Boots []units.Boot
+	// Message collects only entries with a message matching the pattern
+	Message *regexp.Regexp
+}
+
+// filtered returns true when options limit collected entries
+func (o JournalOptions) filtered() bool {
+	return o.MaxPriority != nil || len(o.Boots) > 0 || o.Message != nil
+}
+
+// JournalCollector is a Collector of journal logs that could be customized for every bundle
+type JournalCollector interface {
+	Collector
+	// CollectJournal returns journal logs from the given time window, zero window means the collector default
+	CollectJournal(ctx context.Context, window TimeWindow, options JournalOptions) (goio.ReadCloser, error)
+}
+
+// Kernel is a struct implementing Collector interface. It collects kernel messages from the whole journal
+// the same way journalctl --dmesg does but not limited to the current boot.
+type Kernel struct {
+	name     string
+	optional bool
+	duration time.Duration
+}
+
+func NewKernel(name string, optional bool, duration time.Duration) *Kernel {
+	return &Kernel{
+		name:     name,
+		optional: optional,
+		duration: duration,
+	}
+}
+
+func (c Kernel) Name() string {
+	return c.name
+}
+
+func (c Kernel) Optional() bool {
+	return c.optional
+}
+
+func (c Kernel) Collect(ctx context.Context) (goio.ReadCloser, error) {
+	return c.CollectJournal(ctx, TimeWindow{}, JournalOptions{})
+}
+
+// CollectWindow returns kernel messages from the given window. When window has no start
+// messages from the configured duration before its end are returned.
+func (c Kernel) CollectWindow(ctx context.Context, window TimeWindow) (goio.ReadCloser, error) {
+	return c.CollectJournal(ctx, window, JournalOptions{})
+}
+
+// CollectJournal returns kernel messages from the given window in the requested format
+func (c Kernel) CollectJournal(ctx context.Context, window TimeWindow, options JournalOptions) (goio.ReadCloser, error) {
+	rc, err := readJournal(ctx, units.JournalQuery{Transport: "kernel"}, c.duration, window, options)
+	if err != nil {
+		return nil, fmt.Errorf("could not read kernel logs from journal: %s", err)
+	}
+	return rc, nil
+}
+
+// readJournal returns entries matching the query and options logged in the window. When window has no start
+// entries logged during the duration before its end are returned, unless options select boots.
+func readJournal(ctx context.Context, query units.JournalQuery, duration time.Duration, window TimeWindow,
+	options JournalOptions) (goio.ReadCloser, error) {
+	query.Since, query.Until = window.Since, window.Until
+	if query.Since.IsZero() && len(options.Boots) == 0 {
+		until := window.Until
+		if until.IsZero() {
+			until = time.Now()
+		}
+		query.Since = until.Add(-duration)
+	}
+	query.MaxPriority, query.Boots, query.Message = options.MaxPriority, options.Boots, options.Message
+
+	if options.Format == JSON {
+		return units.ReadJournalJSON(ctx, query)
+	}
+	return units.ReadJournal(ctx, query)
+}
@@ -0,0 +1,281 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	goio "io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// prometheusAccept asks for the text exposition format, endpoints could return protocol buffers otherwise
+const prometheusAccept = "text/plain;version=0.0.4;q=1,*/*;q=0.1"
+
+// maxErrorBodySize is the number of bytes of the error response included in the error
+const maxErrorBodySize = 1024
+
+// Prometheus is a struct implementing Collector interface. It collects metrics exposed in Prometheus text format
+// by given url. Metrics are validated and stored both as the text exposition and as a normalized JSON document
+// in a file with the same name and .json extension.
+type Prometheus struct {
+	name     string
+	optional bool
+	client   *http.Client
+	url      string
+	metrics  []string // glob patterns of collected metric names, empty collects all metrics
+	maxSize  int64    // number of bytes of the scraped exposition kept in memory, 0 disables the limit
+}
+
+// NewPrometheus creates Prometheus collector. When metrics patterns (see path.Match) are given
+// only matching metric families are collected. Expositions bigger than maxSize bytes are not collected.
+func NewPrometheus(name string, optional bool, url string, client *http.Client, metrics []string,
+	maxSize int64) (*Prometheus, error) {
+	for _, pattern := range metrics {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid metric pattern %q: %s", pattern, err)
+		}
+	}
+	return &Prometheus{
+		name:     name,
+		optional: optional,
+		url:      url,
+		client:   client,
+		metrics:  metrics,
+		maxSize:  maxSize,
+	}, nil
+}
+
+func (c Prometheus) Name() string {
+	return c.name
+}
+
+func (c Prometheus) Optional() bool {
+	return c.optional
+}
+
+// Collect returns metrics in the text exposition format
+func (c Prometheus) Collect(ctx context.Context) (goio.ReadCloser, error) {
+	text, _, err := c.scrape(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(text)), nil
+}
+
+// CollectOutputs returns metrics in the text exposition format and as JSON. Both come from the same scrape.
+// Metrics are a point-in-time snapshot so the window is ignored.
+func (c Prometheus) CollectOutputs(ctx context.Context, _ TimeWindow) ([]Output, error) {
+	text, snapshot, err := c.scrape(ctx)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal metrics from %s: %s", c.url, err)
+	}
+
+	jsonName := strings.TrimSuffix(c.name, path.Ext(c.name)) + ".json"
+	if jsonName == c.name {
+		jsonName = c.name + ".json"
+	}
+	return []Output{
+		{Name: c.name, Open: bytesOutput(text)},
+		{Name: jsonName, Open: bytesOutput(data)},
+	}, nil
+}
+
+func bytesOutput(data []byte) func(context.Context) (goio.ReadCloser, error) {
+	return func(context.Context) (goio.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(data)), nil
+	}
+}
+
+// scrape fetches and parses metrics. The text exposition is returned as fetched unless metrics are filtered,
+// then it's rebuilt from matching families.
+func (c Prometheus) scrape(ctx context.Context) ([]byte, metricsSnapshot, error) {
+	request, err := http.NewRequest("GET", c.url, nil)
+	if err != nil {
+		return nil, metricsSnapshot{}, fmt.Errorf("could not create a new HTTP request: %s", err)
+	}
+	request.Header.Set("Accept", prometheusAccept)
+	request = request.WithContext(ctx)
+
+	scraped := time.Now()
+	resp, err := c.client.Do(request)
+	if err != nil {
+		return nil, metricsSnapshot{}, fmt.Errorf("could not fetch url %s: %s", c.url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(goio.LimitReader(resp.Body, maxErrorBodySize))
+		return nil, metricsSnapshot{}, fmt.Errorf("unable to fetch %s. Return code %d. Body: %s", c.url, resp.StatusCode, string(body))
+	}
+
+	// the whole exposition is validated so it's kept in memory, one more byte tells it exceeds the limit
+	src := goio.Reader(resp.Body)
+	if c.maxSize > 0 {
+		src = goio.LimitReader(resp.Body, c.maxSize+1)
+	}
+	body, err := ioutil.ReadAll(src)
+	if err != nil {
+		return nil, metricsSnapshot{}, fmt.Errorf("could not read metrics from %s: %s", c.url, err)
+	}
+	if c.maxSize > 0 && int64(len(body)) > c.maxSize {
+		return nil, metricsSnapshot{}, fmt.Errorf("metrics from %s exceed the size limit of %d bytes", c.url, c.maxSize)
+	}
+
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(bytes.NewReader(body))
+	if err != nil {
+		return nil, metricsSnapshot{}, fmt.Errorf("invalid metrics from %s: %s", c.url, err)
+	}
+
+	names := make([]string, 0, len(families))
+	for name := range families {
+		if c.matches(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	snapshot := metricsSnapshot{URL: c.url, Scraped: scraped.UTC(), Families: make([]metricFamily, 0, len(names))}
+	for _, name := range names {
+		snapshot.Families = append(snapshot.Families, newMetricFamily(families[name]))
+	}
+
+	if len(c.metrics) == 0 {
+		return body, snapshot, nil
+	}
+	filtered := &bytes.Buffer{}
+	for _, name := range names {
+		if _, err := expfmt.MetricFamilyToText(filtered, families[name]); err != nil {
+			return nil, metricsSnapshot{}, fmt.Errorf("could not write metrics from %s: %s", c.url, err)
+		}
+	}
+	return filtered.Bytes(), snapshot, nil
+}
+
+func (c Prometheus) matches(name string) bool {
+	if len(c.metrics) == 0 {
+		return true
+	}
+	for _, pattern := range c.metrics {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// metricsSnapshot is the normalized JSON form of scraped metrics. Values are strings
+// because they could be NaN or infinite.
+type metricsSnapshot struct {
+	URL      string         `json:"url"`
+	Scraped  time.Time      `json:"scraped_at"`
+	Families []metricFamily `json:"families"`
+}
+
+type metricFamily struct {
+	Name    string   `json:"name"`
+	Help    string   `json:"help,omitempty"`
+	Type    string   `json:"type"` // one of counter, gauge, summary, untyped or histogram
+	Metrics []metric `json:"metrics"`
+}
+
+type metric struct {
+	Labels    map[string]string `json:"labels,omitempty"`
+	Value     string            `json:"value,omitempty"` // value of counter, gauge or untyped metric
+	Count     *uint64           `json:"count,omitempty"` // number of observations of summary or histogram
+	Sum       string            `json:"sum,omitempty"`   // sum of observations of summary or histogram
+	Quantiles []quantile        `json:"quantiles,omitempty"`
+	Buckets   []bucket          `json:"buckets,omitempty"`
+	Timestamp int64             `json:"timestamp_ms,omitempty"`
+}
+
+type quantile struct {
+	Quantile string `json:"quantile"`
+	Value    string `json:"value"`
+}
+
+type bucket struct {
+	UpperBound string `json:"le"`
+	Count      uint64 `json:"count"`
+}
+
+func newMetricFamily(mf *dto.MetricFamily) metricFamily {
+	family := metricFamily{
+		Name:    mf.GetName(),
+		Help:    mf.GetHelp(),
+		Type:    strings.ToLower(mf.GetType().String()),
+		Metrics: make([]metric, 0, len(mf.GetMetric())),
+	}
+	for _, m := range mf.GetMetric() {
+		family.Metrics = append(family.Metrics, newMetric(m))
+	}
+	return family
+}
+
+func newMetric(m *dto.Metric) metric {
+	result := metric{Timestamp: m.GetTimestampMs()}
+	if len(m.GetLabel()) > 0 {
+		result.Labels = make(map[string]string, len(m.GetLabel()))
+		for _, l := range m.GetLabel() {
+			result.Labels[l.GetName()] = l.GetValue()
+		}
+	}
+
+	switch {
+	case m.Counter != nil:
+		result.Value = formatFloat(m.GetCounter().GetValue())
+	case m.Gauge != nil:
+		result.Value = formatFloat(m.GetGauge().GetValue())
+	case m.Untyped != nil:
+		result.Value = formatFloat(m.GetUntyped().GetValue())
+	case m.Summary != nil:
+		count := m.GetSummary().GetSampleCount()
+		result.Count = &count
+		result.Sum = formatFloat(m.GetSummary().GetSampleSum())
+		for _, q := range m.GetSummary().GetQuantile() {
+			result.Quantiles = append(result.Quantiles, quantile{
+				Quantile: formatFloat(q.GetQuantile()),
+				Value:    formatFloat(q.GetValue()),
+			})
+		}
+	case m.Histogram != nil:
+		count := m.GetHistogram().GetSampleCount()
+		result.Count = &count
+		result.Sum = formatFloat(m.GetHistogram().GetSampleSum())
+		for _, b := range m.GetHistogram().GetBucket() {
+			result.Buckets = append(result.Buckets, bucket{
+				UpperBound: formatFloat(b.GetUpperBound()),
+				Count:      b.GetCumulativeCount(),
+			})
+		}
+	}
+	return result
+}
+
+// formatFloat formats values the way Prometheus does e.g., +Inf, NaN or 0.5
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, +1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,178 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const metricsText = `# HELP http_requests_total Number of requests.
+# TYPE http_requests_total counter
+http_requests_total{code="200",method="get"} 1027 1395066363000
+http_requests_total{code="400",method="post"} 3
+# TYPE queue_length gauge
+queue_length NaN
+# HELP request_duration_seconds Request duration.
+# TYPE request_duration_seconds histogram
+request_duration_seconds_bucket{le="0.5"} 24054
+request_duration_seconds_bucket{le="+Inf"} 144320
+request_duration_seconds_sum 53423
+request_duration_seconds_count 144320
+`
+
+func metricsServer(t *testing.T, body string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Contains(t, r.Header.Get("Accept"), "text/plain;version=0.0.4")
+		fmt.Fprint(w, body)
+	}))
+}
+
+func readOutputs(t *testing.T, outputs []Output) map[string]string {
+	content := make(map[string]string)
+	for _, o := range outputs {
+		rc, err := o.Open(context.TODO())
+		require.NoError(t, err)
+		data, err := ioutil.ReadAll(rc)
+		require.NoError(t, err)
+		require.NoError(t, rc.Close())
+		content[o.Name] = string(data)
+	}
+	return content
+}
+
+func TestPrometheusIsMultiCollector(t *testing.T) {
+	assert.Implements(t, (*MultiCollector)(nil), new(Prometheus))
+}
+
+func TestPrometheus_Collect(t *testing.T) {
+	server := metricsServer(t, metricsText)
+	defer server.Close()
+
+	c, err := NewPrometheus("metrics.prom", false, server.URL, &http.Client{}, nil, 0)
+	require.NoError(t, err)
+	assert.Equal(t, "metrics.prom", c.Name())
+	assert.False(t, c.Optional())
+
+	r, err := c.Collect(context.TODO())
+	require.NoError(t, err)
+	raw, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, metricsText, string(raw))
+}
+
+func TestPrometheus_CollectOutputs(t *testing.T) {
+	server := metricsServer(t, metricsText)
+	defer server.Close()
+
+	c, err := NewPrometheus("metrics.prom", true, server.URL, &http.Client{}, nil, 0)
+	require.NoError(t, err)
+
+	outputs, err := c.CollectOutputs(context.TODO(), TimeWindow{})
+	require.NoError(t, err)
+	content := readOutputs(t, outputs)
+	require.Len(t, content, 2)
+	assert.Equal(t, metricsText, content["metrics.prom"])
+
+	var snapshot map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(content["metrics.json"]), &snapshot))
+	assert.Equal(t, server.URL, snapshot["url"])
+	assert.NotEmpty(t, snapshot["scraped_at"])
+	families, err := json.Marshal(snapshot["families"])
+	require.NoError(t, err)
+	assert.JSONEq(t, `[
+		{
+			"name": "http_requests_total",
+			"help": "Number of requests.",
+			"type": "counter",
+			"metrics": [
+				{"labels": {"code": "200", "method": "get"}, "value": "1027", "timestamp_ms": 1395066363000},
+				{"labels": {"code": "400", "method": "post"}, "value": "3"}
+			]
+		},
+		{
+			"name": "queue_length",
+			"type": "gauge",
+			"metrics": [{"value": "NaN"}]
+		},
+		{
+			"name": "request_duration_seconds",
+			"help": "Request duration.",
+			"type": "histogram",
+			"metrics": [{
+				"count": 144320,
+				"sum": "53423",
+				"buckets": [{"le": "0.5", "count": 24054}, {"le": "+Inf", "count": 144320}]
+			}]
+		}
+	]`, string(families))
+}
+
+func TestPrometheus_CollectOnlySelectedMetrics(t *testing.T) {
+	server := metricsServer(t, metricsText)
+	defer server.Close()
+
+	c, err := NewPrometheus("metrics", false, server.URL, &http.Client{}, []string{"http_*", "queue_length"}, 0)
+	require.NoError(t, err)
+
+	outputs, err := c.CollectOutputs(context.TODO(), TimeWindow{})
+	require.NoError(t, err)
+	content := readOutputs(t, outputs)
+	assert.Equal(t, `# HELP http_requests_total Number of requests.
+# TYPE http_requests_total counter
+http_requests_total{code="200",method="get"} 1027 1395066363000
+http_requests_total{code="400",method="post"} 3
+# TYPE queue_length gauge
+queue_length NaN
+`, content["metrics"])
+	assert.NotContains(t, content["metrics.json"], "request_duration_seconds")
+}
+
+func TestPrometheus_CollectShouldReturnErrorOnInvalidMetrics(t *testing.T) {
+	server := metricsServer(t, "# TYPE queue_length gauge\nqueue_length{ 1\n")
+	defer server.Close()
+
+	c, err := NewPrometheus("metrics", false, server.URL, &http.Client{}, nil, 0)
+	require.NoError(t, err)
+
+	_, err = c.CollectOutputs(context.TODO(), TimeWindow{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid metrics from "+server.URL)
+}
+
+func TestPrometheus_CollectShouldReturnErrorWhenMetricsExceedSizeLimit(t *testing.T) {
+	server := metricsServer(t, metricsText)
+	defer server.Close()
+
+	c, err := NewPrometheus("metrics", false, server.URL, &http.Client{}, nil, int64(len(metricsText)))
+	require.NoError(t, err)
+	_, err = c.Collect(context.TODO())
+	assert.NoError(t, err)
+
+	c, err = NewPrometheus("metrics", false, server.URL, &http.Client{}, nil, int64(len(metricsText)-1))
+	require.NoError(t, err)
+	_, err = c.Collect(context.TODO())
+	assert.EqualError(t, err, fmt.Sprintf("metrics from %s exceed the size limit of %d bytes", server.URL, len(metricsText)-1))
+}
+
+func TestPrometheus_CollectShouldReturnErrorWhen404(t *testing.T) {
+	server, _ := stubServer("/metrics", "OK")
+	defer server.Close()
+
+	c, err := NewPrometheus("metrics", false, server.URL+"/test", &http.Client{}, nil, 0)
+	require.NoError(t, err)
+
+	_, err = c.Collect(context.TODO())
+	assert.EqualError(t, err, fmt.Sprintf("unable to fetch %s. Return code 404. Body: 404 page not found\n", server.URL+"/test"))
+}
+
+func TestNewPrometheusValidatesMetricPatterns(t *testing.T) {
+	_, err := NewPrometheus("metrics", false, "http://127.0.0.1/metrics", &http.Client{}, []string{"["}, 0)
+	assert.EqualError(t, err, `invalid metric pattern "[": syntax error in pattern`)
+}
@@ -0,0 +1,95 @@
+package collector
+
+import (
+	"bufio"
+	goio "io"
+	"strings"
+	"time"
+)
+
+// TimeWindow limits collected data to entries logged between Since and Until.
+// Zero Since or Until means there is no limit.
+type TimeWindow struct {
+	Since time.Time
+	Until time.Time
+}
+
+// IsZero returns true when window does not limit collected data
+func (w TimeWindow) IsZero() bool {
+	return w.Since.IsZero() && w.Until.IsZero()
+}
+
+// Contains returns true when given time is in the window
+func (w TimeWindow) Contains(t time.Time) bool {
+	return (w.Since.IsZero() || !t.Before(w.Since)) && (w.Until.IsZero() || !t.After(w.Until))
+}
+
+// maxLineLength is the number of bytes of a line kept in memory. Longer lines are filtered in chunks
+// of this size and every chunk follows the first one, where the timestamp is.
+const maxLineLength = 1024 * 1024
+
+// windowFilter returns only lines of the log logged in the given window
+type windowFilter struct {
+	src     goio.ReadCloser
+	r       *bufio.Reader
+	layout  string
+	fields  int // number of whitespace separated fields in the timestamp
+	window  TimeWindow
+	include bool // tells if lines without timestamp should be returned
+	partial bool // tells if the last chunk did not end the line
+	line    []byte
+	err     error
+}
+
+func newWindowFilter(src goio.ReadCloser, layout string, window TimeWindow) *windowFilter {
+	return &windowFilter{
+		src:     src,
+		r:       bufio.NewReaderSize(src, maxLineLength),
+		layout:  layout,
+		fields:  len(strings.Fields(layout)),
+		window:  window,
+		include: true,
+	}
+}
+
+func (f *windowFilter) Read(p []byte) (int, error) {
+	for len(f.line) == 0 {
+		if f.err != nil {
+			return 0, f.err
+		}
+		// the line is read into the reader's buffer which is not reused until the line is consumed
+		line, err := f.r.ReadSlice('\n')
+		partial := err == bufio.ErrBufferFull
+		if partial {
+			err = nil
+		}
+		f.err = err
+		// the rest of a long line has no timestamp, it's kept with the beginning of the line
+		if len(line) > 0 && (f.partial && f.include || !f.partial && f.keep(line)) {
+			f.line = line
+		}
+		f.partial = partial
+	}
+
+	n := copy(p, f.line)
+	f.line = f.line[n:]
+	return n, nil
+}
+
+func (f *windowFilter) Close() error {
+	return f.src.Close()
+}
+
+// keep checks if line should be returned. Lines without timestamp follow the previous line.
+func (f *windowFilter) keep(line []byte) bool {
+	fields := strings.Fields(string(line))
+	if f.fields == 0 || len(fields) < f.fields {
+		return f.include
+	}
+	t, err := time.ParseInLocation(f.layout, strings.Join(fields[:f.fields], " "), time.Local)
+	if err != nil {
+		return f.include
+	}
+	f.include = f.window.Contains(t)
+	return f.include
+}
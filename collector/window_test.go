@@ -0,0 +1,86 @@
+package collector
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeWindow_Contains(t *testing.T) {
+	since := time.Date(2019, 10, 1, 12, 0, 0, 0, time.UTC)
+	until := since.Add(time.Hour)
+
+	tests := []struct {
+		window   TimeWindow
+		time     time.Time
+		contains bool
+	}{
+		{window: TimeWindow{}, time: since, contains: true},
+		{window: TimeWindow{Since: since}, time: since, contains: true},
+		{window: TimeWindow{Since: since}, time: since.Add(-time.Second), contains: false},
+		{window: TimeWindow{Until: until}, time: until, contains: true},
+		{window: TimeWindow{Until: until}, time: until.Add(time.Second), contains: false},
+		{window: TimeWindow{Since: since, Until: until}, time: since.Add(time.Minute), contains: true},
+		{window: TimeWindow{Since: since, Until: until}, time: until.Add(time.Minute), contains: false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.contains, tt.window.Contains(tt.time), "%+v contains %s", tt.window, tt.time)
+	}
+}
+
+func TestWindowFilterReturnsOnlyLinesFromWindow(t *testing.T) {
+	log := `2019-10-01 11:59:59 before
+2019-10-01 12:00:00 first
+  continuation of first
+2019-10-01 12:30:00 second
+2019-10-01 13:00:01 after
+  continuation of after
+`
+	window := TimeWindow{
+		Since: time.Date(2019, 10, 1, 12, 0, 0, 0, time.Local),
+		Until: time.Date(2019, 10, 1, 13, 0, 0, 0, time.Local),
+	}
+
+	f := newWindowFilter(ioutil.NopCloser(strings.NewReader(log)), "2006-01-02 15:04:05", window)
+	raw, err := ioutil.ReadAll(f)
+	require.NoError(t, err)
+	assert.NoError(t, f.Close())
+
+	assert.Equal(t, `2019-10-01 12:00:00 first
+  continuation of first
+2019-10-01 12:30:00 second
+`, string(raw))
+}
+
+func TestWindowFilterKeepsLinesWithoutTimestampBeforeFirstEntry(t *testing.T) {
+	log := "header\n2019-10-01T11:00:00Z old\n2019-10-01T12:00:00Z new"
+	window := TimeWindow{Since: time.Date(2019, 10, 1, 12, 0, 0, 0, time.UTC)}
+
+	f := newWindowFilter(ioutil.NopCloser(strings.NewReader(log)), time.RFC3339, window)
+	raw, err := ioutil.ReadAll(f)
+	require.NoError(t, err)
+
+	assert.Equal(t, "header\n2019-10-01T12:00:00Z new", string(raw))
+}
+
+func TestWindowFilterFiltersLongLinesByTheirBeginning(t *testing.T) {
+	long := strings.Repeat("x", 2*maxLineLength+1)
+	log := long + "\n" +
+		"2019-10-01T11:00:00Z old " + long + "\n" +
+		"2019-10-01T12:00:00Z new " + long + "\n" +
+		// the second chunk of this line starts with something looking like a timestamp
+		"2019-10-01T11:00:00Z " + long[:maxLineLength-21] + "2019-10-01T12:00:00Z rest of the old line\n"
+	window := TimeWindow{Since: time.Date(2019, 10, 1, 12, 0, 0, 0, time.UTC)}
+
+	f := newWindowFilter(ioutil.NopCloser(strings.NewReader(log)), time.RFC3339, window)
+	raw, err := ioutil.ReadAll(f)
+	require.NoError(t, err)
+
+	// long line without timestamp is passed through like any other line without timestamp
+	assert.Equal(t, long+"\n2019-10-01T12:00:00Z new "+long+"\n", string(raw))
+}
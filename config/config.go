@@ -42,6 +42,48 @@ type Config struct {
 	FlagDiagnosticsJobGetSingleURLTimeoutMinutes int      `mapstructure:"diagnostics-url-timeout"`
 	FlagCommandExecTimeoutSec                    int      `mapstructure:"command-exec-timeout"`
 	FlagDiagnosticsBundleFetchersCount           int      `mapstructure:"fetchers-count"`
+	FlagDiagnosticsBundleCollectorsCount         int      `mapstructure:"collectors-count"`
+
+	// bundles retention flags
+	FlagBundleRetentionMaxAgeHours        int     `mapstructure:"bundle-retention-max-age"`
+	FlagBundleRetentionMaxTotalSizeMB     int     `mapstructure:"bundle-retention-max-total-size"`
+	FlagBundleRetentionMaxCount           int     `mapstructure:"bundle-retention-max-count"`
+	FlagBundleRetentionMinFreeDiskPercent float64 `mapstructure:"bundle-retention-min-free-disk"`
+	FlagBundleJanitorIntervalMinutes      int     `mapstructure:"bundle-janitor-interval"`
+	FlagBundleMinFreeSpaceMB              int     `mapstructure:"bundle-min-free-space"`
+
+	// redaction flags
+	FlagRedactionRulesFile      string `mapstructure:"redaction-rules"`
+	FlagNoDefaultRedactionRules bool   `mapstructure:"no-default-redaction-rules"`
+
+	// encryption flags
+	FlagBundleEncryptionRecipients []string `mapstructure:"bundle-encryption-recipients"`
+
+	// export flags
+	FlagBundleExportS3Endpoint        string `mapstructure:"bundle-export-s3-endpoint"`
+	FlagBundleExportS3Region          string `mapstructure:"bundle-export-s3-region"`
+	FlagBundleExportS3Bucket          string `mapstructure:"bundle-export-s3-bucket"`
+	FlagBundleExportS3Prefix          string `mapstructure:"bundle-export-s3-prefix"`
+	FlagBundleExportS3AccessKeyID     string `mapstructure:"bundle-export-s3-access-key-id"`
+	FlagBundleExportS3SecretAccessKey string `mapstructure:"bundle-export-s3-secret-access-key"` // config file only, no flag
+	FlagBundleExportPartSizeMB        int    `mapstructure:"bundle-export-part-size"`
+	FlagBundleExportRetries           int    `mapstructure:"bundle-export-retries"`
+	FlagBundleExportAuto              bool   `mapstructure:"bundle-export-auto"`
+
+	// webhook flags
+	FlagBundleWebhooksFile    string `mapstructure:"bundle-webhooks"`
+	FlagBundleWebhookRetries  int    `mapstructure:"bundle-webhook-retries"`
+	FlagBundleWebhookTimeoutS int    `mapstructure:"bundle-webhook-timeout"`
+
+	// scheduler flags
+	FlagBundleSchedulesFile string `mapstructure:"bundle-schedules"`
+
+	// trigger flags
+	FlagBundleTriggerUnits           []string `mapstructure:"bundle-trigger-units"`
+	FlagBundleTriggerCooldownMinutes int      `mapstructure:"bundle-trigger-cooldown"`
+	FlagBundleTriggerCollectors      []string `mapstructure:"bundle-trigger-collectors"`
+	FlagBundleTriggerSinceMinutes    int      `mapstructure:"bundle-trigger-since"`
+	FlagBundleTriggerMaxConcurrent   int      `mapstructure:"bundle-trigger-max-concurrent"`
 }
 
 func (c Config) GetSingleEntryTimeout() time.Duration {
@@ -0,0 +1,74 @@
+package cron
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNext(t *testing.T) {
+	// Friday
+	now := time.Date(2020, 5, 15, 13, 45, 30, 0, time.UTC)
+
+	for _, tc := range []struct {
+		spec string
+		next time.Time
+	}{
+		{spec: "* * * * *", next: time.Date(2020, 5, 15, 13, 46, 0, 0, time.UTC)},
+		{spec: "*/15 * * * *", next: time.Date(2020, 5, 15, 14, 0, 0, 0, time.UTC)},
+		{spec: "5/20 * * * *", next: time.Date(2020, 5, 15, 14, 5, 0, 0, time.UTC)},
+		{spec: "0 2 * * *", next: time.Date(2020, 5, 16, 2, 0, 0, 0, time.UTC)},
+		{spec: "@daily", next: time.Date(2020, 5, 16, 0, 0, 0, 0, time.UTC)},
+		{spec: "@hourly", next: time.Date(2020, 5, 15, 14, 0, 0, 0, time.UTC)},
+		{spec: "@weekly", next: time.Date(2020, 5, 17, 0, 0, 0, 0, time.UTC)},
+		{spec: "@yearly", next: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{spec: "30 9-17/4 * * mon-fri", next: time.Date(2020, 5, 15, 17, 30, 0, 0, time.UTC)},
+		{spec: "0 0 * * 7", next: time.Date(2020, 5, 17, 0, 0, 0, 0, time.UTC)},
+		{spec: "0 12 1,15 * *", next: time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)},
+		{spec: "0 0 29 feb *", next: time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// either day of month or day of week has to match when both are restricted
+		{spec: "0 0 20 * 1", next: time.Date(2020, 5, 18, 0, 0, 0, 0, time.UTC)},
+		// day of month starting with "*" is not a restriction so both have to match
+		{spec: "0 0 */2 * 1", next: time.Date(2020, 5, 25, 0, 0, 0, 0, time.UTC)},
+		{spec: "0 0 30 2 *", next: time.Time{}},
+	} {
+		s, err := Parse(tc.spec)
+		require.NoError(t, err, tc.spec)
+		assert.Equal(t, tc.next, s.Next(now), tc.spec)
+	}
+}
+
+func TestNextKeepsLocation(t *testing.T) {
+	loc := time.FixedZone("UTC+2", 2*60*60)
+	s, err := Parse("0 2 * * *")
+	require.NoError(t, err)
+
+	next := s.Next(time.Date(2020, 5, 15, 1, 0, 0, 0, time.UTC))
+	assert.Equal(t, time.Date(2020, 5, 15, 2, 0, 0, 0, time.UTC), next)
+
+	next = s.Next(time.Date(2020, 5, 15, 1, 0, 0, 0, loc))
+	assert.Equal(t, time.Date(2020, 5, 15, 2, 0, 0, 0, loc), next)
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, tc := range []struct {
+		spec string
+		err  string
+	}{
+		{spec: "", err: `invalid schedule "": expected 5 fields, got 0`},
+		{spec: "* * * *", err: `invalid schedule "* * * *": expected 5 fields, got 4`},
+		{spec: "60 * * * *", err: `invalid schedule "60 * * * *": invalid minute "60", must be between 0 and 59`},
+		{spec: "* 24 * * *", err: `invalid schedule "* 24 * * *": invalid hour "24", must be between 0 and 23`},
+		{spec: "* * 0 * *", err: `invalid schedule "* * 0 * *": invalid day of month "0", must be between 1 and 31`},
+		{spec: "* * * foo *", err: `invalid schedule "* * * foo *": invalid month "foo", must be between 1 and 12`},
+		{spec: "* * * * 8", err: `invalid schedule "* * * * 8": invalid day of week "8", must be between 0 and 7`},
+		{spec: "*/0 * * * *", err: `invalid schedule "*/0 * * * *": invalid minute step "0"`},
+		{spec: "5-1 * * * *", err: `invalid schedule "5-1 * * * *": invalid minute range "5-1"`},
+		{spec: "@sometimes", err: `invalid schedule "@sometimes": expected 5 fields, got 1`},
+	} {
+		_, err := Parse(tc.spec)
+		assert.EqualError(t, err, tc.err, tc.spec)
+	}
+}
@@ -106,10 +106,10 @@ type findNodesInDNS struct {
 // Agent response json format
 type agentsResponse struct {
 	Agents []struct {
-		Hostname   string `json:"hostname"`
-		Attributes struct {
-			PublicIP string `json:"public_ip"`
-		} `json:"attributes"`
+		ID       string `json:"id"`
+		Hostname string `json:"hostname"`
+		// Attributes values are strings for text attributes and numbers for scalars
+		Attributes map[string]interface{} `json:"attributes"`
 	} `json:"slaves"`
 }
 
@@ -168,13 +168,20 @@ func (f *findNodesInDNS) getMesosAgents() (nodes []Node, err error) {
 	for _, agent := range sr.Agents {
 		role := AgentRole
 
+		attributes := make(map[string]string, len(agent.Attributes))
+		for name, value := range agent.Attributes {
+			attributes[name] = fmt.Sprint(value)
+		}
+
 		// if a node has "attributes": {"public_ip": "true"} we consider it to be a public agent
-		if agent.Attributes.PublicIP == "true" {
+		if attributes["public_ip"] == "true" {
 			role = AgentPublicRole
 		}
 		nodes = append(nodes, Node{
-			Role: role,
-			IP:   agent.Hostname,
+			Role:       role,
+			IP:         agent.Hostname,
+			MesosID:    agent.ID,
+			Attributes: attributes,
 		})
 	}
 	return nodes, nil
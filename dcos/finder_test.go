@@ -76,3 +76,23 @@ func Test_findMastersInExhibitor_FindWithEmptyBody(t *testing.T) {
 	assert.EqualError(t, err, "unexpected end of JSON input")
 	assert.Empty(t, nodes)
 }
+
+func Test_findNodesInDNS_FindAgents(t *testing.T) {
+	getFn := func(url string, duration time.Duration) ([]byte, int, error) {
+		body := `{"slaves": [
+			{"id": "S1", "hostname": "192.0.2.1", "attributes": {"rack": "r12", "cores": 8}},
+			{"id": "S2", "hostname": "192.0.2.2", "attributes": {"public_ip": "true"}}
+		]}`
+		return []byte(body), 200, nil
+	}
+
+	finder := findNodesInDNS{dnsRecord: "localhost", role: AgentRole, getFn: getFn}
+
+	nodes, err := finder.Find()
+
+	assert.NoError(t, err)
+	assert.Equal(t, []Node{
+		{Role: AgentRole, IP: "192.0.2.1", MesosID: "S1", Attributes: map[string]string{"rack": "r12", "cores": "8"}},
+		{Role: AgentPublicRole, IP: "192.0.2.2", MesosID: "S2", Attributes: map[string]string{"public_ip": "true"}},
+	}, nodes)
+}
@@ -49,6 +49,8 @@ type Node struct {
 	Output  map[string]string
 	Units   []Unit `json:",omitempty"`
 	MesosID string
+	// Attributes are Mesos agent attributes e.g., rack or zone, empty for masters
+	Attributes map[string]string `json:",omitempty"`
 }
 
 // Tooler DC/OS specific tools interface.
@@ -0,0 +1,398 @@
+// Package encrypt implements envelope encryption of bundles. Every bundle is encrypted with its own random
+// data key using AES-256-GCM in fixed size chunks. The data key is wrapped with RSA-OAEP for every recipient,
+// so a private key of any recipient decrypts the bundle.
+//
+// Encrypted bundle starts with a magic line followed by a big endian uint32 length of the JSON header
+// and the header itself. Encrypted chunks follow the header. Every chunk nonce contains its sequence number
+// and a flag marking the last chunk, so reordered, removed or truncated chunks are detected.
+package encrypt
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// Extension is appended to names of encrypted bundles
+const Extension = ".enc"
+
+const (
+	magic         = "DCOS-DIAGNOSTICS-ENCRYPTED-BUNDLE-1\n"
+	chunkSize     = 64 * 1024
+	dataKeySize   = 32 // AES-256
+	maxHeaderSize = 1024 * 1024
+	minKeyBits    = 2048
+)
+
+// oaepLabel binds wrapped keys to this format
+var oaepLabel = []byte("dcos-diagnostics bundle data key")
+
+// Recipient is an owner of the RSA key pair the bundle is encrypted for
+type Recipient struct {
+	// ID is hex encoded SHA-256 of the recipient public key in PKIX form
+	ID  string
+	key *rsa.PublicKey
+}
+
+// header describes how the data key is wrapped for every recipient
+type header struct {
+	Recipients []wrappedKey `json:"recipients"`
+}
+
+type wrappedKey struct {
+	ID  string `json:"id"`
+	Key []byte `json:"key"` // data key encrypted with RSA-OAEP SHA-256
+}
+
+// ParseRecipient returns recipient of the PEM encoded RSA public key
+func ParseRecipient(data []byte) (Recipient, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return Recipient{}, fmt.Errorf("no PEM encoded public key found")
+	}
+
+	var key *rsa.PublicKey
+	switch block.Type {
+	case "PUBLIC KEY":
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return Recipient{}, fmt.Errorf("could not parse public key: %s", err)
+		}
+		rsaKey, ok := parsed.(*rsa.PublicKey)
+		if !ok {
+			return Recipient{}, fmt.Errorf("public key is %T, only RSA keys are supported", parsed)
+		}
+		key = rsaKey
+	case "RSA PUBLIC KEY":
+		parsed, err := x509.ParsePKCS1PublicKey(block.Bytes)
+		if err != nil {
+			return Recipient{}, fmt.Errorf("could not parse public key: %s", err)
+		}
+		key = parsed
+	default:
+		return Recipient{}, fmt.Errorf("unsupported PEM block %q, must be PUBLIC KEY or RSA PUBLIC KEY", block.Type)
+	}
+
+	if key.N.BitLen() < minKeyBits {
+		return Recipient{}, fmt.Errorf("public key has %d bits, at least %d are required", key.N.BitLen(), minKeyBits)
+	}
+	id, err := keyID(key)
+	if err != nil {
+		return Recipient{}, err
+	}
+	return Recipient{ID: id, key: key}, nil
+}
+
+// LoadRecipients reads PEM encoded RSA public keys from given files
+func LoadRecipients(paths []string) ([]Recipient, error) {
+	recipients := make([]Recipient, 0, len(paths))
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not read recipient public key: %s", err)
+		}
+		r, err := ParseRecipient(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid recipient public key %s: %s", path, err)
+		}
+		recipients = append(recipients, r)
+	}
+	return recipients, nil
+}
+
+// ParsePrivateKey returns PEM encoded RSA private key in PKCS #1 or PKCS #8 form
+func ParsePrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM encoded private key found")
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse private key: %s", err)
+		}
+		return key, nil
+	case "PRIVATE KEY":
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse private key: %s", err)
+		}
+		key, ok := parsed.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("private key is %T, only RSA keys are supported", parsed)
+		}
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported PEM block %q, must be PRIVATE KEY or RSA PRIVATE KEY", block.Type)
+}
+
+// LoadPrivateKey reads PEM encoded RSA private key from the given file
+func LoadPrivateKey(path string) (*rsa.PrivateKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read private key: %s", err)
+	}
+	key, err := ParsePrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key %s: %s", path, err)
+	}
+	return key, nil
+}
+
+// IsEncrypted checks if the file in the given path is an encrypted bundle
+func IsEncrypted(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	prefix := make([]byte, len(magic))
+	if _, err := io.ReadFull(f, prefix); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return false, nil
+		}
+		return false, err
+	}
+	return string(prefix) == magic, nil
+}
+
+func keyID(key *rsa.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return "", fmt.Errorf("could not marshal public key: %s", err)
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// nonce returns nonce of the chunk with given sequence number
+func nonce(size int, counter uint64, last bool) []byte {
+	n := make([]byte, size)
+	binary.BigEndian.PutUint64(n[size-9:size-1], counter)
+	if last {
+		n[size-1] = 1
+	}
+	return n
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Writer encrypts data written to it. Close must be called to write the last chunk.
+type Writer struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	buf     []byte // plaintext of not yet encrypted chunks
+	counter uint64
+	closed  bool
+	err     error
+}
+
+// NewWriter writes the header with the data key wrapped for every recipient and returns writer
+// encrypting data written to w
+func NewWriter(w io.Writer, recipients []Recipient) (*Writer, error) {
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("at least one recipient is required")
+	}
+
+	dataKey := make([]byte, dataKeySize)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, fmt.Errorf("could not generate data key: %s", err)
+	}
+
+	h := header{Recipients: make([]wrappedKey, 0, len(recipients))}
+	for _, r := range recipients {
+		wrapped, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, r.key, dataKey, oaepLabel)
+		if err != nil {
+			return nil, fmt.Errorf("could not wrap data key for recipient %s: %s", r.ID, err)
+		}
+		h.Recipients = append(h.Recipients, wrappedKey{ID: r.ID, Key: wrapped})
+	}
+	rawHeader, err := json.Marshal(h)
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal header: %s", err)
+	}
+
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("could not create cipher: %s", err)
+	}
+
+	b := &bytes.Buffer{}
+	b.WriteString(magic)
+	_ = binary.Write(b, binary.BigEndian, uint32(len(rawHeader)))
+	b.Write(rawHeader)
+	if _, err := w.Write(b.Bytes()); err != nil {
+		return nil, fmt.Errorf("could not write header: %s", err)
+	}
+
+	return &Writer{w: w, aead: aead, buf: make([]byte, 0, 2*chunkSize)}, nil
+}
+
+// Write encrypts p. Chunks are encrypted only when more data follows them, so the last chunk
+// is always encrypted by Close.
+func (e *Writer) Write(p []byte) (int, error) {
+	if e.closed {
+		return 0, fmt.Errorf("write to closed writer")
+	}
+	if e.err != nil {
+		return 0, e.err
+	}
+
+	e.buf = append(e.buf, p...)
+	for len(e.buf) > chunkSize {
+		if err := e.seal(e.buf[:chunkSize], false); err != nil {
+			return 0, err
+		}
+		e.buf = e.buf[:copy(e.buf, e.buf[chunkSize:])]
+	}
+	return len(p), nil
+}
+
+// Close encrypts the last chunk. It does not close the underlying writer.
+func (e *Writer) Close() error {
+	if e.closed {
+		return e.err
+	}
+	e.closed = true
+	if e.err != nil {
+		return e.err
+	}
+	return e.seal(e.buf, true)
+}
+
+func (e *Writer) seal(plaintext []byte, last bool) error {
+	sealed := e.aead.Seal(nil, nonce(e.aead.NonceSize(), e.counter, last), plaintext, nil)
+	e.counter++
+	if _, err := e.w.Write(sealed); err != nil {
+		e.err = err
+		return err
+	}
+	return nil
+}
+
+// Reader decrypts data read from the underlying reader
+type Reader struct {
+	r       *bufio.Reader
+	aead    cipher.AEAD
+	chunk   []byte
+	buf     []byte // decrypted but not yet read data
+	counter uint64
+	done    bool
+	err     error
+}
+
+// NewReader reads the header, unwraps the data key with the given private key and returns reader
+// decrypting data read from r
+func NewReader(r io.Reader, key *rsa.PrivateKey) (*Reader, error) {
+	br := bufio.NewReader(r)
+
+	prefix := make([]byte, len(magic))
+	if _, err := io.ReadFull(br, prefix); err != nil || string(prefix) != magic {
+		return nil, fmt.Errorf("not an encrypted bundle")
+	}
+
+	var headerSize uint32
+	if err := binary.Read(br, binary.BigEndian, &headerSize); err != nil {
+		return nil, fmt.Errorf("could not read header: %s", err)
+	}
+	if headerSize > maxHeaderSize {
+		return nil, fmt.Errorf("could not read header: header has %d bytes", headerSize)
+	}
+	rawHeader := make([]byte, headerSize)
+	if _, err := io.ReadFull(br, rawHeader); err != nil {
+		return nil, fmt.Errorf("could not read header: %s", err)
+	}
+	h := header{}
+	if err := json.Unmarshal(rawHeader, &h); err != nil {
+		return nil, fmt.Errorf("could not read header: %s", err)
+	}
+
+	id, err := keyID(&key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	var dataKey []byte
+	for _, wrapped := range h.Recipients {
+		if wrapped.ID != id {
+			continue
+		}
+		dataKey, err = rsa.DecryptOAEP(sha256.New(), rand.Reader, key, wrapped.Key, oaepLabel)
+		if err != nil {
+			return nil, fmt.Errorf("could not unwrap data key: %s", err)
+		}
+	}
+	if dataKey == nil {
+		return nil, fmt.Errorf("bundle is not encrypted for key %s", id)
+	}
+
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("could not create cipher: %s", err)
+	}
+
+	return &Reader{r: br, aead: aead, chunk: make([]byte, chunkSize+aead.Overhead())}, nil
+}
+
+func (d *Reader) Read(p []byte) (int, error) {
+	for len(d.buf) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		if d.done {
+			return 0, io.EOF
+		}
+		d.err = d.open()
+	}
+
+	n := copy(p, d.buf)
+	d.buf = d.buf[n:]
+	return n, nil
+}
+
+// open decrypts the next chunk. Only the last chunk is shorter than others
+// and it's always followed by the end of data.
+func (d *Reader) open() error {
+	n, err := io.ReadFull(d.r, d.chunk)
+	last := false
+	switch err {
+	case nil:
+		if _, e := d.r.Peek(1); e == io.EOF {
+			last = true
+		}
+	case io.EOF, io.ErrUnexpectedEOF:
+		last = true
+	default:
+		return err
+	}
+
+	plaintext, err := d.aead.Open(d.chunk[:0], nonce(d.aead.NonceSize(), d.counter, last), d.chunk[:n], nil)
+	if err != nil {
+		return fmt.Errorf("bundle is corrupted or truncated: chunk %d could not be decrypted", d.counter)
+	}
+	d.counter++
+	d.buf = plaintext
+	d.done = last
+	return nil
+}
@@ -0,0 +1,159 @@
+package encrypt_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dcos/dcos-diagnostics/encrypt"
+	"github.com/dcos/dcos-diagnostics/encrypt/encrypttest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func encryptData(t *testing.T, data []byte, recipients ...encrypt.Recipient) []byte {
+	b := &bytes.Buffer{}
+	w, err := encrypt.NewWriter(b, recipients)
+	require.NoError(t, err)
+	// odd write sizes check chunks are split correctly
+	for len(data) > 0 {
+		n := 1000
+		if n > len(data) {
+			n = len(data)
+		}
+		_, err := w.Write(data[:n])
+		require.NoError(t, err)
+		data = data[n:]
+	}
+	require.NoError(t, w.Close())
+	return b.Bytes()
+}
+
+func decrypt(encrypted []byte, key *rsa.PrivateKey) ([]byte, error) {
+	r, err := encrypt.NewReader(bytes.NewReader(encrypted), key)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(r)
+}
+
+func TestEncryptDecryptRoundTrip(t *testing.T) {
+	key, recipient := encrypttest.GenerateKey(t)
+
+	for _, size := range []int{0, 1, encrypt.ChunkSize - 1, encrypt.ChunkSize, encrypt.ChunkSize + 1, 3*encrypt.ChunkSize + 5} {
+		data := make([]byte, size)
+		_, err := rand.Read(data)
+		require.NoError(t, err)
+
+		encrypted := encryptData(t, data, recipient)
+		if size > 100 {
+			assert.NotContains(t, string(encrypted), string(data[:100]))
+		}
+
+		decrypted, err := decrypt(encrypted, key)
+		require.NoError(t, err, "size %d", size)
+		assert.Equal(t, data, decrypted, "size %d", size)
+	}
+}
+
+func TestEveryRecipientCouldDecrypt(t *testing.T) {
+	key1, recipient1 := encrypttest.GenerateKey(t)
+	key2, recipient2 := encrypttest.GenerateKey(t)
+	other, _ := encrypttest.GenerateKey(t)
+
+	encrypted := encryptData(t, []byte("secret data"), recipient1, recipient2)
+
+	for _, key := range []*rsa.PrivateKey{key1, key2} {
+		decrypted, err := decrypt(encrypted, key)
+		require.NoError(t, err)
+		assert.Equal(t, "secret data", string(decrypted))
+	}
+
+	_, err := decrypt(encrypted, other)
+	assert.Contains(t, err.Error(), "bundle is not encrypted for key ")
+}
+
+func TestDecryptDetectsTamperingAndTruncation(t *testing.T) {
+	key, recipient := encrypttest.GenerateKey(t)
+	data := bytes.Repeat([]byte("test\n"), (4*encrypt.ChunkSize+100)/5)
+	encrypted := encryptData(t, data, recipient)
+
+	tampered := append([]byte{}, encrypted...)
+	tampered[len(tampered)-100] ^= 1
+	_, err := decrypt(tampered, key)
+	assert.EqualError(t, err, "bundle is corrupted or truncated: chunk 4 could not be decrypted")
+
+	// full chunks are cut, so the last remaining chunk is not marked as the last one
+	overhead := 16
+	lastChunk := len(data)%encrypt.ChunkSize + overhead
+	_, err = decrypt(encrypted[:len(encrypted)-lastChunk], key)
+	assert.EqualError(t, err, "bundle is corrupted or truncated: chunk 3 could not be decrypted")
+
+	_, err = decrypt([]byte("PK\x03\x04"), key)
+	assert.EqualError(t, err, "not an encrypted bundle")
+}
+
+func TestNewWriterRequiresRecipients(t *testing.T) {
+	_, err := encrypt.NewWriter(&bytes.Buffer{}, nil)
+	assert.EqualError(t, err, "at least one recipient is required")
+}
+
+func TestParseRecipientRejectsInvalidKeys(t *testing.T) {
+	_, err := encrypt.ParseRecipient([]byte("not a key"))
+	assert.EqualError(t, err, "no PEM encoded public key found")
+
+	_, err = encrypt.ParseRecipient(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("test")}))
+	assert.EqualError(t, err, `unsupported PEM block "CERTIFICATE", must be PUBLIC KEY or RSA PUBLIC KEY`)
+
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	_, err = encrypt.ParseRecipient(pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&key.PublicKey)}))
+	assert.EqualError(t, err, "public key has 1024 bits, at least 2048 are required")
+}
+
+func TestLoadKeysAndDetectEncryptedFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keys")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	privatePath := filepath.Join(dir, "private.pem")
+	require.NoError(t, ioutil.WriteFile(privatePath,
+		pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), 0600))
+	publicPath := filepath.Join(dir, "public.pem")
+	require.NoError(t, ioutil.WriteFile(publicPath,
+		pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&key.PublicKey)}), 0600))
+
+	recipients, err := encrypt.LoadRecipients([]string{publicPath})
+	require.NoError(t, err)
+	loaded, err := encrypt.LoadPrivateKey(privatePath)
+	require.NoError(t, err)
+
+	encryptedPath := filepath.Join(dir, "bundle.zip.enc")
+	require.NoError(t, ioutil.WriteFile(encryptedPath, encryptData(t, []byte("data"), recipients...), 0600))
+
+	encrypted, err := encrypt.IsEncrypted(encryptedPath)
+	require.NoError(t, err)
+	assert.True(t, encrypted)
+	encrypted, err = encrypt.IsEncrypted(publicPath)
+	require.NoError(t, err)
+	assert.False(t, encrypted)
+
+	raw, err := ioutil.ReadFile(encryptedPath)
+	require.NoError(t, err)
+	decrypted, err := decrypt(raw, loaded)
+	require.NoError(t, err)
+	assert.Equal(t, "data", string(decrypted))
+
+	_, err = encrypt.LoadRecipients([]string{privatePath})
+	assert.EqualError(t, err, "invalid recipient public key "+privatePath+
+		`: unsupported PEM block "RSA PRIVATE KEY", must be PUBLIC KEY or RSA PUBLIC KEY`)
+}
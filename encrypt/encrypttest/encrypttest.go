@@ -0,0 +1,29 @@
+// Package encrypttest provides keys for tests of encrypted bundles.
+package encrypttest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/dcos/dcos-diagnostics/encrypt"
+)
+
+// GenerateKey returns a new 2048 bit RSA key and the recipient of its public key
+func GenerateKey(t *testing.T) (*rsa.PrivateKey, encrypt.Recipient) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("could not generate key: %s", err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("could not marshal public key: %s", err)
+	}
+	r, err := encrypt.ParseRecipient(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	if err != nil {
+		t.Fatalf("could not parse public key: %s", err)
+	}
+	return key, r
+}
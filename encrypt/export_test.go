@@ -0,0 +1,4 @@
+package encrypt
+
+// ChunkSize exports the size of encrypted chunks to tests
+const ChunkSize = chunkSize
@@ -0,0 +1,344 @@
+// Package export uploads bundles to S3 compatible object storage.
+package export
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// MinPartSize is the smallest part of multipart upload accepted by S3, only the last part could be smaller
+	MinPartSize = 5 * 1024 * 1024
+	// maxParts is the maximum number of parts of a single multipart upload
+	maxParts = 10000
+
+	algorithm   = "AWS4-HMAC-SHA256"
+	service     = "s3"
+	amzDateTime = "20060102T150405Z"
+	amzDate     = "20060102"
+)
+
+// S3Config describes where and how bundles are uploaded
+type S3Config struct {
+	Endpoint        string // base URL of the storage e.g., https://s3.us-east-1.amazonaws.com or http://minio:9000
+	Region          string
+	Bucket          string
+	Prefix          string // prepended to every object key
+	AccessKeyID     string
+	SecretAccessKey string
+	PartSize        int64 // size of a single part of multipart upload in bytes
+	MaxRetries      int   // how many times a failed request is retried
+}
+
+// S3 uploads files with multipart upload. Buckets are addressed with the path style
+// (endpoint/bucket/key) that is supported by AWS and S3 compatible storages like MinIO.
+type S3 struct {
+	cfg        S3Config
+	endpoint   *url.URL
+	client     *http.Client
+	clock      func() time.Time
+	retryDelay time.Duration
+}
+
+// NewS3 returns uploader configured with the given config. Requests are sent with the given client.
+func NewS3(cfg S3Config, client *http.Client) (*S3, error) {
+	endpoint, err := url.Parse(strings.TrimSuffix(cfg.Endpoint, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid endpoint %q: %s", cfg.Endpoint, err)
+	}
+	if endpoint.Scheme != "http" && endpoint.Scheme != "https" {
+		return nil, fmt.Errorf("invalid endpoint %q: scheme must be http or https", cfg.Endpoint)
+	}
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("bucket is required")
+	}
+	if cfg.Region == "" {
+		return nil, fmt.Errorf("region is required")
+	}
+	if cfg.AccessKeyID == "" || cfg.SecretAccessKey == "" {
+		return nil, fmt.Errorf("access key ID and secret access key are required")
+	}
+	if cfg.PartSize < MinPartSize {
+		return nil, fmt.Errorf("part size must be at least %d bytes, got %d", MinPartSize, cfg.PartSize)
+	}
+	if cfg.MaxRetries < 0 {
+		return nil, fmt.Errorf("max retries must not be negative, got %d", cfg.MaxRetries)
+	}
+
+	return &S3{
+		cfg:        cfg,
+		endpoint:   endpoint,
+		client:     client,
+		clock:      time.Now,
+		retryDelay: time.Second,
+	}, nil
+}
+
+// Upload stores size bytes read from r as an object named after the configured prefix and the given name.
+// Returns the key of the uploaded object. Unfinished upload is aborted so it does not use storage.
+func (s *S3) Upload(ctx context.Context, name string, r io.ReaderAt, size int64) (string, error) {
+	key := s.cfg.Prefix + name
+
+	uploadID, err := s.createMultipartUpload(ctx, key)
+	if err != nil {
+		return key, err
+	}
+
+	parts, err := s.uploadParts(ctx, key, uploadID, r, size)
+	if err == nil {
+		err = s.completeMultipartUpload(ctx, key, uploadID, parts)
+	}
+	if err != nil {
+		// the context could be already done so abort gets its own time
+		abortCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		if e := s.abortMultipartUpload(abortCtx, key, uploadID); e != nil {
+			err = fmt.Errorf("%s (abort failed: %s)", err, e)
+		}
+		return key, err
+	}
+
+	return key, nil
+}
+
+type initiateMultipartUploadResult struct {
+	UploadID string `xml:"UploadId"`
+}
+
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+type completeMultipartUpload struct {
+	XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+	Parts   []completedPart `xml:"Part"`
+}
+
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+func (s *S3) createMultipartUpload(ctx context.Context, key string) (string, error) {
+	body, _, err := s.do(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, nil)
+	if err != nil {
+		return "", fmt.Errorf("could not start upload of %s: %s", key, err)
+	}
+	result := initiateMultipartUploadResult{}
+	if err := xml.Unmarshal(body, &result); err != nil || result.UploadID == "" {
+		return "", fmt.Errorf("could not start upload of %s: invalid response %q", key, body)
+	}
+	return result.UploadID, nil
+}
+
+func (s *S3) uploadParts(ctx context.Context, key, uploadID string, r io.ReaderAt, size int64) ([]completedPart, error) {
+	partSize := s.cfg.PartSize
+	if size > partSize*maxParts {
+		partSize = (size + maxParts - 1) / maxParts
+	}
+
+	var parts []completedPart
+	buf := make([]byte, partSize)
+	for offset, number := int64(0), 1; offset < size || number == 1; offset, number = offset+partSize, number+1 {
+		n := partSize
+		if size-offset < n {
+			n = size - offset
+		}
+		part := buf[:n]
+		if _, err := r.ReadAt(part, offset); err != nil && err != io.EOF {
+			return nil, fmt.Errorf("could not read part %d of %s: %s", number, key, err)
+		}
+
+		query := url.Values{"partNumber": {fmt.Sprint(number)}, "uploadId": {uploadID}}
+		_, header, err := s.do(ctx, http.MethodPut, key, query, part)
+		if err != nil {
+			return nil, fmt.Errorf("could not upload part %d of %s: %s", number, key, err)
+		}
+		parts = append(parts, completedPart{PartNumber: number, ETag: header.Get("ETag")})
+	}
+	return parts, nil
+}
+
+func (s *S3) completeMultipartUpload(ctx context.Context, key, uploadID string, parts []completedPart) error {
+	payload, err := xml.Marshal(completeMultipartUpload{Parts: parts})
+	if err != nil {
+		return fmt.Errorf("could not complete upload of %s: %s", key, err)
+	}
+	body, _, err := s.do(ctx, http.MethodPost, key, url.Values{"uploadId": {uploadID}}, payload)
+	if err != nil {
+		return fmt.Errorf("could not complete upload of %s: %s", key, err)
+	}
+	// S3 could report an error with 200 OK when it fails after the response is started
+	if e := parseError(body); e != nil {
+		return fmt.Errorf("could not complete upload of %s: %s", key, e)
+	}
+	return nil
+}
+
+func (s *S3) abortMultipartUpload(ctx context.Context, key, uploadID string) error {
+	_, _, err := s.do(ctx, http.MethodDelete, key, url.Values{"uploadId": {uploadID}}, nil)
+	return err
+}
+
+// do sends signed request and returns body of successful response. Network errors,
+// throttling and server errors are retried.
+func (s *S3) do(ctx context.Context, method, key string, query url.Values, payload []byte) ([]byte, http.Header, error) {
+	var err error
+	for attempt := 0; attempt <= s.cfg.MaxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return nil, nil, ctx.Err()
+			case <-time.After(s.retryDelay << uint(attempt-1)):
+			}
+		}
+
+		var body []byte
+		var header http.Header
+		var retry bool
+		body, header, retry, err = s.send(ctx, method, key, query, payload)
+		if err == nil {
+			return body, header, nil
+		}
+		if !retry || ctx.Err() != nil {
+			return nil, nil, err
+		}
+	}
+	return nil, nil, err
+}
+
+func (s *S3) send(ctx context.Context, method, key string, query url.Values, payload []byte) ([]byte, http.Header, bool, error) {
+	req, err := s.newRequest(ctx, method, key, query, payload)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, nil, true, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, true, err
+	}
+
+	if resp.StatusCode/100 != 2 {
+		retry := resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests
+		if e := parseError(body); e != nil {
+			return nil, nil, retry, fmt.Errorf("%s %s: %s", method, key, e)
+		}
+		return nil, nil, retry, fmt.Errorf("%s %s: unexpected status code %d", method, key, resp.StatusCode)
+	}
+
+	return body, resp.Header, false, nil
+}
+
+func parseError(body []byte) error {
+	e := s3Error{}
+	if err := xml.Unmarshal(body, &e); err != nil || e.Code == "" {
+		return nil
+	}
+	return fmt.Errorf("%s: %s", e.Code, e.Message)
+}
+
+// newRequest creates request signed with AWS Signature Version 4
+func (s *S3) newRequest(ctx context.Context, method, key string, query url.Values, payload []byte) (*http.Request, error) {
+	path := s.endpoint.EscapedPath() + "/" + uriEncode(s.cfg.Bucket, false) + "/" + uriEncode(key, true)
+	rawQuery := canonicalQuery(query)
+	req, err := http.NewRequest(method, s.endpoint.Scheme+"://"+s.endpoint.Host+path+"?"+rawQuery, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+
+	now := s.clock().UTC()
+	payloadHash := sha256.Sum256(payload)
+	req.Header.Set("X-Amz-Date", now.Format(amzDateTime))
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		method,
+		path,
+		rawQuery,
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + req.Header.Get("X-Amz-Content-Sha256"),
+		"x-amz-date:" + req.Header.Get("X-Amz-Date"),
+		"",
+		signedHeaders,
+		req.Header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+	canonicalRequestHash := sha256.Sum256([]byte(canonicalRequest))
+
+	scope := strings.Join([]string{now.Format(amzDate), s.cfg.Region, service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{
+		algorithm,
+		now.Format(amzDateTime),
+		scope,
+		hex.EncodeToString(canonicalRequestHash[:]),
+	}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+s.cfg.SecretAccessKey), now.Format(amzDate))
+	for _, part := range []string{s.cfg.Region, service, "aws4_request"} {
+		signingKey = hmacSHA256(signingKey, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		algorithm, s.cfg.AccessKeyID, scope, signedHeaders, signature))
+	return req, nil
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	params := make([]string, 0, len(keys))
+	for _, k := range keys {
+		for _, v := range query[k] {
+			params = append(params, uriEncode(k, false)+"="+uriEncode(v, false))
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+// uriEncode encodes everything except unreserved characters as required by the signature.
+// Slashes are kept when encoding object keys.
+func uriEncode(s string, keepSlash bool) string {
+	b := strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && keepSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -1,7 +1,6 @@
 package fetcher
 
 import (
-	"archive/zip"
 	"compress/gzip"
 	"context"
 	"fmt"
@@ -13,6 +12,7 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/dcos/dcos-diagnostics/archive"
 	"github.com/dcos/dcos-diagnostics/dcos"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
@@ -69,15 +69,17 @@ func New(
 	return fetcher, nil
 }
 
-// Run starts fetcher. This method should be run as a goroutine
+// Run starts fetcher. This method should be run as a goroutine. Fetched data is always stored as zip
+// because sizes of fetched files are not known upfront.
 func (f *Fetcher) Run(ctx context.Context) {
-	zipWriter := zip.NewWriter(f.file)
-
-	f.workOffRequests(ctx, zipWriter)
+	zipWriter, err := archive.NewWriter(archive.Zip, f.file)
+	if err == nil {
+		f.workOffRequests(ctx, zipWriter)
+		err = zipWriter.Close()
+	}
 
 	filename := f.file.Name()
 
-	err := zipWriter.Close()
 	if err != nil {
 		err = fmt.Errorf("could not close zip writer %s: %s", f.file.Name(), err)
 	}
@@ -90,7 +92,7 @@ func (f *Fetcher) Run(ctx context.Context) {
 	}
 }
 
-func (f *Fetcher) workOffRequests(ctx context.Context, zipWriter *zip.Writer) {
+func (f *Fetcher) workOffRequests(ctx context.Context, zipWriter archive.Writer) {
 	for {
 		select {
 		case <-ctx.Done():
@@ -113,7 +115,7 @@ func (f *Fetcher) workOffRequests(ctx context.Context, zipWriter *zip.Writer) {
 	}
 }
 
-func (f *Fetcher) getDataToZip(ctx context.Context, r EndpointRequest, zipWriter *zip.Writer) error {
+func (f *Fetcher) getDataToZip(ctx context.Context, r EndpointRequest, zipWriter archive.Writer) error {
 	start := time.Now()
 
 	resp, err := get(ctx, f.client, r.URL)
@@ -134,7 +136,7 @@ func (f *Fetcher) getDataToZip(ctx context.Context, r EndpointRequest, zipWriter
 	}
 
 	filename := filepath.Join(r.Node.IP+"_"+r.Node.Role, r.FileName)
-	zipFile, err := zipWriter.Create(filename)
+	zipFile, err := zipWriter.Create(archive.Header{Name: filename, Size: -1, Modified: time.Now()})
 	if err != nil {
 		return fmt.Errorf("could not create a %s in the zip: %s", filename, err)
 	}
@@ -0,0 +1,185 @@
+package redact
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+)
+
+// Redacted replaces sensitive data
+const Redacted = "[REDACTED]"
+
+// maxLineLength is the number of bytes of a line kept in memory. Longer lines are redacted in chunks
+// of this size so secrets split between chunks are not redacted.
+const maxLineLength = 1024 * 1024
+
+// secretGroup is a name of the regular expression group that should be redacted
+const secretGroup = "secret"
+
+// jsonStringField matches JSON object fields with string values
+var jsonStringField = regexp.MustCompile(`"((?:[^"\\]|\\.)*)"\s*:\s*"(?P<secret>(?:[^"\\]|\\.)*)"`)
+
+// Rule describes sensitive data. Exactly one of Pattern or Key must be set.
+type Rule struct {
+	Name string `json:"name"`
+	// Pattern is a regular expression matched against every line. When it contains a group
+	// named "secret" only the group is redacted, otherwise the whole match is redacted.
+	Pattern string `json:"pattern,omitempty"`
+	// Key is a regular expression matched against whole JSON object keys.
+	// String values of matching keys are redacted.
+	Key string `json:"key,omitempty"`
+}
+
+type rule struct {
+	pattern *regexp.Regexp
+	group   int // index of the secret group, 0 when whole match is redacted
+	key     *regexp.Regexp
+}
+
+// Redactor removes sensitive data from collected streams. It is safe to use it from multiple goroutines.
+type Redactor struct {
+	rules []rule
+}
+
+// New compiles given rules
+func New(rules []Rule) (*Redactor, error) {
+	r := &Redactor{rules: make([]rule, 0, len(rules))}
+	for _, rl := range rules {
+		compiled, err := compile(rl)
+		if err != nil {
+			return nil, err
+		}
+		r.rules = append(r.rules, compiled)
+	}
+	return r, nil
+}
+
+func compile(r Rule) (rule, error) {
+	if (r.Pattern == "") == (r.Key == "") {
+		return rule{}, fmt.Errorf("redaction rule %q must have either pattern or key", r.Name)
+	}
+	if r.Key != "" {
+		key, err := regexp.Compile("^(?:" + r.Key + ")$")
+		if err != nil {
+			return rule{}, fmt.Errorf("invalid key of redaction rule %q: %s", r.Name, err)
+		}
+		return rule{pattern: jsonStringField, group: secretGroupIndex(jsonStringField), key: key}, nil
+	}
+	pattern, err := regexp.Compile(r.Pattern)
+	if err != nil {
+		return rule{}, fmt.Errorf("invalid pattern of redaction rule %q: %s", r.Name, err)
+	}
+	return rule{pattern: pattern, group: secretGroupIndex(pattern)}, nil
+}
+
+func secretGroupIndex(pattern *regexp.Regexp) int {
+	for i, name := range pattern.SubexpNames() {
+		if name == secretGroup {
+			return i
+		}
+	}
+	return 0
+}
+
+// LoadRules reads rules from a JSON file containing an array of rules
+func LoadRules(path string) ([]Rule, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read redaction rules: %s", err)
+	}
+	var rules []Rule
+	if err := json.Unmarshal(content, &rules); err != nil {
+		return nil, fmt.Errorf("could not parse redaction rules %s: %s", path, err)
+	}
+	return rules, nil
+}
+
+// Line returns the line with sensitive data redacted and the number of redactions
+func (r *Redactor) Line(line []byte) ([]byte, int) {
+	count := 0
+	for _, rl := range r.rules {
+		var n int
+		line, n = rl.redact(line)
+		count += n
+	}
+	return line, count
+}
+
+func (r rule) redact(line []byte) ([]byte, int) {
+	matches := r.pattern.FindAllSubmatchIndex(line, -1)
+	if len(matches) == 0 {
+		return line, 0
+	}
+
+	redacted := make([]byte, 0, len(line))
+	count := 0
+	last := 0
+	for _, m := range matches {
+		start, end := m[0], m[1]
+		if r.group > 0 {
+			start, end = m[2*r.group], m[2*r.group+1]
+		}
+		if r.key != nil && !r.key.Match(line[m[2]:m[3]]) {
+			continue
+		}
+		if start < 0 || start == end || string(line[start:end]) == Redacted {
+			continue
+		}
+		redacted = append(redacted, line[last:start]...)
+		redacted = append(redacted, Redacted...)
+		last = end
+		count++
+	}
+	return append(redacted, line[last:]...), count
+}
+
+// Reader returns a reader redacting every line read from rc.
+func (r *Redactor) Reader(rc io.ReadCloser) *Reader {
+	return &Reader{src: rc, r: bufio.NewReaderSize(rc, maxLineLength), redactor: r}
+}
+
+// Reader redacts sensitive data line by line. Whole line is kept in memory
+// so secrets are never split between reads unless the line exceeds maxLineLength.
+type Reader struct {
+	src      io.ReadCloser
+	r        *bufio.Reader
+	redactor *Redactor
+	line     []byte
+	count    int
+	err      error
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	for len(r.line) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		// the line is read into the reader's buffer which is not reused until the line is consumed
+		line, err := r.r.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			err = nil
+		}
+		r.err = err
+		if len(line) > 0 {
+			var n int
+			r.line, n = r.redactor.Line(line)
+			r.count += n
+		}
+	}
+
+	n := copy(p, r.line)
+	r.line = r.line[n:]
+	return n, nil
+}
+
+func (r *Reader) Close() error {
+	return r.src.Close()
+}
+
+// Redactions returns the number of redactions made so far
+func (r *Reader) Redactions() int {
+	return r.count
+}
@@ -0,0 +1,43 @@
+package redact
+
+// DefaultRules cover common secret formats found in command outputs, logs, configs and Mesos state
+var DefaultRules = []Rule{
+	{
+		Name: "json-secret-keys",
+		Key:  `(?i).*(password|passwd|secret|token|credential|api[_-]?key|access[_-]?key|private[_-]?key).*`,
+	},
+	{
+		// Mesos task environment variables e.g., {"name":"DB_PASSWORD","type":"VALUE","value":"..."}
+		Name:    "mesos-secret-env-vars",
+		Pattern: `(?i)"name"\s*:\s*"[^"]*(?:password|passwd|secret|token|credential|api_?key|access_?key)[^"]*"\s*,\s*"type"\s*:\s*"VALUE"\s*,\s*"value"\s*:\s*"(?P<secret>(?:[^"\\]|\\.)*)"`,
+	},
+	{
+		Name:    "key-value-secrets",
+		Pattern: `(?i)(?:password|passwd|secret|token|api[_-]?key|access[_-]?key)[\w.-]*\s*[=:]\s*(?P<secret>[^\s"',;&]+)`,
+	},
+	{
+		Name:    "command-line-secrets",
+		Pattern: `(?i)\s--?[\w-]*(?:password|passwd|secret|token)[\w-]*\s+(?P<secret>[^\s-]\S*)`,
+	},
+	{
+		Name:    "url-credentials",
+		Pattern: `[a-zA-Z][a-zA-Z0-9+.-]*://[^:/\s@]+:(?P<secret>[^@/\s]+)@`,
+	},
+	{
+		Name:    "authorization-headers",
+		Pattern: `(?i)\b(?:bearer|basic)\s+(?P<secret>[A-Za-z0-9._~+/-]{16,}=*)`,
+	},
+	{
+		Name:    "jwt",
+		Pattern: `\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`,
+	},
+	{
+		Name:    "aws-access-key-id",
+		Pattern: `\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`,
+	},
+	{
+		// only keys embedded in a single line e.g., in JSON or environment variables
+		Name:    "private-keys",
+		Pattern: `-----BEGIN [A-Z ]*PRIVATE KEY-----(?P<secret>.+?)-----END [A-Z ]*PRIVATE KEY-----`,
+	},
+}
@@ -11,3 +11,13 @@ import (
 func ReadJournalOutputSince(ctx context.Context, unit string, duration time.Duration) (io.ReadCloser, error) {
 	return nil, errors.New("does not work on darwin")
 }
+
+// ReadJournal returns error since darwin does not support journal
+func ReadJournal(ctx context.Context, query JournalQuery) (io.ReadCloser, error) {
+	return nil, errors.New("does not work on darwin")
+}
+
+// ReadJournalJSON returns error since darwin does not support journal
+func ReadJournalJSON(ctx context.Context, query JournalQuery) (io.ReadCloser, error) {
+	return nil, errors.New("does not work on darwin")
+}
@@ -1,8 +1,13 @@
 package units
 
 import (
+	"bufio"
 	"context"
+	"encoding/json"
+	"fmt"
 	goio "io"
+	"sort"
+	"strconv"
 	"time"
 
 	"github.com/coreos/go-systemd/sdjournal"
@@ -15,6 +20,223 @@ func ReadJournalOutputSince(ctx context.Context, unit string, duration time.Dura
 	return readJournalOutput(ctx, unit, duration, 0)
 }
 
+// ReadJournal returns entries selected by the query from journal, every entry is a line with its timestamp and message
+func ReadJournal(ctx context.Context, query JournalQuery) (goio.ReadCloser, error) {
+	return readJournal(ctx, query, func(w goio.Writer) entryWriter {
+		return func(entry *sdjournal.JournalEntry, timestamp time.Time) error {
+			line, err := formatJournalEntry(entry, timestamp)
+			if err != nil {
+				return err
+			}
+			_, err = goio.WriteString(w, line)
+			return err
+		}
+	})
+}
+
+// formatJournalEntry formats entry the same way sdjournal does by default
+func formatJournalEntry(entry *sdjournal.JournalEntry, timestamp time.Time) (string, error) {
+	msg, ok := entry.Fields[sdjournal.SD_JOURNAL_FIELD_MESSAGE]
+	if !ok {
+		return "", fmt.Errorf("no MESSAGE field present in journal entry")
+	}
+	return fmt.Sprintf("%s %s\n", timestamp, msg), nil
+}
+
+// ReadJournalJSON returns entries selected by the query from journal as newline delimited JSON objects
+// with all entry fields, the same way journalctl --output=json does.
+func ReadJournalJSON(ctx context.Context, query JournalQuery) (goio.ReadCloser, error) {
+	return readJournal(ctx, query, func(w goio.Writer) entryWriter {
+		encoder := json.NewEncoder(w)
+		encoder.SetEscapeHTML(false)
+		return func(entry *sdjournal.JournalEntry, _ time.Time) error {
+			return encoder.Encode(journalEntryFields(entry))
+		}
+	})
+}
+
+// journalEntryFields returns all entry fields with the cursor and timestamps added by journal
+func journalEntryFields(entry *sdjournal.JournalEntry) map[string]string {
+	fields := make(map[string]string, len(entry.Fields)+3)
+	for k, v := range entry.Fields {
+		fields[k] = v
+	}
+	fields[sdjournal.SD_JOURNAL_FIELD_CURSOR] = entry.Cursor
+	fields[sdjournal.SD_JOURNAL_FIELD_REALTIME_TIMESTAMP] = strconv.FormatUint(entry.RealtimeTimestamp, 10)
+	fields[sdjournal.SD_JOURNAL_FIELD_MONOTONIC_TIMESTAMP] = strconv.FormatUint(entry.MonotonicTimestamp, 10)
+	return fields
+}
+
+// entryWriter writes a single journal entry logged at the given time
+type entryWriter func(entry *sdjournal.JournalEntry, timestamp time.Time) error
+
+func readJournal(ctx context.Context, query JournalQuery, newWriter func(w goio.Writer) entryWriter) (goio.ReadCloser, error) {
+	j, err := openJournal(query)
+	if err != nil {
+		return nil, err
+	}
+
+	// journal is not safe for concurrent use so only the writing goroutine uses it
+	r, w := goio.Pipe()
+	go func() {
+		defer j.Close()
+		buf := bufio.NewWriter(w)
+		err := writeJournal(ctx, j, query, newWriter(buf))
+		if err == nil {
+			err = buf.Flush()
+		}
+		w.CloseWithError(err)
+	}()
+	return io.ReadCloserWithContext(ctx, r), nil
+}
+
+// openJournal opens journal filtered by query matches and positioned before the first entry to read
+func openJournal(query JournalQuery) (*sdjournal.Journal, error) {
+	j, err := sdjournal.NewJournal()
+	if err != nil {
+		return nil, fmt.Errorf("could not open journal: %s", err)
+	}
+
+	matches, err := journalMatches(j, query)
+	if err != nil {
+		j.Close()
+		return nil, err
+	}
+	// journal joins matches of the same field with OR and matches of different fields with AND
+	for _, m := range matches {
+		if err := j.AddMatch(m.String()); err != nil {
+			j.Close()
+			return nil, fmt.Errorf("could not filter journal: %s", err)
+		}
+	}
+
+	if query.Since.IsZero() {
+		err = j.SeekHead()
+	} else {
+		err = j.SeekRealtimeUsec(uint64(query.Since.UnixNano() / int64(time.Microsecond)))
+	}
+	if err != nil {
+		j.Close()
+		return nil, fmt.Errorf("could not seek journal: %s", err)
+	}
+	return j, nil
+}
+
+func journalMatches(j *sdjournal.Journal, query JournalQuery) ([]sdjournal.Match, error) {
+	var matches []sdjournal.Match
+	if query.Unit != "" {
+		matches = append(matches, sdjournal.Match{Field: sdjournal.SD_JOURNAL_FIELD_SYSTEMD_UNIT, Value: query.Unit})
+	}
+	if query.Transport != "" {
+		matches = append(matches, sdjournal.Match{Field: sdjournal.SD_JOURNAL_FIELD_TRANSPORT, Value: query.Transport})
+	}
+	if query.MaxPriority != nil {
+		for p := PriorityEmerg; p <= *query.MaxPriority; p++ {
+			matches = append(matches, sdjournal.Match{Field: sdjournal.SD_JOURNAL_FIELD_PRIORITY, Value: strconv.Itoa(int(p))})
+		}
+	}
+	if len(query.Boots) > 0 {
+		ids, err := bootIDs(j, query.Boots)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			matches = append(matches, sdjournal.Match{Field: sdjournal.SD_JOURNAL_FIELD_BOOT_ID, Value: id})
+		}
+	}
+	return matches, nil
+}
+
+// bootIDs resolves boot offsets to IDs. Positive offsets count boots from the oldest one in journal,
+// other offsets count boots back from the current one.
+func bootIDs(j *sdjournal.Journal, boots []Boot) ([]string, error) {
+	var ids, listed []string
+	for _, b := range boots {
+		if b.ID != "" {
+			ids = append(ids, b.ID)
+			continue
+		}
+		if listed == nil {
+			var err error
+			if listed, err = listBoots(j); err != nil {
+				return nil, err
+			}
+		}
+		i := len(listed) - 1 + b.Offset
+		if b.Offset > 0 {
+			i = b.Offset - 1
+		}
+		if i < 0 || i >= len(listed) {
+			return nil, fmt.Errorf("boot %d not found, journal has %d boots", b.Offset, len(listed))
+		}
+		ids = append(ids, listed[i])
+	}
+	return ids, nil
+}
+
+// listBoots returns IDs of boots found in journal from the oldest one
+func listBoots(j *sdjournal.Journal) ([]string, error) {
+	ids, err := j.GetUniqueValues(sdjournal.SD_JOURNAL_FIELD_BOOT_ID)
+	if err != nil {
+		return nil, fmt.Errorf("could not list boots: %s", err)
+	}
+	defer j.FlushMatches()
+
+	started := make(map[string]uint64, len(ids))
+	boots := make([]string, 0, len(ids))
+	for _, id := range ids {
+		j.FlushMatches()
+		if err := j.AddMatch(sdjournal.SD_JOURNAL_FIELD_BOOT_ID + "=" + id); err != nil {
+			return nil, fmt.Errorf("could not list boots: %s", err)
+		}
+		if err := j.SeekHead(); err != nil {
+			return nil, fmt.Errorf("could not list boots: %s", err)
+		}
+		if n, err := j.Next(); err != nil || n == 0 {
+			continue
+		}
+		usec, err := j.GetRealtimeUsec()
+		if err != nil {
+			return nil, fmt.Errorf("could not list boots: %s", err)
+		}
+		started[id] = usec
+		boots = append(boots, id)
+	}
+	sort.Slice(boots, func(i, k int) bool { return started[boots[i]] < started[boots[k]] })
+	return boots, nil
+}
+
+// writeJournal writes journal entries matching the query until the last entry or the one newer than query
+// allows is read
+func writeJournal(ctx context.Context, j *sdjournal.Journal, query JournalQuery, write entryWriter) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, err := j.Next()
+		if err != nil {
+			return fmt.Errorf("could not read journal: %s", err)
+		}
+		if n == 0 {
+			return nil
+		}
+		entry, err := j.GetEntry()
+		if err != nil {
+			return fmt.Errorf("could not read journal entry: %s", err)
+		}
+		timestamp := time.Unix(0, int64(entry.RealtimeTimestamp)*int64(time.Microsecond))
+		if !query.Until.IsZero() && timestamp.After(query.Until) {
+			return nil
+		}
+		if query.Message != nil && !query.Message.MatchString(entry.Fields[sdjournal.SD_JOURNAL_FIELD_MESSAGE]) {
+			continue
+		}
+		if err := write(entry, timestamp); err != nil {
+			return err
+		}
+	}
+}
+
 // ReadJournalTail returns numFromTail log lines from the end of the log
 func ReadJournalTail(ctx context.Context, unit string, numFromTail uint64) (goio.ReadCloser, error) {
 	return readJournalOutput(ctx, unit, 0, numFromTail)
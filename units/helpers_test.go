@@ -3,6 +3,7 @@ package units
 import (
 	"context"
 	"io/ioutil"
+	"regexp"
 	"runtime"
 	"strings"
 	"testing"
@@ -41,6 +42,44 @@ func TestReadJournalOutputSince_Linux(t *testing.T) {
 	assert.Empty(t, data)
 }
 
+func TestReadJournalJSON_Linux(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	r, err := ReadJournalJSON(ctx, JournalQuery{
+		Unit:  "not-existing.service",
+		Since: time.Now().Add(-time.Minute),
+		Until: time.Now(),
+	})
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	assert.Empty(t, data)
+}
+
+func TestReadJournal_LinuxFiltersEntries(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	warning := PriorityWarning
+	r, err := ReadJournal(ctx, JournalQuery{
+		Unit:        "not-existing.service",
+		Transport:   "kernel",
+		MaxPriority: &warning,
+		Message:     regexp.MustCompile("(?i)error"),
+	})
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	assert.Empty(t, data)
+}
+
 func TestTimedReaderShouldTimeOut(t *testing.T) {
 	ctx, cancel := context.WithDeadline(context.Background(), time.Now())
 	defer cancel()
@@ -11,3 +11,13 @@ import (
 func ReadJournalOutputSince(ctx context.Context, unit string, duration time.Duration) (io.ReadCloser, error) {
 	return nil, errors.New("there is no journal on Windows")
 }
+
+// ReadJournal returns error since windows does not support journal
+func ReadJournal(ctx context.Context, query JournalQuery) (io.ReadCloser, error) {
+	return nil, errors.New("there is no journal on Windows")
+}
+
+// ReadJournalJSON returns error since windows does not support journal
+func ReadJournalJSON(ctx context.Context, query JournalQuery) (io.ReadCloser, error) {
+	return nil, errors.New("there is no journal on Windows")
+}
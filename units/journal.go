@@ -0,0 +1,88 @@
+package units
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Priority is a syslog priority of journal entries, lower priorities are more important
+type Priority int
+
+// Syslog priorities named the same way as in journalctl --priority
+const (
+	PriorityEmerg Priority = iota
+	PriorityAlert
+	PriorityCrit
+	PriorityErr
+	PriorityWarning
+	PriorityNotice
+	PriorityInfo
+	PriorityDebug
+)
+
+var priorityNames = []string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+
+// ParsePriority returns priority with the given name e.g., warning or number e.g., 4
+func ParsePriority(name string) (Priority, error) {
+	for i, n := range priorityNames {
+		if name == n || name == strconv.Itoa(i) {
+			return Priority(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown priority %q, must be one of %s or a number from 0 to 7",
+		name, strings.Join(priorityNames, ", "))
+}
+
+func (p Priority) String() string {
+	if p < PriorityEmerg || p > PriorityDebug {
+		return strconv.Itoa(int(p))
+	}
+	return priorityNames[p]
+}
+
+// Boot selects entries logged during a single boot. It's either a boot ID or an offset
+// the same way as in journalctl --boot, 0 is the current boot and -1 is the previous one.
+type Boot struct {
+	ID     string
+	Offset int
+}
+
+var bootIDPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// ParseBoot returns boot with the given ID or offset e.g., -1 for the previous boot
+func ParseBoot(s string) (Boot, error) {
+	if offset, err := strconv.Atoi(s); err == nil {
+		return Boot{Offset: offset}, nil
+	}
+	id := strings.Replace(strings.ToLower(s), "-", "", -1)
+	if !bootIDPattern.MatchString(id) {
+		return Boot{}, fmt.Errorf("invalid boot %q, must be a boot ID or an offset e.g., -1 for the previous boot", s)
+	}
+	return Boot{ID: id}, nil
+}
+
+func (b Boot) String() string {
+	if b.ID != "" {
+		return b.ID
+	}
+	return strconv.Itoa(b.Offset)
+}
+
+// JournalQuery selects journal entries, zero fields do not limit returned entries
+type JournalQuery struct {
+	// Unit is the name of the systemd unit that logged entries
+	Unit string
+	// Transport is how entries were received by journal e.g., kernel
+	Transport string
+	Since     time.Time
+	Until     time.Time
+	// MaxPriority is the least important priority of returned entries, nil returns entries of all priorities
+	MaxPriority *Priority
+	// Boots returns only entries logged during any of given boots
+	Boots []Boot
+	// Message returns only entries with a message matching the pattern
+	Message *regexp.Regexp
+}
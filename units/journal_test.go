@@ -0,0 +1,48 @@
+package units
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePriority(t *testing.T) {
+	for name, expected := range map[string]Priority{
+		"emerg":   PriorityEmerg,
+		"0":       PriorityEmerg,
+		"warning": PriorityWarning,
+		"4":       PriorityWarning,
+		"debug":   PriorityDebug,
+	} {
+		p, err := ParsePriority(name)
+		require.NoError(t, err, name)
+		assert.Equal(t, expected, p, name)
+	}
+	assert.Equal(t, "warning", PriorityWarning.String())
+
+	for _, name := range []string{"", "8", "-1", "warn"} {
+		_, err := ParsePriority(name)
+		assert.EqualError(t, err, `unknown priority "`+name+
+			`", must be one of emerg, alert, crit, err, warning, notice, info, debug or a number from 0 to 7`)
+	}
+}
+
+func TestParseBoot(t *testing.T) {
+	b, err := ParseBoot("-1")
+	require.NoError(t, err)
+	assert.Equal(t, Boot{Offset: -1}, b)
+	assert.Equal(t, "-1", b.String())
+
+	b, err = ParseBoot("0")
+	require.NoError(t, err)
+	assert.Equal(t, Boot{}, b)
+
+	b, err = ParseBoot("8B1E4C5A-37C2-4F3E-9C55-2E0E4C2B43A1")
+	require.NoError(t, err)
+	assert.Equal(t, Boot{ID: "8b1e4c5a37c24f3e9c552e0e4c2b43a1"}, b)
+	assert.Equal(t, "8b1e4c5a37c24f3e9c552e0e4c2b43a1", b.String())
+
+	_, err = ParseBoot("previous")
+	assert.EqualError(t, err, `invalid boot "previous", must be a boot ID or an offset e.g., -1 for the previous boot`)
+}